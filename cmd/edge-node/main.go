@@ -5,8 +5,13 @@ import (
 	"flag"
 	"fmt"
 	"github.com/TeaOSLab/EdgeNode/internal/apps"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
 	"github.com/TeaOSLab/EdgeNode/internal/nodes"
+	"github.com/TeaOSLab/EdgeNode/internal/waf"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/modsecurity"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/replay"
 	_ "github.com/iwind/TeaGo/bootstrap"
 	"github.com/iwind/TeaGo/logs"
 	"github.com/iwind/TeaGo/maps"
@@ -16,6 +21,7 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"path/filepath"
 	"sort"
 )
 
@@ -24,8 +30,13 @@ func main() {
 		Version(teaconst.Version).
 		Product(teaconst.ProductName).
 		Usage(teaconst.ProcessName + " [-v|start|stop|restart|status|quit|test|reload|service|daemon|pprof|accesslog]").
+		Usage(teaconst.ProcessName + " restart [--drainSeconds=SECONDS]").
 		Usage(teaconst.ProcessName + " [trackers|goman|conns|gc]").
-		Usage(teaconst.ProcessName + " [ip.drop|ip.reject|ip.remove|ip.close] IP")
+		Usage(teaconst.ProcessName + " [ip.drop|ip.reject|ip.remove|ip.close] IP").
+		Usage(teaconst.ProcessName + " cache export --policy=ID --file=PATH [--host=HOST] [--prefix=PREFIX] [--minHits=N] [--minSize=BYTES] [--maxSize=BYTES]").
+		Usage(teaconst.ProcessName + " cache import --policy=ID --file=PATH").
+		Usage(teaconst.ProcessName + " waf import --file=FILE|DIR [--file=...] --output=PATH [--merge=PATH] [--defaultAction=deny|pass] [--anomalyScoring] [--verbose]").
+		Usage(teaconst.ProcessName + " waf test --policy=PATH --file=PATH [--file=...] [--format=har|curl|accesslog] [--expect=pass|block|none|ACTION] [--failedOnly]")
 
 	app.On("test", func() {
 		err := nodes.NewNode().Test()
@@ -42,6 +53,8 @@ func main() {
 			var params = maps.NewMap(reply.Params)
 			if params.Has("error") {
 				fmt.Println("[ERROR]" + params.GetString("error"))
+			} else if params.GetBool("restarted") {
+				fmt.Println("ok, restarted with new executable, pid: " + params.GetString("pid"))
 			} else {
 				fmt.Println("ok")
 			}
@@ -365,6 +378,248 @@ func main() {
 		}
 		fmt.Println(string(statsJSON))
 	})
+	app.On("cache", func() {
+		var args = os.Args[2:]
+		if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+			fmt.Println("Usage: edge-node cache export --policy=ID --file=PATH [--host=HOST] [--prefix=PREFIX] [--minHits=N] [--minSize=BYTES] [--maxSize=BYTES]")
+			fmt.Println("       edge-node cache import --policy=ID --file=PATH")
+			return
+		}
+		var action = args[0]
+		var options = app.ParseOptions(args[1:])
+		var getOption = func(name string) string {
+			values, ok := options[name]
+			if ok && len(values) > 0 {
+				return values[0]
+			}
+			return ""
+		}
+
+		var policyId = types.Int64(getOption("policy"))
+		if policyId <= 0 {
+			fmt.Println("[ERROR]'--policy' should be a valid cache policy id")
+			return
+		}
+		var file = getOption("file")
+		if len(file) == 0 {
+			fmt.Println("[ERROR]'--file' should not be empty")
+			return
+		}
+		file, err := filepath.Abs(file)
+		if err != nil {
+			fmt.Println("[ERROR]" + err.Error())
+			return
+		}
+
+		var command = &gosock.Command{
+			Params: map[string]interface{}{
+				"policyId": policyId,
+				"path":     file,
+			},
+		}
+		if action == "export" {
+			var filter = &caches.ExportFilter{
+				Hosts:    options["host"],
+				Prefixes: options["prefix"],
+				MinHits:  types.Int64(getOption("minHits")),
+				MinSize:  types.Int64(getOption("minSize")),
+				MaxSize:  types.Int64(getOption("maxSize")),
+			}
+			filterJSON, err := json.Marshal(filter)
+			if err != nil {
+				fmt.Println("[ERROR]" + err.Error())
+				return
+			}
+			command.Code = "cacheExport"
+			command.Params["filterJSON"] = string(filterJSON)
+		} else {
+			command.Code = "cacheImport"
+		}
+
+		fmt.Println(action + " cache of policy '" + types.String(policyId) + "', file: '" + file + "' ...")
+		var sock = gosock.NewTmpSock(teaconst.ProcessName)
+		reply, err := sock.Send(command)
+		if err != nil {
+			fmt.Println("[ERROR]" + err.Error())
+			return
+		}
+		var params = maps.NewMap(reply.Params)
+		var errString = params.GetString("error")
+		if len(errString) > 0 {
+			fmt.Println("[ERROR]" + errString + " (" + types.String(params.GetInt("count")) + " items done)")
+			return
+		}
+		fmt.Println("ok, " + types.String(params.GetInt("count")) + " items")
+	})
+	app.On("waf", func() {
+		var args = os.Args[2:]
+		if len(args) == 0 || (args[0] != "import" && args[0] != "test") {
+			fmt.Println("Usage: edge-node waf import --file=FILE|DIR [--file=...] --output=PATH [--merge=PATH] [--defaultAction=deny|pass] [--anomalyScoring] [--verbose]")
+			fmt.Println("       edge-node waf test --policy=PATH --file=PATH [--file=...] [--format=har|curl|accesslog] [--expect=pass|block|none|ACTION] [--failedOnly]")
+			return
+		}
+		var options = app.ParseOptions(args[1:])
+		var getOption = func(name string) string {
+			values, ok := options[name]
+			if ok && len(values) > 0 {
+				return values[0]
+			}
+			return ""
+		}
+
+		// 使用WAF策略重放请求
+		if args[0] == "test" {
+			var policyFile = getOption("policy")
+			if len(policyFile) == 0 {
+				fmt.Println("[ERROR]'--policy' should not be empty")
+				os.Exit(1)
+			}
+			if len(options["file"]) == 0 {
+				fmt.Println("[ERROR]'--file' should not be empty")
+				os.Exit(1)
+			}
+
+			// 节点本地的WAF扩展配置
+			wafConfig, err := configs.LoadWAFConfig()
+			if err == nil {
+				waf.SharedWAFManager.UpdateLocalConfig(wafConfig)
+			} else if !os.IsNotExist(err) {
+				fmt.Println("[ERROR]load waf config failed: " + err.Error())
+				os.Exit(1)
+			}
+
+			policy, err := replay.LoadWAF(policyFile)
+			if err != nil {
+				fmt.Println("[ERROR]load '" + policyFile + "' failed: " + err.Error())
+				os.Exit(1)
+			}
+
+			var cases = []*replay.Case{}
+			for _, file := range options["file"] {
+				fileCases, err := replay.ParseFile(file, getOption("format"))
+				if err != nil {
+					fmt.Println("[ERROR]" + err.Error())
+					os.Exit(1)
+				}
+				cases = append(cases, fileCases...)
+			}
+
+			var expect = getOption("expect")
+			var _, failedOnly = options["failedOnly"]
+			var countBlocked = 0
+			var countFailed = 0
+			for _, result := range replay.NewReplayer(policy).ReplayAll(cases) {
+				if !result.GoNext {
+					countBlocked++
+				}
+				ok, message := result.Check(expect)
+				if !ok {
+					countFailed++
+				}
+				if ok && failedOnly {
+					continue
+				}
+				fmt.Println(result.String())
+				if !ok {
+					fmt.Println("  [FAILED]" + message)
+				}
+			}
+			fmt.Println(types.String(len(cases)) + " requests, " + types.String(countBlocked) + " blocked, " + types.String(countFailed) + " failed")
+			if countFailed > 0 {
+				os.Exit(1)
+			}
+			return
+		}
+
+		var output = getOption("output")
+		if len(output) == 0 {
+			fmt.Println("[ERROR]'--output' should not be empty")
+			return
+		}
+		if len(options["file"]) == 0 {
+			fmt.Println("[ERROR]'--file' should not be empty")
+			return
+		}
+
+		// 规则文件，目录中的 *.conf 按照文件名顺序导入
+		var ruleFiles = []string{}
+		for _, file := range options["file"] {
+			stat, err := os.Stat(file)
+			if err != nil {
+				fmt.Println("[ERROR]" + err.Error())
+				return
+			}
+			if !stat.IsDir() {
+				ruleFiles = append(ruleFiles, file)
+				continue
+			}
+			matches, err := filepath.Glob(filepath.Join(file, "*.conf"))
+			if err != nil {
+				fmt.Println("[ERROR]" + err.Error())
+				return
+			}
+			sort.Strings(matches)
+			ruleFiles = append(ruleFiles, matches...)
+		}
+
+		var importer = modsecurity.NewImporter()
+		var defaultAction = getOption("defaultAction")
+		if len(defaultAction) > 0 {
+			if defaultAction != "deny" && defaultAction != "pass" {
+				fmt.Println("[ERROR]'--defaultAction' should be 'deny' or 'pass'")
+				return
+			}
+			importer.DefaultAction = defaultAction
+		}
+		for _, file := range ruleFiles {
+			err := importer.ImportFile(file)
+			if err != nil {
+				fmt.Println("[ERROR]" + err.Error())
+				return
+			}
+		}
+
+		var policy = waf.NewWAF()
+		var mergeFile = getOption("merge")
+		if len(mergeFile) > 0 {
+			var err error
+			policy, err = waf.NewWAFFromFile(mergeFile)
+			if err != nil {
+				fmt.Println("[ERROR]load '" + mergeFile + "' failed: " + err.Error())
+				return
+			}
+		}
+		importer.Apply(policy)
+
+		// 使用异常评分模式
+		var _, anomalyScoring = options["anomalyScoring"]
+		if anomalyScoring && policy.AnomalyScoring == nil {
+			policy.AnomalyScoring = &configs.AnomalyScoringConfig{IsOn: true}
+			err := policy.AnomalyScoring.Init()
+			if err != nil {
+				fmt.Println("[ERROR]" + err.Error())
+				return
+			}
+		}
+
+		var _, isVerbose = options["verbose"]
+		var countSkipped = 0
+		for _, issue := range importer.Issues() {
+			if issue.IsSkipped {
+				countSkipped++
+			}
+			if issue.IsSkipped || isVerbose {
+				fmt.Println(issue.String())
+			}
+		}
+
+		err := policy.Save(output)
+		if err != nil {
+			fmt.Println("[ERROR]" + err.Error())
+			return
+		}
+		fmt.Println("ok, " + types.String(importer.CountImportedRules()) + "/" + types.String(importer.CountRules()) + " rules imported into " + types.String(len(importer.Groups())) + " groups, " + types.String(len(importer.Issues())) + " issues (" + types.String(countSkipped) + " skipped), saved to '" + output + "'")
+	})
 	app.Run(func() {
 		var node = nodes.NewNode()
 		node.Start()
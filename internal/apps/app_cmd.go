@@ -232,6 +232,33 @@ func (this *AppCmd) runStop() {
 
 // 重启
 func (this *AppCmd) runRestart() {
+	// 正在运行时尝试平滑重启，将监听的端口传递给新进程，不中断已有连接
+	if this.getPID() > 0 {
+		var drainSeconds = 0
+		var options = this.ParseOptions(os.Args[2:])
+		values, ok := options["drainSeconds"]
+		if ok && len(values) > 0 {
+			drainSeconds = types.Int(values[0])
+		}
+
+		reply, err := this.sock.SendTimeout(&gosock.Command{
+			Code: "gracefulRestart",
+			Params: map[string]interface{}{
+				"drainSeconds": drainSeconds,
+			},
+		}, 90*time.Second)
+		if err == nil {
+			var params = maps.NewMap(reply.Params)
+			if !params.Has("error") {
+				fmt.Println(this.product+" restarted ok, pid:", params.GetInt("pid"))
+				return
+			}
+			fmt.Println("[WARN]" + params.GetString("error") + ", restarting directly ...")
+		} else {
+			fmt.Println("[WARN]graceful restart failed: " + err.Error() + ", restarting directly ...")
+		}
+	}
+
 	this.runStop()
 	time.Sleep(1 * time.Second)
 	this.runStart()
@@ -0,0 +1,81 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/utils"
+	sketchutils "github.com/TeaOSLab/EdgeNode/internal/utils/sketches"
+	"sync/atomic"
+)
+
+// AdmissionStat 准入统计
+type AdmissionStat struct {
+	Admitted uint64 `json:"admitted"` // 允许写入的次数
+	Rejected uint64 `json:"rejected"` // 拒绝写入的次数
+}
+
+// AdmissionFilter 缓存写入准入过滤器
+// 在打开缓存写入之前检查Key的访问次数，访问次数不够的内容不写入缓存
+type AdmissionFilter struct {
+	config *AdmissionConfig
+	sketch *sketchutils.CountMinSketch
+
+	windowEndsAt int64
+
+	admitted uint64
+	rejected uint64
+}
+
+// NewAdmissionFilter 获取新对象
+func NewAdmissionFilter(config *AdmissionConfig) *AdmissionFilter {
+	return &AdmissionFilter{
+		config:       config,
+		sketch:       sketchutils.NewCountMinSketch(config.MaxKeys),
+		windowEndsAt: utils.UnixTime() + config.Window(),
+	}
+}
+
+// Admit 记录一次访问，并判断是否可以写入缓存
+func (this *AdmissionFilter) Admit(key string) bool {
+	this.rotate()
+
+	var hits = int(this.sketch.Add(key))
+	if hits >= this.config.MinHits {
+		atomic.AddUint64(&this.admitted, 1)
+		return true
+	}
+	atomic.AddUint64(&this.rejected, 1)
+	return false
+}
+
+// Stat 统计信息
+func (this *AdmissionFilter) Stat() *AdmissionStat {
+	return &AdmissionStat{
+		Admitted: atomic.LoadUint64(&this.admitted),
+		Rejected: atomic.LoadUint64(&this.rejected),
+	}
+}
+
+// Config 当前设置
+func (this *AdmissionFilter) Config() *AdmissionConfig {
+	return this.config
+}
+
+// 进入新的计数周期
+func (this *AdmissionFilter) rotate() {
+	var windowEndsAt = atomic.LoadInt64(&this.windowEndsAt)
+	var now = utils.UnixTime()
+	if now < windowEndsAt {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&this.windowEndsAt, windowEndsAt, now+this.config.Window()) {
+		return
+	}
+
+	switch this.config.Type {
+	case AdmissionTypeNthHit:
+		this.sketch.Reset()
+	default:
+		this.sketch.Halve()
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"testing"
+)
+
+func TestAdmissionFilter_Admit(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = DefaultAdmissionConfig()
+	config.IsOn = true
+	config.MinHits = 2
+	config.MaxKeys = 1024
+
+	var filter = NewAdmissionFilter(config)
+	a.IsFalse(filter.Admit("https://example.com/a.png"))
+	a.IsTrue(filter.Admit("https://example.com/a.png"))
+	a.IsTrue(filter.Admit("https://example.com/a.png"))
+	a.IsFalse(filter.Admit("https://example.com/b.png"))
+
+	var stat = filter.Stat()
+	a.IsTrue(stat.Admitted == 2)
+	a.IsTrue(stat.Rejected == 2)
+
+	// 新的周期中计数减半
+	filter.windowEndsAt = 0
+	a.IsTrue(filter.Admit("https://example.com/a.png"))
+	a.IsFalse(filter.Admit("https://example.com/b.png"))
+}
+
+func TestAdmissionFilter_NthHit(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = DefaultAdmissionConfig()
+	config.IsOn = true
+	config.Type = AdmissionTypeNthHit
+	config.MinHits = 3
+	config.MaxKeys = 1024
+
+	var filter = NewAdmissionFilter(config)
+	a.IsFalse(filter.Admit("a"))
+	a.IsFalse(filter.Admit("a"))
+	a.IsTrue(filter.Admit("a"))
+
+	// 新的周期中清空计数
+	filter.windowEndsAt = 0
+	a.IsFalse(filter.Admit("a"))
+}
+
+func BenchmarkAdmissionFilter_Admit(b *testing.B) {
+	var config = DefaultAdmissionConfig()
+	config.IsOn = true
+
+	var filter = NewAdmissionFilter(config)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = filter.Admit("https://example.com/images/logo.png")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/iwind/TeaGo/types"
+	"net/http"
+	"strings"
+)
+
+// CacheControl 解析后的Cache-Control指令
+// 数字类型的指令如果没有设置，值为-1
+type CacheControl struct {
+	MaxAge               int64
+	SMaxAge              int64
+	StaleWhileRevalidate int64
+	StaleIfError         int64
+
+	NoCache        bool
+	NoStore        bool
+	Private        bool
+	Public         bool
+	MustRevalidate bool
+}
+
+// ParseCacheControl 解析Cache-Control
+// 多个Header值可以使用逗号连接后传入
+func ParseCacheControl(value string) *CacheControl {
+	var result = &CacheControl{
+		MaxAge:               -1,
+		SMaxAge:              -1,
+		StaleWhileRevalidate: -1,
+		StaleIfError:         -1,
+	}
+
+	for _, piece := range strings.Split(value, ",") {
+		piece = strings.TrimSpace(piece)
+		if len(piece) == 0 {
+			continue
+		}
+
+		var name = piece
+		var arg = ""
+		var eqIndex = strings.Index(piece, "=")
+		if eqIndex > 0 {
+			name = strings.TrimSpace(piece[:eqIndex])
+			arg = strings.Trim(strings.TrimSpace(piece[eqIndex+1:]), "\"")
+		}
+
+		switch strings.ToLower(name) {
+		case "max-age":
+			result.MaxAge = parseCacheControlSeconds(arg)
+		case "s-maxage":
+			result.SMaxAge = parseCacheControlSeconds(arg)
+		case "stale-while-revalidate":
+			result.StaleWhileRevalidate = parseCacheControlSeconds(arg)
+		case "stale-if-error":
+			result.StaleIfError = parseCacheControlSeconds(arg)
+		case "no-cache":
+			result.NoCache = true
+		case "no-store":
+			result.NoStore = true
+		case "private":
+			result.Private = true
+		case "public":
+			result.Public = true
+		case "must-revalidate", "proxy-revalidate":
+			result.MustRevalidate = true
+		}
+	}
+
+	return result
+}
+
+func parseCacheControlSeconds(arg string) int64 {
+	if len(arg) == 0 {
+		return -1
+	}
+	var seconds = types.Int64(arg)
+	if seconds < 0 {
+		return -1
+	}
+	return seconds
+}
+
+// CalculateFreshLifetime 根据响应Header计算内容的有效期（秒）
+// 依次使用 s-maxage、max-age、Expires 减去 Date，没有这些Header时根据 Last-Modified 估算
+// 如果无法计算，则 ok 为false
+func CalculateFreshLifetime(header http.Header, now int64, config *FreshnessConfig) (life int64, ok bool) {
+	var cacheControl = ParseCacheControl(strings.Join(header.Values("Cache-Control"), ","))
+
+	var date = now
+	var dateString = header.Get("Date")
+	if len(dateString) > 0 {
+		t, err := http.ParseTime(dateString)
+		if err == nil {
+			date = t.Unix()
+		}
+	}
+
+	if cacheControl.SMaxAge >= 0 {
+		life = cacheControl.SMaxAge
+	} else if cacheControl.MaxAge >= 0 {
+		life = cacheControl.MaxAge
+	} else if expires, hasExpires := header["Expires"]; hasExpires && len(expires) > 0 {
+		// 无效的Expires表示已经过期
+		t, err := http.ParseTime(expires[0])
+		if err == nil {
+			life = t.Unix() - date
+		}
+	} else if lastModified := header.Get("Last-Modified"); len(lastModified) > 0 && config != nil && config.HeuristicPercent > 0 {
+		t, err := http.ParseTime(lastModified)
+		if err != nil || t.Unix() >= date {
+			return 0, false
+		}
+		life = (date - t.Unix()) * int64(config.HeuristicPercent) / 100
+		if config.HeuristicMaxSeconds > 0 && life > config.HeuristicMaxSeconds {
+			life = config.HeuristicMaxSeconds
+		}
+	} else {
+		return 0, false
+	}
+
+	// 减去在上级缓存中已经存在的时间
+	var age = types.Int64(header.Get("Age"))
+	if age > 0 {
+		life -= age
+	}
+
+	if life < 0 {
+		life = 0
+	}
+	return life, true
+}
+
+// CalculateCacheLife 根据响应Header和缓存条件中设置的有效期计算缓存有效期（秒）
+// 响应中有 s-maxage、max-age、Expires 时优先使用；否则使用缓存条件中设置的有效期 configuredLife，
+// 只有在没有设置有效期时才根据 Last-Modified 估算
+// 如果不能缓存，则 canCache 为false
+func CalculateCacheLife(header http.Header, now int64, configuredLife int64, config *FreshnessConfig) (life int64, canCache bool) {
+	var cacheControl = ParseCacheControl(strings.Join(header.Values("Cache-Control"), ","))
+	if cacheControl.NoStore || cacheControl.Private {
+		return 0, false
+	}
+
+	// 已经设置了有效期，不再估算
+	if configuredLife > 0 && config != nil && config.HeuristicPercent > 0 {
+		var newConfig = *config
+		newConfig.HeuristicPercent = 0
+		config = &newConfig
+	}
+
+	freshLife, ok := CalculateFreshLifetime(header, now, config)
+	if ok {
+		if freshLife <= 0 {
+			return 0, false
+		}
+		return freshLife, true
+	}
+
+	if configuredLife <= 0 {
+		configuredLife = 60
+	}
+	return configuredLife, true
+}
@@ -0,0 +1,222 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var cc = caches.ParseCacheControl("")
+		a.IsTrue(cc.MaxAge == -1)
+		a.IsTrue(cc.SMaxAge == -1)
+		a.IsTrue(cc.StaleWhileRevalidate == -1)
+		a.IsTrue(cc.StaleIfError == -1)
+	}
+
+	{
+		var cc = caches.ParseCacheControl("public, max-age=600")
+		a.IsTrue(cc.Public)
+		a.IsTrue(cc.MaxAge == 600)
+	}
+
+	{
+		var cc = caches.ParseCacheControl(`max-age=60, s-maxage="120",stale-while-revalidate=30 , stale-if-error=86400, must-revalidate, No-Cache`)
+		a.IsTrue(cc.MaxAge == 60)
+		a.IsTrue(cc.SMaxAge == 120)
+		a.IsTrue(cc.StaleWhileRevalidate == 30)
+		a.IsTrue(cc.StaleIfError == 86400)
+		a.IsTrue(cc.MustRevalidate)
+		a.IsTrue(cc.NoCache)
+		a.IsFalse(cc.NoStore)
+	}
+
+	{
+		var cc = caches.ParseCacheControl("max-age=abc, s-maxage=-1")
+		a.IsTrue(cc.MaxAge == 0)
+		a.IsTrue(cc.SMaxAge == -1)
+	}
+}
+
+func TestCalculateFreshLifetime(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var now = time.Now().Unix()
+	var config = caches.DefaultFreshnessConfig()
+	var formatTime = func(timestamp int64) string {
+		return time.Unix(timestamp, 0).UTC().Format(http.TimeFormat)
+	}
+
+	// 没有任何Header
+	{
+		_, ok := caches.CalculateFreshLifetime(http.Header{}, now, config)
+		a.IsFalse(ok)
+	}
+
+	// s-maxage优先
+	{
+		life, ok := caches.CalculateFreshLifetime(http.Header{
+			"Cache-Control": []string{"max-age=60", "s-maxage=120"},
+			"Expires":       []string{formatTime(now + 3600)},
+		}, now, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == 120)
+	}
+
+	// max-age
+	{
+		life, ok := caches.CalculateFreshLifetime(http.Header{
+			"Cache-Control": []string{"public, max-age=600"},
+			"Expires":       []string{formatTime(now + 3600)},
+		}, now, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == 600)
+	}
+
+	// Expires & Date
+	{
+		life, ok := caches.CalculateFreshLifetime(http.Header{
+			"Date":    []string{formatTime(now - 100)},
+			"Expires": []string{formatTime(now + 3500)},
+		}, now, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == 3600)
+	}
+
+	// 无效的Expires
+	{
+		life, ok := caches.CalculateFreshLifetime(http.Header{
+			"Expires": []string{"0"},
+		}, now, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == 0)
+	}
+
+	// Last-Modified
+	{
+		life, ok := caches.CalculateFreshLifetime(http.Header{
+			"Date":          []string{formatTime(now)},
+			"Last-Modified": []string{formatTime(now - 1000)},
+		}, now, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == 100)
+
+		life, ok = caches.CalculateFreshLifetime(http.Header{
+			"Last-Modified": []string{formatTime(now - 100*86400)},
+		}, now, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == config.HeuristicMaxSeconds)
+
+		_, ok = caches.CalculateFreshLifetime(http.Header{
+			"Last-Modified": []string{formatTime(now - 1000)},
+		}, now, &caches.FreshnessConfig{})
+		a.IsFalse(ok)
+	}
+
+	// Age
+	{
+		life, ok := caches.CalculateFreshLifetime(http.Header{
+			"Cache-Control": []string{"max-age=600"},
+			"Age":           []string{"100"},
+		}, now, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == 500)
+	}
+}
+
+func TestCalculateCacheLife(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var now = time.Now().Unix()
+	var config = caches.DefaultFreshnessConfig()
+	var formatTime = func(timestamp int64) string {
+		return time.Unix(timestamp, 0).UTC().Format(http.TimeFormat)
+	}
+
+	// 没有有效期相关Header + Last-Modified，使用设置的有效期
+	{
+		life, ok := caches.CalculateCacheLife(http.Header{
+			"Date":          []string{formatTime(now)},
+			"Last-Modified": []string{formatTime(now - 1000)},
+		}, now, 3600, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == 3600)
+		a.IsTrue(config.HeuristicPercent == 10)
+	}
+
+	// 没有设置有效期时根据Last-Modified估算
+	{
+		life, ok := caches.CalculateCacheLife(http.Header{
+			"Date":          []string{formatTime(now)},
+			"Last-Modified": []string{formatTime(now - 1000)},
+		}, now, 0, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == 100)
+	}
+
+	// 源站的max-age优先
+	{
+		life, ok := caches.CalculateCacheLife(http.Header{
+			"Cache-Control": []string{"max-age=600"},
+			"Last-Modified": []string{formatTime(now - 1000)},
+		}, now, 3600, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == 600)
+	}
+
+	// 没有任何Header
+	{
+		life, ok := caches.CalculateCacheLife(http.Header{}, now, 0, config)
+		a.IsTrue(ok)
+		a.IsTrue(life == 60)
+	}
+
+	// 不能缓存
+	{
+		_, ok := caches.CalculateCacheLife(http.Header{
+			"Cache-Control": []string{"private"},
+		}, now, 3600, config)
+		a.IsFalse(ok)
+
+		_, ok = caches.CalculateCacheLife(http.Header{
+			"Cache-Control": []string{"max-age=0"},
+		}, now, 3600, config)
+		a.IsFalse(ok)
+	}
+}
+
+func TestDecodePolicyOptions(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var options = caches.DecodePolicyOptions(nil)
+		a.IsNotNil(options.FetchCoalescing)
+		a.IsFalse(options.FetchCoalescing.IsOn)
+		a.IsNotNil(options.Freshness)
+		a.IsTrue(options.Freshness.StaleLifeSeconds == 600)
+	}
+
+	{
+		var options = caches.DecodePolicyOptions(map[string]interface{}{
+			"dir": "/tmp",
+			"fetchCoalescing": map[string]interface{}{
+				"isOn": true,
+			},
+			"freshness": map[string]interface{}{
+				"staleLifeSeconds": 3600,
+			},
+		})
+		a.IsTrue(options.FetchCoalescing.IsOn)
+		a.IsTrue(options.FetchCoalescing.WaitSeconds == 10)
+		a.IsTrue(options.Freshness.StaleLifeSeconds == 3600)
+		a.IsTrue(options.Freshness.HeuristicPercent == 10)
+		a.IsTrue(options.Freshness.StaleWhileRevalidate)
+	}
+}
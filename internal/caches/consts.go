@@ -8,4 +8,6 @@ const (
 	SuffixCompression = "@GOEDGE_"        // 压缩后缀 SuffixCompression + Encoding
 	SuffixMethod      = "@GOEDGE_"        // 请求方法后缀 SuffixMethod + RequestMethod
 	SuffixPartial     = "@GOEDGE_partial" // 分区缓存后缀
+	SuffixVary        = "@GOEDGE_vary"    // Vary变体后缀 SuffixVary + "_" + VariantId
+	SuffixSlice       = "@GOEDGE_slice"   // 分片缓存后缀 SuffixSlice + "_" + Index
 )
@@ -13,6 +13,8 @@ var (
 	ErrWritingUnavailable = errors.New("writing unavailable")
 	ErrWritingQueueFull   = errors.New("writing queue full")
 	ErrTooManyOpenFiles   = errors.New("too many open files")
+	ErrFetchStreamBroken  = errors.New("fetch stream broken")
+	ErrSliceChanged       = errors.New("slice changed")
 )
 
 // CapacityError 容量错误
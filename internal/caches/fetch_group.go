@@ -0,0 +1,132 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"context"
+	"github.com/TeaOSLab/EdgeNode/internal/zero"
+	"sync"
+	"time"
+)
+
+var SharedFetchGroup = NewFetchGroup()
+
+// FetchGroup 合并同一个Key的回源请求
+// 同一时间只有一个请求（Leader）回源，其他请求等待Leader写入缓存后从缓存中读取，或者直接读取Leader正在写入的内容
+type FetchGroup struct {
+	callMap map[string]*FetchCall // key => *FetchCall
+	locker  sync.Mutex
+}
+
+func NewFetchGroup() *FetchGroup {
+	return &FetchGroup{
+		callMap: map[string]*FetchCall{},
+	}
+}
+
+// Begin 开始回源
+// 如果 isLeader 为true，表示当前请求需要回源，并在结束时调用 FetchCall.Done()
+func (this *FetchGroup) Begin(key string) (call *FetchCall, isLeader bool) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	call, ok := this.callMap[key]
+	if ok {
+		return call, false
+	}
+
+	call = &FetchCall{
+		group:      this,
+		key:        key,
+		doneChan:   make(chan zero.Zero),
+		streamChan: make(chan zero.Zero),
+	}
+	this.callMap[key] = call
+	return call, true
+}
+
+// Count 正在回源的Key数量
+func (this *FetchGroup) Count() int {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	return len(this.callMap)
+}
+
+func (this *FetchGroup) remove(call *FetchCall) {
+	this.locker.Lock()
+	if this.callMap[call.key] == call {
+		delete(this.callMap, call.key)
+	}
+	this.locker.Unlock()
+}
+
+// FetchCall 单个Key的回源过程
+type FetchCall struct {
+	group *FetchGroup
+	key   string
+
+	doneChan   chan zero.Zero
+	streamChan chan zero.Zero
+	doneOnce   sync.Once
+	streamOnce sync.Once
+
+	isCached bool
+	stream   *FetchStream
+}
+
+// Key 当前回源的Key
+func (this *FetchCall) Key() string {
+	return this.key
+}
+
+// Wait 等待Leader回源
+// 如果 stream 不为空，表示可以直接读取正在写入的内容；如果 isCached 为true，表示内容已经写入缓存
+// 如果超时或者客户端已经关闭，则 ok 为false
+func (this *FetchCall) Wait(ctx context.Context, timeout time.Duration) (stream *FetchStream, isCached bool, ok bool) {
+	var timer = time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-this.doneChan:
+		return nil, this.isCached, true
+	case <-this.streamChan:
+		return this.stream, false, true
+	case <-timer.C:
+		return nil, false, false
+	case <-ctx.Done():
+		return nil, false, false
+	}
+}
+
+// StartStream 开始向等待的请求输出正在写入的内容
+// 只有内容尺寸已知并且不超过 maxSize 时才会输出，否则返回nil
+func (this *FetchCall) StartStream(status int, header []byte, size int64, maxSize int64) *FetchStream {
+	if size < 0 || maxSize <= 0 || size > maxSize {
+		return nil
+	}
+
+	var stream *FetchStream
+	this.streamOnce.Do(func() {
+		stream = NewFetchStream(status, header, size)
+		this.stream = stream
+		close(this.streamChan)
+	})
+	return stream
+}
+
+// Done 结束回源
+// isCached 表示内容是否已经成功写入缓存
+func (this *FetchCall) Done(isCached bool) {
+	this.doneOnce.Do(func() {
+		this.group.remove(this)
+
+		// 防止Leader异常结束时等待的请求一直读取
+		var stream = this.stream
+		if stream != nil {
+			stream.Fail(ErrFetchStreamBroken)
+		}
+
+		this.isCached = isCached
+		close(this.doneChan)
+	})
+}
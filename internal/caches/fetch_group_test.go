@@ -0,0 +1,149 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches_test
+
+import (
+	"context"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetchGroup_Begin(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var group = caches.NewFetchGroup()
+	call, isLeader := group.Begin("a")
+	a.IsTrue(isLeader)
+
+	call2, isLeader2 := group.Begin("a")
+	a.IsFalse(isLeader2)
+	a.IsTrue(call == call2)
+
+	_, isLeader3 := group.Begin("b")
+	a.IsTrue(isLeader3)
+	a.IsTrue(group.Count() == 2)
+
+	call.Done(true)
+	a.IsTrue(group.Count() == 1)
+
+	_, isLeader4 := group.Begin("a")
+	a.IsTrue(isLeader4)
+}
+
+func TestFetchCall_Wait(t *testing.T) {
+	var group = caches.NewFetchGroup()
+	call, _ := group.Begin("a")
+
+	var wg = sync.WaitGroup{}
+	var count = 10
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		go func() {
+			defer wg.Done()
+			stream, isCached, ok := call.Wait(context.Background(), 5*time.Second)
+			if !ok || !isCached || stream != nil {
+				t.Error("wait failed:", ok, isCached, stream)
+			}
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	call.Done(true)
+	wg.Wait()
+}
+
+func TestFetchCall_Wait_Timeout(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var group = caches.NewFetchGroup()
+	call, _ := group.Begin("a")
+
+	var before = time.Now()
+	_, _, ok := call.Wait(context.Background(), 100*time.Millisecond)
+	a.IsFalse(ok)
+	a.IsTrue(time.Since(before) >= 100*time.Millisecond)
+
+	call.Done(false)
+	_, isCached, ok := call.Wait(context.Background(), 100*time.Millisecond)
+	a.IsTrue(ok)
+	a.IsFalse(isCached)
+}
+
+func TestFetchCall_Stream(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var group = caches.NewFetchGroup()
+	call, _ := group.Begin("a")
+
+	// 尺寸未知或者太大
+	a.IsNil(call.StartStream(200, nil, -1, 1024))
+	a.IsNil(call.StartStream(200, nil, 2048, 1024))
+
+	var body = "Hello, World"
+
+	var wg = sync.WaitGroup{}
+	var count = 10
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		go func() {
+			defer wg.Done()
+			stream, _, ok := call.Wait(context.Background(), 5*time.Second)
+			if !ok || stream == nil {
+				t.Error("wait stream failed")
+				return
+			}
+			if stream.Status() != 200 || string(stream.Header()) != "Content-Type:text/plain\n" {
+				t.Error("invalid status or header")
+			}
+
+			data, err := io.ReadAll(stream.NewReader())
+			if err != nil || string(data) != body {
+				t.Error("invalid body:", string(data), err)
+			}
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	var stream = call.StartStream(200, []byte("Content-Type:text/plain\n"), int64(len(body)), 1024)
+	a.IsNotNil(stream)
+	for _, c := range []byte(body) {
+		_, _ = stream.Write([]byte{c})
+		time.Sleep(1 * time.Millisecond)
+	}
+	_ = stream.Close()
+	call.Done(true)
+	wg.Wait()
+}
+
+func TestFetchStream_Fail(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var stream = caches.NewFetchStream(200, nil, 10)
+	_, _ = stream.Write([]byte("12345"))
+
+	var reader = stream.NewReader()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		stream.Fail(caches.ErrFetchStreamBroken)
+	}()
+	data, err := io.ReadAll(reader)
+	a.IsTrue(string(data) == "12345")
+	a.IsTrue(err == caches.ErrFetchStreamBroken)
+
+	// 内容不完整
+	var stream2 = caches.NewFetchStream(200, nil, 10)
+	_, _ = stream2.Write([]byte("12345"))
+	_ = stream2.Close()
+	_, err = io.ReadAll(stream2.NewReader())
+	a.IsTrue(err == caches.ErrFetchStreamBroken)
+
+	// 内容超出
+	var stream3 = caches.NewFetchStream(200, nil, 2)
+	_, _ = stream3.Write([]byte("12345"))
+	_, err = io.ReadAll(stream3.NewReader())
+	a.IsTrue(err == caches.ErrFetchStreamBroken)
+}
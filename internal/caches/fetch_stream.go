@@ -0,0 +1,128 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"io"
+	"sync"
+)
+
+// FetchStream 正在回源写入的内容
+// 由Leader写入，等待的请求通过 NewReader() 同时读取
+type FetchStream struct {
+	status int
+	header []byte
+	size   int64
+
+	buf    []byte
+	err    error
+	isDone bool
+
+	locker sync.Mutex
+	cond   *sync.Cond
+}
+
+func NewFetchStream(status int, header []byte, size int64) *FetchStream {
+	var stream = &FetchStream{
+		status: status,
+		header: header,
+		size:   size,
+		buf:    make([]byte, 0, size),
+	}
+	stream.cond = sync.NewCond(&stream.locker)
+	return stream
+}
+
+// Status 状态码
+func (this *FetchStream) Status() int {
+	return this.status
+}
+
+// Header Header数据，格式和缓存中的Header一致
+func (this *FetchStream) Header() []byte {
+	return this.header
+}
+
+// Size 内容总长度
+func (this *FetchStream) Size() int64 {
+	return this.size
+}
+
+// Write 写入Body数据
+// 总是返回成功，以免影响缓存写入；超出尺寸的内容会导致读取失败
+func (this *FetchStream) Write(p []byte) (n int, err error) {
+	this.locker.Lock()
+	if !this.isDone {
+		if int64(len(this.buf)+len(p)) > this.size {
+			this.err = ErrFetchStreamBroken
+			this.isDone = true
+		} else {
+			this.buf = append(this.buf, p...)
+		}
+	}
+	this.locker.Unlock()
+	this.cond.Broadcast()
+
+	return len(p), nil
+}
+
+// Close 成功写入所有内容
+func (this *FetchStream) Close() error {
+	this.finish(nil)
+	return nil
+}
+
+// Fail 写入失败
+func (this *FetchStream) Fail(err error) {
+	this.finish(err)
+}
+
+// NewReader 获取新的读取器
+func (this *FetchStream) NewReader() *FetchStreamReader {
+	return &FetchStreamReader{stream: this}
+}
+
+func (this *FetchStream) finish(err error) {
+	this.locker.Lock()
+	if !this.isDone {
+		this.isDone = true
+		if err == nil && int64(len(this.buf)) != this.size {
+			err = ErrFetchStreamBroken
+		}
+		this.err = err
+	}
+	this.locker.Unlock()
+	this.cond.Broadcast()
+}
+
+// FetchStreamReader 正在回源写入内容的读取器
+type FetchStreamReader struct {
+	stream *FetchStream
+	offset int
+}
+
+func (this *FetchStreamReader) Read(p []byte) (n int, err error) {
+	var stream = this.stream
+
+	stream.locker.Lock()
+	defer stream.locker.Unlock()
+
+	for this.offset >= len(stream.buf) && !stream.isDone {
+		stream.cond.Wait()
+	}
+
+	if this.offset < len(stream.buf) {
+		n = copy(p, stream.buf[this.offset:])
+		this.offset += n
+		return
+	}
+
+	if stream.err != nil {
+		return 0, stream.err
+	}
+	return 0, io.EOF
+}
+
+func (this *FetchStreamReader) Close() error {
+	return nil
+}
@@ -11,6 +11,7 @@ type ItemType = int
 const (
 	ItemTypeFile   ItemType = 1
 	ItemTypeMemory ItemType = 2
+	ItemTypeRedis  ItemType = 3
 )
 
 // 计算当前周
@@ -29,6 +30,7 @@ type Item struct {
 	MetaSize   int64    `json:"metaSize"`
 	Host       string   `json:"host"`     // 主机名
 	ServerId   int64    `json:"serverId"` // 服务ID
+	Tags       []string `json:"tags"`     // 标签，用来按标签清除缓存
 
 	Week1Hits int64 `json:"week1Hits"`
 	Week2Hits int64 `json:"week2Hits"`
@@ -213,6 +213,26 @@ func (this *FileList) CleanMatchPrefix(prefix string) error {
 	return nil
 }
 
+// CleanTag 清理某个标签的缓存数据
+func (this *FileList) CleanTag(tag string, staleLife int) error {
+	if len(tag) == 0 {
+		return nil
+	}
+
+	defer func() {
+		// TODO 需要优化
+		this.memoryCache.Clean()
+	}()
+
+	for _, db := range this.dbList {
+		err := db.CleanTag(tag, staleLife)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (this *FileList) Remove(hash string) error {
 	_, err := this.remove(hash)
 	return err
@@ -329,6 +349,43 @@ func (this *FileList) Stat(check func(hash string) bool) (*Stat, error) {
 	return result, nil
 }
 
+// ListItems 遍历所有未过期的缓存条目
+func (this *FileList) ListItems(callback func(hash string, item *Item) (goNext bool, err error)) error {
+	for _, db := range this.dbList {
+		if db == nil || !db.IsReady() {
+			continue
+		}
+
+		var lastId int64
+		for {
+			hashList, items, maxId, err := db.ListItems(lastId)
+			if err != nil {
+				return err
+			}
+			if len(hashList) == 0 {
+				break
+			}
+			lastId = maxId
+
+			for index, hash := range hashList {
+				var item = items[index]
+				item.Tags, err = db.ListTags(hash)
+				if err != nil {
+					return err
+				}
+				goNext, err := callback(hash, item)
+				if err != nil {
+					return err
+				}
+				if !goNext {
+					return nil
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // Count 总数量
 // 常用的方法，所以避免直接查询数据库
 func (this *FileList) Count() (int64, error) {
@@ -346,6 +403,23 @@ func (this *FileList) IncreaseHit(hash string) error {
 	return db.IncreaseHitAsync(hash)
 }
 
+// UpdateExpiredAt 修改过期时间
+func (this *FileList) UpdateExpiredAt(hash string, expiredAt int64, staleAt int64) error {
+	var db = this.GetDB(hash)
+
+	if !db.IsReady() {
+		return nil
+	}
+
+	err := db.UpdateExpiredAtAsync(hash, expiredAt, staleAt)
+	if err != nil {
+		return err
+	}
+
+	this.memoryCache.Write(hash, 1, expiredAt)
+	return nil
+}
+
 // OnAdd 添加事件
 func (this *FileList) OnAdd(f func(item *Item)) {
 	this.onAdd = f
@@ -34,6 +34,7 @@ type FileListDB struct {
 
 	itemsTableName string
 	hitsTableName  string
+	tagsTableName  string
 
 	total int64
 
@@ -49,6 +50,7 @@ type FileListDB struct {
 	selectByHashStmt *dbs.Stmt // 使用hash查询数据
 
 	selectHashListStmt *dbs.Stmt
+	selectItemListStmt *dbs.Stmt // 读取缓存条目，用来导出缓存
 
 	deleteByHashStmt *dbs.Stmt // 根据hash删除数据
 	deleteByHashSQL  string
@@ -58,11 +60,17 @@ type FileListDB struct {
 	deleteAllStmt       *dbs.Stmt // 删除所有数据
 	listOlderItemsStmt  *dbs.Stmt // 读取较早存储的缓存
 	updateAccessWeekSQL string    // 修改访问日期
+	updateExpiredAtSQL  string    // 修改过期时间
 
 	// hits
 	insertHitSQL       string // 写入数据
 	increaseHitSQL     string // 增加点击量
 	deleteHitByHashSQL string // 根据hash删除数据
+
+	// tags
+	insertTagSQL         string    // 写入标签
+	deleteTagsByHashSQL  string    // 根据hash删除标签
+	selectTagsByHashStmt *dbs.Stmt // 根据hash查询标签
 }
 
 func NewFileListDB() *FileListDB {
@@ -143,6 +151,7 @@ func (this *FileListDB) Open(dbPath string) error {
 func (this *FileListDB) Init() error {
 	this.itemsTableName = "cacheItems"
 	this.hitsTableName = "hits"
+	this.tagsTableName = "cacheTags"
 
 	// 创建
 	var err = this.initTables(1)
@@ -184,6 +193,11 @@ func (this *FileListDB) Init() error {
 		return err
 	}
 
+	this.selectItemListStmt, err = this.readDB.Prepare(`SELECT i."id", i."hash", i."key", i."headerSize", i."bodySize", i."metaSize", i."expiredAt", i."staleAt", IFNULL(i."host", ''), IFNULL(i."serverId", 0), IFNULL(h."week1Hits", 0), IFNULL(h."week2Hits", 0) FROM "` + this.itemsTableName + `" AS i LEFT JOIN "` + this.hitsTableName + `" AS h ON h."hash"=i."hash" WHERE i.id>? AND i.expiredAt>? ORDER BY i.id ASC LIMIT 1000`)
+	if err != nil {
+		return err
+	}
+
 	this.deleteByHashSQL = `DELETE FROM "` + this.itemsTableName + `" WHERE "hash"=?`
 	this.deleteByHashStmt, err = this.writeDB.Prepare(this.deleteByHashSQL)
 	if err != nil {
@@ -212,12 +226,23 @@ func (this *FileListDB) Init() error {
 
 	this.updateAccessWeekSQL = `UPDATE "` + this.itemsTableName + `" SET "accessWeek"=? WHERE "hash"=?`
 
+	this.updateExpiredAtSQL = `UPDATE "` + this.itemsTableName + `" SET "expiredAt"=?, "staleAt"=? WHERE "hash"=?`
+
 	this.insertHitSQL = `INSERT INTO "` + this.hitsTableName + `" ("hash", "week2Hits", "week") VALUES (?, 1, ?)`
 
 	this.increaseHitSQL = `INSERT INTO "` + this.hitsTableName + `" ("hash", "week2Hits", "week") VALUES (?, 1, ?) ON CONFLICT("hash") DO UPDATE SET "week1Hits"=IIF("week"=?, "week1Hits", "week2Hits"), "week2Hits"=IIF("week"=?, "week2Hits"+1, 1), "week"=?`
 
 	this.deleteHitByHashSQL = `DELETE FROM "` + this.hitsTableName + `" WHERE "hash"=?`
 
+	this.insertTagSQL = `INSERT INTO "` + this.tagsTableName + `" ("hash", "tag") VALUES (?, ?)`
+
+	this.deleteTagsByHashSQL = `DELETE FROM "` + this.tagsTableName + `" WHERE "hash"=?`
+
+	this.selectTagsByHashStmt, err = this.readDB.Prepare(`SELECT "tag" FROM "` + this.tagsTableName + `" WHERE "hash"=?`)
+	if err != nil {
+		return err
+	}
+
 	this.isReady = true
 
 	// 加载HashMap
@@ -247,6 +272,9 @@ func (this *FileListDB) AddAsync(hash string, item *Item) error {
 	}
 
 	this.writeBatch.Add(this.insertSQL, hash, item.Key, item.HeaderSize, item.BodySize, item.MetaSize, item.ExpiredAt, item.StaleAt, item.Host, item.ServerId, utils.UnixTime(), timeutil.Format("YW"))
+	for _, tag := range item.Tags {
+		this.writeBatch.Add(this.insertTagSQL, hash, tag)
+	}
 	return nil
 
 }
@@ -263,6 +291,13 @@ func (this *FileListDB) AddSync(hash string, item *Item) error {
 		return this.WrapError(err)
 	}
 
+	for _, tag := range item.Tags {
+		_, err = this.writeDB.Exec(this.insertTagSQL, hash, tag)
+		if err != nil {
+			return this.WrapError(err)
+		}
+	}
+
 	return nil
 }
 
@@ -270,6 +305,7 @@ func (this *FileListDB) DeleteAsync(hash string) error {
 	this.hashMap.Delete(hash)
 
 	this.writeBatch.Add(this.deleteByHashSQL, hash)
+	this.writeBatch.Add(this.deleteTagsByHashSQL, hash)
 	return nil
 }
 
@@ -280,6 +316,11 @@ func (this *FileListDB) DeleteSync(hash string) error {
 	if err != nil {
 		return err
 	}
+
+	_, err = this.writeDB.Exec(this.deleteTagsByHashSQL, hash)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -360,6 +401,53 @@ func (this *FileListDB) ListHashes(lastId int64) (hashList []string, maxId int64
 	return
 }
 
+// ListItems 读取未过期的缓存条目，包括点击量
+func (this *FileListDB) ListItems(lastId int64) (hashList []string, items []*Item, maxId int64, err error) {
+	rows, err := this.selectItemListStmt.Query(lastId, utils.UnixTime())
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var id int64
+		var hash string
+		var item = &Item{Type: ItemTypeFile}
+		err = rows.Scan(&id, &hash, &item.Key, &item.HeaderSize, &item.BodySize, &item.MetaSize, &item.ExpiredAt, &item.StaleAt, &item.Host, &item.ServerId, &item.Week1Hits, &item.Week2Hits)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		maxId = id
+		hashList = append(hashList, hash)
+		items = append(items, item)
+	}
+
+	return hashList, items, maxId, rows.Err()
+}
+
+// ListTags 读取某个缓存条目的标签
+func (this *FileListDB) ListTags(hash string) (tags []string, err error) {
+	rows, err := this.selectTagsByHashStmt.Query(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var tag string
+		err = rows.Scan(&tag)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
 func (this *FileListDB) IncreaseHitAsync(hash string) error {
 	var week = timeutil.Format("YW")
 	this.writeBatch.Add(this.increaseHitSQL, hash, week, week, week, week)
@@ -367,6 +455,15 @@ func (this *FileListDB) IncreaseHitAsync(hash string) error {
 	return nil
 }
 
+func (this *FileListDB) UpdateExpiredAtAsync(hash string, expiredAt int64, staleAt int64) error {
+	if !this.isReady {
+		return nil
+	}
+
+	this.writeBatch.Add(this.updateExpiredAtSQL, expiredAt, staleAt, hash)
+	return nil
+}
+
 func (this *FileListDB) DeleteHitAsync(hash string) error {
 	this.writeBatch.Add(this.deleteHitByHashSQL, hash)
 	return nil
@@ -473,6 +570,21 @@ func (this *FileListDB) CleanMatchPrefix(prefix string) error {
 	return err
 }
 
+// CleanTag 清除某个标签的缓存
+func (this *FileListDB) CleanTag(tag string, staleLife int) error {
+	if !this.isReady {
+		return nil
+	}
+
+	var unixTime = utils.UnixTime() // 只删除当前的，不删除新的
+
+	_, err := this.writeDB.Exec(`UPDATE "`+this.itemsTableName+`" SET "expiredAt"=0, "staleAt"=? WHERE "expiredAt">0 AND "createdAt"<=? AND "hash" IN (SELECT "hash" FROM "`+this.tagsTableName+`" WHERE "tag"=?)`, unixTime+int64(staleLife), unixTime, tag)
+	if err != nil {
+		return this.WrapError(err)
+	}
+	return nil
+}
+
 func (this *FileListDB) CleanAll() error {
 	if !this.isReady {
 		return nil
@@ -483,6 +595,11 @@ func (this *FileListDB) CleanAll() error {
 		return this.WrapError(err)
 	}
 
+	_, err = this.writeDB.Exec(`DELETE FROM "` + this.tagsTableName + `"`)
+	if err != nil {
+		return this.WrapError(err)
+	}
+
 	this.hashMap.Clean()
 
 	return nil
@@ -504,6 +621,12 @@ func (this *FileListDB) Close() error {
 	if this.selectHashListStmt != nil {
 		_ = this.selectHashListStmt.Close()
 	}
+	if this.selectItemListStmt != nil {
+		_ = this.selectItemListStmt.Close()
+	}
+	if this.selectTagsByHashStmt != nil {
+		_ = this.selectTagsByHashStmt.Close()
+	}
 	if this.deleteByHashStmt != nil {
 		_ = this.deleteByHashStmt.Close()
 	}
@@ -641,6 +764,37 @@ ON "` + this.hitsTableName + `" (
 		}
 	}
 
+	{
+		_, err := this.writeDB.Exec(`CREATE TABLE IF NOT EXISTS "` + this.tagsTableName + `" (
+  "id" integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+  "hash" varchar(32),
+  "tag" varchar(128)
+);
+
+CREATE INDEX IF NOT EXISTS "tags_hash"
+ON "` + this.tagsTableName + `" (
+  "hash" ASC
+);
+
+CREATE INDEX IF NOT EXISTS "tags_tag"
+ON "` + this.tagsTableName + `" (
+  "tag" ASC
+);
+`)
+		if err != nil {
+			// 尝试删除重建
+			if times < 3 {
+				_, dropErr := this.writeDB.Exec(`DROP TABLE "` + this.tagsTableName + `"`)
+				if dropErr == nil {
+					return this.initTables(times + 1)
+				}
+				return this.WrapError(err)
+			}
+
+			return this.WrapError(err)
+		}
+	}
+
 	return nil
 }
 
@@ -85,3 +85,17 @@ func TestFileListDB_CleanMatchPrefix(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestFileListDB_CleanTag(t *testing.T) {
+	var db = caches.NewFileListDB()
+	err := db.Open(Tea.Root + "/data/cache-db-large.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Init()
+
+	err = db.CleanTag("product-1", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
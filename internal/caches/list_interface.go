@@ -24,9 +24,16 @@ type ListInterface interface {
 	// CleanMatchPrefix 清除通配符匹配的前缀
 	CleanMatchPrefix(prefix string) error
 
+	// CleanTag 清除某个标签的缓存
+	// staleLife 为清除后陈旧内容仍然可以使用的时长
+	CleanTag(tag string, staleLife int) error
+
 	// Remove 删除内容
 	Remove(hash string) error
 
+	// UpdateExpiredAt 修改过期时间
+	UpdateExpiredAt(hash string, expiredAt int64, staleAt int64) error
+
 	// Purge 清理过期数据
 	Purge(count int, callback func(hash string) error) (int, error)
 
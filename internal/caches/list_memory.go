@@ -2,6 +2,7 @@ package caches
 
 import (
 	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
+	"github.com/TeaOSLab/EdgeNode/internal/utils"
 	"github.com/TeaOSLab/EdgeNode/internal/zero"
 	"github.com/iwind/TeaGo/logs"
 	"net"
@@ -22,6 +23,8 @@ type MemoryList struct {
 	weekItemMaps map[int32]map[string]zero.Zero // week => { hash => Zero }
 	minWeek      int32
 
+	tagItemMaps map[string]map[string]zero.Zero // tag => { hash => Zero }
+
 	prefixes []string
 	locker   sync.RWMutex
 	onAdd    func(item *Item)
@@ -35,6 +38,7 @@ func NewMemoryList() ListInterface {
 		itemMaps:     map[string]map[string]*Item{},
 		weekItemMaps: map[int32]map[string]zero.Zero{},
 		minWeek:      currentWeek(),
+		tagItemMaps:  map[string]map[string]zero.Zero{},
 	}
 }
 
@@ -57,6 +61,7 @@ func (this *MemoryList) Reset() error {
 		this.itemMaps[key] = map[string]*Item{}
 	}
 	this.weekItemMaps = map[int32]map[string]zero.Zero{}
+	this.tagItemMaps = map[string]map[string]zero.Zero{}
 	this.locker.Unlock()
 
 	atomic.StoreInt64(&this.count, 0)
@@ -89,6 +94,9 @@ func (this *MemoryList) Add(hash string, item *Item) error {
 			}
 		}
 
+		// 从tag map中删除
+		this.removeTags(hash, oldItem.Tags)
+
 		// 回调
 		if this.onRemove != nil {
 			this.onRemove(oldItem)
@@ -112,6 +120,9 @@ func (this *MemoryList) Add(hash string, item *Item) error {
 		this.weekItemMaps[item.Week] = map[string]zero.Zero{hash: zero.New()}
 	}
 
+	// tag map
+	this.addTags(hash, item.Tags)
+
 	this.locker.Unlock()
 	return nil
 }
@@ -225,6 +236,44 @@ func (this *MemoryList) CleanMatchPrefix(prefix string) error {
 	return nil
 }
 
+// CleanTag 清除某个标签的缓存
+// 和文件缓存列表一致，清除后的缓存在 staleLife 秒内仍可作为陈旧内容使用
+func (this *MemoryList) CleanTag(tag string, staleLife int) error {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	var staleAt = utils.UnixTime() + int64(staleLife)
+	for hash := range this.tagItemMaps[tag] {
+		itemMap, ok := this.itemMaps[this.prefix(hash)]
+		if !ok {
+			continue
+		}
+		item, ok := itemMap[hash]
+		if ok && item.ExpiredAt > 0 {
+			item.ExpiredAt = 0
+			item.StaleAt = staleAt
+		}
+	}
+	return nil
+}
+
+// IsCleaned 检查缓存是否已在列表中被清除或过期
+// 列表中不存在的缓存返回 false
+func (this *MemoryList) IsCleaned(hash string) bool {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+
+	itemMap, ok := this.itemMaps[this.prefix(hash)]
+	if !ok {
+		return false
+	}
+	item, ok := itemMap[hash]
+	if !ok {
+		return false
+	}
+	return item.IsExpired()
+}
+
 func (this *MemoryList) Remove(hash string) error {
 	this.locker.Lock()
 
@@ -250,12 +299,32 @@ func (this *MemoryList) Remove(hash string) error {
 				delete(wm, hash)
 			}
 		}
+
+		// tag map
+		this.removeTags(hash, item.Tags)
 	}
 
 	this.locker.Unlock()
 	return nil
 }
 
+// UpdateExpiredAt 修改过期时间
+func (this *MemoryList) UpdateExpiredAt(hash string, expiredAt int64, staleAt int64) error {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	itemMap, ok := this.itemMaps[this.prefix(hash)]
+	if !ok {
+		return nil
+	}
+	item, ok := itemMap[hash]
+	if ok {
+		item.ExpiredAt = expiredAt
+		item.StaleAt = staleAt
+	}
+	return nil
+}
+
 // Purge 清理过期的缓存
 // count 每次遍历的最大数量，控制此数字可以保证每次清理的时候不用花太多时间
 // callback 每次发现过期key的调用
@@ -276,12 +345,14 @@ func (this *MemoryList) Purge(count int, callback func(hash string) error) (int,
 		return 0, nil
 	}
 	var countFound = 0
+	var now = utils.UnixTime()
 	for hash, item := range itemMap {
 		if count <= 0 {
 			break
 		}
 
-		if item.IsExpired() {
+		// 陈旧内容可用时间内的缓存暂不删除
+		if item.IsExpired() && item.StaleAt < now {
 			if this.onRemove != nil {
 				this.onRemove(item)
 			}
@@ -298,6 +369,9 @@ func (this *MemoryList) Purge(count int, callback func(hash string) error) (int,
 				}
 			}
 
+			// tag map
+			this.removeTags(hash, item.Tags)
+
 			countFound++
 		}
 
@@ -370,6 +444,7 @@ Loop:
 
 					atomic.AddInt64(&this.count, -1)
 					delete(itemMap, hash)
+					this.removeTags(hash, item.Tags)
 					deletedHashList = append(deletedHashList, hash)
 				}
 			}
@@ -497,3 +572,28 @@ func (this *MemoryList) prefix(hash string) string {
 	}
 	return prefix
 }
+
+// 添加标签索引，需要在锁内调用
+func (this *MemoryList) addTags(hash string, tags []string) {
+	for _, tag := range tags {
+		tm, ok := this.tagItemMaps[tag]
+		if ok {
+			tm[hash] = zero.New()
+		} else {
+			this.tagItemMaps[tag] = map[string]zero.Zero{hash: zero.New()}
+		}
+	}
+}
+
+// 删除标签索引，需要在锁内调用
+func (this *MemoryList) removeTags(hash string, tags []string) {
+	for _, tag := range tags {
+		tm, ok := this.tagItemMaps[tag]
+		if ok {
+			delete(tm, hash)
+			if len(tm) == 0 {
+				delete(this.tagItemMaps, tag)
+			}
+		}
+	}
+}
@@ -54,6 +54,64 @@ func TestMemoryList_Remove(t *testing.T) {
 	t.Log(list.Count())
 }
 
+func TestMemoryList_CleanTag(t *testing.T) {
+	list := NewMemoryList().(*MemoryList)
+	_ = list.Init()
+	_ = list.Add("a", &Item{
+		Key:       "a1",
+		ExpiredAt: time.Now().Unix() + 3600,
+		Tags:      []string{"product", "home"},
+	})
+	_ = list.Add("b", &Item{
+		Key:       "b1",
+		ExpiredAt: time.Now().Unix() + 3600,
+		Tags:      []string{"home"},
+	})
+	_ = list.Add("c", &Item{
+		Key:       "c1",
+		ExpiredAt: time.Now().Unix() + 3600,
+	})
+
+	_ = list.CleanTag("product", 600)
+	for _, hash := range []string{"a", "b", "c"} {
+		ok, _ := list.Exist(hash)
+		t.Log(hash, ok)
+		if ok == (hash == "a") {
+			t.Fatal("clean tag failed: " + hash)
+		}
+	}
+
+	// 在陈旧内容可用时间内不应被清理
+	if !list.IsCleaned("a") || list.IsCleaned("b") {
+		t.Fatal("'a' should be cleaned")
+	}
+	if list.itemMaps[list.prefix("a")]["a"].StaleAt < time.Now().Unix()+600-1 {
+		t.Fatal("stale life not applied")
+	}
+	for i := 0; i < 1000; i++ {
+		_, _ = list.Purge(100, func(hash string) error {
+			return nil
+		})
+	}
+	if count, _ := list.Count(); count != 3 {
+		t.Fatal("stale item should not be purged")
+	}
+
+	_ = list.Remove("b")
+	if len(list.tagItemMaps["home"]) != 1 {
+		t.Fatal("tag map not updated")
+	}
+
+	_ = list.Add("a", &Item{
+		Key:       "a1",
+		ExpiredAt: time.Now().Unix() + 3600,
+	})
+	if len(list.tagItemMaps) != 0 {
+		t.Fatal("tag map not updated")
+	}
+	logs.PrintAsJSON(list.tagItemMaps, t)
+}
+
 func TestMemoryList_Purge(t *testing.T) {
 	list := NewMemoryList().(*MemoryList)
 	_ = list.Init()
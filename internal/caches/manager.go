@@ -28,8 +28,13 @@ type Manager struct {
 	SubDiskDirs       []*serverconfigs.CacheDir
 	MaxMemoryCapacity *shared.SizeCapacity
 
+	// RefreshAheadFunc 在后台刷新某个即将过期的缓存Key，由节点设置
+	RefreshAheadFunc func(key string)
+
 	policyMap  map[int64]*serverconfigs.HTTPCachePolicy // policyId => []*Policy
 	storageMap map[int64]StorageInterface               // policyId => *Storage
+	optionsMap map[int64]*PolicyOptions                 // policyId => *PolicyOptions
+	filterMap  map[int64]*AdmissionFilter               // policyId => *AdmissionFilter
 	locker     sync.RWMutex
 }
 
@@ -38,6 +43,8 @@ func NewManager() *Manager {
 	var m = &Manager{
 		policyMap:  map[int64]*serverconfigs.HTTPCachePolicy{},
 		storageMap: map[int64]StorageInterface{},
+		optionsMap: map[int64]*PolicyOptions{},
+		filterMap:  map[int64]*AdmissionFilter{},
 	}
 
 	return m
@@ -61,6 +68,8 @@ func (this *Manager) UpdatePolicies(newPolicies []*serverconfigs.HTTPCachePolicy
 		if !lists.ContainsInt64(newPolicyIds, oldPolicy.Id) {
 			remotelogs.Println("CACHE", "remove policy "+strconv.FormatInt(oldPolicy.Id, 10))
 			delete(this.policyMap, oldPolicy.Id)
+			delete(this.optionsMap, oldPolicy.Id)
+			delete(this.filterMap, oldPolicy.Id)
 			storage, ok := this.storageMap[oldPolicy.Id]
 			if ok {
 				storage.Stop()
@@ -83,6 +92,18 @@ func (this *Manager) UpdatePolicies(newPolicies []*serverconfigs.HTTPCachePolicy
 			continue
 		}
 		this.policyMap[newPolicy.Id] = newPolicy
+		var options = DecodePolicyOptions(newPolicy.Options)
+		this.optionsMap[newPolicy.Id] = options
+
+		// 准入过滤器，设置不变时保留已有的计数
+		if options.Admission.IsOn {
+			filter, ok := this.filterMap[newPolicy.Id]
+			if !ok || !filter.Config().Equals(options.Admission) {
+				this.filterMap[newPolicy.Id] = NewAdmissionFilter(options.Admission)
+			}
+		} else {
+			delete(this.filterMap, newPolicy.Id)
+		}
 	}
 
 	// 启动存储管理
@@ -147,6 +168,43 @@ func (this *Manager) FindPolicy(policyId int64) *serverconfigs.HTTPCachePolicy {
 	return p
 }
 
+// FindPolicyOptions 获取策略扩展选项
+func (this *Manager) FindPolicyOptions(policyId int64) *PolicyOptions {
+	this.locker.RLock()
+	options, ok := this.optionsMap[policyId]
+	this.locker.RUnlock()
+
+	if !ok {
+		return DecodePolicyOptions(nil)
+	}
+	return options
+}
+
+// AdmitWrite 检查某个Key是否可以写入缓存
+// 没有开启准入时总是允许写入
+func (this *Manager) AdmitWrite(policyId int64, key string) bool {
+	this.locker.RLock()
+	filter, ok := this.filterMap[policyId]
+	this.locker.RUnlock()
+
+	if !ok {
+		return true
+	}
+	return filter.Admit(key)
+}
+
+// FindAdmissionStat 获取准入统计，没有开启准入时返回nil
+func (this *Manager) FindAdmissionStat(policyId int64) *AdmissionStat {
+	this.locker.RLock()
+	filter, ok := this.filterMap[policyId]
+	this.locker.RUnlock()
+
+	if !ok {
+		return nil
+	}
+	return filter.Stat()
+}
+
 // FindStorageWithPolicy 根据策略ID查找存储
 func (this *Manager) FindStorageWithPolicy(policyId int64) StorageInterface {
 	this.locker.RLock()
@@ -163,6 +221,8 @@ func (this *Manager) NewStorageWithPolicy(policy *serverconfigs.HTTPCachePolicy)
 		return NewFileStorage(policy)
 	case serverconfigs.CachePolicyStorageMemory:
 		return NewMemoryStorage(policy, nil)
+	case CachePolicyStorageRedis:
+		return NewRedisStorage(policy)
 	}
 	return nil
 }
@@ -0,0 +1,237 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PolicyOptions 缓存策略中节点使用的扩展选项
+// 和存储选项一起保存在策略的Options中，没有设置的选项使用默认值
+type PolicyOptions struct {
+	FetchCoalescing *FetchCoalescingConfig `json:"fetchCoalescing"` // 合并回源
+	Freshness       *FreshnessConfig       `json:"freshness"`       // 有效期计算
+	Vary            *VaryConfig            `json:"vary"`            // Vary变体
+	RefreshAhead    *RefreshAheadConfig    `json:"refreshAhead"`    // 热点数据提前刷新
+	Slice           *SliceConfig           `json:"slice"`           // 分片缓存
+	Admission       *AdmissionConfig       `json:"admission"`       // 写入准入
+}
+
+// DecodePolicyOptions 从策略的Options中解析扩展选项
+func DecodePolicyOptions(options map[string]interface{}) *PolicyOptions {
+	// 先填充默认值，以便于只设置部分选项
+	var result = &PolicyOptions{}
+	result.init()
+
+	if len(options) > 0 {
+		optionsJSON, err := json.Marshal(options)
+		if err == nil {
+			_ = json.Unmarshal(optionsJSON, result)
+		}
+	}
+	result.init()
+	return result
+}
+
+func (this *PolicyOptions) init() {
+	if this.FetchCoalescing == nil {
+		this.FetchCoalescing = DefaultFetchCoalescingConfig()
+	}
+	if this.Freshness == nil {
+		this.Freshness = DefaultFreshnessConfig()
+	}
+	if this.Vary == nil {
+		this.Vary = DefaultVaryConfig()
+	}
+	if this.RefreshAhead == nil {
+		this.RefreshAhead = DefaultRefreshAheadConfig()
+	}
+	if this.Slice == nil {
+		this.Slice = DefaultSliceConfig()
+	}
+	if this.Admission == nil {
+		this.Admission = DefaultAdmissionConfig()
+	}
+}
+
+// FetchCoalescingConfig 合并回源设置
+type FetchCoalescingConfig struct {
+	IsOn          bool  `json:"isOn"`
+	WaitSeconds   int   `json:"waitSeconds"`   // 其他请求等待的最长时间
+	StreamMaxSize int64 `json:"streamMaxSize"` // 允许其他请求从正在写入的内容中直接读取的最大内容尺寸，为0表示不允许
+}
+
+func DefaultFetchCoalescingConfig() *FetchCoalescingConfig {
+	return &FetchCoalescingConfig{
+		IsOn:          false, // 默认不开启，以免改变已有策略的回源行为
+		WaitSeconds:   10,
+		StreamMaxSize: 32 << 20,
+	}
+}
+
+// WaitDuration 等待时间
+func (this *FetchCoalescingConfig) WaitDuration() time.Duration {
+	if this.WaitSeconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(this.WaitSeconds) * time.Second
+}
+
+// FreshnessConfig 有效期计算设置
+type FreshnessConfig struct {
+	HeuristicPercent     int   `json:"heuristicPercent"`     // 根据Last-Modified估算有效期时使用的百分比，为0表示不估算
+	HeuristicMaxSeconds  int64 `json:"heuristicMaxSeconds"`  // 估算的最长有效期
+	StaleLifeSeconds     int   `json:"staleLifeSeconds"`     // 源站没有设置stale-if-error时陈旧内容保留的时长
+	StaleWhileRevalidate bool  `json:"staleWhileRevalidate"` // 是否支持stale-while-revalidate
+	Revalidate           bool  `json:"revalidate"`           // 过期后是否使用ETag和Last-Modified向源站验证
+}
+
+func DefaultFreshnessConfig() *FreshnessConfig {
+	return &FreshnessConfig{
+		HeuristicPercent:     10,
+		HeuristicMaxSeconds:  86400,
+		StaleLifeSeconds:     600,
+		StaleWhileRevalidate: true,
+		Revalidate:           true,
+	}
+}
+
+// VaryConfig Vary变体设置
+type VaryConfig struct {
+	IsOn        bool `json:"isOn"`
+	MaxVariants int  `json:"maxVariants"` // 每个Key最多的变体数量，超出后不再缓存新的变体
+}
+
+// DefaultVaryConfig 默认的Vary设置
+// 默认不开启，开启后带有Vary的响应会使用新的变体Key缓存，已有的缓存不再命中
+func DefaultVaryConfig() *VaryConfig {
+	return &VaryConfig{
+		IsOn:        false,
+		MaxVariants: 32,
+	}
+}
+
+// RefreshAheadConfig 热点数据提前刷新设置
+// 热点数据剩余的有效期低于一定比例时，在后台向源站验证并更新缓存，目前仅支持文件缓存
+type RefreshAheadConfig struct {
+	IsOn           bool  `json:"isOn"`
+	Percent        int   `json:"percent"`        // 剩余有效期占总有效期的百分比，低于此值时开始刷新
+	MinLifeSeconds int64 `json:"minLifeSeconds"` // 有效期低于此值的缓存不刷新
+	MaxItems       int   `json:"maxItems"`       // 每次最多刷新的数量
+}
+
+func DefaultRefreshAheadConfig() *RefreshAheadConfig {
+	return &RefreshAheadConfig{
+		IsOn:           false,
+		Percent:        10,
+		MinLifeSeconds: 60,
+		MaxItems:       100,
+	}
+}
+
+// ShouldRefresh 判断某个缓存是否需要刷新
+// createdAt 为缓存写入时间，expiresAt 为过期时间
+func (this *RefreshAheadConfig) ShouldRefresh(createdAt int64, expiresAt int64, now int64) bool {
+	if !this.IsOn || this.Percent <= 0 || createdAt <= 0 || expiresAt <= now {
+		return false
+	}
+	var life = expiresAt - createdAt
+	if life <= 0 || life < this.MinLifeSeconds {
+		return false
+	}
+	return (expiresAt-now)*100 <= life*int64(this.Percent)
+}
+
+// SliceConfig 分片缓存设置
+// 开启后按照固定尺寸的对齐区间从源站读取内容，每个分片单独缓存，客户端请求的区间从分片中组合
+type SliceConfig struct {
+	IsOn           bool  `json:"isOn"`
+	SizeBytes      int64 `json:"sizeBytes"`      // 每个分片的尺寸
+	Concurrent     int   `json:"concurrent"`     // 同时从源站读取的分片数量
+	TimeoutSeconds int   `json:"timeoutSeconds"` // 等待单个分片读取完成的最长时间
+}
+
+func DefaultSliceConfig() *SliceConfig {
+	return &SliceConfig{
+		IsOn:           false,
+		SizeBytes:      4 << 20,
+		Concurrent:     4,
+		TimeoutSeconds: 60,
+	}
+}
+
+// Size 分片尺寸
+func (this *SliceConfig) Size() int64 {
+	if this.SizeBytes <= 0 {
+		return 4 << 20
+	}
+	return this.SizeBytes
+}
+
+// Index 某个位置所在的分片序号
+func (this *SliceConfig) Index(offset int64) int64 {
+	if offset <= 0 {
+		return 0
+	}
+	return offset / this.Size()
+}
+
+// Range 某个分片的区间，end 包含在区间内
+func (this *SliceConfig) Range(index int64) (start int64, end int64) {
+	start = index * this.Size()
+	end = start + this.Size() - 1
+	return
+}
+
+// TimeoutDuration 等待时间
+func (this *SliceConfig) TimeoutDuration() time.Duration {
+	if this.TimeoutSeconds <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(this.TimeoutSeconds) * time.Second
+}
+
+// AdmissionType 准入方式
+type AdmissionType = string
+
+const (
+	AdmissionTypeTinyLFU AdmissionType = "tinyLFU" // 访问频率估算，在每个周期结束时计数减半
+	AdmissionTypeNthHit  AdmissionType = "nthHit"  // 在一个周期内访问达到一定次数，在每个周期结束时清空计数
+)
+
+// AdmissionConfig 缓存写入准入设置
+// 开启后只有访问次数达到 MinHits 的内容才会写入缓存，以减少只访问一次的内容对磁盘的写入
+type AdmissionConfig struct {
+	IsOn          bool          `json:"isOn"`
+	Type          AdmissionType `json:"type"`          // 准入方式
+	MinHits       int           `json:"minHits"`       // 写入缓存需要的最少访问次数
+	WindowSeconds int           `json:"windowSeconds"` // 计数周期
+	MaxKeys       int           `json:"maxKeys"`       // 预计同时计数的Key数量，用来决定计数器占用的内存
+}
+
+func DefaultAdmissionConfig() *AdmissionConfig {
+	return &AdmissionConfig{
+		IsOn:          false,
+		Type:          AdmissionTypeTinyLFU,
+		MinHits:       2,
+		WindowSeconds: 3600,
+		MaxKeys:       1 << 20,
+	}
+}
+
+// Window 计数周期
+func (this *AdmissionConfig) Window() int64 {
+	if this.WindowSeconds <= 0 {
+		return 3600
+	}
+	return int64(this.WindowSeconds)
+}
+
+// Equals 检查设置是否相同
+func (this *AdmissionConfig) Equals(other *AdmissionConfig) bool {
+	if other == nil {
+		return false
+	}
+	return *this == *other
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/iwind/TeaGo/assert"
+	"testing"
+)
+
+func TestRefreshAheadConfig_ShouldRefresh(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var now int64 = 10000
+
+	{
+		var config = caches.DefaultRefreshAheadConfig()
+		a.IsFalse(config.ShouldRefresh(now-950, now+50, now))
+	}
+
+	var config = caches.DecodePolicyOptions(map[string]interface{}{
+		"refreshAhead": map[string]interface{}{
+			"isOn": true,
+		},
+	}).RefreshAhead
+	a.IsTrue(config.Percent == 10)
+	a.IsTrue(config.ShouldRefresh(now-950, now+50, now))
+	a.IsTrue(config.ShouldRefresh(now-900, now+100, now))
+	a.IsFalse(config.ShouldRefresh(now-500, now+500, now))
+	a.IsFalse(config.ShouldRefresh(now-1000, now, now)) // 已过期
+	a.IsFalse(config.ShouldRefresh(now-29, now+1, now)) // 有效期太短
+	a.IsFalse(config.ShouldRefresh(0, now+1, now))      // 无法获得写入时间
+}
+
+func TestAdmissionConfig_Equals(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = caches.DecodePolicyOptions(map[string]interface{}{
+		"admission": map[string]interface{}{
+			"isOn":    true,
+			"minHits": 3,
+		},
+	}).Admission
+	a.IsTrue(config.IsOn)
+	a.IsTrue(config.MinHits == 3)
+	a.IsTrue(config.Type == caches.AdmissionTypeTinyLFU)
+	a.IsTrue(config.Window() == 3600)
+	a.IsFalse(config.Equals(caches.DefaultAdmissionConfig()))
+	a.IsTrue(config.Equals(&caches.AdmissionConfig{
+		IsOn:          true,
+		Type:          caches.AdmissionTypeTinyLFU,
+		MinHits:       3,
+		WindowSeconds: 3600,
+		MaxKeys:       1 << 20,
+	}))
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"context"
+	"errors"
+	rangeutils "github.com/TeaOSLab/EdgeNode/internal/utils/ranges"
+	"github.com/go-redis/redis/v8"
+	"github.com/iwind/TeaGo/types"
+	"io"
+)
+
+// RedisReader Redis缓存读取器
+// 内容分块按需读取，不会一次性读取整个内容
+type RedisReader struct {
+	storage *RedisStorage
+	values  map[string]string
+
+	hash       string
+	version    string
+	expiresAt  int64
+	status     int
+	modifiedAt int64
+	header     []byte
+	bodySize   int64
+	chunkSize  int64
+
+	offset int64
+	chunk  []byte // 当前读取的分块
+	index  int64  // 当前读取的分块序号
+}
+
+func NewRedisReader(storage *RedisStorage, values map[string]string) *RedisReader {
+	return &RedisReader{
+		storage: storage,
+		values:  values,
+		index:   -1,
+	}
+}
+
+func (this *RedisReader) Init() error {
+	this.hash = this.storage.hash(this.values[redisFieldKey])
+	this.version = this.values[redisFieldVersion]
+	this.expiresAt = types.Int64(this.values[redisFieldExpiresAt])
+	this.status = types.Int(this.values[redisFieldStatus])
+	this.modifiedAt = types.Int64(this.values[redisFieldModifiedAt])
+	this.header = []byte(this.values[redisFieldHeader])
+	this.bodySize = types.Int64(this.values[redisFieldBodySize])
+	this.chunkSize = types.Int64(this.values[redisFieldChunkSize])
+
+	if this.bodySize > 0 && this.chunkSize <= 0 {
+		return errors.New("invalid chunk size")
+	}
+	return nil
+}
+
+func (this *RedisReader) TypeName() string {
+	return "redis"
+}
+
+func (this *RedisReader) ExpiresAt() int64 {
+	return this.expiresAt
+}
+
+func (this *RedisReader) Status() int {
+	return this.status
+}
+
+func (this *RedisReader) LastModified() int64 {
+	return this.modifiedAt
+}
+
+func (this *RedisReader) HeaderSize() int64 {
+	return int64(len(this.header))
+}
+
+func (this *RedisReader) BodySize() int64 {
+	return this.bodySize
+}
+
+func (this *RedisReader) ReadHeader(buf []byte, callback ReaderFunc) error {
+	var l = len(buf)
+	if l == 0 {
+		return errors.New("using empty buffer")
+	}
+
+	var size = len(this.header)
+	var offset = 0
+	for offset < size {
+		var n = copy(buf, this.header[offset:])
+		offset += n
+		goNext, err := callback(n)
+		if err != nil {
+			return err
+		}
+		if !goNext {
+			break
+		}
+	}
+	return nil
+}
+
+func (this *RedisReader) ReadBody(buf []byte, callback ReaderFunc) error {
+	if this.bodySize == 0 {
+		return nil
+	}
+	return this.ReadBodyRange(buf, 0, this.bodySize-1, callback)
+}
+
+func (this *RedisReader) Read(buf []byte) (n int, err error) {
+	if len(buf) == 0 {
+		return 0, errors.New("using empty buffer")
+	}
+
+	if this.offset >= this.bodySize {
+		return 0, io.EOF
+	}
+
+	n, err = this.readAt(buf, this.offset)
+	if err != nil {
+		return
+	}
+	this.offset += int64(n)
+	if this.offset >= this.bodySize {
+		err = io.EOF
+	}
+	return
+}
+
+func (this *RedisReader) ReadBodyRange(buf []byte, start int64, end int64, callback ReaderFunc) error {
+	var offset = start
+	var bodySize = this.bodySize
+	if start < 0 {
+		offset = bodySize + end
+		end = bodySize - 1
+	} else if end < 0 {
+		offset = start
+		end = bodySize - 1
+	}
+
+	if end >= bodySize {
+		end = bodySize - 1
+	}
+
+	if offset < 0 || end < 0 || offset > end {
+		return ErrInvalidRange
+	}
+
+	if len(buf) == 0 {
+		return errors.New("using empty buffer")
+	}
+
+	for offset <= end {
+		var size = int64(len(buf))
+		if size > end-offset+1 {
+			size = end - offset + 1
+		}
+		n, err := this.readAt(buf[:size], offset)
+		if err != nil {
+			return err
+		}
+		offset += int64(n)
+
+		goNext, err := callback(n)
+		if err != nil {
+			return err
+		}
+		if !goNext {
+			break
+		}
+	}
+
+	return nil
+}
+
+// ContainsRange 是否包含某些区间内容
+func (this *RedisReader) ContainsRange(r rangeutils.Range) (r2 rangeutils.Range, ok bool) {
+	return r, true
+}
+
+func (this *RedisReader) Close() error {
+	this.chunk = nil
+	return nil
+}
+
+// 从某个位置开始读取内容，最多读取到当前分块结束
+func (this *RedisReader) readAt(buf []byte, offset int64) (n int, err error) {
+	var index = offset / this.chunkSize
+	if index != this.index {
+		var chunkKey = this.storage.chunkKey(this.hash, this.version, index)
+		chunk, err := this.storage.client.Get(context.Background(), chunkKey).Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				return 0, ErrNotFound
+			}
+			return 0, err
+		}
+		this.chunk = chunk
+		this.index = index
+	}
+
+	var chunkOffset = offset - index*this.chunkSize
+	if chunkOffset >= int64(len(this.chunk)) {
+		return 0, ErrNotFound
+	}
+	return copy(buf, this.chunk[chunkOffset:]), nil
+}
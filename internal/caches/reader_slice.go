@@ -0,0 +1,426 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"bytes"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	rangeutils "github.com/TeaOSLab/EdgeNode/internal/utils/ranges"
+	"github.com/iwind/TeaGo/types"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+var sliceContentRangeRegexp = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+)`)
+
+// SliceKey 某个分片的缓存Key
+func SliceKey(key string, index int64) string {
+	return key + SuffixSlice + "_" + strconv.FormatInt(index, 10)
+}
+
+// SliceFetcher 从源站读取某个分片并写入缓存，在写入完成或者失败后返回
+type SliceFetcher func(index int64) error
+
+// 单个分片的读取过程
+type sliceFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// SliceReader 分片缓存读取器
+// 每个分片的Header中保留源站返回的Content-Range，用来得知内容总长度和分片的位置；
+// 读取时如果分片不存在，则调用 SliceFetcher 从源站读取，并同时读取后面的几个分片
+type SliceReader struct {
+	storage    StorageInterface
+	key        string
+	config     *SliceConfig
+	fetcher    SliceFetcher
+	firstIndex int64
+
+	header     []byte
+	expiresAt  int64
+	modifiedAt int64
+	bodySize   int64
+	validator  string // ETag或者Last-Modified，用来检查所有分片是否为同一个版本
+
+	offset int64
+
+	current      Reader
+	currentIndex int64
+
+	fetchMap map[int64]*sliceFetch // index => fetch
+	locker   sync.Mutex
+}
+
+// NewSliceReader 获取新的分片读取器
+// firstIndex 为第一个需要读取的分片，从此分片中读取Header和内容总长度
+func NewSliceReader(storage StorageInterface, key string, config *SliceConfig, firstIndex int64, fetcher SliceFetcher) *SliceReader {
+	return &SliceReader{
+		storage:      storage,
+		key:          key,
+		config:       config,
+		fetcher:      fetcher,
+		firstIndex:   firstIndex,
+		bodySize:     -1,
+		currentIndex: -1,
+		fetchMap:     map[int64]*sliceFetch{},
+	}
+}
+
+func (this *SliceReader) Init() error {
+	reader, err := this.openSlice(this.firstIndex)
+	if err != nil {
+		return err
+	}
+	this.current = reader
+	this.currentIndex = this.firstIndex
+	return nil
+}
+
+func (this *SliceReader) TypeName() string {
+	return "slice"
+}
+
+func (this *SliceReader) ExpiresAt() int64 {
+	return this.expiresAt
+}
+
+func (this *SliceReader) Status() int {
+	return http.StatusOK
+}
+
+func (this *SliceReader) LastModified() int64 {
+	return this.modifiedAt
+}
+
+func (this *SliceReader) HeaderSize() int64 {
+	return int64(len(this.header))
+}
+
+func (this *SliceReader) BodySize() int64 {
+	return this.bodySize
+}
+
+func (this *SliceReader) ReadHeader(buf []byte, callback ReaderFunc) error {
+	if len(buf) == 0 {
+		return errors.New("using empty buffer")
+	}
+
+	var size = len(this.header)
+	var offset = 0
+	for offset < size {
+		var n = copy(buf, this.header[offset:])
+		offset += n
+		goNext, err := callback(n)
+		if err != nil {
+			return err
+		}
+		if !goNext {
+			break
+		}
+	}
+	return nil
+}
+
+func (this *SliceReader) ReadBody(buf []byte, callback ReaderFunc) error {
+	if this.bodySize <= 0 {
+		return nil
+	}
+	return this.ReadBodyRange(buf, 0, this.bodySize-1, callback)
+}
+
+func (this *SliceReader) Read(buf []byte) (n int, err error) {
+	if len(buf) == 0 {
+		return 0, errors.New("using empty buffer")
+	}
+	if this.offset >= this.bodySize {
+		return 0, io.EOF
+	}
+
+	var end = this.offset + int64(len(buf)) - 1
+	var sliceEnd = (this.config.Index(this.offset)+1)*this.config.Size() - 1
+	if end > sliceEnd {
+		end = sliceEnd
+	}
+	err = this.ReadBodyRange(buf, this.offset, end, func(size int) (goNext bool, err error) {
+		n = size
+		return false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	this.offset += int64(n)
+	if this.offset >= this.bodySize {
+		err = io.EOF
+	}
+	return
+}
+
+func (this *SliceReader) ReadBodyRange(buf []byte, start int64, end int64, callback ReaderFunc) error {
+	var offset = start
+	var bodySize = this.bodySize
+	if start < 0 {
+		offset = bodySize + end
+		end = bodySize - 1
+	} else if end < 0 {
+		offset = start
+		end = bodySize - 1
+	}
+
+	if end >= bodySize {
+		end = bodySize - 1
+	}
+
+	if offset < 0 || end < 0 || offset > end {
+		return ErrInvalidRange
+	}
+
+	if len(buf) == 0 {
+		return errors.New("using empty buffer")
+	}
+
+	var sliceSize = this.config.Size()
+	for index := this.config.Index(offset); index <= this.config.Index(end); index++ {
+		reader, err := this.sliceReader(index)
+		if err != nil {
+			return err
+		}
+
+		// 分片中的区间
+		var sliceStart = index * sliceSize
+		var localStart = offset - sliceStart
+		var localEnd = end - sliceStart
+		if localEnd >= sliceSize {
+			localEnd = sliceSize - 1
+		}
+
+		var stopped = false
+		err = reader.ReadBodyRange(buf, localStart, localEnd, func(n int) (goNext bool, err error) {
+			goNext, err = callback(n)
+			if err == nil && !goNext {
+				stopped = true
+			}
+			return
+		})
+		if err != nil {
+			return err
+		}
+		if stopped {
+			break
+		}
+
+		offset = sliceStart + sliceSize
+	}
+
+	return nil
+}
+
+// ContainsRange 是否包含某些区间内容
+// 缺少的分片会在读取时从源站读取，所以总是包含
+func (this *SliceReader) ContainsRange(r rangeutils.Range) (r2 rangeutils.Range, ok bool) {
+	return r, true
+}
+
+func (this *SliceReader) Close() error {
+	if this.current != nil {
+		var err = this.current.Close()
+		this.current = nil
+		this.currentIndex = -1
+		return err
+	}
+	return nil
+}
+
+// 获取某个分片的读取器
+func (this *SliceReader) sliceReader(index int64) (Reader, error) {
+	if this.current != nil && this.currentIndex == index {
+		return this.current, nil
+	}
+
+	if this.current != nil {
+		_ = this.current.Close()
+		this.current = nil
+		this.currentIndex = -1
+	}
+
+	reader, err := this.openSlice(index)
+	if err != nil {
+		return nil, err
+	}
+	this.current = reader
+	this.currentIndex = index
+	return reader, nil
+}
+
+// 打开某个分片，如果不存在则从源站读取
+func (this *SliceReader) openSlice(index int64) (Reader, error) {
+	var sliceKey = SliceKey(this.key, index)
+	reader, err := this.storage.OpenReader(sliceKey, false, false)
+	if err == ErrNotFound && this.fetcher != nil {
+		err = this.fetch(index)
+		if err != nil {
+			return nil, err
+		}
+		reader, err = this.storage.OpenReader(sliceKey, false, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = this.checkSlice(reader, index)
+	if err != nil {
+		_ = reader.Close()
+		if err == ErrSliceChanged {
+			_ = this.storage.Delete(sliceKey)
+		}
+		return nil, err
+	}
+
+	// 同时读取后面的分片
+	this.prefetch(index + 1)
+
+	return reader, nil
+}
+
+// 检查分片并读取Header
+func (this *SliceReader) checkSlice(reader Reader, index int64) error {
+	var headerData = []byte{}
+	var buf = make([]byte, 1024)
+	err := reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+		headerData = append(headerData, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var header = []byte{}
+	var start int64 = -1
+	var total int64 = -1
+	var eTag string
+	var lastModified string
+	for _, row := range bytes.Split(headerData, []byte{'\n'}) {
+		var spaceIndex = bytes.IndexByte(row, ':')
+		if spaceIndex <= 0 {
+			continue
+		}
+		var value = string(row[spaceIndex+1:])
+		switch http.CanonicalHeaderKey(string(row[:spaceIndex])) {
+		case "Content-Range":
+			var matches = sliceContentRangeRegexp.FindStringSubmatch(value)
+			if len(matches) == 4 {
+				start = types.Int64(matches[1])
+				total = types.Int64(matches[3])
+			}
+			continue
+		case "Content-Length":
+			continue
+		case "Etag":
+			eTag = value
+		case "Last-Modified":
+			lastModified = value
+		}
+		header = append(header, row...)
+		header = append(header, '\n')
+	}
+
+	if start != index*this.config.Size() || total <= 0 {
+		return ErrSliceChanged
+	}
+
+	var validator = eTag
+	if len(validator) == 0 {
+		validator = lastModified
+	}
+
+	// 第一个分片
+	if this.bodySize < 0 {
+		this.header = header
+		this.bodySize = total
+		this.validator = validator
+		this.expiresAt = reader.ExpiresAt()
+		this.modifiedAt = reader.LastModified()
+		return nil
+	}
+
+	// 源站内容已经变化
+	if total != this.bodySize || validator != this.validator {
+		return ErrSliceChanged
+	}
+	if reader.ExpiresAt() < this.expiresAt {
+		this.expiresAt = reader.ExpiresAt()
+	}
+	return nil
+}
+
+// 从源站读取某个分片并等待结束
+func (this *SliceReader) fetch(index int64) error {
+	this.locker.Lock()
+	var f = this.fetchMap[index]
+	if f != nil {
+		// 已经失败的后台读取需要重试
+		select {
+		case <-f.done:
+			if f.err != nil {
+				f = nil
+			}
+		default:
+		}
+	}
+	if f == nil {
+		f = this.startFetch(index, false)
+	}
+	this.locker.Unlock()
+
+	<-f.done
+
+	this.locker.Lock()
+	delete(this.fetchMap, index)
+	this.locker.Unlock()
+
+	return f.err
+}
+
+// 在后台读取后面的几个分片
+func (this *SliceReader) prefetch(fromIndex int64) {
+	if this.fetcher == nil || this.bodySize <= 0 {
+		return
+	}
+
+	var lastIndex = this.config.Index(this.bodySize - 1)
+	this.locker.Lock()
+	for index := fromIndex; index < fromIndex+int64(this.config.Concurrent)-1 && index <= lastIndex; index++ {
+		if this.fetchMap[index] != nil {
+			continue
+		}
+		this.startFetch(index, true)
+	}
+	this.locker.Unlock()
+}
+
+// 开始读取某个分片，需要在锁内调用
+func (this *SliceReader) startFetch(index int64, checkExists bool) *sliceFetch {
+	var f = &sliceFetch{
+		done: make(chan struct{}),
+	}
+	this.fetchMap[index] = f
+
+	goman.New(func() {
+		defer close(f.done)
+
+		if checkExists {
+			reader, err := this.storage.OpenReader(SliceKey(this.key, index), false, false)
+			if err == nil {
+				_ = reader.Close()
+				return
+			}
+		}
+		f.err = this.fetcher(index)
+	})
+	return f
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestSliceFetcher(storage StorageInterface, key string, config *SliceConfig, body []byte, eTag string, count *int32) SliceFetcher {
+	return func(index int64) error {
+		atomic.AddInt32(count, 1)
+
+		start, end := config.Range(index)
+		if end >= int64(len(body)) {
+			end = int64(len(body)) - 1
+		}
+		writer, err := storage.OpenWriter(SliceKey(key, index), time.Now().Unix()+60, 206, -1, -1, -1, false)
+		if err != nil {
+			return err
+		}
+		_, err = writer.WriteHeader([]byte("Content-Range:bytes " + strconv.FormatInt(start, 10) + "-" + strconv.FormatInt(end, 10) + "/" + strconv.Itoa(len(body)) + "\nContent-Type:text/plain\nEtag:" + eTag + "\n"))
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(body[start : end+1])
+		if err != nil {
+			return err
+		}
+		return writer.Close()
+	}
+}
+
+func TestSliceReader_ReadBodyRange(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var storage = NewMemoryStorage(&serverconfigs.HTTPCachePolicy{}, nil)
+	_ = storage.Init()
+	defer storage.Stop()
+
+	var key = "https://example.com/large.bin"
+	var body = []byte("0123456789abcdefghij")
+	var config = &SliceConfig{IsOn: true, SizeBytes: 4, Concurrent: 1}
+	var count int32
+	var fetcher = newTestSliceFetcher(storage, key, config, body, "\"v1\"", &count)
+
+	var readRange = func(start int64, end int64) string {
+		var reader = NewSliceReader(storage, key, config, config.Index(start), fetcher)
+		err := reader.Init()
+		if err != nil {
+			return err.Error()
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		a.IsTrue(reader.BodySize() == int64(len(body)))
+
+		var buf = make([]byte, 3)
+		var result = &bytes.Buffer{}
+		err = reader.ReadBodyRange(buf, start, end, func(n int) (goNext bool, err error) {
+			result.Write(buf[:n])
+			return true, nil
+		})
+		if err != nil {
+			return err.Error()
+		}
+		return result.String()
+	}
+
+	a.IsTrue(readRange(5, 6) == "56")
+	a.IsTrue(readRange(6, 13) == "6789abcd")
+	a.IsTrue(readRange(18, -1) == "ij")
+	a.IsTrue(readRange(3, 100) == "3456789abcdefghij")
+	t.Log("fetch count:", atomic.LoadInt32(&count))
+	a.IsTrue(atomic.LoadInt32(&count) == 5)
+}
+
+func TestSliceReader_Read(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var storage = NewMemoryStorage(&serverconfigs.HTTPCachePolicy{}, nil)
+	_ = storage.Init()
+	defer storage.Stop()
+
+	var key = "https://example.com/large.bin"
+	var body = []byte("0123456789abcdefghij")
+	var config = &SliceConfig{IsOn: true, SizeBytes: 8, Concurrent: 4}
+	var count int32
+
+	var reader = NewSliceReader(storage, key, config, 0, newTestSliceFetcher(storage, key, config, body, "\"v1\"", &count))
+	err := reader.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(reader.Status() == 200)
+
+	var header = []byte{}
+	var headerBuf = make([]byte, 16)
+	err = reader.ReadHeader(headerBuf, func(n int) (goNext bool, err error) {
+		header = append(header, headerBuf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsFalse(bytes.Contains(header, []byte("Content-Range")))
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(string(data) == string(body))
+	_ = reader.Close()
+}
+
+func TestSliceReader_Changed(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var storage = NewMemoryStorage(&serverconfigs.HTTPCachePolicy{}, nil)
+	_ = storage.Init()
+	defer storage.Stop()
+
+	var key = "https://example.com/large.bin"
+	var body = []byte("0123456789abcdefghij")
+	var config = &SliceConfig{IsOn: true, SizeBytes: 4, Concurrent: 1}
+	var count int32
+
+	// 第二个分片来自新版本
+	err := newTestSliceFetcher(storage, key, config, body, "\"v2\"", &count)(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reader = NewSliceReader(storage, key, config, 0, newTestSliceFetcher(storage, key, config, body, "\"v1\"", &count))
+	err = reader.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf = make([]byte, 4)
+	err = reader.ReadBodyRange(buf, 0, 7, func(n int) (goNext bool, err error) {
+		return true, nil
+	})
+	a.IsTrue(err == ErrSliceChanged)
+
+	// 变化的分片已经被删除
+	_, err = storage.OpenReader(SliceKey(key, 1), false, false)
+	a.IsTrue(err == ErrNotFound)
+}
@@ -24,6 +24,7 @@ import (
 	"golang.org/x/sys/unix"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
@@ -728,6 +729,159 @@ func (this *FileStorage) Delete(key string) error {
 	return err
 }
 
+// UpdateExpiresAt 修改缓存的过期时间，不改变缓存内容
+// headerData 不为空时同时替换缓存中的Header
+func (this *FileStorage) UpdateExpiresAt(key string, expiresAt int64, staleAt int64, headerData []byte) error {
+	// 是否正在退出
+	if teaconst.IsQuiting {
+		return nil
+	}
+
+	// 先尝试内存缓存
+	var isInMemory = false
+	this.runMemoryStorageSafety(func(memoryStorage *MemoryStorage) {
+		isInMemory = memoryStorage.UpdateExpiresAt(key, expiresAt, staleAt, headerData) == nil
+	})
+
+	// 分区缓存中内容的位置和Header长度相关，所以只修改过期时间
+	if strings.Contains(key, SuffixPartial) {
+		headerData = nil
+	}
+
+	hash, path, _ := this.keyPath(key)
+	fp, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if isInMemory {
+				return nil
+			}
+			return ErrNotFound
+		}
+		return err
+	}
+
+	err = this.updateFileMeta(key, path, fp, expiresAt, headerData)
+	var closeErr = fp.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	// 关闭已打开的文件，以便于重新读取文件头部
+	var openFileCache = this.openFileCache
+	if openFileCache != nil {
+		openFileCache.Close(path)
+	}
+
+	return this.list.UpdateExpiredAt(hash, expiresAt, staleAt)
+}
+
+// 修改缓存文件中的过期时间和Header
+func (this *FileStorage) updateFileMeta(key string, path string, fp *os.File, expiresAt int64, headerData []byte) error {
+	var expiresAtBytes = make([]byte, SizeExpiresAt)
+	binary.BigEndian.PutUint32(expiresAtBytes, uint32(expiresAt))
+
+	if len(headerData) == 0 {
+		_, err := fp.WriteAt(expiresAtBytes, OffsetExpiresAt)
+		return err
+	}
+
+	var metaBytes = make([]byte, SizeMeta)
+	_, err := io.ReadFull(fp, metaBytes)
+	if err != nil {
+		return err
+	}
+	var urlLength = int64(binary.BigEndian.Uint32(metaBytes[OffsetURLLength : OffsetURLLength+SizeURLLength]))
+	var headerSize = int64(binary.BigEndian.Uint32(metaBytes[OffsetHeaderLength : OffsetHeaderLength+SizeHeaderLength]))
+
+	// Header长度不变时直接覆盖
+	if int64(len(headerData)) == headerSize {
+		_, err = fp.WriteAt(expiresAtBytes, OffsetExpiresAt)
+		if err != nil {
+			return err
+		}
+		_, err = fp.WriteAt(headerData, SizeMeta+urlLength)
+		return err
+	}
+
+	// Header长度改变时需要重写文件，如果正在写入则只修改过期时间
+	sharedWritingFileKeyLocker.Lock()
+	_, ok := sharedWritingFileKeyMap[key]
+	if ok {
+		sharedWritingFileKeyLocker.Unlock()
+		_, err = fp.WriteAt(expiresAtBytes, OffsetExpiresAt)
+		return err
+	}
+	sharedWritingFileKeyMap[key] = zero.New()
+	sharedWritingFileKeyLocker.Unlock()
+	defer func() {
+		sharedWritingFileKeyLocker.Lock()
+		delete(sharedWritingFileKeyMap, key)
+		sharedWritingFileKeyLocker.Unlock()
+	}()
+
+	var tmpPath = path + FileTmpSuffix
+	writer, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	var isOk = false
+	defer func() {
+		if !isOk {
+			_ = writer.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	err = syscall.Flock(int(writer.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		return ErrFileIsWriting
+	}
+
+	// meta
+	copy(metaBytes[OffsetExpiresAt:], expiresAtBytes)
+	binary.BigEndian.PutUint32(metaBytes[OffsetHeaderLength:], uint32(len(headerData)))
+	_, err = writer.Write(metaBytes)
+	if err != nil {
+		return err
+	}
+
+	// URL
+	_, err = io.CopyN(writer, fp, urlLength)
+	if err != nil {
+		return err
+	}
+
+	// Header
+	_, err = writer.Write(headerData)
+	if err != nil {
+		return err
+	}
+
+	// Body
+	_, err = fp.Seek(SizeMeta+urlLength+headerSize, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, fp)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return err
+	}
+	isOk = true
+	return nil
+}
+
 // Stat 统计
 func (this *FileStorage) Stat() (*Stat, error) {
 	return this.list.Stat(func(hash string) bool {
@@ -833,6 +987,18 @@ func (this *FileStorage) Purge(keys []string, urlType string) error {
 		_ = memoryStorage.Purge(keys, urlType)
 	})
 
+	// 标签
+	if urlType == "tag" {
+		var staleLife = SharedManager.FindPolicyOptions(this.policy.Id).Freshness.StaleLifeSeconds
+		for _, key := range keys {
+			err := this.list.CleanTag(key, staleLife)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	// 目录
 	if urlType == "dir" {
 		for _, key := range keys {
@@ -883,6 +1049,29 @@ func (this *FileStorage) Purge(keys []string, urlType string) error {
 		if err != nil {
 			return err
 		}
+
+		// 同时清除Vary变体
+		if !strings.Contains(key, SuffixVary) {
+			markerHash, _, _ := this.keyPath(VaryMarkerKey(key))
+			hasVariants, err := this.list.Exist(markerHash)
+			if err != nil {
+				return err
+			}
+			if hasVariants {
+				err = this.list.CleanPrefix(VaryMarkerKey(key))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// 同时清除分片
+		if SharedManager.FindPolicyOptions(this.policy.Id).Slice.IsOn && !strings.Contains(key, SuffixSlice) {
+			err = this.list.CleanPrefix(key + SuffixSlice)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -1127,7 +1316,7 @@ func (this *FileStorage) purgeLoop() {
 // 热点数据任务
 func (this *FileStorage) hotLoop() {
 	var memoryStorage = this.memoryStorage
-	if memoryStorage == nil {
+	if memoryStorage == nil && !this.refreshAheadIsOn() {
 		return
 	}
 
@@ -1148,11 +1337,19 @@ func (this *FileStorage) hotLoop() {
 	this.hotMap = map[string]*HotItem{}
 	this.hotMapLocker.Unlock()
 
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Hits > result[j].Hits
+	})
+
+	// 提前刷新即将过期的热点数据
+	this.refreshAhead(result)
+
+	if memoryStorage == nil {
+		return
+	}
+
 	// 取Top10%写入内存
 	if len(result) > 0 {
-		sort.Slice(result, func(i, j int) bool {
-			return result[i].Hits > result[j].Hits
-		})
 		var size = 1
 		if len(result) < 10 {
 			size = 1
@@ -1202,7 +1399,9 @@ func (this *FileStorage) hotLoop() {
 				continue
 			}
 
+			var headerData = []byte{}
 			err = reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+				headerData = append(headerData, buf[:n]...)
 				_, err = writer.WriteHeader(buf[:n])
 				return
 			})
@@ -1235,6 +1434,7 @@ func (this *FileStorage) hotLoop() {
 				ExpiredAt:  expiresAt,
 				HeaderSize: writer.HeaderSize(),
 				BodySize:   writer.BodySize(),
+				Tags:       ParseCacheTagsFromHeaderData(headerData),
 			})
 
 			_ = reader.Close()
@@ -1285,6 +1485,60 @@ func (this *FileStorage) cleanDeletedDirs(dir string) error {
 	return nil
 }
 
+// 提前刷新即将过期的热点数据
+func (this *FileStorage) refreshAhead(hotItems []*HotItem) {
+	var refreshFunc = SharedManager.RefreshAheadFunc
+	if refreshFunc == nil || len(hotItems) == 0 {
+		return
+	}
+
+	var config = SharedManager.FindPolicyOptions(this.policy.Id).RefreshAhead
+	if config == nil || !config.IsOn {
+		return
+	}
+
+	var nowUnixTime = time.Now().Unix()
+	var countRefreshing = 0
+	var refreshedKeys = map[string]bool{}
+	for _, item := range hotItems {
+		if config.MaxItems > 0 && countRefreshing >= config.MaxItems {
+			break
+		}
+
+		// 压缩、WebP等衍生的缓存使用原始Key刷新，Vary变体无法重建请求，所以忽略
+		var key = item.Key
+		if strings.Contains(key, SuffixVary) {
+			continue
+		}
+		var suffixIndex = strings.Index(key, SuffixAll)
+		if suffixIndex > 0 {
+			key = key[:suffixIndex]
+		}
+		if refreshedKeys[key] {
+			continue
+		}
+		refreshedKeys[key] = true
+
+		reader, err := this.openReader(key, false, false, false)
+		if err != nil || reader == nil {
+			continue
+		}
+		var shouldRefresh = config.ShouldRefresh(reader.LastModified(), reader.ExpiresAt(), nowUnixTime)
+		_ = reader.Close()
+
+		if shouldRefresh {
+			refreshFunc(key)
+			countRefreshing++
+		}
+	}
+}
+
+// 是否开启了热点数据提前刷新
+func (this *FileStorage) refreshAheadIsOn() bool {
+	var config = SharedManager.FindPolicyOptions(this.policy.Id).RefreshAhead
+	return config != nil && config.IsOn
+}
+
 // 增加某个Key的点击量
 func (this *FileStorage) increaseHit(key string, hash string, reader Reader) {
 	var rate = this.policy.PersistenceHitSampleRate
@@ -1306,7 +1560,7 @@ func (this *FileStorage) increaseHit(key string, hash string, reader Reader) {
 
 		// 增加到热点
 		// 这里不收录缓存尺寸过大的文件
-		if memoryStorage != nil && reader.BodySize() > 0 && reader.BodySize() < 128*sizes.M {
+		if (memoryStorage != nil || this.refreshAheadIsOn()) && reader.BodySize() > 0 && reader.BodySize() < 128*sizes.M {
 			this.hotMapLocker.Lock()
 			hotItem, ok := this.hotMap[key]
 
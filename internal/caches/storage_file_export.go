@@ -0,0 +1,494 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/utils"
+	"github.com/iwind/TeaGo/types"
+	stringutil "github.com/iwind/TeaGo/utils/string"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	exportVersion      = 1
+	exportManifestName = "manifest.json"
+	exportItemsDir     = "items/"
+	exportTmpSuffix    = ".import" + FileTmpSuffix
+)
+
+var exportHashRegexp = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// ExportFilter 导出缓存时的过滤条件
+type ExportFilter struct {
+	Hosts    []string `json:"hosts"`    // 域名，支持通配符
+	Prefixes []string `json:"prefixes"` // Key前缀
+	MinHits  int64    `json:"minHits"`  // 最近两周最小访问量
+	MinSize  int64    `json:"minSize"`  // 内容最小尺寸
+	MaxSize  int64    `json:"maxSize"`  // 内容最大尺寸
+}
+
+// Match 检查缓存条目是否匹配
+func (this *ExportFilter) Match(item *Item) bool {
+	if this == nil {
+		return true
+	}
+	if len(this.Hosts) > 0 {
+		var host = item.Host
+		hostPart, _, err := net.SplitHostPort(host)
+		if err == nil && len(hostPart) > 0 {
+			host = hostPart
+		}
+		if !configutils.MatchDomains(this.Hosts, host) {
+			return false
+		}
+	}
+	if len(this.Prefixes) > 0 {
+		var found = false
+		for _, prefix := range this.Prefixes {
+			if strings.HasPrefix(item.Key, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if this.MinHits > 0 && item.Week1Hits+item.Week2Hits < this.MinHits {
+		return false
+	}
+	if this.MinSize > 0 && item.BodySize < this.MinSize {
+		return false
+	}
+	if this.MaxSize > 0 && item.BodySize > this.MaxSize {
+		return false
+	}
+	return true
+}
+
+// 导出文件说明
+type exportManifest struct {
+	Version   int   `json:"version"`
+	PolicyId  int64 `json:"policyId"`
+	CreatedAt int64 `json:"createdAt"`
+}
+
+// 导出的缓存条目信息
+type exportItem struct {
+	Item     *Item  `json:"item"`
+	FileSize int64  `json:"fileSize"` // 缓存文件尺寸
+	Checksum string `json:"checksum"` // 缓存文件MD5
+}
+
+// ExportFile 导出缓存到文件
+func (this *FileStorage) ExportFile(path string, filter *ExportFilter) (count int, err error) {
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err = this.Export(fp, filter)
+	if err != nil {
+		_ = fp.Close()
+		_ = os.Remove(path)
+		return 0, err
+	}
+	err = fp.Close()
+	return
+}
+
+// Export 导出缓存
+// 导出格式为tar.gz，依次为说明文件、每个条目的缓存文件和条目信息
+func (this *FileStorage) Export(writer io.Writer, filter *ExportFilter) (count int, err error) {
+	fileList, ok := this.list.(*FileList)
+	if !ok {
+		return 0, errors.New("unsupported list type")
+	}
+
+	var gzipWriter = gzip.NewWriter(writer)
+	var tarWriter = tar.NewWriter(gzipWriter)
+
+	manifestJSON, err := json.Marshal(&exportManifest{
+		Version:   exportVersion,
+		PolicyId:  this.policy.Id,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = this.writeTarEntry(tarWriter, exportManifestName, manifestJSON)
+	if err != nil {
+		return 0, err
+	}
+
+	err = fileList.ListItems(func(hash string, item *Item) (goNext bool, err error) {
+		// 区间缓存需要和区间信息一起使用，暂时不导出
+		if strings.Contains(item.Key, SuffixPartial) || !filter.Match(item) {
+			return true, nil
+		}
+
+		path, _ := this.hashPath(hash)
+		ok, err := this.exportItem(tarWriter, hash, path, item)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			count++
+		}
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return 0, err
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// 导出单个缓存条目
+func (this *FileStorage) exportItem(tarWriter *tar.Writer, hash string, path string, item *Item) (ok bool, err error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		// 文件可能已经被清理
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	stat, err := fp.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	err = tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     exportItemsDir + hash + ".cache",
+		Size:     stat.Size(),
+		Mode:     0666,
+		ModTime:  stat.ModTime(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var hashWriter = md5.New()
+	_, err = io.CopyN(tarWriter, io.TeeReader(fp, hashWriter), stat.Size())
+	if err != nil {
+		return false, err
+	}
+
+	itemJSON, err := json.Marshal(&exportItem{
+		Item:     item,
+		FileSize: stat.Size(),
+		Checksum: hex.EncodeToString(hashWriter.Sum(nil)),
+	})
+	if err != nil {
+		return false, err
+	}
+	err = this.writeTarEntry(tarWriter, exportItemsDir+hash+".json", itemJSON)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (this *FileStorage) writeTarEntry(tarWriter *tar.Writer, name string, data []byte) error {
+	err := tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0666,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tarWriter.Write(data)
+	return err
+}
+
+// ImportFile 从文件中导入缓存
+func (this *FileStorage) ImportFile(path string) (count int, err error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+	return this.Import(fp)
+}
+
+// Import 导入缓存
+// 每个缓存文件在校验尺寸、MD5和文件中的Key之后才会加入到缓存列表，已经存在的缓存不会被覆盖
+func (this *FileStorage) Import(reader io.Reader) (count int, err error) {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = gzipReader.Close()
+	}()
+
+	var tarReader = tar.NewReader(gzipReader)
+
+	// 等待条目信息的缓存文件
+	var pendingHash string
+	var pendingPath string
+	var pendingSize int64
+	var pendingChecksum string
+	defer func() {
+		if len(pendingPath) > 0 {
+			_ = os.Remove(pendingPath)
+		}
+	}()
+
+	var hasManifest = false
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return count, err
+		}
+
+		var name = header.Name
+		if name == exportManifestName {
+			var manifest = &exportManifest{}
+			err = json.NewDecoder(tarReader).Decode(manifest)
+			if err != nil {
+				return count, errors.New("decode manifest failed: " + err.Error())
+			}
+			if manifest.Version != exportVersion {
+				return count, errors.New("unsupported export version '" + types.String(manifest.Version) + "'")
+			}
+			hasManifest = true
+			continue
+		}
+		if !hasManifest {
+			return count, errors.New("invalid export file: manifest not found")
+		}
+		if !strings.HasPrefix(name, exportItemsDir) {
+			continue
+		}
+		name = strings.TrimPrefix(name, exportItemsDir)
+		var ext = filepath.Ext(name)
+		var hash = strings.TrimSuffix(name, ext)
+		if !exportHashRegexp.MatchString(hash) {
+			return count, errors.New("invalid item name '" + header.Name + "'")
+		}
+
+		switch ext {
+		case ".cache":
+			if len(pendingPath) > 0 {
+				_ = os.Remove(pendingPath)
+				pendingPath = ""
+			}
+
+			path, diskIsFull := this.hashPath(hash)
+			if diskIsFull {
+				return count, errors.New("no enough disk space")
+			}
+			var tmpPath = path + exportTmpSuffix
+			pendingSize, pendingChecksum, err = this.importCacheFile(tmpPath, tarReader)
+			if err != nil {
+				_ = os.Remove(tmpPath)
+				return count, err
+			}
+			pendingHash = hash
+			pendingPath = tmpPath
+		case ".json":
+			if hash != pendingHash || len(pendingPath) == 0 {
+				return count, errors.New("cache file of '" + header.Name + "' not found")
+			}
+
+			var itemInfo = &exportItem{}
+			err = json.NewDecoder(tarReader).Decode(itemInfo)
+			if err != nil {
+				return count, errors.New("decode '" + header.Name + "' failed: " + err.Error())
+			}
+			ok, err := this.importItem(hash, pendingPath, pendingSize, pendingChecksum, itemInfo)
+			if err != nil {
+				return count, errors.New("import '" + header.Name + "' failed: " + err.Error())
+			}
+			if ok {
+				count++
+			} else {
+				_ = os.Remove(pendingPath)
+			}
+			pendingHash = ""
+			pendingPath = ""
+		}
+	}
+
+	if !hasManifest {
+		return count, errors.New("invalid export file: manifest not found")
+	}
+
+	return count, nil
+}
+
+// 将导出的缓存文件写入到临时文件中
+func (this *FileStorage) importCacheFile(tmpPath string, reader io.Reader) (size int64, checksum string, err error) {
+	err = os.MkdirAll(filepath.Dir(tmpPath), 0777)
+	if err != nil {
+		return 0, "", err
+	}
+
+	fp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var hashWriter = md5.New()
+	size, err = io.Copy(io.MultiWriter(fp, hashWriter), reader)
+	if err != nil {
+		_ = fp.Close()
+		return 0, "", err
+	}
+	err = fp.Close()
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hashWriter.Sum(nil)), nil
+}
+
+// 校验并注册导入的缓存条目
+func (this *FileStorage) importItem(hash string, tmpPath string, size int64, checksum string, itemInfo *exportItem) (ok bool, err error) {
+	var item = itemInfo.Item
+	if item == nil || len(item.Key) == 0 {
+		return false, errors.New("invalid item")
+	}
+	if stringutil.Md5(item.Key) != hash {
+		return false, errors.New("hash not match")
+	}
+	if itemInfo.FileSize != size || itemInfo.Checksum != checksum {
+		return false, errors.New("checksum not match")
+	}
+
+	// 已过期的不再导入
+	if item.ExpiredAt <= utils.UnixTime() {
+		return false, nil
+	}
+
+	// 检查缓存文件
+	err = this.checkImportFile(tmpPath, item)
+	if err != nil {
+		return false, err
+	}
+
+	// 不覆盖已有的缓存
+	exists, err := this.list.Exist(hash)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	path, _ := this.hashPath(hash)
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return false, err
+	}
+
+	this.runMemoryStorageSafety(func(memoryStorage *MemoryStorage) {
+		_ = memoryStorage.Delete(item.Key)
+	})
+
+	this.AddToList(&Item{
+		Type:       ItemTypeFile,
+		Key:        item.Key,
+		ExpiredAt:  item.ExpiredAt,
+		StaleAt:    item.StaleAt,
+		HeaderSize: item.HeaderSize,
+		BodySize:   item.BodySize,
+		Host:       item.Host,
+		ServerId:   item.ServerId,
+		Tags:       item.Tags,
+	})
+
+	return true, nil
+}
+
+// 检查缓存文件中的元数据是否和条目信息一致
+func (this *FileStorage) checkImportFile(path string, item *Item) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	var meta = make([]byte, SizeMeta)
+	_, err = io.ReadFull(fp, meta)
+	if err != nil {
+		return errors.New("read meta failed: " + err.Error())
+	}
+
+	var expiresAt = int64(binary.BigEndian.Uint32(meta[OffsetExpiresAt : OffsetExpiresAt+SizeExpiresAt]))
+	var urlLength = int(binary.BigEndian.Uint32(meta[OffsetURLLength : OffsetURLLength+SizeURLLength]))
+	var headerSize = int64(binary.BigEndian.Uint32(meta[OffsetHeaderLength : OffsetHeaderLength+SizeHeaderLength]))
+	var bodySize = int64(binary.BigEndian.Uint64(meta[OffsetBodyLength : OffsetBodyLength+SizeBodyLength]))
+	// 从v0.5.8开始不再在meta中写入Key，所以只检查有Key的文件
+	if urlLength > 0 {
+		if urlLength != len(item.Key) {
+			return errors.New("key not match")
+		}
+		var keyBytes = make([]byte, urlLength)
+		_, err = io.ReadFull(fp, keyBytes)
+		if err != nil {
+			return errors.New("read key failed: " + err.Error())
+		}
+		if string(keyBytes) != item.Key {
+			return errors.New("key not match")
+		}
+	}
+
+	if headerSize != item.HeaderSize || bodySize != item.BodySize {
+		return errors.New("size not match")
+	}
+	stat, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() != int64(SizeMeta)+int64(urlLength)+headerSize+bodySize {
+		return errors.New("size not match")
+	}
+
+	// 以文件中的过期时间为准
+	if expiresAt != item.ExpiredAt {
+		remotelogs.Warn("CACHE", "import '"+item.Key+"': expires time not match")
+		item.ExpiredAt = expiresAt
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/assert"
+	"testing"
+	"time"
+)
+
+func TestExportFilter_Match(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var item = &Item{
+		Key:       "https://example.com/images/logo.png",
+		Host:      "example.com",
+		BodySize:  1024,
+		Week1Hits: 3,
+		Week2Hits: 2,
+	}
+
+	a.IsTrue((*ExportFilter)(nil).Match(item))
+	a.IsTrue((&ExportFilter{}).Match(item))
+	a.IsTrue((&ExportFilter{Hosts: []string{"example.com"}}).Match(item))
+	a.IsTrue((&ExportFilter{Hosts: []string{"*.com"}}).Match(item))
+	a.IsFalse((&ExportFilter{Hosts: []string{"example.org"}}).Match(item))
+	a.IsTrue((&ExportFilter{Prefixes: []string{"https://example.com/css/", "https://example.com/images/"}}).Match(item))
+	a.IsFalse((&ExportFilter{Prefixes: []string{"https://example.com/css/"}}).Match(item))
+	a.IsTrue((&ExportFilter{MinHits: 5}).Match(item))
+	a.IsFalse((&ExportFilter{MinHits: 6}).Match(item))
+	a.IsTrue((&ExportFilter{MinSize: 1024, MaxSize: 2048}).Match(item))
+	a.IsFalse((&ExportFilter{MinSize: 2048}).Match(item))
+	a.IsFalse((&ExportFilter{MaxSize: 512}).Match(item))
+}
+
+func TestFileStorage_Export(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var newStorage = func(id int64, dir string) *FileStorage {
+		var storage = NewFileStorage(&serverconfigs.HTTPCachePolicy{
+			Id:   id,
+			IsOn: true,
+			Options: map[string]interface{}{
+				"dir": dir,
+			},
+		})
+		err := storage.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = storage.CleanAll()
+
+		// 等待Hash列表加载完成
+		for _, db := range storage.list.(*FileList).dbList {
+			for !db.hashMap.IsReady() {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		return storage
+	}
+
+	var srcStorage = newStorage(1001, Tea.Root+"/caches-export-src")
+	defer srcStorage.Stop()
+
+	var write = func(key string, body string) {
+		writer, err := srcStorage.OpenWriter(key, time.Now().Unix()+3600, 200, -1, -1, -1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.WriteHeader([]byte("Content-Type:text/plain\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write([]byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcStorage.AddToList(&Item{
+			Type:       writer.ItemType(),
+			Key:        key,
+			ExpiredAt:  writer.ExpiredAt(),
+			HeaderSize: writer.HeaderSize(),
+			BodySize:   writer.BodySize(),
+			Host:       ParseHost(key),
+		})
+	}
+	write("https://example.com/a.txt", "Hello, World")
+	write("https://example.com/b.txt", "Hello, GoEdge")
+	write("https://example.org/c.txt", "Hello, Other")
+
+	// 等待写入数据库
+	time.Sleep(500 * time.Millisecond)
+
+	var buf = &bytes.Buffer{}
+	count, err := srcStorage.Export(buf, &ExportFilter{Hosts: []string{"example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(count == 2)
+
+	var dstStorage = newStorage(1002, Tea.Root+"/caches-export-dst")
+	defer dstStorage.Stop()
+
+	count, err = dstStorage.Import(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(count == 2)
+
+	reader, err := dstStorage.OpenReader("https://example.com/b.txt", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body = &bytes.Buffer{}
+	var readBuf = make([]byte, 16)
+	err = reader.ReadBody(readBuf, func(n int) (goNext bool, err error) {
+		body.Write(readBuf[:n])
+		return true, nil
+	})
+	_ = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(body.String() == "Hello, GoEdge")
+
+	_, err = dstStorage.OpenReader("https://example.org/c.txt", false, false)
+	a.IsTrue(err == ErrNotFound)
+
+	// 已经存在的不再导入
+	count, err = dstStorage.Import(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(count == 0)
+
+	// 损坏的导出文件
+	var data = buf.Bytes()
+	_, err = dstStorage.Import(bytes.NewReader(data[:len(data)/2]))
+	a.IsNotNil(err)
+}
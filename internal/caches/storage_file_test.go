@@ -439,6 +439,74 @@ func TestFileStorage_Delete(t *testing.T) {
 	t.Log("ok")
 }
 
+func TestFileStorage_UpdateExpiresAt(t *testing.T) {
+	storage := NewFileStorage(&serverconfigs.HTTPCachePolicy{
+		Id:   1,
+		IsOn: true,
+		Options: map[string]interface{}{
+			"dir": Tea.Root + "/caches",
+		},
+	})
+	err := storage.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := storage.OpenWriter("my-key", time.Now().Unix()-10, 200, -1, -1, -1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = writer.WriteHeader([]byte("Etag:\"1\"\n"))
+	_, _ = writer.Write([]byte("Hello, World"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expiresAt = time.Now().Unix() + 3600
+	err = storage.UpdateExpiresAt("my-key", expiresAt, expiresAt+600, []byte("Etag:\"2022\"\nCache-Control:max-age=3600\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := storage.OpenReader("my-key", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	if reader.ExpiresAt() != expiresAt {
+		t.Fatal("expiresAt should be updated")
+	}
+
+	var buf = make([]byte, 1024)
+	var headerData = []byte{}
+	err = reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+		headerData = append(headerData, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(headerData) != "Etag:\"2022\"\nCache-Control:max-age=3600\n" {
+		t.Fatal("header should be updated, but got:", string(headerData))
+	}
+
+	var bodyData = []byte{}
+	err = reader.ReadBody(buf, func(n int) (goNext bool, err error) {
+		bodyData = append(bodyData, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bodyData) != "Hello, World" {
+		t.Fatal("body should not be changed, but got:", string(bodyData))
+	}
+	t.Log("ok")
+}
+
 func TestFileStorage_Stat(t *testing.T) {
 	storage := NewFileStorage(&serverconfigs.HTTPCachePolicy{
 		Id:   1,
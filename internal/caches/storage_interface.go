@@ -22,6 +22,10 @@ type StorageInterface interface {
 	// Delete 删除某个键值对应的缓存
 	Delete(key string) error
 
+	// UpdateExpiresAt 修改缓存的过期时间，不改变缓存内容
+	// headerData 不为空时同时替换缓存中的Header
+	UpdateExpiresAt(key string, expiresAt int64, staleAt int64, headerData []byte) error
+
 	// Stat 统计缓存
 	Stat() (*Stat, error)
 
@@ -35,7 +39,7 @@ type StorageInterface interface {
 	CleanAll() error
 
 	// Purge 批量删除缓存
-	// urlType 值为file|dir
+	// urlType 值为file|dir|tag，为tag时 keys 为要清除的标签
 	Purge(keys []string, urlType string) error
 
 	// Stop 停止缓存策略
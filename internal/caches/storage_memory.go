@@ -120,6 +120,15 @@ func (this *MemoryStorage) OpenReader(key string, useStale bool, isPartial bool)
 	}
 
 	if useStale || (item.ExpiresAt > utils.UnixTime()) {
+		// 已在列表中被清除（比如按标签清除），但仍保留为陈旧内容
+		if !useStale {
+			memoryList, ok := this.list.(*MemoryList)
+			if ok && memoryList.IsCleaned(types.String(hash)) {
+				this.locker.RUnlock()
+				return nil, ErrNotFound
+			}
+		}
+
 		reader := NewMemoryReader(item)
 		err := reader.Init()
 		if err != nil {
@@ -238,6 +247,24 @@ func (this *MemoryStorage) Delete(key string) error {
 	return nil
 }
 
+// UpdateExpiresAt 修改缓存的过期时间，不改变缓存内容
+// headerData 不为空时同时替换缓存中的Header
+func (this *MemoryStorage) UpdateExpiresAt(key string, expiresAt int64, staleAt int64, headerData []byte) error {
+	var hash = this.hash(key)
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	item, ok := this.valuesMap[hash]
+	if !ok || !item.IsDone {
+		return ErrNotFound
+	}
+	item.ExpiresAt = expiresAt
+	if len(headerData) > 0 {
+		item.HeaderValue = append([]byte{}, headerData...)
+	}
+	return this.list.UpdateExpiredAt(types.String(hash), expiresAt, staleAt)
+}
+
 // Stat 统计缓存
 func (this *MemoryStorage) Stat() (*Stat, error) {
 	this.locker.RLock()
@@ -260,6 +287,18 @@ func (this *MemoryStorage) CleanAll() error {
 
 // Purge 批量删除缓存
 func (this *MemoryStorage) Purge(keys []string, urlType string) error {
+	// 标签
+	if urlType == "tag" {
+		var staleLife = SharedManager.FindPolicyOptions(this.policy.Id).Freshness.StaleLifeSeconds
+		for _, key := range keys {
+			err := this.list.CleanTag(key, staleLife)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	// 目录
 	if urlType == "dir" {
 		for _, key := range keys {
@@ -303,6 +342,27 @@ func (this *MemoryStorage) Purge(keys []string, urlType string) error {
 		if err != nil {
 			return err
 		}
+
+		// 同时清除Vary变体
+		if !strings.Contains(key, SuffixVary) {
+			this.locker.RLock()
+			_, hasVariants := this.valuesMap[this.hash(VaryMarkerKey(key))]
+			this.locker.RUnlock()
+			if hasVariants {
+				err = this.list.CleanPrefix(VaryMarkerKey(key))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// 同时清除分片
+		if SharedManager.FindPolicyOptions(this.policy.Id).Slice.IsOn && !strings.Contains(key, SuffixSlice) {
+			err = this.list.CleanPrefix(key + SuffixSlice)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -548,6 +608,7 @@ func (this *MemoryStorage) flushItem(key string) {
 		ExpiredAt:  item.ExpiresAt,
 		HeaderSize: writer.HeaderSize(),
 		BodySize:   writer.BodySize(),
+		Tags:       ParseCacheTagsFromHeaderData(item.HeaderValue),
 	})
 
 	// 从内存中移除
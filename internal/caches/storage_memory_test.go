@@ -13,6 +13,43 @@ import (
 	"time"
 )
 
+func TestMemoryStorage_UpdateExpiresAt(t *testing.T) {
+	var storage = NewMemoryStorage(&serverconfigs.HTTPCachePolicy{}, nil)
+	_ = storage.Init()
+	defer storage.Stop()
+
+	var expiresAt = time.Now().Unix() - 10
+	writer, err := storage.OpenWriter("abc", expiresAt, 200, -1, -1, -1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = writer.WriteHeader([]byte("Etag:\"1\"\n"))
+	_, _ = writer.Write([]byte("Hello"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.UpdateExpiresAt("abc", time.Now().Unix()+60, time.Now().Unix()+120, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := storage.OpenReader("abc", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("expires at:", reader.ExpiresAt())
+	if reader.ExpiresAt() <= expiresAt {
+		t.Fatal("expiresAt should be updated")
+	}
+
+	err = storage.UpdateExpiresAt("not-found", time.Now().Unix()+60, time.Now().Unix()+120, nil)
+	if err != ErrNotFound {
+		t.Fatal("should return ErrNotFound")
+	}
+}
+
 func TestMemoryStorage_OpenWriter(t *testing.T) {
 	var storage = NewMemoryStorage(&serverconfigs.HTTPCachePolicy{}, nil)
 
@@ -0,0 +1,697 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	setutils "github.com/TeaOSLab/EdgeNode/internal/utils/sets"
+	"github.com/TeaOSLab/EdgeNode/internal/zero"
+	"github.com/go-redis/redis/v8"
+	"github.com/iwind/TeaGo/types"
+	stringutil "github.com/iwind/TeaGo/utils/string"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachePolicyStorageRedis 使用Redis协议服务器作为缓存存储
+const CachePolicyStorageRedis = "redis"
+
+const (
+	redisFieldKey        = "key"
+	redisFieldStatus     = "status"
+	redisFieldExpiresAt  = "expiresAt"
+	redisFieldModifiedAt = "modifiedAt"
+	redisFieldHeader     = "header"
+	redisFieldBodySize   = "bodySize"
+	redisFieldChunkSize  = "chunkSize"
+	redisFieldVersion    = "version"
+
+	redisOldChunksLifeSeconds = 60 // 覆盖写入后旧的分块保留时间，以便于正在读取的请求可以读完
+)
+
+const (
+	redisNamespaceHash  = "h:" // 缓存项
+	redisNamespaceChunk = "c:" // 内容分块
+	redisNamespaceTag   = "t:" // 标签
+
+	redisKeyIndex    = redisNamespaceHash + "index" // 缓存项索引
+	redisKeyTagIndex = redisNamespaceHash + "tags"  // 标签索引
+)
+
+// RedisStorageOptions Redis存储选项
+type RedisStorageOptions struct {
+	Network        string `json:"network"`        // tcp|unix
+	Addr           string `json:"addr"`           // 地址，比如 127.0.0.1:6379
+	Username       string `json:"username"`       // 用户名
+	Password       string `json:"password"`       // 密码
+	DB             int    `json:"db"`             // 数据库
+	KeyPrefix      string `json:"keyPrefix"`      // Key前缀，多个策略共用一个服务器时需要设置不同的前缀
+	ChunkSize      int    `json:"chunkSize"`      // 内容分块尺寸
+	PoolSize       int    `json:"poolSize"`       // 连接池尺寸
+	TimeoutSeconds int    `json:"timeoutSeconds"` // 读写超时时间
+}
+
+func (this *RedisStorageOptions) Init() error {
+	if len(this.Addr) == 0 {
+		return errors.New("redis address should not be empty")
+	}
+	if len(this.Network) == 0 {
+		this.Network = "tcp"
+	}
+	if len(this.KeyPrefix) == 0 {
+		this.KeyPrefix = "GOEDGE_CACHE_"
+	}
+	if this.ChunkSize <= 0 {
+		this.ChunkSize = 128 << 10
+	}
+	if this.TimeoutSeconds <= 0 {
+		this.TimeoutSeconds = 3
+	}
+	return nil
+}
+
+// RedisStorage 使用Redis协议服务器的缓存存储
+// 同一台主机或者同一个机柜中的多个节点可以共享同一个服务器中的缓存
+//
+// 每个缓存项由一个Hash和若干个内容分块组成：
+//   - {prefix}h:{hash} 保存状态码、Header、过期时间等信息
+//   - {prefix}c:{hash}:{version}:{index} 保存内容分块，每次写入使用新的version，以免读取到不完整的内容
+//   - {prefix}t:{tag} 保存某个标签下的缓存Hash列表
+//   - {prefix}h:index 有序集合，保存当前策略所有的缓存Hash，Score为缓存项在服务器中的过期时间
+//   - {prefix}h:tags 保存当前策略用到的所有标签
+//
+// 统计、清除时只遍历索引中的缓存项，不需要遍历服务器中所有的Key，以免影响共用服务器的其他策略和应用
+type RedisStorage struct {
+	policy  *serverconfigs.HTTPCachePolicy
+	options *RedisStorageOptions
+	client  *redis.Client
+
+	writingKeyMap map[string]zero.Zero // key => Zero
+	locker        sync.Mutex
+
+	ignoreKeys *setutils.FixedSet
+}
+
+func NewRedisStorage(policy *serverconfigs.HTTPCachePolicy) *RedisStorage {
+	return &RedisStorage{
+		policy:        policy,
+		writingKeyMap: map[string]zero.Zero{},
+		ignoreKeys:    setutils.NewFixedSet(32768),
+	}
+}
+
+// Init 初始化
+func (this *RedisStorage) Init() error {
+	options, err := this.decodeOptions(this.policy)
+	if err != nil {
+		return err
+	}
+	this.options = options
+
+	var timeout = time.Duration(options.TimeoutSeconds) * time.Second
+	this.client = redis.NewClient(&redis.Options{
+		Network:      options.Network,
+		Addr:         options.Addr,
+		Username:     options.Username,
+		Password:     options.Password,
+		DB:           options.DB,
+		PoolSize:     options.PoolSize,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	})
+
+	// 检查连接，连接失败时仍然可以使用，等待服务器恢复
+	err = this.client.Ping(context.Background()).Err()
+	if err != nil {
+		remotelogs.Warn("CACHE", "connect to redis '"+options.Addr+"' failed: "+err.Error())
+	}
+
+	return nil
+}
+
+// OpenReader 读取缓存
+func (this *RedisStorage) OpenReader(key string, useStale bool, isPartial bool) (Reader, error) {
+	if isPartial {
+		return nil, ErrNotFound
+	}
+
+	var ctx = context.Background()
+	values, err := this.client.HGetAll(ctx, this.metaKey(key)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 || values[redisFieldKey] != key {
+		return nil, ErrNotFound
+	}
+
+	var reader = NewRedisReader(this, values)
+	err = reader.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	if !useStale && reader.ExpiresAt() <= time.Now().Unix() {
+		return nil, ErrNotFound
+	}
+
+	return reader, nil
+}
+
+// OpenWriter 打开缓存写入器等待写入
+func (this *RedisStorage) OpenWriter(key string, expiresAt int64, status int, headerSize int, bodySize int64, maxSize int64, isPartial bool) (Writer, error) {
+	// 不支持区间内容
+	if isPartial {
+		return nil, ErrWritingUnavailable
+	}
+
+	if this.ignoreKeys.Has(key) {
+		return nil, ErrEntityTooLarge
+	}
+
+	// 检查尺寸
+	if maxSize > 0 && bodySize > maxSize {
+		return nil, ErrEntityTooLarge
+	}
+	var maxPolicySize = this.policy.MaxSizeBytes()
+	if maxPolicySize > 0 && (maxSize <= 0 || maxSize > maxPolicySize) {
+		maxSize = maxPolicySize
+	}
+
+	// 是否正在写入
+	this.locker.Lock()
+	_, ok := this.writingKeyMap[key]
+	if ok {
+		this.locker.Unlock()
+		return nil, ErrFileIsWriting
+	}
+	this.writingKeyMap[key] = zero.New()
+	this.locker.Unlock()
+
+	return NewRedisWriter(this, key, expiresAt, status, maxSize, func() {
+		this.locker.Lock()
+		delete(this.writingKeyMap, key)
+		this.locker.Unlock()
+	}), nil
+}
+
+// OpenFlushWriter 打开从其他媒介直接刷入的写入器
+func (this *RedisStorage) OpenFlushWriter(key string, expiresAt int64, status int, headerSize int, bodySize int64) (Writer, error) {
+	return this.OpenWriter(key, expiresAt, status, headerSize, bodySize, -1, false)
+}
+
+// Delete 删除某个键值对应的缓存
+func (this *RedisStorage) Delete(key string) error {
+	return this.deleteHash(context.Background(), this.hash(key))
+}
+
+// UpdateExpiresAt 修改缓存的过期时间，不改变缓存内容
+// headerData 不为空时同时替换缓存中的Header
+func (this *RedisStorage) UpdateExpiresAt(key string, expiresAt int64, staleAt int64, headerData []byte) error {
+	var ctx = context.Background()
+	var metaKey = this.metaKey(key)
+	values, err := this.client.HMGet(ctx, metaKey, redisFieldKey, redisFieldVersion, redisFieldBodySize, redisFieldChunkSize).Result()
+	if err != nil {
+		return err
+	}
+	if types.String(values[0]) != key {
+		return ErrNotFound
+	}
+
+	var fields = []interface{}{redisFieldExpiresAt, expiresAt}
+	if len(headerData) > 0 {
+		fields = append(fields, redisFieldHeader, headerData)
+	}
+	err = this.client.HSet(ctx, metaKey, fields...).Err()
+	if err != nil {
+		return err
+	}
+
+	return this.expireItem(ctx, this.hash(key), types.String(values[1]), types.Int64(values[2]), types.Int64(values[3]), staleAt)
+}
+
+// Stat 统计缓存
+func (this *RedisStorage) Stat() (*Stat, error) {
+	var ctx = context.Background()
+	var stat = &Stat{}
+	err := this.scanHashes(ctx, func(hash string) error {
+		values, err := this.client.HMGet(ctx, this.hashKey(hash), redisFieldHeader, redisFieldBodySize, redisFieldExpiresAt).Result()
+		if err != nil {
+			return err
+		}
+		if types.Int64(values[2]) <= time.Now().Unix() {
+			return nil
+		}
+		var headerSize = int64(len(types.String(values[0])))
+		var bodySize = types.Int64(values[1])
+		stat.Count++
+		stat.ValueSize += headerSize + bodySize
+		stat.Size += headerSize + bodySize
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+// TotalDiskSize 消耗的磁盘尺寸
+func (this *RedisStorage) TotalDiskSize() int64 {
+	return 0
+}
+
+// TotalMemorySize 内存尺寸
+// 内容保存在其他服务器中，所以这里不计算
+func (this *RedisStorage) TotalMemorySize() int64 {
+	return 0
+}
+
+// CleanAll 清除所有缓存
+// 只清除索引中的缓存项和标签，不影响共用服务器的其他Key
+func (this *RedisStorage) CleanAll() error {
+	var ctx = context.Background()
+	var indexKey = this.indexKey()
+	for {
+		hashList, err := this.client.ZRange(ctx, indexKey, 0, 999).Result()
+		if err != nil {
+			return err
+		}
+		if len(hashList) == 0 {
+			break
+		}
+		for _, hash := range hashList {
+			err = this.deleteHash(ctx, hash)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// 标签
+	var tagIndexKey = this.tagIndexKey()
+	tags, err := this.client.SMembers(ctx, tagIndexKey).Result()
+	if err != nil {
+		return err
+	}
+	var keys = []string{indexKey, tagIndexKey}
+	for _, tag := range tags {
+		keys = append(keys, this.tagKey(tag))
+	}
+	return this.client.Del(ctx, keys...).Err()
+}
+
+// Purge 批量删除缓存
+func (this *RedisStorage) Purge(keys []string, urlType string) error {
+	var ctx = context.Background()
+
+	// 标签
+	if urlType == "tag" {
+		for _, tag := range keys {
+			var tagKey = this.tagKey(tag)
+			hashList, err := this.client.SMembers(ctx, tagKey).Result()
+			if err != nil {
+				return err
+			}
+			for _, hash := range hashList {
+				err = this.expireHash(ctx, hash)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = this.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, tagKey)
+				pipe.SRem(ctx, this.tagIndexKey(), tag)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// 目录
+	if urlType == "dir" {
+		return this.scanHashes(ctx, func(hash string) error {
+			itemKey, err := this.client.HGet(ctx, this.hashKey(hash), redisFieldKey).Result()
+			if err != nil {
+				if err == redis.Nil {
+					return nil
+				}
+				return err
+			}
+			for _, key := range keys {
+				if redisMatchPrefix(itemKey, key) {
+					return this.expireHash(ctx, hash)
+				}
+			}
+			return nil
+		})
+	}
+
+	// URL
+	for _, key := range keys {
+		// 检查是否有通配符 http(s)://*.example.com
+		var schemeIndex = strings.Index(key, "://")
+		if schemeIndex > 0 {
+			var keyRight = key[schemeIndex+3:]
+			if strings.HasPrefix(keyRight, "*.") {
+				var matchKey = key
+				err := this.scanHashes(ctx, func(hash string) error {
+					itemKey, err := this.client.HGet(ctx, this.hashKey(hash), redisFieldKey).Result()
+					if err != nil {
+						if err == redis.Nil {
+							return nil
+						}
+						return err
+					}
+					if redisMatchKey(itemKey, matchKey) {
+						return this.expireHash(ctx, hash)
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		err := this.Delete(key)
+		if err != nil {
+			return err
+		}
+
+		// 同时清除Vary变体
+		if !strings.Contains(key, SuffixVary) {
+			hasVariants, err := this.client.Exists(ctx, this.metaKey(VaryMarkerKey(key))).Result()
+			if err != nil {
+				return err
+			}
+			if hasVariants > 0 {
+				err = this.Purge([]string{VaryMarkerKey(key)}, "dir")
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// 同时清除分片
+		if SharedManager.FindPolicyOptions(this.policy.Id).Slice.IsOn && !strings.Contains(key, SuffixSlice) {
+			err = this.Purge([]string{key + SuffixSlice}, "dir")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stop 停止缓存策略
+func (this *RedisStorage) Stop() {
+	this.locker.Lock()
+	this.writingKeyMap = map[string]zero.Zero{}
+	this.locker.Unlock()
+
+	this.ignoreKeys.Reset()
+
+	if this.client != nil {
+		_ = this.client.Close()
+	}
+
+	remotelogs.Println("CACHE", "close redis storage '"+strconv.FormatInt(this.policy.Id, 10)+"'")
+}
+
+// Policy 获取当前存储的Policy
+func (this *RedisStorage) Policy() *serverconfigs.HTTPCachePolicy {
+	return this.policy
+}
+
+// UpdatePolicy 修改策略
+func (this *RedisStorage) UpdatePolicy(newPolicy *serverconfigs.HTTPCachePolicy) {
+	this.policy = newPolicy
+}
+
+// CanUpdatePolicy 检查策略是否可以更新
+// 服务器连接信息有变化时需要重新创建存储
+func (this *RedisStorage) CanUpdatePolicy(newPolicy *serverconfigs.HTTPCachePolicy) bool {
+	newOptions, err := this.decodeOptions(newPolicy)
+	if err != nil {
+		return false
+	}
+	oldOptionsJSON, err := json.Marshal(this.options)
+	if err != nil {
+		return false
+	}
+	newOptionsJSON, err := json.Marshal(newOptions)
+	if err != nil {
+		return false
+	}
+	return string(oldOptionsJSON) == string(newOptionsJSON)
+}
+
+// AddToList 将缓存添加到列表
+// 这里设置缓存在服务器中的存活时间，并记录标签
+func (this *RedisStorage) AddToList(item *Item) {
+	var ctx = context.Background()
+	var hash = this.hash(item.Key)
+
+	values, err := this.client.HMGet(ctx, this.hashKey(hash), redisFieldKey, redisFieldVersion, redisFieldBodySize, redisFieldChunkSize).Result()
+	if err != nil || types.String(values[0]) != item.Key {
+		return
+	}
+
+	var staleAt = item.StaleAt
+	if staleAt < item.ExpiredAt {
+		staleAt = item.ExpiredAt
+	}
+	err = this.expireItem(ctx, hash, types.String(values[1]), types.Int64(values[2]), types.Int64(values[3]), staleAt)
+	if err != nil {
+		remotelogs.Error("CACHE", "add to list failed: "+err.Error())
+		return
+	}
+
+	if len(item.Tags) > 0 {
+		_, err = this.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, tag := range item.Tags {
+				var tagKey = this.tagKey(tag)
+				pipe.SAdd(ctx, tagKey, hash)
+				pipe.Expire(ctx, tagKey, time.Duration(staleAt-time.Now().Unix()+3600)*time.Second)
+				pipe.SAdd(ctx, this.tagIndexKey(), tag)
+			}
+			return nil
+		})
+		if err != nil {
+			remotelogs.Error("CACHE", "add tags failed: "+err.Error())
+		}
+	}
+}
+
+// IgnoreKey 忽略某个Key，即不缓存某个Key
+func (this *RedisStorage) IgnoreKey(key string) {
+	this.ignoreKeys.Push(key)
+}
+
+// CanSendfile 是否支持Sendfile
+func (this *RedisStorage) CanSendfile() bool {
+	return false
+}
+
+// 解析选项
+func (this *RedisStorage) decodeOptions(policy *serverconfigs.HTTPCachePolicy) (*RedisStorageOptions, error) {
+	var options = &RedisStorageOptions{}
+	optionsJSON, err := json.Marshal(policy.Options)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(optionsJSON, options)
+	if err != nil {
+		return nil, err
+	}
+	err = options.Init()
+	if err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// 计算Key Hash
+func (this *RedisStorage) hash(key string) string {
+	return stringutil.Md5(key)
+}
+
+// 保存缓存信息的Key
+func (this *RedisStorage) metaKey(key string) string {
+	return this.hashKey(this.hash(key))
+}
+
+// 缓存Hash对应的Key
+func (this *RedisStorage) hashKey(hash string) string {
+	return this.options.KeyPrefix + redisNamespaceHash + hash
+}
+
+// 内容分块的Key
+func (this *RedisStorage) chunkKey(hash string, version string, index int64) string {
+	return this.options.KeyPrefix + redisNamespaceChunk + hash + ":" + version + ":" + strconv.FormatInt(index, 10)
+}
+
+// 标签Key
+func (this *RedisStorage) tagKey(tag string) string {
+	return this.options.KeyPrefix + redisNamespaceTag + tag
+}
+
+// 缓存项索引Key
+func (this *RedisStorage) indexKey() string {
+	return this.options.KeyPrefix + redisKeyIndex
+}
+
+// 标签索引Key
+func (this *RedisStorage) tagIndexKey() string {
+	return this.options.KeyPrefix + redisKeyTagIndex
+}
+
+// 所有的分块Key
+func (this *RedisStorage) chunkKeys(hash string, version string, bodySize int64, chunkSize int64) []string {
+	if len(version) == 0 || bodySize <= 0 || chunkSize <= 0 {
+		return nil
+	}
+	var result = []string{}
+	var count = (bodySize + chunkSize - 1) / chunkSize
+	for i := int64(0); i < count; i++ {
+		result = append(result, this.chunkKey(hash, version, i))
+	}
+	return result
+}
+
+// 设置缓存项在服务器中的存活时间
+func (this *RedisStorage) expireItem(ctx context.Context, hash string, version string, bodySize int64, chunkSize int64, staleAt int64) error {
+	var t = time.Unix(staleAt, 0)
+	_, err := this.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ExpireAt(ctx, this.hashKey(hash), t)
+		for _, chunkKey := range this.chunkKeys(hash, version, bodySize, chunkSize) {
+			pipe.ExpireAt(ctx, chunkKey, t)
+		}
+		pipe.ZAdd(ctx, this.indexKey(), &redis.Z{
+			Score:  float64(staleAt),
+			Member: hash,
+		})
+		return nil
+	})
+	return err
+}
+
+// 将缓存项设置为过期，陈旧内容仍然可以使用
+func (this *RedisStorage) expireHash(ctx context.Context, hash string) error {
+	var metaKey = this.hashKey(hash)
+	exists, err := this.client.Exists(ctx, metaKey).Result()
+	if err != nil || exists == 0 {
+		return err
+	}
+	return this.client.HSet(ctx, metaKey, redisFieldExpiresAt, 0).Err()
+}
+
+// 删除缓存项
+func (this *RedisStorage) deleteHash(ctx context.Context, hash string) error {
+	var metaKey = this.hashKey(hash)
+	values, err := this.client.HMGet(ctx, metaKey, redisFieldVersion, redisFieldBodySize, redisFieldChunkSize).Result()
+	if err != nil {
+		return err
+	}
+	var keys = append([]string{metaKey}, this.chunkKeys(hash, types.String(values[0]), types.Int64(values[1]), types.Int64(values[2]))...)
+	_, err = this.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		pipe.ZRem(ctx, this.indexKey(), hash)
+		return nil
+	})
+	return err
+}
+
+// 遍历所有的缓存项
+// 从缓存项索引中读取，并先清除索引中已经在服务器中过期的缓存项
+func (this *RedisStorage) scanHashes(ctx context.Context, f func(hash string) error) error {
+	var indexKey = this.indexKey()
+	err := this.client.ZRemRangeByScore(ctx, indexKey, "-inf", "("+strconv.FormatInt(time.Now().Unix(), 10)).Err()
+	if err != nil {
+		return err
+	}
+
+	var cursor uint64
+	for {
+		// 返回的结果中Member和Score交替出现
+		members, nextCursor, err := this.client.ZScan(ctx, indexKey, cursor, "", 1000).Result()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(members); i += 2 {
+			err = f(members[i])
+			if err != nil {
+				return err
+			}
+		}
+		if nextCursor == 0 {
+			break
+		}
+		cursor = nextCursor
+	}
+	return nil
+}
+
+// 检查缓存Key是否匹配目录
+func redisMatchPrefix(itemKey string, prefix string) bool {
+	// 检查是否有通配符 http(s)://*.example.com
+	var schemeIndex = strings.Index(prefix, "://")
+	if schemeIndex > 0 && strings.HasPrefix(prefix[schemeIndex+3:], "*.") {
+		host, requestURI, ok := redisParseKey(prefix)
+		if !ok {
+			return false
+		}
+		itemHost, itemRequestURI, ok := redisParseKey(itemKey)
+		if !ok || !configutils.MatchDomain(host, itemHost) {
+			return false
+		}
+		return requestURI == "/" || strings.HasPrefix(itemRequestURI, requestURI)
+	}
+	return strings.HasPrefix(itemKey, prefix)
+}
+
+// 检查缓存Key是否匹配通配符Key
+func redisMatchKey(itemKey string, key string) bool {
+	if strings.Contains(key, SuffixAll) {
+		return false
+	}
+	host, requestURI, ok := redisParseKey(key)
+	if !ok {
+		return false
+	}
+	itemHost, itemRequestURI, ok := redisParseKey(itemKey)
+	if !ok || !configutils.MatchDomain(host, itemHost) {
+		return false
+	}
+	return itemRequestURI == requestURI || strings.HasPrefix(itemRequestURI, requestURI+SuffixAll)
+}
+
+// 从Key中分析主机名和路径
+func redisParseKey(key string) (host string, requestURI string, ok bool) {
+	u, err := url.Parse(key)
+	if err != nil {
+		return "", "", false
+	}
+	host = u.Host
+	hostPart, _, err := net.SplitHostPort(host)
+	if err == nil && len(hostPart) > 0 {
+		host = hostPart
+	}
+	if len(host) == 0 {
+		return "", "", false
+	}
+	return host, u.RequestURI(), true
+}
@@ -0,0 +1,341 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRedisStorage(t *testing.T) (*RedisStorage, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var storage = NewRedisStorage(&serverconfigs.HTTPCachePolicy{
+		Id:   1,
+		IsOn: true,
+		Options: map[string]interface{}{
+			"addr":      server.Addr(),
+			"chunkSize": 4,
+		},
+	})
+	err = storage.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage, server
+}
+
+func writeTestRedisItem(t *testing.T, storage *RedisStorage, key string, expiresAt int64, header string, body string) {
+	writer, err := storage.OpenWriter(key, expiresAt, 200, -1, -1, -1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.WriteHeader([]byte(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisStorage_OpenWriter(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	storage, server := newTestRedisStorage(t)
+	defer server.Close()
+	defer storage.Stop()
+
+	var key = "https://example.com/hello"
+	writeTestRedisItem(t, storage, key, time.Now().Unix()+60, "Content-Type:text/plain", "Hello, World")
+
+	reader, err := storage.OpenReader(key, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	a.IsTrue(reader.Status() == 200)
+	a.IsTrue(reader.BodySize() == 12)
+
+	var buf = make([]byte, 5)
+	var header = []byte{}
+	err = reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+		header = append(header, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(string(header) == "Content-Type:text/plain")
+
+	var body = []byte{}
+	err = reader.ReadBody(buf, func(n int) (goNext bool, err error) {
+		body = append(body, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(string(body) == "Hello, World")
+
+	// 内容分块
+	a.IsTrue(len(storage.chunkKeys(storage.hash(key), reader.(*RedisReader).version, 12, 4)) == 3)
+
+	// 重复写入
+	writer, err := storage.OpenWriter(key, time.Now().Unix()+60, 200, -1, -1, -1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.OpenWriter(key, time.Now().Unix()+60, 200, -1, -1, -1, false)
+	a.IsTrue(err == ErrFileIsWriting)
+	_ = writer.Discard()
+}
+
+func TestRedisReader_Read(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	storage, server := newTestRedisStorage(t)
+	defer server.Close()
+	defer storage.Stop()
+
+	var key = "https://example.com/read"
+	writeTestRedisItem(t, storage, key, time.Now().Unix()+60, "", "0123456789")
+
+	reader, err := storage.OpenReader(key, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(string(data) == "0123456789")
+}
+
+func TestRedisReader_ReadBodyRange(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	storage, server := newTestRedisStorage(t)
+	defer server.Close()
+	defer storage.Stop()
+
+	var key = "https://example.com/range"
+	writeTestRedisItem(t, storage, key, time.Now().Unix()+60, "", "0123456789")
+
+	reader, err := storage.OpenReader(key, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var readRange = func(start int64, end int64) string {
+		var buf = make([]byte, 3)
+		var result = &bytes.Buffer{}
+		err := reader.ReadBodyRange(buf, start, end, func(n int) (goNext bool, err error) {
+			result.Write(buf[:n])
+			return true, nil
+		})
+		if err != nil {
+			return err.Error()
+		}
+		return result.String()
+	}
+
+	a.IsTrue(readRange(2, 6) == "23456")
+	a.IsTrue(readRange(7, -1) == "789")
+	a.IsTrue(readRange(-1, -3) == "789")
+	a.IsTrue(readRange(3, 100) == "3456789")
+	a.IsTrue(readRange(8, 2) == ErrInvalidRange.Error())
+}
+
+func TestRedisStorage_Expires(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	storage, server := newTestRedisStorage(t)
+	defer server.Close()
+	defer storage.Stop()
+
+	var key = "https://example.com/expires"
+	writeTestRedisItem(t, storage, key, time.Now().Unix()-1, "", "hello")
+
+	_, err := storage.OpenReader(key, false, false)
+	a.IsTrue(err == ErrNotFound)
+
+	reader, err := storage.OpenReader(key, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = reader.Close()
+
+	var expiresAt = time.Now().Unix() + 60
+	err = storage.UpdateExpiresAt(key, expiresAt, expiresAt+60, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err = storage.OpenReader(key, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(reader.ExpiresAt() == expiresAt)
+
+	a.IsTrue(storage.UpdateExpiresAt("https://example.com/none", expiresAt, expiresAt, nil) == ErrNotFound)
+}
+
+func TestRedisStorage_Purge(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	storage, server := newTestRedisStorage(t)
+	defer server.Close()
+	defer storage.Stop()
+
+	var expiresAt = time.Now().Unix() + 60
+	for _, key := range []string{"https://example.com/a", "https://example.com/b/1", "https://example.com/b/2", "https://www.example.com/c"} {
+		writeTestRedisItem(t, storage, key, expiresAt, "", "hello")
+	}
+	storage.AddToList(&Item{
+		Key:       "https://example.com/a",
+		ExpiredAt: expiresAt,
+		StaleAt:   expiresAt + 60,
+		Tags:      []string{"product"},
+	})
+
+	// 标签Key不能影响遍历缓存项
+	storage.AddToList(&Item{
+		Key:       "https://example.com/b/1",
+		ExpiredAt: expiresAt,
+		StaleAt:   expiresAt + 60,
+		Tags:      []string{strings.Repeat("t", 28), strings.Repeat("t", 30)},
+	})
+
+	var isFresh = func(key string) bool {
+		reader, err := storage.OpenReader(key, false, false)
+		if err != nil {
+			return false
+		}
+		_ = reader.Close()
+		return true
+	}
+
+	// 标签
+	err := storage.Purge([]string{"product"}, "tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsFalse(isFresh("https://example.com/a"))
+	a.IsTrue(isFresh("https://example.com/b/1"))
+
+	// 目录
+	err = storage.Purge([]string{"https://example.com/b/"}, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsFalse(isFresh("https://example.com/b/1"))
+	a.IsFalse(isFresh("https://example.com/b/2"))
+	a.IsTrue(isFresh("https://www.example.com/c"))
+
+	// 通配符
+	err = storage.Purge([]string{"https://*.example.com/c"}, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsFalse(isFresh("https://www.example.com/c"))
+
+	stat, err := storage.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(stat.Count == 0)
+
+	err = storage.CleanAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(server.Keys()) == 0)
+}
+
+func TestRedisStorage_ForeignKeys(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	storage, server := newTestRedisStorage(t)
+	defer server.Close()
+	defer storage.Stop()
+
+	// 共用服务器的其他策略和应用
+	var otherStorage = NewRedisStorage(&serverconfigs.HTTPCachePolicy{
+		Id:   2,
+		IsOn: true,
+		Options: map[string]interface{}{
+			"addr":      server.Addr(),
+			"chunkSize": 4,
+			"keyPrefix": "GOEDGE_CACHE_2_",
+		},
+	})
+	err := otherStorage.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherStorage.Stop()
+
+	var expiresAt = time.Now().Unix() + 60
+	writeTestRedisItem(t, otherStorage, "https://example.com/a", expiresAt, "", "hello")
+	_ = server.Set("GOEDGE_CACHE_h:"+strings.Repeat("f", 32), "foreign")
+	_ = server.Set("session:1", "foreign")
+
+	for _, key := range []string{"https://example.com/a", "https://example.com/b"} {
+		writeTestRedisItem(t, storage, key, expiresAt, "", "hello")
+	}
+	storage.AddToList(&Item{
+		Key:       "https://example.com/a",
+		ExpiredAt: expiresAt,
+		StaleAt:   expiresAt + 60,
+		Tags:      []string{"product"},
+	})
+
+	stat, err := storage.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(stat.Count == 2)
+
+	err = storage.Purge([]string{"https://example.com/"}, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := otherStorage.OpenReader("https://example.com/a", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = reader.Close()
+
+	err = storage.CleanAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(server.Exists("GOEDGE_CACHE_h:" + strings.Repeat("f", 32)))
+	a.IsTrue(server.Exists("session:1"))
+	for _, key := range server.Keys() {
+		a.IsFalse(strings.HasPrefix(key, "GOEDGE_CACHE_h:") && key != "GOEDGE_CACHE_h:"+strings.Repeat("f", 32))
+		a.IsFalse(strings.HasPrefix(key, "GOEDGE_CACHE_c:") || strings.HasPrefix(key, "GOEDGE_CACHE_t:"))
+	}
+
+	stat, err = otherStorage.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(stat.Count == 1)
+}
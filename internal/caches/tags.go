@@ -0,0 +1,57 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"bytes"
+	"github.com/iwind/TeaGo/lists"
+	"net/http"
+	"strings"
+)
+
+const (
+	MaxCacheTags      = 64  // 每个缓存项最多的标签数
+	MaxCacheTagLength = 128 // 单个标签的最大长度
+)
+
+// ParseCacheTags 从响应Header中读取缓存标签
+// Surrogate-Key 以空格分隔，Cache-Tag 以逗号分隔
+func ParseCacheTags(header http.Header) (tags []string) {
+	var addTag = func(tag string) {
+		tag = strings.TrimSpace(tag)
+		if len(tag) == 0 || len(tag) > MaxCacheTagLength || len(tags) >= MaxCacheTags {
+			return
+		}
+		if !lists.ContainsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	for _, value := range header.Values("Surrogate-Key") {
+		for _, tag := range strings.Fields(value) {
+			addTag(tag)
+		}
+	}
+	for _, value := range header.Values("Cache-Tag") {
+		for _, tag := range strings.Split(value, ",") {
+			addTag(tag)
+		}
+	}
+	return
+}
+
+// ParseCacheTagsFromHeaderData 从缓存的Header数据中读取缓存标签
+func ParseCacheTagsFromHeaderData(data []byte) []string {
+	var header = http.Header{}
+	for _, row := range bytes.Split(data, []byte{'\n'}) {
+		var index = bytes.IndexByte(row, ':')
+		if index <= 0 {
+			continue
+		}
+		var name = http.CanonicalHeaderKey(string(row[:index]))
+		if name == "Surrogate-Key" || name == "Cache-Tag" {
+			header.Add(name, string(row[index+1:]))
+		}
+	}
+	return ParseCacheTags(header)
+}
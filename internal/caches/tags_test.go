@@ -0,0 +1,54 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseCacheTags(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var tags = caches.ParseCacheTags(http.Header{})
+		a.IsTrue(len(tags) == 0)
+	}
+
+	{
+		var tags = caches.ParseCacheTags(http.Header{
+			"Surrogate-Key": []string{" product-1  product-2 ", "product-1"},
+			"Cache-Tag":     []string{"list, product-2,,home"},
+		})
+		t.Log(tags)
+		a.IsTrue(strings.Join(tags, ",") == "product-1,product-2,list,home")
+	}
+
+	{
+		var tags = caches.ParseCacheTags(http.Header{
+			"Cache-Tag": []string{strings.Repeat("a", caches.MaxCacheTagLength+1) + ",b"},
+		})
+		a.IsTrue(strings.Join(tags, ",") == "b")
+	}
+
+	{
+		var values = []string{}
+		for i := 0; i < caches.MaxCacheTags+10; i++ {
+			values = append(values, "tag"+strings.Repeat("x", i))
+		}
+		var tags = caches.ParseCacheTags(http.Header{
+			"Surrogate-Key": []string{strings.Join(values, " ")},
+		})
+		a.IsTrue(len(tags) == caches.MaxCacheTags)
+	}
+}
+
+func TestParseCacheTagsFromHeaderData(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var tags = caches.ParseCacheTagsFromHeaderData([]byte("Content-Type:text/html\nsurrogate-key:a b\nCache-Tag:c\n"))
+	a.IsTrue(strings.Join(tags, ",") == "a,b,c")
+}
@@ -0,0 +1,239 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"bytes"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fnv"
+	"github.com/iwind/TeaGo/lists"
+	"github.com/iwind/TeaGo/types"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrTooManyVariants = errors.New("too many variants")
+
+// 用来串行化同一个Key的Vary信息的更新
+var varyMarkerLockers = make([]*sync.Mutex, 1024)
+
+func init() {
+	for i := range varyMarkerLockers {
+		varyMarkerLockers[i] = &sync.Mutex{}
+	}
+}
+
+// VaryNormalizer 对Vary中引用的请求Header值进行规范化，以减少变体数量
+type VaryNormalizer func(value string) string
+
+var varyNormalizers = map[string]VaryNormalizer{
+	"Accept-Encoding": normalizeVaryAcceptEncoding,
+}
+
+// RegisterVaryNormalizer 注册某个请求Header的规范化函数
+// 只能在初始化时调用
+func RegisterVaryNormalizer(headerName string, normalizer VaryNormalizer) {
+	varyNormalizers[http.CanonicalHeaderKey(headerName)] = normalizer
+}
+
+// ParseVary 解析Vary Header
+// 返回排序后的Header名称，如果包含*，则 isAll 为true
+func ParseVary(value string) (names []string, isAll bool) {
+	for _, piece := range strings.Split(value, ",") {
+		piece = strings.TrimSpace(piece)
+		if len(piece) == 0 {
+			continue
+		}
+		if piece == "*" {
+			return nil, true
+		}
+		var name = http.CanonicalHeaderKey(piece)
+		if !lists.ContainsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// VaryMarkerKey 记录Vary信息的Key
+// 所有变体的Key均以此为前缀，所以清除此前缀即可清除所有变体
+func VaryMarkerKey(key string) string {
+	return key + SuffixVary
+}
+
+// VaryVariantKey 根据请求Header计算变体的Key
+func VaryVariantKey(key string, names []string, header http.Header) string {
+	return VaryMarkerKey(key) + "_" + VaryVariantId(names, header)
+}
+
+// VaryVariantId 根据请求Header计算变体ID
+func VaryVariantId(names []string, header http.Header) string {
+	var buf = &bytes.Buffer{}
+	for _, name := range names {
+		var value = strings.TrimSpace(strings.Join(header.Values(name), ","))
+		normalizer, ok := varyNormalizers[name]
+		if ok {
+			value = normalizer(value)
+		}
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+	return strconv.FormatUint(fnv.Hash(buf.Bytes()), 16)
+}
+
+// LockVaryMarker 锁定某个Key的Vary信息
+// 在读取、修改、写入Vary信息期间调用，防止并发请求互相覆盖已有的变体，返回解锁函数
+func LockVaryMarker(key string) (unlock func()) {
+	var locker = varyMarkerLockers[fnv.HashString(key)%uint64(len(varyMarkerLockers))]
+	locker.Lock()
+	return locker.Unlock
+}
+
+// VaryMarker Vary信息
+// Header中保存Vary，Body中保存已有的变体ID，每行一个
+type VaryMarker struct {
+	Names     []string
+	Variants  []string
+	ExpiresAt int64
+}
+
+// ReadVaryMarker 从存储中读取Vary信息
+func ReadVaryMarker(storage StorageInterface, key string, useStale bool) (*VaryMarker, error) {
+	reader, err := storage.OpenReader(VaryMarkerKey(key), useStale, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var buf = make([]byte, 1024)
+
+	var headerData = []byte{}
+	err = reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+		headerData = append(headerData, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var bodyData = []byte{}
+	err = reader.ReadBody(buf, func(n int) (goNext bool, err error) {
+		bodyData = append(bodyData, buf[:n]...)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var marker = &VaryMarker{
+		ExpiresAt: reader.ExpiresAt(),
+	}
+	for _, row := range bytes.Split(headerData, []byte{'\n'}) {
+		var index = bytes.IndexByte(row, ':')
+		if index > 0 && string(row[:index]) == "Vary" {
+			marker.Names, _ = ParseVary(string(row[index+1:]))
+		}
+	}
+	for _, row := range bytes.Split(bodyData, []byte{'\n'}) {
+		if len(row) > 0 {
+			marker.Variants = append(marker.Variants, string(row))
+		}
+	}
+
+	return marker, nil
+}
+
+// IsSameNames 检查Vary是否一致
+func (this *VaryMarker) IsSameNames(names []string) bool {
+	if len(this.Names) != len(names) {
+		return false
+	}
+	for index, name := range names {
+		if this.Names[index] != name {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsVariant 检查是否已包含某个变体
+func (this *VaryMarker) ContainsVariant(variantId string) bool {
+	return lists.ContainsString(this.Variants, variantId)
+}
+
+// AddVariant 添加变体
+func (this *VaryMarker) AddVariant(variantId string, maxVariants int) error {
+	if this.ContainsVariant(variantId) {
+		return nil
+	}
+	if maxVariants > 0 && len(this.Variants) >= maxVariants {
+		return ErrTooManyVariants
+	}
+	this.Variants = append(this.Variants, variantId)
+	return nil
+}
+
+// Write 写入到存储中
+func (this *VaryMarker) Write(storage StorageInterface, key string, staleAt int64, host string, serverId int64) error {
+	writer, err := storage.OpenWriter(VaryMarkerKey(key), this.ExpiresAt, http.StatusOK, -1, -1, -1, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.WriteHeader([]byte("Vary:" + strings.Join(this.Names, ", ") + "\n"))
+	if err == nil {
+		_, err = writer.Write([]byte(strings.Join(this.Variants, "\n")))
+	}
+	if err != nil {
+		_ = writer.Discard()
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	storage.AddToList(&Item{
+		Type:       writer.ItemType(),
+		Key:        writer.Key(),
+		ExpiredAt:  writer.ExpiredAt(),
+		StaleAt:    staleAt,
+		HeaderSize: writer.HeaderSize(),
+		BodySize:   writer.BodySize(),
+		Host:       host,
+		ServerId:   serverId,
+	})
+	return nil
+}
+
+// 规范化Accept-Encoding，只保留优先使用的一个编码
+func normalizeVaryAcceptEncoding(value string) string {
+	var acceptedMap = map[string]bool{}
+	for _, piece := range strings.Split(strings.ToLower(value), ",") {
+		var encoding = strings.TrimSpace(piece)
+		var semicolonIndex = strings.Index(encoding, ";")
+		if semicolonIndex >= 0 {
+			var param = strings.TrimSpace(encoding[semicolonIndex+1:])
+			encoding = strings.TrimSpace(encoding[:semicolonIndex])
+			if strings.HasPrefix(param, "q=") && types.Float64(param[2:]) <= 0 {
+				continue
+			}
+		}
+		acceptedMap[encoding] = true
+	}
+	for _, encoding := range []string{"br", "zstd", "gzip", "deflate"} {
+		if acceptedMap[encoding] {
+			return encoding
+		}
+	}
+	return ""
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseVary(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		names, isAll := ParseVary("")
+		a.IsTrue(len(names) == 0)
+		a.IsFalse(isAll)
+	}
+	{
+		names, isAll := ParseVary("x-device, accept-language,Accept-Language")
+		a.IsFalse(isAll)
+		a.IsTrue(strings.Join(names, ",") == "Accept-Language,X-Device")
+	}
+	{
+		_, isAll := ParseVary("Accept-Language, *")
+		a.IsTrue(isAll)
+	}
+}
+
+func TestVaryVariantId(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var names = []string{"Accept-Encoding", "Accept-Language"}
+
+	var id1 = VaryVariantId(names, http.Header{
+		"Accept-Encoding": []string{"gzip, deflate, br"},
+		"Accept-Language": []string{"en"},
+	})
+	var id2 = VaryVariantId(names, http.Header{
+		"Accept-Encoding": []string{"br;q=1.0, gzip;q=0.8"},
+		"Accept-Language": []string{"en"},
+	})
+	var id3 = VaryVariantId(names, http.Header{
+		"Accept-Encoding": []string{"gzip, br;q=0"},
+		"Accept-Language": []string{"en"},
+	})
+	var id4 = VaryVariantId(names, http.Header{
+		"Accept-Encoding": []string{"gzip, deflate, br"},
+		"Accept-Language": []string{"fr"},
+	})
+	t.Log(id1, id2, id3, id4)
+	a.IsTrue(id1 == id2)
+	a.IsTrue(id1 != id3)
+	a.IsTrue(id1 != id4)
+	a.IsTrue(strings.HasPrefix(VaryVariantKey("https://example.com/", names, http.Header{}), "https://example.com/"+SuffixVary+"_"))
+}
+
+func TestVaryMarker_AddVariant(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var marker = &VaryMarker{}
+	a.IsNil(marker.AddVariant("a", 2))
+	a.IsNil(marker.AddVariant("a", 2))
+	a.IsNil(marker.AddVariant("b", 2))
+	a.IsTrue(marker.AddVariant("c", 2) == ErrTooManyVariants)
+	a.IsTrue(len(marker.Variants) == 2)
+}
+
+func TestVaryMarker_Write(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var storage = NewMemoryStorage(&serverconfigs.HTTPCachePolicy{}, nil)
+	_ = storage.Init()
+	defer storage.Stop()
+
+	var key = "https://example.com/"
+	var expiresAt = time.Now().Unix() + 60
+	var marker = &VaryMarker{
+		Names:     []string{"Accept-Language", "X-Device"},
+		Variants:  []string{"a", "b"},
+		ExpiresAt: expiresAt,
+	}
+	err := marker.Write(storage, key, expiresAt+60, "example.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marker2, err := ReadVaryMarker(storage, key, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(marker2.IsSameNames(marker.Names))
+	a.IsTrue(strings.Join(marker2.Variants, ",") == "a,b")
+	a.IsTrue(marker2.ExpiresAt == expiresAt)
+
+	// 清除原始Key的时候同时清除变体
+	err = storage.Purge([]string{key}, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := storage.list.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("count:", count)
+}
+
+func TestLockVaryMarker(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var storage = NewMemoryStorage(&serverconfigs.HTTPCachePolicy{}, nil)
+	_ = storage.Init()
+	defer storage.Stop()
+
+	var key = "https://example.com/"
+	var expiresAt = time.Now().Unix() + 60
+	var names = []string{"X-Device"}
+
+	var wg = &sync.WaitGroup{}
+	var count = 20
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		go func(i int) {
+			defer wg.Done()
+
+			var unlock = LockVaryMarker(key)
+			defer unlock()
+
+			marker, err := ReadVaryMarker(storage, key, false)
+			if err != nil {
+				marker = &VaryMarker{
+					Names:     names,
+					ExpiresAt: expiresAt,
+				}
+			}
+			_ = marker.AddVariant(VaryVariantId(names, http.Header{
+				"X-Device": []string{"device" + strconv.Itoa(i)},
+			}), 0)
+			err = marker.Write(storage, key, expiresAt, "example.com", 1)
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	marker, err := ReadVaryMarker(storage, key, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(marker.Variants) == count)
+}
@@ -0,0 +1,228 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package caches
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/iwind/TeaGo/types"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RedisWriter Redis缓存写入器
+// 内容按照分块尺寸分别写入到不同的Key中，写入完成后再写入缓存信息，以免读取到不完整的内容
+type RedisWriter struct {
+	storage *RedisStorage
+
+	key        string
+	hash       string
+	version    string
+	expiredAt  int64
+	status     int
+	maxSize    int64
+	headerSize int64
+	bodySize   int64
+	chunkSize  int64
+
+	header     []byte
+	chunk      []byte
+	chunkIndex int64
+
+	endFunc func()
+	once    sync.Once
+}
+
+func NewRedisWriter(storage *RedisStorage, key string, expiredAt int64, status int, maxSize int64, endFunc func()) *RedisWriter {
+	return &RedisWriter{
+		storage:   storage,
+		key:       key,
+		hash:      storage.hash(key),
+		version:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		expiredAt: expiredAt,
+		status:    status,
+		maxSize:   maxSize,
+		chunkSize: int64(storage.options.ChunkSize),
+		endFunc:   endFunc,
+	}
+}
+
+// WriteHeader 写入数据
+func (this *RedisWriter) WriteHeader(data []byte) (n int, err error) {
+	this.headerSize += int64(len(data))
+	this.header = append(this.header, data...)
+	return len(data), nil
+}
+
+// Write 写入数据
+func (this *RedisWriter) Write(data []byte) (n int, err error) {
+	n = len(data)
+	this.bodySize += int64(n)
+
+	// 检查尺寸
+	if this.maxSize > 0 && this.bodySize > this.maxSize {
+		this.storage.IgnoreKey(this.key)
+		return n, ErrEntityTooLarge
+	}
+
+	for len(data) > 0 {
+		var left = int(this.chunkSize) - len(this.chunk)
+		if left > len(data) {
+			left = len(data)
+		}
+		this.chunk = append(this.chunk, data[:left]...)
+		data = data[left:]
+
+		if int64(len(this.chunk)) >= this.chunkSize {
+			err = this.flushChunk()
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// WriteAt 在指定位置写入数据
+func (this *RedisWriter) WriteAt(offset int64, b []byte) error {
+	_ = b
+	_ = offset
+	return errors.New("not supported")
+}
+
+// HeaderSize 数据尺寸
+func (this *RedisWriter) HeaderSize() int64 {
+	return this.headerSize
+}
+
+// BodySize 主体内容尺寸
+func (this *RedisWriter) BodySize() int64 {
+	return this.bodySize
+}
+
+// Close 关闭
+func (this *RedisWriter) Close() error {
+	defer this.once.Do(func() {
+		this.endFunc()
+	})
+
+	err := this.flushChunk()
+	if err != nil {
+		_ = this.discardChunks()
+		return err
+	}
+
+	var ctx = context.Background()
+	var client = this.storage.client
+	var metaKey = this.storage.hashKey(this.hash)
+
+	// 旧的版本
+	oldValues, err := client.HMGet(ctx, metaKey, redisFieldVersion, redisFieldBodySize, redisFieldChunkSize).Result()
+	if err != nil {
+		_ = this.discardChunks()
+		return err
+	}
+	var oldVersion = types.String(oldValues[0])
+
+	// 在服务器中的存活时间，加入列表时会再次设置
+	var staleAt = this.expiredAt + int64(SharedManager.FindPolicyOptions(this.storage.policy.Id).Freshness.StaleLifeSeconds)
+	var staleTime = time.Unix(staleAt, 0)
+
+	_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, metaKey)
+		pipe.HSet(ctx, metaKey,
+			redisFieldKey, this.key,
+			redisFieldStatus, this.status,
+			redisFieldExpiresAt, this.expiredAt,
+			redisFieldModifiedAt, time.Now().Unix(),
+			redisFieldHeader, this.header,
+			redisFieldBodySize, this.bodySize,
+			redisFieldChunkSize, this.chunkSize,
+			redisFieldVersion, this.version)
+		pipe.ExpireAt(ctx, metaKey, staleTime)
+		for _, chunkKey := range this.storage.chunkKeys(this.hash, this.version, this.bodySize, this.chunkSize) {
+			pipe.ExpireAt(ctx, chunkKey, staleTime)
+		}
+		pipe.ZAdd(ctx, this.storage.indexKey(), &redis.Z{
+			Score:  float64(staleAt),
+			Member: this.hash,
+		})
+		return nil
+	})
+	if err != nil {
+		_ = this.discardChunks()
+		return err
+	}
+
+	// 旧的分块延时删除，以便于正在读取的请求可以读完
+	if len(oldVersion) > 0 && oldVersion != this.version {
+		var oldChunkKeys = this.storage.chunkKeys(this.hash, oldVersion, types.Int64(oldValues[1]), types.Int64(oldValues[2]))
+		if len(oldChunkKeys) > 0 {
+			_, _ = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, chunkKey := range oldChunkKeys {
+					pipe.Expire(ctx, chunkKey, redisOldChunksLifeSeconds*time.Second)
+				}
+				return nil
+			})
+		}
+	}
+
+	return nil
+}
+
+// Discard 丢弃
+func (this *RedisWriter) Discard() error {
+	defer this.once.Do(func() {
+		this.endFunc()
+	})
+
+	return this.discardChunks()
+}
+
+// Key 获取Key
+func (this *RedisWriter) Key() string {
+	return this.key
+}
+
+// ExpiredAt 过期时间
+func (this *RedisWriter) ExpiredAt() int64 {
+	return this.expiredAt
+}
+
+// ItemType 内容类型
+func (this *RedisWriter) ItemType() ItemType {
+	return ItemTypeRedis
+}
+
+// 写入当前分块
+func (this *RedisWriter) flushChunk() error {
+	if len(this.chunk) == 0 {
+		return nil
+	}
+
+	// 在写入完成之前先设置一个较短的存活时间，以免写入中断后残留
+	var chunkKey = this.storage.chunkKey(this.hash, this.version, this.chunkIndex)
+	err := this.storage.client.Set(context.Background(), chunkKey, this.chunk, time.Hour).Err()
+	if err != nil {
+		return err
+	}
+	this.chunkIndex++
+	this.chunk = this.chunk[:0]
+	return nil
+}
+
+// 删除已写入的分块
+func (this *RedisWriter) discardChunks() error {
+	this.chunk = nil
+	if this.chunkIndex == 0 {
+		return nil
+	}
+	var keys = []string{}
+	for i := int64(0); i < this.chunkIndex; i++ {
+		keys = append(keys, this.storage.chunkKey(this.hash, this.version, i))
+	}
+	return this.storage.client.Del(context.Background(), keys...).Err()
+}
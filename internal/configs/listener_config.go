@@ -0,0 +1,314 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"github.com/iwind/TeaGo/Tea"
+	"gopkg.in/yaml.v3"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// ListenerConfig 节点本地的监听扩展配置
+// 保存在 configs/listener.yaml 中，文件不存在时使用默认设置
+type ListenerConfig struct {
+	Default   *ListenerOptions            `yaml:"default" json:"default"`     // 所有监听地址的默认设置
+	Addresses map[string]*ListenerOptions `yaml:"addresses" json:"addresses"` // 单个监听地址的设置：协议://主机:端口 => *ListenerOptions，比如 http://:80、tcp://:8000
+}
+
+// ListenerOptions 监听扩展设置
+// 单个地址中没有设置的选项使用 Default 中的设置
+type ListenerOptions struct {
+	ProxyProtocol *InboundProxyProtocolConfig `yaml:"proxyProtocol" json:"proxyProtocol"` // 接收PROXY协议
+	Unix          *UnixSocketConfig           `yaml:"unix" json:"unix"`                   // Unix套接字文件设置
+	Socket        *ListenerSocketConfig       `yaml:"socket" json:"socket"`               // TCP套接字设置
+	HTTP3         *HTTP3Config                `yaml:"http3" json:"http3"`                 // HTTP/3设置，只对HTTPS地址有效
+}
+
+func NewListenerConfig() *ListenerConfig {
+	return &ListenerConfig{}
+}
+
+// LoadListenerConfig 从 configs/listener.yaml 中读取配置
+func LoadListenerConfig() (*ListenerConfig, error) {
+	data, err := os.ReadFile(Tea.ConfigFile("listener.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	var config = NewListenerConfig()
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Init 初始化
+func (this *ListenerConfig) Init() error {
+	if this.Default != nil {
+		err := this.Default.Init()
+		if err != nil {
+			return err
+		}
+	}
+
+	for addr, options := range this.Addresses {
+		if options == nil {
+			continue
+		}
+		err := options.Init()
+		if err != nil {
+			return errors.New("address '" + addr + "': " + err.Error())
+		}
+	}
+
+	// 合并默认设置，以便于查找时不需要再次合并
+	for _, options := range this.Addresses {
+		if options == nil {
+			continue
+		}
+		options.merge(this.Default)
+	}
+
+	return nil
+}
+
+// FindAddressOptions 查找某个监听地址的设置
+func (this *ListenerConfig) FindAddressOptions(fullAddr string) *ListenerOptions {
+	if len(fullAddr) > 0 && this.Addresses != nil {
+		options, ok := this.Addresses[fullAddr]
+		if ok && options != nil {
+			return options
+		}
+	}
+	if this.Default != nil {
+		return this.Default
+	}
+	return defaultListenerOptions
+}
+
+var defaultListenerOptions = &ListenerOptions{}
+
+// Init 初始化
+func (this *ListenerOptions) Init() error {
+	if this.ProxyProtocol != nil {
+		err := this.ProxyProtocol.Init()
+		if err != nil {
+			return errors.New("proxyProtocol: " + err.Error())
+		}
+	}
+	if this.Unix != nil {
+		err := this.Unix.Init()
+		if err != nil {
+			return errors.New("unix: " + err.Error())
+		}
+	}
+	if this.Socket != nil {
+		err := this.Socket.Init()
+		if err != nil {
+			return errors.New("socket: " + err.Error())
+		}
+	}
+	if this.HTTP3 != nil {
+		err := this.HTTP3.Init()
+		if err != nil {
+			return errors.New("http3: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// 使用默认设置填充没有设置的选项
+func (this *ListenerOptions) merge(defaultOptions *ListenerOptions) {
+	if defaultOptions == nil {
+		return
+	}
+	if this.ProxyProtocol == nil {
+		this.ProxyProtocol = defaultOptions.ProxyProtocol
+	}
+	if this.Unix == nil {
+		this.Unix = defaultOptions.Unix
+	}
+	if this.Socket == nil {
+		this.Socket = defaultOptions.Socket
+	}
+	if this.HTTP3 == nil {
+		this.HTTP3 = defaultOptions.HTTP3
+	}
+}
+
+// InboundProxyProtocolConfig 接收客户端连接中的PROXY协议（v1/v2）
+type InboundProxyProtocolConfig struct {
+	IsOn           bool     `yaml:"isOn" json:"isOn"`
+	TrustedCIDRs   []string `yaml:"trustedCIDRs" json:"trustedCIDRs"`     // 信任的来源IP或IP范围，只有这些来源的连接才会读取PROXY协议头
+	TimeoutSeconds int      `yaml:"timeoutSeconds" json:"timeoutSeconds"` // 读取PROXY协议头的超时时间
+
+	trustedNets []*net.IPNet
+}
+
+// Init 初始化
+func (this *InboundProxyProtocolConfig) Init() error {
+	if this.TimeoutSeconds <= 0 {
+		this.TimeoutSeconds = 5
+	}
+
+	this.trustedNets = nil
+	for _, cidr := range this.TrustedCIDRs {
+		// 单个IP
+		var ip = net.ParseIP(cidr)
+		if ip != nil {
+			var bits = 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			this.trustedNets = append(this.trustedNets, &net.IPNet{
+				IP:   ip,
+				Mask: net.CIDRMask(bits, bits),
+			})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return errors.New("invalid trusted CIDR '" + cidr + "'")
+		}
+		this.trustedNets = append(this.trustedNets, ipNet)
+	}
+
+	if this.IsOn && len(this.trustedNets) == 0 {
+		return errors.New("'trustedCIDRs' should not be empty")
+	}
+
+	return nil
+}
+
+// IsTrusted 判断来源IP是否可信
+func (this *InboundProxyProtocolConfig) IsTrusted(ip net.IP) bool {
+	if !this.IsOn || ip == nil {
+		return false
+	}
+	for _, ipNet := range this.trustedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Timeout 读取PROXY协议头的超时时间
+func (this *InboundProxyProtocolConfig) Timeout() time.Duration {
+	return time.Duration(this.TimeoutSeconds) * time.Second
+}
+
+// UnixSocketConfig Unix套接字文件设置
+type UnixSocketConfig struct {
+	Mode  string `yaml:"mode" json:"mode"`   // 文件权限，使用八进制表示，比如 0660，为空表示使用系统默认权限
+	User  string `yaml:"user" json:"user"`   // 所属用户名或UID
+	Group string `yaml:"group" json:"group"` // 所属用户组名或GID
+
+	fileMode os.FileMode
+}
+
+// Init 初始化
+func (this *UnixSocketConfig) Init() error {
+	this.fileMode = 0
+	if len(this.Mode) > 0 {
+		mode, err := strconv.ParseUint(this.Mode, 8, 32)
+		if err != nil || mode > 0777 {
+			return errors.New("invalid mode '" + this.Mode + "'")
+		}
+		this.fileMode = os.FileMode(mode)
+	}
+	return nil
+}
+
+// FileMode 文件权限
+func (this *UnixSocketConfig) FileMode() os.FileMode {
+	return this.fileMode
+}
+
+// HasOwner 是否设置了所属用户或用户组
+func (this *UnixSocketConfig) HasOwner() bool {
+	return len(this.User) > 0 || len(this.Group) > 0
+}
+
+// ListenerSocketConfig TCP套接字设置
+type ListenerSocketConfig struct {
+	ReusePort          bool `yaml:"reusePort" json:"reusePort"`                   // 是否开启SO_REUSEPORT，开启后每个地址会创建多个套接字，分别接受连接
+	Acceptors          int  `yaml:"acceptors" json:"acceptors"`                   // 开启SO_REUSEPORT后每个地址的套接字数量，为0表示CPU核数
+	FastOpen           int  `yaml:"fastOpen" json:"fastOpen"`                     // TCP_FASTOPEN队列长度，为0表示不开启
+	DeferAcceptSeconds int  `yaml:"deferAcceptSeconds" json:"deferAcceptSeconds"` // TCP_DEFER_ACCEPT，在收到数据之前不唤醒接受连接，为0表示不开启
+	Backlog            int  `yaml:"backlog" json:"backlog"`                       // 等待接受的连接队列长度，为0表示使用系统默认值
+	KeepAliveSeconds   int  `yaml:"keepAliveSeconds" json:"keepAliveSeconds"`     // TCP保持连接探测间隔，为0表示使用默认值，小于0表示不开启
+}
+
+// Init 初始化
+func (this *ListenerSocketConfig) Init() error {
+	if this.Acceptors < 0 {
+		return errors.New("'acceptors' should not be negative")
+	}
+	if this.FastOpen < 0 {
+		return errors.New("'fastOpen' should not be negative")
+	}
+	if this.DeferAcceptSeconds < 0 {
+		return errors.New("'deferAcceptSeconds' should not be negative")
+	}
+	if this.Backlog < 0 {
+		return errors.New("'backlog' should not be negative")
+	}
+	return nil
+}
+
+// CountAcceptors 每个地址的套接字数量
+func (this *ListenerSocketConfig) CountAcceptors() int {
+	if !this.ReusePort {
+		return 1
+	}
+	if this.Acceptors > 0 {
+		return this.Acceptors
+	}
+	return runtime.NumCPU()
+}
+
+// KeepAlive 保持连接探测间隔
+func (this *ListenerSocketConfig) KeepAlive() time.Duration {
+	if this.KeepAliveSeconds < 0 {
+		return -1
+	}
+	return time.Duration(this.KeepAliveSeconds) * time.Second
+}
+
+// HTTP3Config HTTP/3（QUIC）设置
+// 开启后在HTTPS地址的同一个UDP端口上提供HTTP/3服务，并通过 Alt-Svc 报头通知客户端
+type HTTP3Config struct {
+	IsOn          bool `yaml:"isOn" json:"isOn"`
+	MaxAgeSeconds int  `yaml:"maxAgeSeconds" json:"maxAgeSeconds"` // Alt-Svc 报头中的 ma 参数，即客户端缓存HTTP/3可用信息的时间
+}
+
+// Init 初始化
+func (this *HTTP3Config) Init() error {
+	if this.MaxAgeSeconds < 0 {
+		return errors.New("'maxAgeSeconds' should not be negative")
+	}
+	if this.MaxAgeSeconds == 0 {
+		this.MaxAgeSeconds = 86400
+	}
+	return nil
+}
+
+// AltSvc 构造 Alt-Svc 报头值
+func (this *HTTP3Config) AltSvc(port int) string {
+	return "h3=\":" + strconv.Itoa(port) + "\"; ma=" + strconv.Itoa(this.MaxAgeSeconds)
+}
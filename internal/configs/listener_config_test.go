@@ -0,0 +1,124 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"net"
+	"runtime"
+	"testing"
+)
+
+func TestListenerConfig_FindAddressOptions(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = configs.NewListenerConfig()
+	err := yaml.Unmarshal([]byte(`
+default:
+  proxyProtocol:
+    isOn: false
+addresses:
+  "http://:80":
+    proxyProtocol:
+      isOn: true
+      trustedCIDRs: [ "10.0.0.0/8", "192.168.1.2", "fd00::/8" ]
+  "tcp://:8000": { }
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var options = config.FindAddressOptions("http://:80").ProxyProtocol
+	a.IsTrue(options.IsOn)
+	a.IsTrue(options.TimeoutSeconds == 5)
+	a.IsTrue(options.IsTrusted(net.ParseIP("10.1.2.3")))
+	a.IsTrue(options.IsTrusted(net.ParseIP("192.168.1.2")))
+	a.IsTrue(options.IsTrusted(net.ParseIP("fd00::1")))
+	a.IsFalse(options.IsTrusted(net.ParseIP("192.168.1.3")))
+	a.IsFalse(options.IsTrusted(nil))
+
+	a.IsFalse(config.FindAddressOptions("tcp://:8000").ProxyProtocol.IsOn)
+	a.IsFalse(config.FindAddressOptions("https://:443").ProxyProtocol.IsOn)
+	a.IsTrue(configs.NewListenerConfig().FindAddressOptions("http://:80").ProxyProtocol == nil)
+}
+
+func TestInboundProxyProtocolConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	a.IsNotNil((&configs.InboundProxyProtocolConfig{IsOn: true}).Init())
+	a.IsNotNil((&configs.InboundProxyProtocolConfig{IsOn: true, TrustedCIDRs: []string{"10.0.0.0/33"}}).Init())
+	a.IsNil((&configs.InboundProxyProtocolConfig{IsOn: false}).Init())
+}
+
+func TestUnixSocketConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var config = &configs.UnixSocketConfig{Mode: "0660", User: "nobody"}
+		a.IsNil(config.Init())
+		a.IsTrue(config.FileMode() == 0660)
+		a.IsTrue(config.HasOwner())
+	}
+
+	{
+		var config = &configs.UnixSocketConfig{}
+		a.IsNil(config.Init())
+		a.IsTrue(config.FileMode() == 0)
+		a.IsFalse(config.HasOwner())
+	}
+
+	a.IsNotNil((&configs.UnixSocketConfig{Mode: "0999"}).Init())
+	a.IsNotNil((&configs.UnixSocketConfig{Mode: "1777"}).Init())
+}
+
+func TestListenerSocketConfig(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var config = &configs.ListenerSocketConfig{}
+		a.IsNil(config.Init())
+		a.IsTrue(config.CountAcceptors() == 1)
+		a.IsTrue(config.KeepAlive() == 0)
+	}
+
+	{
+		var config = &configs.ListenerSocketConfig{ReusePort: true, Acceptors: 4, KeepAliveSeconds: -1}
+		a.IsNil(config.Init())
+		a.IsTrue(config.CountAcceptors() == 4)
+		a.IsTrue(config.KeepAlive() < 0)
+	}
+
+	{
+		var config = &configs.ListenerSocketConfig{ReusePort: true}
+		a.IsNil(config.Init())
+		a.IsTrue(config.CountAcceptors() == runtime.NumCPU())
+	}
+
+	a.IsNotNil((&configs.ListenerSocketConfig{Backlog: -1}).Init())
+	a.IsNotNil((&configs.ListenerSocketConfig{Acceptors: -1}).Init())
+}
+
+func TestHTTP3Config(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var config = &configs.HTTP3Config{IsOn: true}
+		a.IsNil(config.Init())
+		a.IsTrue(config.MaxAgeSeconds == 86400)
+		a.IsTrue(config.AltSvc(443) == `h3=":443"; ma=86400`)
+	}
+
+	{
+		var config = &configs.HTTP3Config{IsOn: true, MaxAgeSeconds: 3600}
+		a.IsNil(config.Init())
+		a.IsTrue(config.AltSvc(8443) == `h3=":8443"; ma=3600`)
+	}
+
+	a.IsNotNil((&configs.HTTP3Config{MaxAgeSeconds: -1}).Init())
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"time"
+)
+
+// LoadBalanceMode 负载均衡模式
+type LoadBalanceMode = string
+
+const (
+	LoadBalanceModeDefault      LoadBalanceMode = ""             // 使用反向代理中设置的调度算法
+	LoadBalanceModeLeastRequest LoadBalanceMode = "leastRequest" // 正在处理的请求数最少
+	LoadBalanceModePeakEWMA     LoadBalanceMode = "peakEWMA"     // 峰值EWMA延迟 x 正在处理的请求数最小
+)
+
+// LoadBalanceConfig 负载均衡设置
+type LoadBalanceConfig struct {
+	Mode         LoadBalanceMode `yaml:"mode" json:"mode"`                 // 模式
+	DecaySeconds int             `yaml:"decaySeconds" json:"decaySeconds"` // EWMA衰减时间
+}
+
+// Init 初始化
+func (this *LoadBalanceConfig) Init() error {
+	switch this.Mode {
+	case LoadBalanceModeDefault, LoadBalanceModeLeastRequest, LoadBalanceModePeakEWMA:
+	default:
+		return errors.New("invalid mode '" + this.Mode + "'")
+	}
+	if this.DecaySeconds <= 0 {
+		this.DecaySeconds = 10
+	}
+	return nil
+}
+
+// Decay EWMA衰减时间
+func (this *LoadBalanceConfig) Decay() time.Duration {
+	if this.DecaySeconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(this.DecaySeconds) * time.Second
+}
+
+// OutlierDetectionConfig 异常源站摘除设置
+type OutlierDetectionConfig struct {
+	IsOn               bool `yaml:"isOn" json:"isOn"`
+	Consecutive5xx     int  `yaml:"consecutive5xx" json:"consecutive5xx"`         // 连续多少个5xx错误后摘除，连接错误也计算在内
+	EjectionSeconds    int  `yaml:"ejectionSeconds" json:"ejectionSeconds"`       // 摘除时长
+	MaxEjectionPercent int  `yaml:"maxEjectionPercent" json:"maxEjectionPercent"` // 同一个反向代理中最多可以同时摘除的源站比例
+}
+
+// Init 初始化
+func (this *OutlierDetectionConfig) Init() error {
+	if this.Consecutive5xx <= 0 {
+		this.Consecutive5xx = 5
+	}
+	if this.EjectionSeconds <= 0 {
+		this.EjectionSeconds = 30
+	}
+	if this.MaxEjectionPercent <= 0 {
+		this.MaxEjectionPercent = 50
+	} else if this.MaxEjectionPercent > 100 {
+		this.MaxEjectionPercent = 100
+	}
+	return nil
+}
+
+// MaxEjections 在一组源站中最多可以同时摘除的数量
+// 和Envoy一样，无论比例如何设置，至少可以摘除一个源站
+func (this *OutlierDetectionConfig) MaxEjections(countOrigins int) int {
+	var max = countOrigins * this.MaxEjectionPercent / 100
+	if max < 1 {
+		max = 1
+	}
+	return max
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OriginHealthCheckProtocol 健康检查协议
+type OriginHealthCheckProtocol = string
+
+const (
+	OriginHealthCheckProtocolHTTP  OriginHealthCheckProtocol = "http"
+	OriginHealthCheckProtocolHTTPS OriginHealthCheckProtocol = "https"
+	OriginHealthCheckProtocolTCP   OriginHealthCheckProtocol = "tcp"
+)
+
+// OriginHealthCheckConfig 源站主动健康检查设置
+type OriginHealthCheckConfig struct {
+	IsOn            bool                      `yaml:"isOn" json:"isOn"`
+	Protocol        OriginHealthCheckProtocol `yaml:"protocol" json:"protocol"`               // 检查协议：http、https、tcp，为空时根据源站协议决定
+	Method          string                    `yaml:"method" json:"method"`                   // HTTP请求方法，默认为GET
+	Path            string                    `yaml:"path" json:"path"`                       // HTTP请求路径，默认为 /
+	Host            string                    `yaml:"host" json:"host"`                       // HTTP请求的Host，为空时使用回源主机名
+	StatusCodes     []int                     `yaml:"statusCodes" json:"statusCodes"`         // 期望的状态码，为空时表示200-399
+	BodyRegexp      string                    `yaml:"bodyRegexp" json:"bodyRegexp"`           // 期望响应内容匹配的正则表达式
+	IntervalSeconds int                       `yaml:"intervalSeconds" json:"intervalSeconds"` // 检查间隔
+	TimeoutSeconds  int                       `yaml:"timeoutSeconds" json:"timeoutSeconds"`   // 单次检查超时时间
+	Rise            int                       `yaml:"rise" json:"rise"`                       // 连续成功多少次后认为恢复正常
+	Fall            int                       `yaml:"fall" json:"fall"`                       // 连续失败多少次后认为异常
+	JitterPercent   int                       `yaml:"jitterPercent" json:"jitterPercent"`     // 检查间隔随机浮动的百分比，避免多个节点同时检查
+
+	bodyReg *regexp.Regexp
+}
+
+// Init 初始化
+func (this *OriginHealthCheckConfig) Init() error {
+	switch this.Protocol {
+	case "", OriginHealthCheckProtocolHTTP, OriginHealthCheckProtocolHTTPS, OriginHealthCheckProtocolTCP:
+	default:
+		return errors.New("invalid protocol '" + this.Protocol + "'")
+	}
+
+	if len(this.Method) == 0 {
+		this.Method = "GET"
+	} else {
+		this.Method = strings.ToUpper(this.Method)
+	}
+	if len(this.Path) == 0 {
+		this.Path = "/"
+	} else if this.Path[0] != '/' {
+		this.Path = "/" + this.Path
+	}
+	if this.IntervalSeconds <= 0 {
+		this.IntervalSeconds = 10
+	}
+	if this.TimeoutSeconds <= 0 {
+		this.TimeoutSeconds = 5
+	}
+	if this.Rise <= 0 {
+		this.Rise = 2
+	}
+	if this.Fall <= 0 {
+		this.Fall = 3
+	}
+	if this.JitterPercent < 0 {
+		this.JitterPercent = 0
+	} else if this.JitterPercent > 100 {
+		this.JitterPercent = 100
+	}
+
+	this.bodyReg = nil
+	if len(this.BodyRegexp) > 0 {
+		reg, err := regexp.Compile(this.BodyRegexp)
+		if err != nil {
+			return errors.New("invalid bodyRegexp: " + err.Error())
+		}
+		this.bodyReg = reg
+	}
+	return nil
+}
+
+// MatchStatus 检查状态码是否符合期望
+func (this *OriginHealthCheckConfig) MatchStatus(statusCode int) bool {
+	if len(this.StatusCodes) == 0 {
+		return statusCode >= 200 && statusCode < 400
+	}
+	for _, code := range this.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// HasBodyRegexp 是否需要检查响应内容
+func (this *OriginHealthCheckConfig) HasBodyRegexp() bool {
+	return this.bodyReg != nil
+}
+
+// MatchBody 检查响应内容是否符合期望
+func (this *OriginHealthCheckConfig) MatchBody(body []byte) bool {
+	if this.bodyReg == nil {
+		return true
+	}
+	return this.bodyReg.Match(body)
+}
+
+// TimeoutDuration 单次检查超时时间
+func (this *OriginHealthCheckConfig) TimeoutDuration() time.Duration {
+	if this.TimeoutSeconds <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(this.TimeoutSeconds) * time.Second
+}
+
+// NextInterval 下次检查的间隔，包括随机浮动
+func (this *OriginHealthCheckConfig) NextInterval() time.Duration {
+	var interval = time.Duration(this.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	if this.JitterPercent <= 0 {
+		return interval
+	}
+	var jitter = int64(interval) * int64(this.JitterPercent) / 100
+	if jitter <= 0 {
+		return interval
+	}
+	return interval - time.Duration(jitter) + time.Duration(rand.Int63n(jitter*2+1))
+}
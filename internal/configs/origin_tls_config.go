@@ -0,0 +1,140 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+// OriginTLSVerifyMode 源站证书验证方式
+type OriginTLSVerifyMode = string
+
+const (
+	OriginTLSVerifyModeNone   OriginTLSVerifyMode = ""       // 不验证
+	OriginTLSVerifyModeSystem OriginTLSVerifyMode = "system" // 使用系统根证书验证
+	OriginTLSVerifyModeCA     OriginTLSVerifyMode = "ca"     // 使用自定义CA证书验证
+	OriginTLSVerifyModePin    OriginTLSVerifyMode = "pin"    // 验证证书公钥（SPKI）的SHA256摘要
+)
+
+// OriginTLSConfig 连接源站的TLS设置
+type OriginTLSConfig struct {
+	VerifyMode   OriginTLSVerifyMode `yaml:"verifyMode" json:"verifyMode"`     // 证书验证方式
+	CAFile       string              `yaml:"caFile" json:"caFile"`             // PEM格式的CA证书文件，verifyMode为ca时有效
+	Pins         []string            `yaml:"pins" json:"pins"`                 // Base64编码的SPKI SHA256摘要，可以以 sha256/ 开头，verifyMode为pin时有效
+	ServerName   string              `yaml:"serverName" json:"serverName"`     // SNI主机名，同时用于验证证书
+	MinVersion   string              `yaml:"minVersion" json:"minVersion"`     // 最低TLS版本：1.0、1.1、1.2、1.3
+	CipherSuites []string            `yaml:"cipherSuites" json:"cipherSuites"` // 加密套件名称，比如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+
+	caPool         *x509.CertPool
+	pins           [][]byte
+	minVersion     uint16
+	cipherSuiteIds []uint16
+}
+
+// Init 初始化
+func (this *OriginTLSConfig) Init() error {
+	this.caPool = nil
+	this.pins = nil
+	this.minVersion = 0
+	this.cipherSuiteIds = nil
+
+	switch this.VerifyMode {
+	case OriginTLSVerifyModeNone, OriginTLSVerifyModeSystem:
+	case OriginTLSVerifyModeCA:
+		if len(this.CAFile) == 0 {
+			return errors.New("'caFile' should not be empty")
+		}
+		data, err := os.ReadFile(this.CAFile)
+		if err != nil {
+			return errors.New("read ca file failed: " + err.Error())
+		}
+		var pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.New("no valid certificates found in '" + this.CAFile + "'")
+		}
+		this.caPool = pool
+	case OriginTLSVerifyModePin:
+		if len(this.Pins) == 0 {
+			return errors.New("'pins' should not be empty")
+		}
+		for _, pin := range this.Pins {
+			pinData, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(pin), "sha256/"))
+			if err != nil || len(pinData) != sha256.Size {
+				return errors.New("invalid pin '" + pin + "'")
+			}
+			this.pins = append(this.pins, pinData)
+		}
+	default:
+		return errors.New("invalid verifyMode '" + this.VerifyMode + "'")
+	}
+
+	switch this.MinVersion {
+	case "":
+	case "1.0":
+		this.minVersion = tls.VersionTLS10
+	case "1.1":
+		this.minVersion = tls.VersionTLS11
+	case "1.2":
+		this.minVersion = tls.VersionTLS12
+	case "1.3":
+		this.minVersion = tls.VersionTLS13
+	default:
+		return errors.New("invalid minVersion '" + this.MinVersion + "'")
+	}
+
+	if len(this.CipherSuites) > 0 {
+		var suiteMap = map[string]uint16{}
+		for _, suite := range tls.CipherSuites() {
+			suiteMap[suite.Name] = suite.ID
+		}
+		for _, suite := range tls.InsecureCipherSuites() {
+			suiteMap[suite.Name] = suite.ID
+		}
+		for _, name := range this.CipherSuites {
+			id, ok := suiteMap[name]
+			if !ok {
+				return errors.New("invalid cipher suite '" + name + "'")
+			}
+			this.cipherSuiteIds = append(this.cipherSuiteIds, id)
+		}
+	}
+
+	return nil
+}
+
+// CAPool 自定义CA证书
+func (this *OriginTLSConfig) CAPool() *x509.CertPool {
+	return this.caPool
+}
+
+// MinTLSVersion 最低TLS版本
+func (this *OriginTLSConfig) MinTLSVersion() uint16 {
+	return this.minVersion
+}
+
+// CipherSuiteIds 加密套件
+func (this *OriginTLSConfig) CipherSuiteIds() []uint16 {
+	return this.cipherSuiteIds
+}
+
+// MatchPin 检查源站证书公钥是否和设置的摘要一致
+// 只能传入源站的叶子证书，TLS握手可以证明源站持有叶子证书的私钥，证书链中的其他证书可以被任意附加，所以不能用来匹配
+func (this *OriginTLSConfig) MatchPin(leafCert *x509.Certificate) bool {
+	if leafCert == nil {
+		return false
+	}
+	var sum = sha256.Sum256(leafCert.RawSubjectPublicKeyInfo)
+	for _, pin := range this.pins {
+		if bytes.Equal(sum[:], pin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOriginTLSConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var server = httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+	var cert = server.Certificate()
+
+	// pin
+	{
+		var sum = sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		var config = &configs.OriginTLSConfig{
+			VerifyMode: configs.OriginTLSVerifyModePin,
+			Pins:       []string{"sha256/" + base64.StdEncoding.EncodeToString(sum[:])},
+			MinVersion: "1.2",
+			CipherSuites: []string{
+				"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+			},
+		}
+		a.IsNil(config.Init())
+		a.IsTrue(config.MatchPin(cert))
+		a.IsTrue(config.MinTLSVersion() == tls.VersionTLS12)
+		a.IsTrue(len(config.CipherSuiteIds()) == 1 && config.CipherSuiteIds()[0] == tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+
+		var otherSum = sha256.Sum256([]byte("other"))
+		config.Pins = []string{base64.StdEncoding.EncodeToString(otherSum[:])}
+		a.IsNil(config.Init())
+		a.IsFalse(config.MatchPin(cert))
+	}
+
+	// ca
+	{
+		var caFile = filepath.Join(t.TempDir(), "ca.pem")
+		err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var config = &configs.OriginTLSConfig{
+			VerifyMode: configs.OriginTLSVerifyModeCA,
+			CAFile:     caFile,
+		}
+		a.IsNil(config.Init())
+		a.IsNotNil(config.CAPool())
+	}
+
+	a.IsNotNil((&configs.OriginTLSConfig{VerifyMode: configs.OriginTLSVerifyModePin, Pins: []string{"abc"}}).Init())
+	a.IsNotNil((&configs.OriginTLSConfig{VerifyMode: configs.OriginTLSVerifyModeCA}).Init())
+	a.IsNotNil((&configs.OriginTLSConfig{MinVersion: "2.0"}).Init())
+	a.IsNotNil((&configs.OriginTLSConfig{CipherSuites: []string{"TLS_UNKNOWN"}}).Init())
+	a.IsNotNil((&configs.OriginTLSConfig{VerifyMode: "always"}).Init())
+}
+
+func TestOriginTLSConfig_MatchPin_Chain(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	caCert, leafCert := testOriginTLSCertChain(t)
+
+	// 只设置了证书链中CA证书的摘要时，叶子证书不能通过验证
+	var caSum = sha256.Sum256(caCert.RawSubjectPublicKeyInfo)
+	var config = &configs.OriginTLSConfig{
+		VerifyMode: configs.OriginTLSVerifyModePin,
+		Pins:       []string{base64.StdEncoding.EncodeToString(caSum[:])},
+	}
+	a.IsNil(config.Init())
+	a.IsFalse(config.MatchPin(leafCert.Leaf))
+	a.IsFalse(config.MatchPin(nil))
+
+	var leafSum = sha256.Sum256(leafCert.Leaf.RawSubjectPublicKeyInfo)
+	config.Pins = []string{base64.StdEncoding.EncodeToString(leafSum[:])}
+	a.IsNil(config.Init())
+	a.IsTrue(config.MatchPin(leafCert.Leaf))
+}
+
+// 生成CA证书和由CA签发的叶子证书
+func testOriginTLSCertChain(t *testing.T) (caCert *x509.Certificate, leafCert tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var caTemplate = &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caData, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err = x509.ParseCertificate(caData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var leafTemplate = &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(1 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafData, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCert = tls.Certificate{
+		Certificate: [][]byte{leafData, caData},
+		PrivateKey:  leafKey,
+	}
+	leafCert.Leaf, err = x509.ParseCertificate(leafData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
@@ -0,0 +1,235 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/types"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// ProxyConfig 节点本地的反向代理扩展配置
+// 保存在 configs/proxy.yaml 中，文件不存在时使用默认设置
+type ProxyConfig struct {
+	DefaultOrigin *OriginOptions           `yaml:"defaultOrigin" json:"defaultOrigin"` // 所有源站的默认设置
+	Origins       map[int64]*OriginOptions `yaml:"origins" json:"origins"`             // 单个源站的设置 originId => *OriginOptions
+
+	DefaultServer *ServerProxyOptions           `yaml:"defaultServer" json:"defaultServer"` // 所有网站的默认设置
+	Servers       map[int64]*ServerProxyOptions `yaml:"servers" json:"servers"`             // 单个网站的设置 serverId => *ServerProxyOptions
+}
+
+// OriginOptions 源站扩展设置
+// 单个源站中没有设置的选项使用 DefaultOrigin 中的设置
+type OriginOptions struct {
+	HealthCheck *OriginHealthCheckConfig `yaml:"healthCheck" json:"healthCheck"` // 主动健康检查
+	HTTPVersion OriginHTTPVersion        `yaml:"httpVersion" json:"httpVersion"` // 回源HTTP协议版本
+	TLS         *OriginTLSConfig         `yaml:"tls" json:"tls"`                 // TLS设置
+}
+
+// OriginHTTPVersion 回源HTTP协议版本
+type OriginHTTPVersion = string
+
+const (
+	OriginHTTPVersionDefault OriginHTTPVersion = ""        // 默认，即HTTP/1.1
+	OriginHTTPVersionHTTP1   OriginHTTPVersion = "http1.1" // HTTP/1.1
+	OriginHTTPVersionHTTP2   OriginHTTPVersion = "http2"   // HTTPS源站通过ALPN协商HTTP/2，源站不支持时使用HTTP/1.1
+	OriginHTTPVersionH2C     OriginHTTPVersion = "h2c"     // HTTP源站直接使用明文HTTP/2（prior knowledge），HTTPS源站同 http2
+)
+
+// ServerProxyOptions 网站反向代理扩展设置
+// 单个网站中没有设置的选项使用 DefaultServer 中的设置
+type ServerProxyOptions struct {
+	LoadBalance      *LoadBalanceConfig      `yaml:"loadBalance" json:"loadBalance"`           // 负载均衡
+	OutlierDetection *OutlierDetectionConfig `yaml:"outlierDetection" json:"outlierDetection"` // 异常源站摘除
+	RetryPolicy      *RetryPolicyConfig      `yaml:"retryPolicy" json:"retryPolicy"`           // 回源重试
+}
+
+func NewProxyConfig() *ProxyConfig {
+	return &ProxyConfig{}
+}
+
+// LoadProxyConfig 从 configs/proxy.yaml 中读取配置
+func LoadProxyConfig() (*ProxyConfig, error) {
+	data, err := os.ReadFile(Tea.ConfigFile("proxy.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	var config = NewProxyConfig()
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Init 初始化
+func (this *ProxyConfig) Init() error {
+	if this.DefaultOrigin != nil {
+		err := this.DefaultOrigin.Init()
+		if err != nil {
+			return err
+		}
+	}
+
+	for originId, options := range this.Origins {
+		if options == nil {
+			continue
+		}
+		err := options.Init()
+		if err != nil {
+			return errors.New("origin '" + types.String(originId) + "': " + err.Error())
+		}
+	}
+
+	if this.DefaultServer != nil {
+		err := this.DefaultServer.Init()
+		if err != nil {
+			return err
+		}
+	}
+
+	for serverId, options := range this.Servers {
+		if options == nil {
+			continue
+		}
+		err := options.Init()
+		if err != nil {
+			return errors.New("server '" + types.String(serverId) + "': " + err.Error())
+		}
+	}
+
+	// 合并默认设置，以便于查找时不需要再次合并
+	for _, options := range this.Origins {
+		if options == nil {
+			continue
+		}
+		options.merge(this.DefaultOrigin)
+	}
+	for _, options := range this.Servers {
+		if options == nil {
+			continue
+		}
+		options.merge(this.DefaultServer)
+	}
+
+	return nil
+}
+
+// FindOriginOptions 查找某个源站的设置
+func (this *ProxyConfig) FindOriginOptions(originId int64) *OriginOptions {
+	if originId > 0 && this.Origins != nil {
+		options, ok := this.Origins[originId]
+		if ok && options != nil {
+			return options
+		}
+	}
+	if this.DefaultOrigin != nil {
+		return this.DefaultOrigin
+	}
+	return defaultOriginOptions
+}
+
+var defaultOriginOptions = &OriginOptions{}
+
+// FindServerOptions 查找某个网站的设置
+func (this *ProxyConfig) FindServerOptions(serverId int64) *ServerProxyOptions {
+	if serverId > 0 && this.Servers != nil {
+		options, ok := this.Servers[serverId]
+		if ok && options != nil {
+			return options
+		}
+	}
+	if this.DefaultServer != nil {
+		return this.DefaultServer
+	}
+	return defaultServerProxyOptions
+}
+
+var defaultServerProxyOptions = &ServerProxyOptions{}
+
+// Init 初始化
+func (this *OriginOptions) Init() error {
+	switch this.HTTPVersion {
+	case OriginHTTPVersionDefault, OriginHTTPVersionHTTP1, OriginHTTPVersionHTTP2, OriginHTTPVersionH2C:
+	default:
+		return errors.New("invalid httpVersion '" + this.HTTPVersion + "'")
+	}
+
+	if this.HealthCheck != nil {
+		err := this.HealthCheck.Init()
+		if err != nil {
+			return errors.New("healthCheck: " + err.Error())
+		}
+	}
+	if this.TLS != nil {
+		err := this.TLS.Init()
+		if err != nil {
+			return errors.New("tls: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// 使用默认设置填充没有设置的选项
+func (this *OriginOptions) merge(defaultOptions *OriginOptions) {
+	if defaultOptions == nil {
+		return
+	}
+	if this.HealthCheck == nil {
+		this.HealthCheck = defaultOptions.HealthCheck
+	}
+	if len(this.HTTPVersion) == 0 {
+		this.HTTPVersion = defaultOptions.HTTPVersion
+	}
+	if this.TLS == nil {
+		this.TLS = defaultOptions.TLS
+	}
+}
+
+// Init 初始化
+func (this *ServerProxyOptions) Init() error {
+	if this.LoadBalance != nil {
+		err := this.LoadBalance.Init()
+		if err != nil {
+			return errors.New("loadBalance: " + err.Error())
+		}
+	}
+	if this.OutlierDetection != nil {
+		err := this.OutlierDetection.Init()
+		if err != nil {
+			return errors.New("outlierDetection: " + err.Error())
+		}
+	}
+	if this.RetryPolicy != nil {
+		err := this.RetryPolicy.Init()
+		if err != nil {
+			return errors.New("retryPolicy: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// 使用默认设置填充没有设置的选项
+func (this *ServerProxyOptions) merge(defaultOptions *ServerProxyOptions) {
+	if defaultOptions == nil {
+		return
+	}
+	if this.LoadBalance == nil {
+		this.LoadBalance = defaultOptions.LoadBalance
+	}
+	if this.OutlierDetection == nil {
+		this.OutlierDetection = defaultOptions.OutlierDetection
+	}
+	if this.RetryPolicy == nil {
+		this.RetryPolicy = defaultOptions.RetryPolicy
+	}
+}
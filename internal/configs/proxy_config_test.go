@@ -0,0 +1,157 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func TestProxyConfig_FindOriginOptions(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = configs.NewProxyConfig()
+	err := yaml.Unmarshal([]byte(`
+defaultOrigin:
+  healthCheck:
+    isOn: true
+    path: /health
+origins:
+  2:
+    healthCheck:
+      isOn: true
+      protocol: tcp
+      rise: 5
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var options1 = config.FindOriginOptions(1)
+	a.IsTrue(options1.HealthCheck != nil)
+	a.IsTrue(options1.HealthCheck.Path == "/health")
+	a.IsTrue(options1.HealthCheck.Rise == 2)
+	a.IsTrue(options1.HealthCheck.Fall == 3)
+
+	var options2 = config.FindOriginOptions(2)
+	a.IsTrue(options2.HealthCheck.Rise == 5)
+	a.IsTrue(options2.HealthCheck.Protocol == configs.OriginHealthCheckProtocolTCP)
+	a.IsTrue(options2.HealthCheck.Path == "/")
+
+	a.IsTrue(configs.NewProxyConfig().FindOriginOptions(1).HealthCheck == nil)
+}
+
+func TestOriginHealthCheckConfig_Match(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.OriginHealthCheckConfig{
+		BodyRegexp:    `"status":\s*"ok"`,
+		JitterPercent: 10,
+	}
+	a.IsNil(config.Init())
+	a.IsTrue(config.MatchStatus(200))
+	a.IsTrue(config.MatchStatus(302))
+	a.IsFalse(config.MatchStatus(502))
+	a.IsTrue(config.MatchBody([]byte(`{"status": "ok"}`)))
+	a.IsFalse(config.MatchBody([]byte(`{"status": "error"}`)))
+
+	config.StatusCodes = []int{204}
+	a.IsFalse(config.MatchStatus(200))
+	a.IsTrue(config.MatchStatus(204))
+
+	for i := 0; i < 100; i++ {
+		var interval = config.NextInterval()
+		if interval.Seconds() < 9 || interval.Seconds() > 11 {
+			t.Fatal("invalid interval:", interval)
+		}
+	}
+
+	a.IsNotNil((&configs.OriginHealthCheckConfig{Protocol: "udp"}).Init())
+	a.IsNotNil((&configs.OriginHealthCheckConfig{BodyRegexp: "("}).Init())
+}
+
+func TestProxyConfig_FindServerOptions(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = configs.NewProxyConfig()
+	err := yaml.Unmarshal([]byte(`
+defaultServer:
+  outlierDetection:
+    isOn: true
+servers:
+  2:
+    loadBalance:
+      mode: peakEWMA
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var options1 = config.FindServerOptions(1)
+	a.IsTrue(options1.LoadBalance == nil)
+	a.IsTrue(options1.OutlierDetection.Consecutive5xx == 5)
+	a.IsTrue(options1.OutlierDetection.MaxEjections(10) == 5)
+	a.IsTrue(options1.OutlierDetection.MaxEjections(1) == 1)
+
+	var options2 = config.FindServerOptions(2)
+	a.IsTrue(options2.LoadBalance.Mode == configs.LoadBalanceModePeakEWMA)
+	a.IsTrue(options2.LoadBalance.DecaySeconds == 10)
+	a.IsTrue(options2.OutlierDetection.IsOn)
+
+	a.IsNotNil((&configs.LoadBalanceConfig{Mode: "random"}).Init())
+}
+
+func TestRetryPolicyConfig(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.RetryPolicyConfig{
+		IsOn:               true,
+		RetryOnStatusCodes: []int{502, 503, 504},
+	}
+	a.IsNil(config.Init())
+	a.IsTrue(config.MaxRetries == 2)
+	a.IsFalse(config.ShouldRetryOn(configs.RetryOnConnectFailure))
+	a.IsTrue(config.ShouldRetryStatus(503))
+	a.IsFalse(config.ShouldRetryStatus(500))
+	a.IsTrue(config.CanRetryMethod("GET"))
+	a.IsFalse(config.CanRetryMethod("POST"))
+
+	for i := 1; i <= 10; i++ {
+		var backoff = config.Backoff(i)
+		if backoff < 0 || backoff.Milliseconds() > int64(config.BackoffMaxMs) {
+			t.Fatal("invalid backoff:", backoff)
+		}
+	}
+
+	config.RetryNonIdempotent = true
+	a.IsTrue(config.CanRetryMethod("POST"))
+
+	a.IsNotNil((&configs.RetryPolicyConfig{RetryOn: []string{"always"}}).Init())
+}
+
+func TestOriginOptions_HTTPVersion(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = configs.NewProxyConfig()
+	config.DefaultOrigin = &configs.OriginOptions{HTTPVersion: configs.OriginHTTPVersionHTTP2}
+	config.Origins = map[int64]*configs.OriginOptions{
+		2: {HTTPVersion: configs.OriginHTTPVersionH2C},
+		3: {},
+	}
+	a.IsNil(config.Init())
+	a.IsTrue(config.FindOriginOptions(1).HTTPVersion == configs.OriginHTTPVersionHTTP2)
+	a.IsTrue(config.FindOriginOptions(2).HTTPVersion == configs.OriginHTTPVersionH2C)
+	a.IsTrue(config.FindOriginOptions(3).HTTPVersion == configs.OriginHTTPVersionHTTP2)
+
+	a.IsNotNil((&configs.OriginOptions{HTTPVersion: "http3"}).Init())
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryOn 重试条件
+type RetryOn = string
+
+const (
+	RetryOnConnectFailure RetryOn = "connectFailure" // 连接源站失败
+	RetryOnTimeout        RetryOn = "timeout"        // 读取源站超时
+	RetryOnReset          RetryOn = "reset"          // 连接被源站重置或者提前关闭
+)
+
+// RetryPolicyConfig 回源重试策略
+type RetryPolicyConfig struct {
+	IsOn                bool      `yaml:"isOn" json:"isOn"`
+	MaxRetries          int       `yaml:"maxRetries" json:"maxRetries"`                   // 最多重试次数，不包括第一次请求
+	RetryOn             []RetryOn `yaml:"retryOn" json:"retryOn"`                         // 重试条件
+	RetryOnStatusCodes  []int     `yaml:"retryOnStatusCodes" json:"retryOnStatusCodes"`   // 需要重试的响应状态码，比如 502、503、504
+	PerTryTimeoutMs     int       `yaml:"perTryTimeoutMs" json:"perTryTimeoutMs"`         // 每次尝试等待源站响应Header的超时时间
+	BackoffBaseMs       int       `yaml:"backoffBaseMs" json:"backoffBaseMs"`             // 重试间隔基数
+	BackoffMaxMs        int       `yaml:"backoffMaxMs" json:"backoffMaxMs"`               // 最大重试间隔
+	RetryNonIdempotent  bool      `yaml:"retryNonIdempotent" json:"retryNonIdempotent"`   // 是否允许重试非幂等的请求方法，比如POST
+	BudgetPercent       int       `yaml:"budgetPercent" json:"budgetPercent"`             // 重试次数最多占请求数的百分比
+	MinRetriesPerSecond int       `yaml:"minRetriesPerSecond" json:"minRetriesPerSecond"` // 请求较少时每秒最少允许的重试次数
+}
+
+// Init 初始化
+func (this *RetryPolicyConfig) Init() error {
+	if this.MaxRetries < 0 {
+		return errors.New("invalid maxRetries")
+	}
+	if this.MaxRetries == 0 {
+		this.MaxRetries = 2
+	}
+	if len(this.RetryOn) == 0 && len(this.RetryOnStatusCodes) == 0 {
+		this.RetryOn = []RetryOn{RetryOnConnectFailure}
+	}
+	for _, retryOn := range this.RetryOn {
+		switch retryOn {
+		case RetryOnConnectFailure, RetryOnTimeout, RetryOnReset:
+		default:
+			return errors.New("invalid retryOn '" + retryOn + "'")
+		}
+	}
+	if this.BackoffBaseMs <= 0 {
+		this.BackoffBaseMs = 25
+	}
+	if this.BackoffMaxMs <= 0 {
+		this.BackoffMaxMs = this.BackoffBaseMs * 10
+	}
+	if this.BudgetPercent <= 0 {
+		this.BudgetPercent = 20
+	}
+	if this.MinRetriesPerSecond <= 0 {
+		this.MinRetriesPerSecond = 3
+	}
+	return nil
+}
+
+// ShouldRetryOn 检查是否在某个条件下重试
+func (this *RetryPolicyConfig) ShouldRetryOn(retryOn RetryOn) bool {
+	for _, r := range this.RetryOn {
+		if r == retryOn {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldRetryStatus 检查是否对某个状态码重试
+func (this *RetryPolicyConfig) ShouldRetryStatus(statusCode int) bool {
+	for _, code := range this.RetryOnStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRetryMethod 检查请求方法是否可以重试
+func (this *RetryPolicyConfig) CanRetryMethod(method string) bool {
+	if this.RetryNonIdempotent {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// PerTryTimeout 每次尝试的超时时间
+func (this *RetryPolicyConfig) PerTryTimeout() time.Duration {
+	if this.PerTryTimeoutMs <= 0 {
+		return 0
+	}
+	return time.Duration(this.PerTryTimeoutMs) * time.Millisecond
+}
+
+// Backoff 第N次重试前需要等待的时间
+// 使用指数退避，并在 [0, 间隔] 之间随机选择以避免同时重试
+func (this *RetryPolicyConfig) Backoff(retry int) time.Duration {
+	if retry <= 0 {
+		return 0
+	}
+	var base = time.Duration(this.BackoffBaseMs) * time.Millisecond
+	var max = time.Duration(this.BackoffMaxMs) * time.Millisecond
+	var backoff = max
+	if retry < 31 {
+		backoff = base << uint(retry-1)
+		if backoff > max || backoff <= 0 {
+			backoff = max
+		}
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
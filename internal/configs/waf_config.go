@@ -0,0 +1,243 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs
+
+import (
+	"errors"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/lists"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// WAFConfig 节点本地的WAF扩展配置
+// 保存在 configs/waf.yaml 中，文件不存在时使用默认设置
+type WAFConfig struct {
+	Default  *WAFPolicyOptions           `yaml:"default" json:"default"`   // 所有WAF策略的默认设置
+	Policies map[int64]*WAFPolicyOptions `yaml:"policies" json:"policies"` // 单个WAF策略的设置 policyId => *WAFPolicyOptions
+}
+
+// WAFPolicyOptions WAF策略扩展设置
+// 单个策略中没有设置的选项使用 Default 中的设置
+type WAFPolicyOptions struct {
+	AnomalyScoring   *AnomalyScoringConfig `yaml:"anomalyScoring" json:"anomalyScoring"`     // 异常评分模式
+	DetectOnlyGroups []int64               `yaml:"detectOnlyGroups" json:"detectOnlyGroups"` // 仅检测模式的规则分组ID，匹配时只记录而不阻止请求
+	DetectOnlySets   []int64               `yaml:"detectOnlySets" json:"detectOnlySets"`     // 仅检测模式的规则集ID
+}
+
+func NewWAFConfig() *WAFConfig {
+	return &WAFConfig{}
+}
+
+// LoadWAFConfig 从 configs/waf.yaml 中读取配置
+func LoadWAFConfig() (*WAFConfig, error) {
+	data, err := os.ReadFile(Tea.ConfigFile("waf.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	var config = NewWAFConfig()
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Init()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Init 初始化
+func (this *WAFConfig) Init() error {
+	if this.Default != nil {
+		err := this.Default.Init()
+		if err != nil {
+			return err
+		}
+	}
+
+	for policyId, options := range this.Policies {
+		if options == nil {
+			continue
+		}
+		err := options.Init()
+		if err != nil {
+			return errors.New("policy '" + strconv.FormatInt(policyId, 10) + "': " + err.Error())
+		}
+	}
+
+	// 合并默认设置
+	for _, options := range this.Policies {
+		if options == nil {
+			continue
+		}
+		options.merge(this.Default)
+	}
+
+	return nil
+}
+
+// FindPolicyOptions 查找某个WAF策略的设置
+func (this *WAFConfig) FindPolicyOptions(policyId int64) *WAFPolicyOptions {
+	if policyId > 0 && this.Policies != nil {
+		options, ok := this.Policies[policyId]
+		if ok && options != nil {
+			return options
+		}
+	}
+	if this.Default != nil {
+		return this.Default
+	}
+	return defaultWAFPolicyOptions
+}
+
+var defaultWAFPolicyOptions = &WAFPolicyOptions{}
+
+// Init 初始化
+func (this *WAFPolicyOptions) Init() error {
+	if this.AnomalyScoring != nil {
+		err := this.AnomalyScoring.Init()
+		if err != nil {
+			return errors.New("anomalyScoring: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// 使用默认设置填充没有设置的选项
+func (this *WAFPolicyOptions) merge(defaultOptions *WAFPolicyOptions) {
+	if defaultOptions == nil {
+		return
+	}
+	if this.AnomalyScoring == nil {
+		this.AnomalyScoring = defaultOptions.AnomalyScoring
+	}
+	if this.DetectOnlyGroups == nil {
+		this.DetectOnlyGroups = defaultOptions.DetectOnlyGroups
+	}
+	if this.DetectOnlySets == nil {
+		this.DetectOnlySets = defaultOptions.DetectOnlySets
+	}
+}
+
+// IsDetectOnlyGroup 规则分组是否为仅检测模式
+func (this *WAFPolicyOptions) IsDetectOnlyGroup(groupId int64) bool {
+	return groupId > 0 && lists.ContainsInt64(this.DetectOnlyGroups, groupId)
+}
+
+// IsDetectOnlySet 规则集是否为仅检测模式
+func (this *WAFPolicyOptions) IsDetectOnlySet(setId int64) bool {
+	return setId > 0 && lists.ContainsInt64(this.DetectOnlySets, setId)
+}
+
+// AnomalyScoringConfig WAF异常评分模式设置
+// 开启后匹配的规则集不再直接执行动作，而是累加分数，最后根据分数阈值决定执行的动作
+type AnomalyScoringConfig struct {
+	IsOn                bool                `yaml:"isOn" json:"isOn"`
+	ParanoiaLevel       int                 `yaml:"paranoiaLevel" json:"paranoiaLevel"`             // 偏执级别1-4，只检查级别不高于此值的规则分组，默认为1
+	DefaultScore        int                 `yaml:"defaultScore" json:"defaultScore"`               // 没有设置分数的规则集的分数，默认为5
+	GroupParanoiaLevels map[string]int      `yaml:"groupParanoiaLevels" json:"groupParanoiaLevels"` // 规则分组的偏执级别：分组代号 => 级别，分组中已设置的级别优先
+	SetScores           map[string]int      `yaml:"setScores" json:"setScores"`                     // 规则集的分数：规则集代号 => 分数，规则集中已设置的分数优先
+	Thresholds          []*AnomalyThreshold `yaml:"thresholds" json:"thresholds"`                   // 请求阶段的分数阈值，默认为5分阻止
+	OutboundThresholds  []*AnomalyThreshold `yaml:"outboundThresholds" json:"outboundThresholds"`   // 响应阶段的分数阈值，默认为4分阻止
+}
+
+// AnomalyThreshold 异常评分阈值
+// 达到多个阈值时使用分数最高的一个
+type AnomalyThreshold struct {
+	Score   int                    `yaml:"score" json:"score"`     // 达到此分数时执行动作
+	Action  string                 `yaml:"action" json:"action"`   // 动作：block、captcha、log
+	Options map[string]interface{} `yaml:"options" json:"options"` // 动作选项，比如 block 的 statusCode
+}
+
+// Init 初始化
+func (this *AnomalyScoringConfig) Init() error {
+	if this.ParanoiaLevel < 0 || this.ParanoiaLevel > 4 {
+		return errors.New("'paranoiaLevel' should be between 1 and 4")
+	}
+	if this.ParanoiaLevel == 0 {
+		this.ParanoiaLevel = 1
+	}
+	if this.DefaultScore < 0 {
+		return errors.New("'defaultScore' should not be negative")
+	}
+	if this.DefaultScore == 0 {
+		this.DefaultScore = 5
+	}
+
+	if len(this.Thresholds) == 0 {
+		this.Thresholds = []*AnomalyThreshold{{Score: 5, Action: "block"}}
+	}
+	if len(this.OutboundThresholds) == 0 {
+		this.OutboundThresholds = []*AnomalyThreshold{{Score: 4, Action: "block"}}
+	}
+	for _, thresholds := range [][]*AnomalyThreshold{this.Thresholds, this.OutboundThresholds} {
+		for _, threshold := range thresholds {
+			if threshold.Score <= 0 {
+				return errors.New("threshold score should be greater than 0")
+			}
+			switch threshold.Action {
+			case "block", "captcha", "log":
+			default:
+				return errors.New("invalid threshold action '" + threshold.Action + "', should be one of 'block', 'captcha' and 'log'")
+			}
+		}
+
+		// 分数从高到低排列
+		sort.SliceStable(thresholds, func(i, j int) bool {
+			return thresholds[i].Score > thresholds[j].Score
+		})
+	}
+
+	return nil
+}
+
+// MatchThreshold 查找分数达到的最高阈值，没有达到任何阈值时返回 -1
+func (this *AnomalyScoringConfig) MatchThreshold(score int, isInbound bool) int {
+	var thresholds = this.Thresholds
+	if !isInbound {
+		thresholds = this.OutboundThresholds
+	}
+	for index, threshold := range thresholds {
+		if score >= threshold.Score {
+			return index
+		}
+	}
+	return -1
+}
+
+// GroupParanoiaLevel 规则分组的偏执级别
+func (this *AnomalyScoringConfig) GroupParanoiaLevel(groupCode string, groupLevel int) int {
+	if groupLevel > 0 {
+		return groupLevel
+	}
+	if len(groupCode) > 0 {
+		level, ok := this.GroupParanoiaLevels[groupCode]
+		if ok && level > 0 {
+			return level
+		}
+	}
+	return 1
+}
+
+// SetScore 规则集的分数
+func (this *AnomalyScoringConfig) SetScore(setCode string, setScore int) int {
+	if setScore > 0 {
+		return setScore
+	}
+	if setScore < 0 {
+		return 0
+	}
+	if len(setCode) > 0 {
+		score, ok := this.SetScores[setCode]
+		if ok && score >= 0 {
+			return score
+		}
+	}
+	return this.DefaultScore
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package configs_test
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func TestWAFConfig_FindPolicyOptions(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = configs.NewWAFConfig()
+	err := yaml.Unmarshal([]byte(`
+default:
+  anomalyScoring:
+    isOn: false
+policies:
+  1:
+    anomalyScoring:
+      isOn: true
+      paranoiaLevel: 2
+      thresholds:
+        - score: 5
+          action: log
+        - score: 10
+          action: captcha
+        - score: 20
+          action: block
+  2: { }
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scoring = config.FindPolicyOptions(1).AnomalyScoring
+	a.IsTrue(scoring.IsOn)
+	a.IsTrue(scoring.ParanoiaLevel == 2)
+	a.IsTrue(scoring.DefaultScore == 5)
+	a.IsTrue(scoring.Thresholds[0].Score == 20)
+	a.IsTrue(scoring.MatchThreshold(4, true) == -1)
+	a.IsTrue(scoring.Thresholds[scoring.MatchThreshold(5, true)].Action == "log")
+	a.IsTrue(scoring.Thresholds[scoring.MatchThreshold(12, true)].Action == "captcha")
+	a.IsTrue(scoring.Thresholds[scoring.MatchThreshold(25, true)].Action == "block")
+	a.IsTrue(scoring.OutboundThresholds[scoring.MatchThreshold(4, false)].Action == "block")
+
+	a.IsFalse(config.FindPolicyOptions(2).AnomalyScoring.IsOn)
+	a.IsFalse(config.FindPolicyOptions(3).AnomalyScoring.IsOn)
+	a.IsTrue(configs.NewWAFConfig().FindPolicyOptions(1).AnomalyScoring == nil)
+}
+
+func TestWAFPolicyOptions_DetectOnly(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = configs.NewWAFConfig()
+	err := yaml.Unmarshal([]byte(`
+default:
+  detectOnlyGroups: [ 1, 2 ]
+policies:
+  1:
+    detectOnlySets: [ 10 ]
+  2:
+    detectOnlyGroups: [ ]
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.IsTrue(config.FindPolicyOptions(1).IsDetectOnlyGroup(1))
+	a.IsTrue(config.FindPolicyOptions(1).IsDetectOnlySet(10))
+	a.IsFalse(config.FindPolicyOptions(1).IsDetectOnlySet(11))
+	a.IsFalse(config.FindPolicyOptions(2).IsDetectOnlyGroup(1))
+	a.IsTrue(config.FindPolicyOptions(3).IsDetectOnlyGroup(2))
+	a.IsFalse(config.FindPolicyOptions(3).IsDetectOnlyGroup(0))
+}
+
+func TestAnomalyScoringConfig_Init(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	a.IsNotNil((&configs.AnomalyScoringConfig{ParanoiaLevel: 5}).Init())
+	a.IsNotNil((&configs.AnomalyScoringConfig{Thresholds: []*configs.AnomalyThreshold{{Score: 5, Action: "allow"}}}).Init())
+	a.IsNotNil((&configs.AnomalyScoringConfig{Thresholds: []*configs.AnomalyThreshold{{Score: 0, Action: "block"}}}).Init())
+	a.IsNil((&configs.AnomalyScoringConfig{IsOn: true}).Init())
+}
+
+func TestAnomalyScoringConfig_Scores(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var config = &configs.AnomalyScoringConfig{
+		IsOn:                true,
+		GroupParanoiaLevels: map[string]int{"xss": 3},
+		SetScores:           map[string]int{"set1": 2},
+	}
+	err := config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.IsTrue(config.GroupParanoiaLevel("xss", 0) == 3)
+	a.IsTrue(config.GroupParanoiaLevel("xss", 2) == 2)
+	a.IsTrue(config.GroupParanoiaLevel("sqlInjection", 0) == 1)
+
+	a.IsTrue(config.SetScore("set1", 0) == 2)
+	a.IsTrue(config.SetScore("set1", 4) == 4)
+	a.IsTrue(config.SetScore("set2", 0) == 5)
+	a.IsTrue(config.SetScore("set2", -1) == 0)
+}
@@ -108,6 +108,18 @@ func (this *Map) CloseIPConns(ip string) {
 	}
 }
 
+// Count 连接总数
+func (this *Map) Count() int {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+
+	var count = 0
+	for _, m := range this.m {
+		count += len(m)
+	}
+	return count
+}
+
 func (this *Map) AllConns() []net.Conn {
 	this.locker.RLock()
 	defer this.locker.RUnlock()
@@ -288,7 +288,17 @@ func (this *APIStream) handleStatCache(message *pb.NodeStreamMessage) error {
 	} else {
 		sizeFormat = fmt.Sprintf("%.2f GB", float64(stat.Size)/1024/1024/1024)
 	}
-	this.replyOk(message.RequestId, "size:"+sizeFormat+", count:"+strconv.Itoa(stat.Count))
+	var result = "size:" + sizeFormat + ", count:" + strconv.Itoa(stat.Count)
+
+	// 准入统计
+	var policy = storage.Policy()
+	if policy != nil {
+		var admissionStat = caches.SharedManager.FindAdmissionStat(policy.Id)
+		if admissionStat != nil {
+			result += ", admitted:" + strconv.FormatUint(admissionStat.Admitted, 10) + ", rejected:" + strconv.FormatUint(admissionStat.Rejected, 10)
+		}
+	}
+	this.replyOk(message.RequestId, result)
 
 	return nil
 }
@@ -312,7 +322,16 @@ func (this *APIStream) handleCleanCache(message *pb.NodeStreamMessage) error {
 		}()
 	}
 
-	err = storage.CleanAll()
+	// 按标签清除
+	var tagMsg = &struct {
+		Tags []string `json:"tags"` // 要清除的缓存标签，不为空时只清除这些标签的缓存，否则清除所有缓存
+	}{}
+	_ = json.Unmarshal(message.DataJSON, tagMsg)
+	if len(tagMsg.Tags) > 0 {
+		err = storage.Purge(tagMsg.Tags, "tag")
+	} else {
+		err = storage.CleanAll()
+	}
 	if err != nil {
 		this.replyFail(message.RequestId, "clean cache failed: "+err.Error())
 		return err
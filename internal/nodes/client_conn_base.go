@@ -110,6 +110,8 @@ func (this *BaseClientConn) TCPConn() (tcpConn *net.TCPConn, ok bool) {
 			return clientConn.TCPConn()
 		}
 		tcpConn, ok = internalConn.(*net.TCPConn)
+	case *ProxyProtocolConn:
+		tcpConn, ok = conn.NetConn().(*net.TCPConn)
 	default:
 		tcpConn, ok = this.rawConn.(*net.TCPConn)
 	}
@@ -0,0 +1,87 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/quic-go/quic-go"
+	"sync"
+)
+
+// HTTP3ClientConn HTTP/3（QUIC）客户端连接
+// QUIC连接不是 net.Conn，所以在这里单独实现和 ClientConn 一样的服务绑定和并发连接数限制
+type HTTP3ClientConn struct {
+	rawConn       *quic.Conn
+	rawRemoteAddr string
+
+	isBound     bool
+	userId      int64
+	serverId    int64
+	isWebsocket bool
+	isClosed    bool
+
+	closeOnce sync.Once
+}
+
+func NewHTTP3ClientConn(rawConn *quic.Conn) *HTTP3ClientConn {
+	return &HTTP3ClientConn{
+		rawConn:       rawConn,
+		rawRemoteAddr: rawConn.RemoteAddr().String(),
+	}
+}
+
+// IsClosed 是否已关闭
+func (this *HTTP3ClientConn) IsClosed() bool {
+	return this.isClosed
+}
+
+// IsBound 是否已绑定服务
+func (this *HTTP3ClientConn) IsBound() bool {
+	return this.isBound
+}
+
+// Bind 绑定服务
+func (this *HTTP3ClientConn) Bind(serverId int64, remoteAddr string, maxConnsPerServer int, maxConnsPerIP int) bool {
+	if this.isBound {
+		return true
+	}
+	this.isBound = true
+	this.serverId = serverId
+
+	// 检查是否可以连接
+	return sharedClientConnLimiter.Add(this.rawRemoteAddr, serverId, remoteAddr, maxConnsPerServer, maxConnsPerIP)
+}
+
+// ServerId 读取当前连接绑定的服务ID
+func (this *HTTP3ClientConn) ServerId() int64 {
+	return this.serverId
+}
+
+// SetServerId 设置服务ID
+func (this *HTTP3ClientConn) SetServerId(serverId int64) {
+	this.serverId = serverId
+}
+
+// SetUserId 设置所属服务的用户ID
+func (this *HTTP3ClientConn) SetUserId(userId int64) {
+	this.userId = userId
+}
+
+// UserId 获取当前连接所属服务的用户ID
+func (this *HTTP3ClientConn) UserId() int64 {
+	return this.userId
+}
+
+func (this *HTTP3ClientConn) SetIsWebsocket(isWebsocket bool) {
+	this.isWebsocket = isWebsocket
+}
+
+// Close 关闭连接，并释放连接数限制
+func (this *HTTP3ClientConn) Close() error {
+	var err error
+	this.closeOnce.Do(func() {
+		this.isClosed = true
+		err = this.rawConn.CloseWithError(0, "")
+		sharedClientConnLimiter.Remove(this.rawRemoteAddr)
+	})
+	return err
+}
@@ -3,28 +3,56 @@
 package nodes
 
 import (
+	"errors"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	"github.com/TeaOSLab/EdgeNode/internal/firewalls"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
 	"github.com/TeaOSLab/EdgeNode/internal/iplibrary"
 	"github.com/TeaOSLab/EdgeNode/internal/waf"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+type clientAcceptResult struct {
+	conn net.Conn
+	err  error
+}
+
 // ClientListener 客户端网络监听
+// 开启SO_REUSEPORT时同一个地址上的每个监听器都对应一个ClientListener，分别在单独的循环中接受连接
 type ClientListener struct {
 	rawListener net.Listener
 	isHTTP      bool
 	isTLS       bool
+	addr        string // 完整的监听地址，用来查找本地监听设置
+
+	// 读取PROXY协议头时不能阻塞其他连接，所以改为在单独的goroutine中接受连接
+	isAsync       int32
+	asyncOnce     sync.Once
+	acceptChan    chan *clientAcceptResult
+	readyConnChan chan net.Conn // 已经读取完PROXY协议头的连接
+	closeChan     chan struct{}
+	closeOnce     sync.Once
 }
 
 func NewClientListener(listener net.Listener, isHTTP bool) *ClientListener {
 	return &ClientListener{
-		rawListener: listener,
-		isHTTP:      isHTTP,
+		rawListener:   listener,
+		isHTTP:        isHTTP,
+		acceptChan:    make(chan *clientAcceptResult),
+		readyConnChan: make(chan net.Conn),
+		closeChan:     make(chan struct{}),
 	}
 }
 
+// SetAddr 设置完整的监听地址
+func (this *ClientListener) SetAddr(addr string) {
+	this.addr = addr
+}
+
 func (this *ClientListener) SetIsTLS(isTLS bool) {
 	this.isTLS = isTLS
 }
@@ -34,57 +62,168 @@ func (this *ClientListener) IsTLS() bool {
 }
 
 func (this *ClientListener) Accept() (net.Conn, error) {
-	conn, err := this.rawListener.Accept()
+	for {
+		conn, isReady, err := this.next()
+		if err != nil {
+			return nil, err
+		}
+		if isReady {
+			return conn, nil
+		}
+
+		// 从信任的来源读取PROXY协议头
+		var proxyProtocol = sharedListenerConfig.FindAddressOptions(this.addr).ProxyProtocol
+		if proxyProtocol != nil && proxyProtocol.IsTrusted(this.connIP(conn)) {
+			this.startAsync()
+			goman.New(func() {
+				this.acceptProxyProtocolConn(conn, proxyProtocol)
+			})
+			continue
+		}
+
+		clientConn, ok := this.wrapConn(conn)
+		if ok {
+			return clientConn, nil
+		}
+	}
+}
+
+func (this *ClientListener) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.closeChan)
+	})
+
+	return this.rawListener.Close()
+}
+
+func (this *ClientListener) Addr() net.Addr {
+	return this.rawListener.Addr()
+}
+
+// 获取下一个连接
+// isReady 表示连接已经处理完毕，可以直接返回
+func (this *ClientListener) next() (conn net.Conn, isReady bool, err error) {
+	if atomic.LoadInt32(&this.isAsync) == 0 {
+		conn, err = this.rawListener.Accept()
+		return
+	}
+
+	select {
+	case result := <-this.acceptChan:
+		return result.conn, false, result.err
+	case conn = <-this.readyConnChan:
+		return conn, true, nil
+	case <-this.closeChan:
+		return nil, false, net.ErrClosed
+	}
+}
+
+// 开始在单独的goroutine中接受连接
+func (this *ClientListener) startAsync() {
+	this.asyncOnce.Do(func() {
+		atomic.StoreInt32(&this.isAsync, 1)
+		goman.New(func() {
+			this.acceptLoop()
+		})
+	})
+}
+
+// 在单独的goroutine中接受连接
+func (this *ClientListener) acceptLoop() {
+	for {
+		conn, err := this.rawListener.Accept()
+		select {
+		case this.acceptChan <- &clientAcceptResult{conn: conn, err: err}:
+		case <-this.closeChan:
+			if conn != nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		if err != nil && errors.Is(err, net.ErrClosed) {
+			return
+		}
+	}
+}
+
+// 读取PROXY协议头
+func (this *ClientListener) acceptProxyProtocolConn(conn net.Conn, config *configs.InboundProxyProtocolConfig) {
+	proxyConn, err := ReadProxyProtocolConn(conn, config.Timeout())
 	if err != nil {
-		return nil, err
+		// 信任的来源必须发送PROXY协议头
+		_ = conn.Close()
+		return
 	}
 
-	// 是否在WAF名单中
+	clientConn, ok := this.wrapConn(proxyConn)
+	if !ok {
+		return
+	}
+
+	select {
+	case this.readyConnChan <- clientConn:
+	case <-this.closeChan:
+		_ = clientConn.Close()
+	}
+}
+
+// 检查连接是否在WAF名单中，并包装为客户端连接
+func (this *ClientListener) wrapConn(conn net.Conn) (net.Conn, bool) {
 	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
 	var isInAllowList = false
 	if err == nil {
-		canGoNext, inAllowList := iplibrary.AllowIP(ip, 0)
+		canGoNext, inAllowList := checkClientIP(ip)
 		isInAllowList = inAllowList
-		if !waf.SharedIPWhiteList.Contains(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 0, ip) {
-			expiresAt, ok := waf.SharedIPBlackList.ContainsExpires(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 0, ip)
-			if ok {
-				var timeout = expiresAt - time.Now().Unix()
-				if timeout > 0 {
-					canGoNext = false
-
-					if timeout > 3600 {
-						timeout = 3600
-					}
-
-					// 使用本地防火墙延长封禁
-					var fw = firewalls.Firewall()
-					if fw != nil && !fw.IsMock() {
-						// 这里 int(int64) 转换的前提是限制了 timeout <= 3600，否则将有整型溢出的风险
-						_ = fw.DropSourceIP(ip, int(timeout), true)
-					}
-				}
-			}
-		}
 
 		if !canGoNext {
-			tcpConn, ok := conn.(*net.TCPConn)
+			lingerConn, ok := conn.(LingerConn)
 			if ok {
-				_ = tcpConn.SetLinger(0)
+				_ = lingerConn.SetLinger(0)
 			}
 
 			_ = conn.Close()
 
-			return this.Accept()
+			return nil, false
 		}
 	}
 
-	return NewClientConn(conn, this.isHTTP, this.isTLS, isInAllowList), nil
+	return NewClientConn(conn, this.isHTTP, this.isTLS, isInAllowList), true
 }
 
-func (this *ClientListener) Close() error {
-	return this.rawListener.Close()
+// 连接的来源IP
+func (this *ClientListener) connIP(conn net.Conn) net.IP {
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UnixAddr:
+		// Unix套接字连接来自本机
+		return net.IPv4(127, 0, 0, 1)
+	}
+	return nil
 }
 
-func (this *ClientListener) Addr() net.Addr {
-	return this.rawListener.Addr()
+// 检查客户端IP是否可以连接，同时返回是否在IP名单的白名单中
+func checkClientIP(ip string) (canGoNext bool, isInAllowList bool) {
+	canGoNext, isInAllowList = iplibrary.AllowIP(ip, 0)
+	if !waf.SharedIPWhiteList.Contains(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 0, ip) {
+		expiresAt, ok := waf.SharedIPBlackList.ContainsExpires(waf.IPTypeAll, firewallconfigs.FirewallScopeGlobal, 0, ip)
+		if ok {
+			var timeout = expiresAt - time.Now().Unix()
+			if timeout > 0 {
+				canGoNext = false
+
+				if timeout > 3600 {
+					timeout = 3600
+				}
+
+				// 使用本地防火墙延长封禁
+				var fw = firewalls.Firewall()
+				if fw != nil && !fw.IsMock() {
+					// 这里 int(int64) 转换的前提是限制了 timeout <= 3600，否则将有整型溢出的风险
+					_ = fw.DropSourceIP(ip, int(timeout), true)
+				}
+			}
+		}
+	}
+	return
 }
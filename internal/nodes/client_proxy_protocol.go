@@ -0,0 +1,84 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bufio"
+	"github.com/pires/go-proxyproto"
+	"net"
+	"time"
+)
+
+// ProxyProtocolConn 读取过PROXY协议头的客户端连接
+// RemoteAddr() 返回PROXY协议头中的客户端地址，LocalAddr() 仍然返回本机地址，以便于匹配网站
+type ProxyProtocolConn struct {
+	net.Conn
+
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+// ReadProxyProtocolConn 从连接中读取PROXY协议头
+func ReadProxyProtocolConn(conn net.Conn, timeout time.Duration) (*ProxyProtocolConn, error) {
+	if timeout > 0 {
+		err := conn.SetReadDeadline(time.Now().Add(timeout))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var reader = bufio.NewReader(conn)
+	header, err := proxyproto.Read(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout > 0 {
+		err = conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var proxyConn = &ProxyProtocolConn{
+		Conn:       conn,
+		reader:     reader,
+		remoteAddr: conn.RemoteAddr(),
+	}
+
+	// LOCAL命令（比如负载均衡器的健康检查）和未知协议中不包含客户端地址
+	if header.Command.IsProxy() && !header.TransportProtocol.IsUnspec() && header.SourceAddr != nil {
+		proxyConn.remoteAddr = header.SourceAddr
+	}
+
+	return proxyConn, nil
+}
+
+func (this *ProxyProtocolConn) Read(b []byte) (n int, err error) {
+	// 先读取缓冲区中剩余的数据
+	if this.reader != nil {
+		if this.reader.Buffered() > 0 {
+			return this.reader.Read(b)
+		}
+		this.reader = nil
+	}
+	return this.Conn.Read(b)
+}
+
+func (this *ProxyProtocolConn) RemoteAddr() net.Addr {
+	return this.remoteAddr
+}
+
+// NetConn 获取包装前的连接
+func (this *ProxyProtocolConn) NetConn() net.Conn {
+	return this.Conn
+}
+
+// SetLinger 设置Linger
+func (this *ProxyProtocolConn) SetLinger(seconds int) error {
+	tcpConn, ok := this.Conn.(*net.TCPConn)
+	if ok {
+		return tcpConn.SetLinger(seconds)
+	}
+	return nil
+}
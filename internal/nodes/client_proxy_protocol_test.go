@@ -0,0 +1,76 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"github.com/pires/go-proxyproto"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReadProxyProtocolConn(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	for _, version := range []byte{1, 2} {
+		var header = &proxyproto.Header{
+			Version:           version,
+			Command:           proxyproto.PROXY,
+			TransportProtocol: proxyproto.TCPv4,
+			SourceAddr:        &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 12345},
+			DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80},
+		}
+		headerData, err := header.Format()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		serverConn, clientConn := net.Pipe()
+		go func() {
+			_, _ = clientConn.Write(append(headerData, []byte("GET / HTTP/1.1\r\n")...))
+			_ = clientConn.Close()
+		}()
+
+		proxyConn, err := ReadProxyProtocolConn(serverConn, 1*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(proxyConn.RemoteAddr().String() == "1.2.3.4:12345")
+
+		data, err := io.ReadAll(proxyConn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.IsTrue(string(data) == "GET / HTTP/1.1\r\n")
+		_ = proxyConn.Close()
+	}
+}
+
+func TestReadProxyProtocolConn_Invalid(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	// 没有PROXY协议头
+	{
+		serverConn, clientConn := net.Pipe()
+		go func() {
+			_, _ = clientConn.Write([]byte("GET / HTTP/1.1\r\n"))
+			_ = clientConn.Close()
+		}()
+		_, err := ReadProxyProtocolConn(serverConn, 1*time.Second)
+		a.IsNotNil(err)
+		_ = serverConn.Close()
+	}
+
+	// 超时
+	{
+		serverConn, clientConn := net.Pipe()
+		var before = time.Now()
+		_, err := ReadProxyProtocolConn(serverConn, 100*time.Millisecond)
+		a.IsNotNil(err)
+		a.IsTrue(time.Since(before) < 1*time.Second)
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/TeaOSLab/EdgeNode/internal/conns"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/utils"
+	"github.com/iwind/TeaGo/types"
+	"github.com/iwind/gosock/pkg/gosock"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultGracefulDrainSeconds = 300              // 平滑重启时等待已有连接结束的默认时间
+	gracefulReadyTimeout        = 60 * time.Second // 等待新进程启动的最长时间
+)
+
+var sharedGracefulRestarter = NewGracefulRestarter()
+
+// GracefulRestarter 平滑重启
+// 将当前的TCP和Unix监听器传递给新进程，新进程开始接受连接后，当前进程停止接受新连接，
+// 在已有的请求和Websocket连接结束或超时后退出；UDP监听器会在当前进程关闭后由新进程重新监听
+//
+// 启动新进程前当前进程会先释放缓存目录和缓存数据库，以免两个进程同时读写，在退出前仍未结束的请求不再使用缓存
+type GracefulRestarter struct {
+	sock         *gosock.Sock
+	isRestarting int32
+
+	exeModTime int64
+	exeSize    int64
+}
+
+// NewGracefulRestarter 获取新对象
+func NewGracefulRestarter() *GracefulRestarter {
+	var restarter = &GracefulRestarter{}
+
+	stat, err := os.Stat(restarter.exePath())
+	if err == nil {
+		restarter.exeModTime = stat.ModTime().UnixNano()
+		restarter.exeSize = stat.Size()
+	}
+
+	return restarter
+}
+
+// SetSock 设置本地sock，启动新进程前需要关闭，以便于新进程监听
+func (this *GracefulRestarter) SetSock(sock *gosock.Sock) {
+	this.sock = sock
+}
+
+// Restart 平滑重启
+// 返回新进程的PID
+func (this *GracefulRestarter) Restart(drainTimeout time.Duration) (newPid int, err error) {
+	if !atomic.CompareAndSwapInt32(&this.isRestarting, 0, 1) {
+		return 0, errors.New("the process is restarting")
+	}
+
+	// 释放缓存，由新进程重新打开
+	caches.SharedManager.UpdatePolicies([]*serverconfigs.HTTPCachePolicy{})
+
+	newPid, err = this.startNewProcess()
+	if err != nil {
+		this.restoreCaches()
+		atomic.StoreInt32(&this.isRestarting, 0)
+		return 0, err
+	}
+
+	remotelogs.Println("GRACEFUL_RESTART", "new process started, pid: "+types.String(newPid)+", draining connections ...")
+
+	goman.New(func() {
+		this.drain(drainTimeout)
+	})
+
+	return newPid, nil
+}
+
+// IsRestarting 是否正在平滑重启
+func (this *GracefulRestarter) IsRestarting() bool {
+	return atomic.LoadInt32(&this.isRestarting) == 1
+}
+
+// ExecutableChanged 可执行文件是否在启动后有变化
+func (this *GracefulRestarter) ExecutableChanged() bool {
+	stat, err := os.Stat(this.exePath())
+	if err != nil {
+		return false
+	}
+	return stat.ModTime().UnixNano() != this.exeModTime || stat.Size() != this.exeSize
+}
+
+// 启动新进程，并等待新进程启动完成
+func (this *GracefulRestarter) startNewProcess() (int, error) {
+	var files = []*os.File{}
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+
+	// 监听器，从3开始依次排列
+	var infoList = []*inheritedListenerInfo{}
+	for _, listener := range sharedListenerManager.FindStreamListeners() {
+		listenerFiles, err := listener.Files()
+		if err != nil {
+			remotelogs.Warn("GRACEFUL_RESTART", "can not pass listener to new process: "+err.Error())
+			continue
+		}
+		for _, file := range listenerFiles {
+			files = append(files, file)
+			infoList = append(infoList, &inheritedListenerInfo{
+				Addr: listener.FullAddr(),
+				Fd:   2 + len(files),
+			})
+		}
+	}
+	infoJSON, err := json.Marshal(infoList)
+	if err != nil {
+		return 0, err
+	}
+
+	// 用来通知启动完成的管道
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = readyReader.Close()
+	}()
+	files = append(files, readyWriter)
+	var readyFd = 2 + len(files)
+
+	var cmd = exec.Command(this.exePath())
+	cmd.Env = append(this.env(), envInheritedListeners+"="+string(infoJSON), envUpgradeReadyFd+"="+strconv.Itoa(readyFd), "EdgeBackground=on")
+	cmd.ExtraFiles = files
+
+	// 关闭本地sock，以便于新进程监听
+	if this.sock != nil {
+		_ = this.sock.Close()
+	}
+
+	err = cmd.Start()
+
+	// 关闭当前进程中的写入端，以便于在新进程退出时可以读取到EOF
+	_ = readyWriter.Close()
+
+	if err != nil {
+		this.relistenSock()
+		return 0, err
+	}
+
+	_ = readyReader.SetReadDeadline(time.Now().Add(gracefulReadyTimeout))
+	_, err = bufio.NewReader(readyReader).ReadString('\n')
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		this.relistenSock()
+		return 0, errors.New("wait for new process failed: " + err.Error())
+	}
+
+	var pid = cmd.Process.Pid
+	_ = cmd.Process.Release()
+	return pid, nil
+}
+
+// 停止接受新连接，等待已有连接结束后退出
+func (this *GracefulRestarter) drain(timeout time.Duration) {
+	// 新进程继续使用Unix套接字文件，关闭时不能删除
+	// 这里只关闭已经传递给新进程的监听器，其他服务在退出前仍然需要继续运行，以便于处理已有的请求
+	for _, listener := range sharedListenerManager.FindStreamListeners() {
+		listener.KeepUnixSockFile()
+		listener.StopAccepting()
+	}
+
+	var deadline = time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if sharedListenerManager.TotalActiveConnections() <= 0 && conns.SharedMap.Count() == 0 {
+			break
+		}
+		time.Sleep(1 * time.Second)
+	}
+
+	events.Notify(events.EventQuit)
+	events.Notify(events.EventTerminated)
+	utils.Exit()
+}
+
+// 启动新进程失败时重新打开缓存
+func (this *GracefulRestarter) restoreCaches() {
+	var nodeConfig = sharedNodeConfig
+	if nodeConfig == nil || len(nodeConfig.HTTPCachePolicies) == 0 {
+		return
+	}
+	caches.SharedManager.UpdatePolicies(nodeConfig.HTTPCachePolicies)
+}
+
+// 启动新进程失败时重新监听本地sock
+func (this *GracefulRestarter) relistenSock() {
+	if this.sock == nil {
+		return
+	}
+	var sock = this.sock
+	goman.New(func() {
+		err := sock.Listen()
+		if err != nil {
+			remotelogs.Error("GRACEFUL_RESTART", "listen sock failed: "+err.Error())
+		}
+	})
+}
+
+// 新进程的环境变量
+func (this *GracefulRestarter) env() []string {
+	var result = []string{}
+	for _, env := range os.Environ() {
+		// 新进程不是由守护进程直接启动的
+		if strings.HasPrefix(env, "EdgeDaemon=") ||
+			strings.HasPrefix(env, envInheritedListeners+"=") ||
+			strings.HasPrefix(env, envUpgradeReadyFd+"=") {
+			continue
+		}
+		result = append(result, env)
+	}
+	return result
+}
+
+// 可执行文件路径
+// 升级时当前可执行文件会被改名，所以总是使用 bin/ 目录下的同名文件
+func (this *GracefulRestarter) exePath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return os.Args[0]
+	}
+	return filepath.Dir(exe) + "/" + teaconst.ProcessName
+}
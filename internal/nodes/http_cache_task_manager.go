@@ -13,16 +13,21 @@ import (
 	"github.com/TeaOSLab/EdgeNode/internal/goman"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
 	"github.com/TeaOSLab/EdgeNode/internal/rpc"
+	"github.com/TeaOSLab/EdgeNode/internal/zero"
 	"github.com/iwind/TeaGo/Tea"
 	"io"
 	"net"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 func init() {
+	caches.SharedManager.RefreshAheadFunc = SharedHTTPCacheTaskManager.RefreshAhead
+
 	events.On(events.EventStart, func() {
 		goman.New(func() {
 			SharedHTTPCacheTaskManager.Start()
@@ -32,6 +37,16 @@ func init() {
 
 var SharedHTTPCacheTaskManager = NewHTTPCacheTaskManager()
 
+// 同时在后台刷新的最大URL数量
+const httpCacheTaskMaxRefreshing = 256
+
+// 本地请求使用的缓存动作，通过 X-Edge-Cache-Action 传递
+const (
+	httpCacheActionFetch      = "fetch"      // 重新从源站读取
+	httpCacheActionRevalidate = "revalidate" // 使用缓存中的ETag和Last-Modified向源站验证
+	httpCacheActionSlice      = "slice"      // 从源站读取某个分片
+)
+
 // HTTPCacheTaskManager 缓存任务管理
 type HTTPCacheTaskManager struct {
 	ticker      *time.Ticker
@@ -39,6 +54,9 @@ type HTTPCacheTaskManager struct {
 	protocolReg *regexp.Regexp
 
 	taskQueue chan *pb.PurgeServerCacheRequest
+
+	refreshingMap    map[string]zero.Zero // cache key => Zero
+	refreshingLocker sync.Mutex
 }
 
 func NewHTTPCacheTaskManager() *HTTPCacheTaskManager {
@@ -69,8 +87,9 @@ func NewHTTPCacheTaskManager() *HTTPCacheTaskManager {
 				},
 			},
 		},
-		protocolReg: regexp.MustCompile(`^(?i)(http|https)://`),
-		taskQueue:   make(chan *pb.PurgeServerCacheRequest, 1024),
+		protocolReg:   regexp.MustCompile(`^(?i)(http|https)://`),
+		taskQueue:     make(chan *pb.PurgeServerCacheRequest, 1024),
+		refreshingMap: map[string]zero.Zero{},
 	}
 }
 
@@ -198,6 +217,11 @@ func (this *HTTPCacheTaskManager) processKey(key *pb.HTTPCacheTaskKey) error {
 				if err != nil {
 					return err
 				}
+			case "tag":
+				err := storage.Purge([]string{key.Key}, "tag")
+				if err != nil {
+					return err
+				}
 			}
 		}
 	case "fetch":
@@ -220,15 +244,70 @@ func (this *HTTPCacheTaskManager) fetchKey(key *pb.HTTPCacheTaskKey) error {
 		fullKey = "https://" + fullKey
 	}
 
+	return this.fetchURL(fullKey, nil, httpCacheActionFetch)
+}
+
+// RefreshURL 在后台重新从源站读取内容并更新缓存
+// 同一个缓存Key同时只会有一个刷新任务；header 为原始请求的Header，用来生成同样的Vary变体
+func (this *HTTPCacheTaskManager) RefreshURL(cacheKey string, fullURL string, header http.Header) {
+	this.refreshURL(cacheKey, fullURL, header, httpCacheActionFetch)
+}
+
+// RefreshAhead 在后台向源站验证即将过期的缓存
+// 源站内容没有变化时只更新缓存的有效期，有变化时重新写入缓存
+func (this *HTTPCacheTaskManager) RefreshAhead(key string) {
+	// 无法从Key中得知完整URL的时候忽略
+	if !this.protocolReg.MatchString(key) {
+		return
+	}
+	this.refreshURL(key, key, nil, httpCacheActionRevalidate)
+}
+
+func (this *HTTPCacheTaskManager) refreshURL(cacheKey string, fullURL string, header http.Header, action string) {
+	this.refreshingLocker.Lock()
+	_, isRefreshing := this.refreshingMap[cacheKey]
+	if isRefreshing || len(this.refreshingMap) >= httpCacheTaskMaxRefreshing {
+		this.refreshingLocker.Unlock()
+		return
+	}
+	this.refreshingMap[cacheKey] = zero.New()
+	this.refreshingLocker.Unlock()
+
+	goman.New(func() {
+		defer func() {
+			this.refreshingLocker.Lock()
+			delete(this.refreshingMap, cacheKey)
+			this.refreshingLocker.Unlock()
+		}()
+
+		err := this.fetchURL(fullURL, header, action)
+		if err != nil {
+			remotelogs.Warn("HTTP_CACHE_TASK_MANAGER", "refresh cache failed: "+err.Error())
+		}
+	})
+}
+
+// 通过本地请求读取URL以生成缓存
+func (this *HTTPCacheTaskManager) fetchURL(fullKey string, header http.Header, action string) error {
 	req, err := http.NewRequest(http.MethodGet, fullKey, nil)
 	if err != nil {
 		return errors.New("invalid url: " + fullKey + ": " + err.Error())
 	}
 
-	// TODO 可以在管理界面自定义Header
-	req.Header.Set("X-Edge-Cache-Action", "fetch")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0.4183.121 Safari/537.36") // TODO 可以定义
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	if header != nil {
+		for k, v := range header {
+			// 去除条件请求和区间请求相关的Header，以便于读取完整内容
+			if k == "Range" || strings.HasPrefix(k, "If-") {
+				continue
+			}
+			req.Header[k] = v
+		}
+	} else {
+		// TODO 可以在管理界面自定义Header
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0.4183.121 Safari/537.36") // TODO 可以定义
+		req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	}
+	req.Header.Set("X-Edge-Cache-Action", action)
 	resp, err := this.httpClient.Do(req)
 	if err != nil {
 		return errors.New("request failed: " + fullKey + ": " + err.Error())
@@ -248,3 +327,37 @@ func (this *HTTPCacheTaskManager) fetchKey(key *pb.HTTPCacheTaskKey) error {
 
 	return nil
 }
+
+// FetchSlice 通过本地请求读取某个分片以生成分片缓存
+func (this *HTTPCacheTaskManager) FetchSlice(fullURL string, header http.Header, start int64, end int64) error {
+	req, err := http.NewRequest(http.MethodGet, fullURL, nil)
+	if err != nil {
+		return errors.New("invalid url: " + fullURL + ": " + err.Error())
+	}
+
+	for k, v := range header {
+		// 分片内容不压缩，也不使用条件请求
+		if k == "Range" || k == "Accept-Encoding" || strings.HasPrefix(k, "If-") {
+			continue
+		}
+		req.Header[k] = v
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10))
+	req.Header.Set("X-Edge-Cache-Action", httpCacheActionSlice)
+	resp, err := this.httpClient.Do(req)
+	if err != nil {
+		return errors.New("request failed: " + fullURL + ": " + err.Error())
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// 读取内容，以便于生成缓存
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return errors.New("fetch slice failed: " + fullURL + ": unexpected status '" + strconv.Itoa(resp.StatusCode) + "'")
+	}
+	return nil
+}
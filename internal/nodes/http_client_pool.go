@@ -5,9 +5,11 @@ import (
 	"crypto/tls"
 	"errors"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	"github.com/TeaOSLab/EdgeNode/internal/goman"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
 	"github.com/pires/go-proxyproto"
+	"golang.org/x/net/http2"
 	"net"
 	"net/http"
 	"runtime"
@@ -53,7 +55,18 @@ func (this *HTTPClientPool) Client(req *HTTPRequest,
 		return nil, errors.New("origin addr should not be empty (originId:" + strconv.FormatInt(origin.Id, 10) + ")")
 	}
 
+	var httpVersion = sharedProxyConfig.FindOriginOptions(origin.Id).HTTPVersion
+
 	var key = origin.UniqueKey() + "@" + originAddr
+	if len(httpVersion) > 0 {
+		key += "@" + httpVersion
+
+		// 使用HTTP/2时多个请求会复用同一个连接，而TOA和PROXY Protocol只在建立连接时发送客户端地址，
+		// 所以此时每个客户端地址使用单独的Client，以保证连接上的请求都来自同一个客户端地址
+		if req != nil && (this.isTOAOn() || this.isPROXYProtocolOn(proxyProtocol)) {
+			key += "@" + req.requestRemoteAddr(true)
+		}
+	}
 	var isLnRequest = origin.Id == 0
 
 	this.locker.RLock()
@@ -114,46 +127,59 @@ func (this *HTTPClientPool) Client(req *HTTPRequest,
 	}
 
 	// TLS通讯
-	var tlsConfig = &tls.Config{
-		InsecureSkipVerify: true,
-	}
-	if origin.Cert != nil {
-		var obj = origin.Cert.CertObject()
-		if obj != nil {
-			tlsConfig.InsecureSkipVerify = false
-			tlsConfig.Certificates = []tls.Certificate{*obj}
-			if len(origin.Cert.ServerName) > 0 {
-				tlsConfig.ServerName = origin.Cert.ServerName
-			}
+	var tlsConfig = NewOriginTLSConfig(origin, "")
+
+	// 连接源站
+	var dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// 支持TOA的连接
+		conn, err := this.handleTOA(req, ctx, network, originAddr, connectionTimeout)
+		if conn != nil || err != nil {
+			return conn, err
 		}
-	}
 
-	var transport = &HTTPClientTransport{
-		Transport: &http.Transport{
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				// 支持TOA的连接
-				conn, err := this.handleTOA(req, ctx, network, originAddr, connectionTimeout)
-				if conn != nil || err != nil {
-					return conn, err
-				}
+		// 普通的连接
+		conn, err = (&net.Dialer{
+			Timeout:   connectionTimeout,
+			KeepAlive: 1 * time.Minute,
+		}).DialContext(ctx, network, originAddr)
+		if err != nil {
+			return nil, err
+		}
 
-				// 普通的连接
-				conn, err = (&net.Dialer{
-					Timeout:   connectionTimeout,
-					KeepAlive: 1 * time.Minute,
-				}).DialContext(ctx, network, originAddr)
-				if err != nil {
-					return nil, err
-				}
+		// 处理PROXY protocol
+		err = this.handlePROXYProtocol(conn, req, proxyProtocol)
+		if err != nil {
+			return nil, err
+		}
+
+		return conn, nil
+	}
 
-				// 处理PROXY protocol
-				err = this.handlePROXYProtocol(conn, req, proxyProtocol)
+	var transport = &HTTPClientTransport{}
+	var isTLS = origin.Addr.Protocol.IsHTTPSFamily()
+	if httpVersion == configs.OriginHTTPVersionH2C && !isTLS {
+		// 明文HTTP/2
+		// http2.Transport 不支持 MaxConnsPerHost，所以在建立连接时限制连接数
+		var connLimiter = newOriginConnLimiter(maxConnections)
+		transport.RoundTripper = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				if !connLimiter.Acquire(connectionTimeout) {
+					return nil, errors.New("too many connections to origin '" + originAddr + "'")
+				}
+				conn, err := dial(context.Background(), network, addr)
 				if err != nil {
+					connLimiter.Release()
 					return nil, err
 				}
-
-				return conn, nil
+				return connLimiter.Wrap(conn), nil
 			},
+			ReadIdleTimeout: 30 * time.Second,
+			PingTimeout:     15 * time.Second,
+		}
+	} else {
+		var httpTransport = &http.Transport{
+			DialContext:           dial,
 			MaxIdleConns:          0,
 			MaxIdleConnsPerHost:   idleConns,
 			MaxConnsPerHost:       maxConnections,
@@ -163,7 +189,19 @@ func (this *HTTPClientPool) Client(req *HTTPRequest,
 			TLSClientConfig:       tlsConfig,
 			ReadBufferSize:        8 * 1024,
 			Proxy:                 nil,
-		},
+		}
+
+		// 通过ALPN协商HTTP/2
+		if isTLS && (httpVersion == configs.OriginHTTPVersionHTTP2 || httpVersion == configs.OriginHTTPVersionH2C) {
+			h2Transport, err := http2.ConfigureTransports(httpTransport)
+			if err != nil {
+				return nil, err
+			}
+			h2Transport.ReadIdleTimeout = 30 * time.Second
+			h2Transport.PingTimeout = 15 * time.Second
+		}
+
+		transport.RoundTripper = httpTransport
 	}
 
 	rawClient = &http.Client{
@@ -193,6 +231,17 @@ func (this *HTTPClientPool) Client(req *HTTPRequest,
 	return rawClient, nil
 }
 
+// Reset 关闭并清除所有的Client
+// 在回源设置变化时调用
+func (this *HTTPClientPool) Reset() {
+	this.locker.Lock()
+	for k, client := range this.clientsMap {
+		delete(this.clientsMap, k)
+		client.Close()
+	}
+	this.locker.Unlock()
+}
+
 // 清理不使用的Client
 func (this *HTTPClientPool) cleanClients() {
 	for range this.cleanTicker.C {
@@ -209,6 +258,17 @@ func (this *HTTPClientPool) cleanClients() {
 	}
 }
 
+// 是否开启了TOA
+func (this *HTTPClientPool) isTOAOn() bool {
+	var toaConfig = sharedTOAManager.Config()
+	return toaConfig != nil && toaConfig.IsOn
+}
+
+// 是否开启了PROXY Protocol
+func (this *HTTPClientPool) isPROXYProtocolOn(proxyProtocol *serverconfigs.ProxyProtocolConfig) bool {
+	return proxyProtocol != nil && proxyProtocol.IsOn && (proxyProtocol.Version == serverconfigs.ProxyProtocolVersion1 || proxyProtocol.Version == serverconfigs.ProxyProtocolVersion2)
+}
+
 // 支持TOA
 func (this *HTTPClientPool) handleTOA(req *HTTPRequest, ctx context.Context, network string, originAddr string, connectionTimeout time.Duration) (net.Conn, error) {
 	// TODO 每个服务读取自身所属集群的TOA设置
@@ -252,7 +312,10 @@ func (this *HTTPClientPool) handlePROXYProtocol(conn net.Conn, req *HTTPRequest,
 		var destAddr = conn.RemoteAddr()
 		var reqConn = req.RawReq.Context().Value(HTTPConnContextKey)
 		if reqConn != nil {
-			destAddr = reqConn.(net.Conn).LocalAddr()
+			netConn, ok := reqConn.(net.Conn)
+			if ok {
+				destAddr = netConn.LocalAddr()
+			}
 		}
 		var header = proxyproto.Header{
 			Version:           byte(proxyProtocol.Version),
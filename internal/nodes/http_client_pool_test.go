@@ -2,6 +2,14 @@ package nodes
 
 import (
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/pires/go-proxyproto"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"runtime"
 	"testing"
 	"time"
@@ -75,3 +83,127 @@ func BenchmarkHTTPClientPool_Client(b *testing.B) {
 		_, _ = pool.Client(nil, origin, origin.Addr.PickAddress(), nil, false)
 	}
 }
+
+func TestHTTPClientPool_Client_H2C(t *testing.T) {
+	var server = httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		_, _ = writer.Write([]byte(req.Proto))
+	}), &http2.Server{}))
+	defer server.Close()
+
+	var proxyConfig = configs.NewProxyConfig()
+	proxyConfig.DefaultOrigin = &configs.OriginOptions{
+		HTTPVersion: configs.OriginHTTPVersionH2C,
+	}
+	err := proxyConfig.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedProxyConfig = proxyConfig
+	defer func() {
+		sharedProxyConfig = configs.NewProxyConfig()
+	}()
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var origin = &serverconfigs.OriginConfig{
+		Id:   1,
+		Addr: &serverconfigs.NetworkAddressConfig{Protocol: serverconfigs.ProtocolHTTP, Host: "127.0.0.1", PortRange: port},
+	}
+	err = origin.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pool = NewHTTPClientPool()
+	client, err := pool.Client(nil, origin, origin.Addr.PickAddress(), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.ProtoMajor != 2 {
+		t.Fatal("expect HTTP/2, but got", resp.Proto)
+	}
+}
+
+func TestHTTPClientPool_Client_H2C_PROXYProtocol(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var server = &http.Server{
+		Handler: h2c.NewHandler(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			host, _, _ := net.SplitHostPort(req.RemoteAddr)
+			_, _ = writer.Write([]byte(req.Proto + " " + host))
+		}), &http2.Server{}),
+	}
+	go func() {
+		_ = server.Serve(&proxyproto.Listener{Listener: listener})
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+
+	var proxyConfig = configs.NewProxyConfig()
+	proxyConfig.DefaultOrigin = &configs.OriginOptions{
+		HTTPVersion: configs.OriginHTTPVersionH2C,
+	}
+	err = proxyConfig.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedProxyConfig = proxyConfig
+	defer func() {
+		sharedProxyConfig = configs.NewProxyConfig()
+	}()
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var origin = &serverconfigs.OriginConfig{
+		Id:   1,
+		Addr: &serverconfigs.NetworkAddressConfig{Protocol: serverconfigs.ProtocolHTTP, Host: "127.0.0.1", PortRange: port},
+	}
+	err = origin.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var proxyProtocol = &serverconfigs.ProxyProtocolConfig{
+		IsOn:    true,
+		Version: serverconfigs.ProxyProtocolVersion1,
+	}
+
+	var pool = NewHTTPClientPool()
+	for _, remoteAddr := range []string{"192.168.1.100", "192.168.1.200", "192.168.1.100"} {
+		var rawReq = httptest.NewRequest(http.MethodGet, "http://127.0.0.1:"+port+"/", nil)
+		rawReq.RemoteAddr = remoteAddr + ":12345"
+		var req = &HTTPRequest{
+			RawReq: rawReq,
+		}
+		client, err := pool.Client(req, origin, origin.Addr.PickAddress(), proxyProtocol, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get("http://127.0.0.1:" + port + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "HTTP/2.0 "+remoteAddr {
+			t.Fatal("unexpected response '" + string(data) + "' for client '" + remoteAddr + "'")
+		}
+	}
+}
@@ -8,12 +8,14 @@ import (
 
 const emptyHTTPLocation = "/$EmptyHTTPLocation$"
 
+// HTTPClientTransport 回源使用的Transport
+// RoundTripper 可以为 *http.Transport 或 *http2.Transport
 type HTTPClientTransport struct {
-	*http.Transport
+	http.RoundTripper
 }
 
 func (this *HTTPClientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	resp, err := this.Transport.RoundTrip(req)
+	resp, err := this.RoundTripper.RoundTrip(req)
 	if err != nil {
 		return resp, err
 	}
@@ -24,3 +26,11 @@ func (this *HTTPClientTransport) RoundTrip(req *http.Request) (*http.Response, e
 	}
 	return resp, nil
 }
+
+// CloseIdleConnections 关闭空闲连接
+func (this *HTTPClientTransport) CloseIdleConnections() {
+	closer, ok := this.RoundTripper.(interface{ CloseIdleConnections() })
+	if ok {
+		closer.CloseIdleConnections()
+	}
+}
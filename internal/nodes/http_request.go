@@ -9,6 +9,8 @@ import (
 	iplib "github.com/TeaOSLab/EdgeCommon/pkg/iplibrary"
 	"github.com/TeaOSLab/EdgeCommon/pkg/nodeconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
 	"github.com/TeaOSLab/EdgeNode/internal/metrics"
 	"github.com/TeaOSLab/EdgeNode/internal/stats"
@@ -69,16 +71,25 @@ type HTTPRequest struct {
 	origin               *serverconfigs.OriginConfig       // 源站
 	originAddr           string                            // 源站实际地址
 	originStatus         int32                             // 源站响应代码
+	originAttempts       []string                          // 失败的回源尝试
+	retryPolicy          *configs.RetryPolicyConfig        // 回源重试策略
 	errors               []string                          // 错误信息
 	rewriteRule          *serverconfigs.HTTPRewriteRule    // 匹配到的重写规则
 	rewriteReplace       string                            // 重写规则的目标
 	rewriteIsExternalURL bool                              // 重写目标是否为外部URL
 	remoteAddr           string                            // 计算后的RemoteAddr
 
-	cacheRef         *serverconfigs.HTTPCacheRef // 缓存设置
-	cacheKey         string                      // 缓存使用的Key
-	isCached         bool                        // 是否已经被缓存
-	cacheCanTryStale bool                        // 是否可以尝试使用Stale缓存
+	cacheRef              *serverconfigs.HTTPCacheRef // 缓存设置
+	cacheRefType          string                      // 缓存设置来源：server、policy
+	cacheKey              string                      // 缓存使用的Key
+	cacheBaseKey          string                      // 不包含Vary变体的Key
+	isCached              bool                        // 是否已经被缓存
+	cacheCanTryStale      bool                        // 是否可以尝试使用Stale缓存
+	cacheFetchCall        *caches.FetchCall           // 合并回源
+	cacheIsRevalidating   bool                        // 是否正在向源站验证缓存
+	cacheRevalidateHeader http.Header                 // 验证缓存前客户端的条件请求Header
+	cacheIsSlice          bool                        // 是否正在从源站读取分片
+	cacheSliceIndex       int64                       // 正在读取的分片序号
 
 	isAttack        bool   // 是否是攻击请求
 	requestBodyData []byte // 读取的Body内容
@@ -90,6 +101,9 @@ type HTTPRequest struct {
 	firewallRuleId      int64
 	firewallActions     []string
 	wafHasRequestBody   bool
+	wafAnomalyScore     int      // 异常评分模式下的总分
+	wafAnomalySetIds    []string // 异常评分模式下匹配的规则集
+	wafDetectOnlyItems  []string // 仅检测模式下匹配的规则集 groupId:setId:action
 
 	tags []string
 
@@ -370,6 +384,12 @@ func (this *HTTPRequest) doBegin() {
 
 // 结束调用
 func (this *HTTPRequest) doEnd() {
+	// 结束合并回源
+	if this.cacheFetchCall != nil {
+		this.cacheFetchCall.Done(false)
+		this.cacheFetchCall = nil
+	}
+
 	// 记录日志
 	this.log()
 
@@ -1474,6 +1494,12 @@ func (this *HTTPRequest) Close() {
 		_ = conn.Close()
 		return
 	}
+
+	// HTTP/3连接
+	http3Conn, ok := requestConn.(*HTTP3ClientConn)
+	if ok {
+		_ = http3Conn.Close()
+	}
 }
 
 // Allow 放行
@@ -1828,5 +1854,11 @@ func (this *HTTPRequest) isConnClosed() bool {
 		return isClientConnClosed(conn)
 	}
 
+	// HTTP/3连接
+	http3Conn, ok := requestConn.(*HTTP3ClientConn)
+	if ok {
+		return http3Conn.IsClosed()
+	}
+
 	return true
 }
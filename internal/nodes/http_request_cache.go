@@ -83,6 +83,7 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 	if this.cacheRef == nil {
 		return
 	}
+	this.cacheRefType = refType
 
 	// 是否正在Purge
 	var isPurging = this.web.Cache.PurgeIsOn && strings.ToUpper(this.RawReq.Method) == "PURGE" && this.RawReq.Header.Get("X-Edge-Purge-Key") == this.web.Cache.PurgeKey
@@ -109,8 +110,6 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 		}
 	}
 
-	// TODO 支持Vary Header
-
 	// 缓存标签
 	var tags = []string{}
 
@@ -127,6 +126,7 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 	}
 
 	this.cacheKey = key
+	this.cacheBaseKey = key
 	this.varMapping["cache.key"] = key
 
 	// 读取缓存
@@ -138,7 +138,16 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 	this.writer.cacheStorage = storage
 
 	// 如果正在预热，则不读取缓存，等待下一个步骤重新生成
-	if (strings.HasPrefix(this.RawReq.RemoteAddr, "127.") || strings.HasPrefix(this.RawReq.RemoteAddr, "[::1]")) && this.RawReq.Header.Get("X-Edge-Cache-Action") == "fetch" {
+	switch this.localCacheAction() {
+	case httpCacheActionFetch:
+		return
+	case httpCacheActionRevalidate:
+		// 向源站验证内容是否有变化
+		this.prepareCacheRevalidation(storage, key)
+		return
+	case httpCacheActionSlice:
+		// 从源站读取分片
+		this.prepareCacheSlice(cachePolicy.Id, key)
 		return
 	}
 
@@ -164,12 +173,32 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 			}
 		}
 
+		// 清除所有的Vary变体
+		for _, varyKey := range []string{key, key + caches.SuffixMethod + "HEAD"} {
+			err := storage.Purge([]string{caches.VaryMarkerKey(varyKey)}, "dir")
+			if err != nil {
+				remotelogs.ErrorServer("HTTP_REQUEST_CACHE", "purge failed: "+err.Error())
+			}
+		}
+
+		// 清除所有的分片
+		if caches.SharedManager.FindPolicyOptions(cachePolicy.Id).Slice.IsOn {
+			err := storage.Purge([]string{key + caches.SuffixSlice}, "dir")
+			if err != nil {
+				remotelogs.ErrorServer("HTTP_REQUEST_CACHE", "purge failed: "+err.Error())
+			}
+		}
+
 		// 通过API节点清除别节点上的的Key
 		SharedHTTPCacheTaskManager.PushTaskKeys([]string{key})
 
 		return true
 	}
 
+	// 根据Vary选择变体
+	key = this.findCacheVariantKey(storage, cachePolicy.Id, key, useStale)
+	this.cacheKey = key
+
 	// 调用回调
 	this.onRequest()
 	if this.writer.isFinished {
@@ -253,11 +282,47 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 			}
 		}
 
+		// 分片缓存
+		if err == caches.ErrNotFound && !useStale && method == http.MethodGet {
+			sReader := this.trySliceReader(storage, cachePolicy.Id, key, this.RawReq.Header.Get("Range"))
+			if sReader != nil {
+				reader = sReader
+				err = nil
+			}
+		}
+
+		// 在stale-while-revalidate期间使用陈旧内容，同时在后台更新
+		if err == caches.ErrNotFound && !useStale && !isPartialRequest && method == http.MethodGet {
+			sReader := this.tryStaleWhileRevalidateReader(storage, cachePolicy.Id, key)
+			if sReader != nil {
+				reader = sReader
+				err = nil
+				useStale = true
+			}
+		}
+
+		// 合并回源
+		if err == caches.ErrNotFound && !useStale && !isPartialRequest && method == http.MethodGet {
+			cReader, cStream := this.doCacheCoalescing(storage, cachePolicy.Id, key)
+			if cStream != nil {
+				return this.doCacheStream(cStream, refType)
+			}
+			if cReader != nil {
+				reader = cReader
+				err = nil
+			}
+		}
+
 		if err != nil {
 			if err == caches.ErrNotFound {
 				// cache相关变量
 				this.varMapping["cache.status"] = "MISS"
 
+				// 使用过期缓存中的ETag和Last-Modified向源站验证
+				if !useStale && !isPartialRequest && method == http.MethodGet && caches.SharedManager.FindPolicyOptions(cachePolicy.Id).Freshness.Revalidate {
+					this.prepareCacheRevalidation(storage, key)
+				}
+
 				if !useStale && this.web.Cache.Stale != nil && this.web.Cache.Stale.IsOn {
 					this.cacheCanTryStale = true
 				}
@@ -271,6 +336,13 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 		}
 	}
 
+	return this.doCacheReader(storage, reader, useStale, refType, tags, isPartialCache, partialRanges, rangeHeader)
+}
+
+// 从已经打开的缓存读取器中输出内容
+func (this *HTTPRequest) doCacheReader(storage caches.StorageInterface, reader caches.Reader, useStale bool, refType string, tags []string, isPartialCache bool, partialRanges []rangeutils.Range, rangeHeader string) (shouldStop bool) {
+	var err error
+
 	defer func() {
 		if !this.writer.DelayRead() {
 			_ = reader.Close()
@@ -331,7 +403,7 @@ func (this *HTTPRequest) doCacheRead(useStale bool) (shouldStop bool) {
 	var age = strconv.FormatInt(utils.UnixTime()-reader.LastModified(), 10)
 	this.varMapping["cache.age"] = age
 
-	if addStatusHeader {
+	if this.web.Cache.AddStatusHeader {
 		if useStale {
 			this.writer.Header().Set("X-Cache", "STALE, "+refType+", "+reader.TypeName())
 		} else {
@@ -598,6 +670,57 @@ func (this *HTTPRequest) addExpiresHeader(expiresAt int64) {
 	}
 }
 
+// 尝试读取处于stale-while-revalidate期间的缓存
+func (this *HTTPRequest) tryStaleWhileRevalidateReader(storage caches.StorageInterface, policyId int64, key string) caches.Reader {
+	var freshnessConfig = caches.SharedManager.FindPolicyOptions(policyId).Freshness
+	if freshnessConfig == nil || !freshnessConfig.StaleWhileRevalidate {
+		return nil
+	}
+
+	reader, err := storage.OpenReader(key, true, false)
+	if err != nil {
+		return nil
+	}
+
+	var isOk = false
+	defer func() {
+		if !isOk {
+			_ = reader.Close()
+		}
+	}()
+
+	// 从缓存的Header中读取Cache-Control
+	var cacheControlValues = []string{}
+	var headerData = []byte{}
+	var headerPool = this.bytePool(reader.HeaderSize())
+	var headerBuf = headerPool.Get()
+	err = reader.ReadHeader(headerBuf, func(n int) (goNext bool, err error) {
+		headerData = append(headerData, headerBuf[:n]...)
+		return true, nil
+	})
+	headerPool.Put(headerBuf)
+	if err != nil {
+		return nil
+	}
+	for _, row := range bytes.Split(headerData, []byte{'\n'}) {
+		var spaceIndex = bytes.IndexByte(row, ':')
+		if spaceIndex > 0 && http.CanonicalHeaderKey(string(row[:spaceIndex])) == "Cache-Control" {
+			cacheControlValues = append(cacheControlValues, string(row[spaceIndex+1:]))
+		}
+	}
+
+	var cacheControl = caches.ParseCacheControl(strings.Join(cacheControlValues, ","))
+	if cacheControl.StaleWhileRevalidate <= 0 || reader.ExpiresAt()+cacheControl.StaleWhileRevalidate < utils.UnixTime() {
+		return nil
+	}
+
+	// 后台更新
+	SharedHTTPCacheTaskManager.RefreshURL(key, this.requestScheme()+"://"+this.ReqHost+this.rawURI, this.RawReq.Header.Clone())
+
+	isOk = true
+	return reader
+}
+
 // 尝试读取区间缓存
 func (this *HTTPRequest) tryPartialReader(storage caches.StorageInterface, key string, useStale bool, rangeHeader string) (caches.Reader, []rangeutils.Range) {
 	// 尝试读取Partial cache
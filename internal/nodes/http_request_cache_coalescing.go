@@ -0,0 +1,102 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"io"
+	"net/http"
+)
+
+// 合并同一个Key的回源请求
+// 如果当前请求需要回源，则返回空；否则返回已经写入的缓存或者正在写入的内容
+func (this *HTTPRequest) doCacheCoalescing(storage caches.StorageInterface, policyId int64, key string) (reader caches.Reader, stream *caches.FetchStream) {
+	var config = caches.SharedManager.FindPolicyOptions(policyId).FetchCoalescing
+	if config == nil || !config.IsOn {
+		return
+	}
+
+	call, isLeader := caches.SharedFetchGroup.Begin(key)
+	if isLeader {
+		this.cacheFetchCall = call
+		return
+	}
+
+	stream, isCached, ok := call.Wait(this.RawReq.Context(), config.WaitDuration())
+	if !ok {
+		// 超时后自行回源
+		return nil, nil
+	}
+	if stream != nil {
+		return nil, stream
+	}
+	if isCached {
+		// 写入的可能是Vary变体
+		if key == this.cacheBaseKey {
+			key = this.findCacheVariantKey(storage, policyId, key, false)
+			this.cacheKey = key
+		}
+		reader, _ = storage.OpenReader(key, false, false)
+	}
+	return reader, nil
+}
+
+// 从正在写入的内容中读取
+func (this *HTTPRequest) doCacheStream(stream *caches.FetchStream, refType string) (shouldStop bool) {
+	// 读取Header
+	var headerData = stream.Header()
+	for {
+		var nIndex = bytes.IndexByte(headerData, '\n')
+		if nIndex < 0 {
+			break
+		}
+		var row = headerData[:nIndex]
+		headerData = headerData[nIndex+1:]
+
+		var spaceIndex = bytes.IndexByte(row, ':')
+		if spaceIndex <= 0 {
+			remotelogs.WarnServer("HTTP_REQUEST_CACHE", this.URL()+": read from fetch stream failed: invalid header '"+string(row)+"'")
+			return
+		}
+		// 同一个Header可能有多个值，比如Set-Cookie，所以不能使用Set()
+		this.writer.Header().Add(string(row[:spaceIndex]), string(row[spaceIndex+1:]))
+	}
+
+	this.varMapping["cache.status"] = "HIT"
+	this.logAttrs["cache.status"] = "HIT"
+	if this.web.Cache.AddStatusHeader {
+		this.writer.Header().Set("X-Cache", "HIT, "+refType+", coalesced")
+	} else {
+		this.writer.Header().Del("X-Cache")
+	}
+
+	this.processResponseHeaders(this.writer.Header(), stream.Status())
+
+	var reader = stream.NewReader()
+	var resp = &http.Response{
+		Body:          reader,
+		ContentLength: stream.Size(),
+	}
+	this.writer.Prepare(resp, stream.Size(), stream.Status(), false)
+	this.writer.WriteHeader(stream.Status())
+
+	var pool = this.bytePool(stream.Size())
+	var bodyBuf = pool.Get()
+	_, err := io.CopyBuffer(this.writer, resp.Body, bodyBuf)
+	pool.Put(bodyBuf)
+	if err != nil {
+		if !this.canIgnore(err) {
+			remotelogs.WarnServer("HTTP_REQUEST_CACHE", this.URL()+": read from fetch stream failed: "+err.Error())
+		}
+		return true
+	}
+
+	this.isCached = true
+	this.cacheRef = nil
+
+	this.writer.SetOk()
+
+	return true
+}
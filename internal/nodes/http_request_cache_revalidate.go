@@ -0,0 +1,240 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bytes"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/utils"
+	"net/http"
+	"strings"
+)
+
+// 源站返回304时需要更新到缓存中的Header
+var httpCacheRevalidateHeaderNames = []string{"Cache-Control", "Expires", "Date", "Etag", "Last-Modified"}
+
+// 源站返回304时和有效期相关的Header
+// Header长度改变时需要重写整个缓存文件，所以只在这些Header改变时才重写，Date、Etag等其他Header保持原来的值
+var httpCacheRevalidateFreshnessHeaderNames = []string{"Cache-Control", "Expires"}
+
+// 本地请求使用的缓存动作
+func (this *HTTPRequest) localCacheAction() string {
+	if strings.HasPrefix(this.RawReq.RemoteAddr, "127.") || strings.HasPrefix(this.RawReq.RemoteAddr, "[::1]") {
+		return this.RawReq.Header.Get("X-Edge-Cache-Action")
+	}
+	return ""
+}
+
+// 准备向源站验证缓存
+// 使用缓存中的ETag和Last-Modified设置条件请求Header，如果缓存中没有这些信息，则按普通请求回源
+func (this *HTTPRequest) prepareCacheRevalidation(storage caches.StorageInterface, key string) {
+	reader, err := storage.OpenReader(key, true, false)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	headerData, err := httpRequestReadCacheHeaderData(reader)
+	if err != nil {
+		return
+	}
+	var header = httpRequestParseCacheHeaderData(headerData)
+
+	var eTag = header.Get("Etag")
+	var lastModified = header.Get("Last-Modified")
+	if len(eTag) == 0 && len(lastModified) == 0 {
+		return
+	}
+
+	// 保存客户端的条件请求Header，以便于验证后恢复
+	this.cacheRevalidateHeader = http.Header{}
+	for _, name := range []string{"If-None-Match", "If-Modified-Since"} {
+		var values = this.RawReq.Header.Values(name)
+		if len(values) > 0 {
+			this.cacheRevalidateHeader[name] = values
+		}
+		this.DeleteHeader(name)
+	}
+
+	if len(eTag) > 0 {
+		this.SetHeader("If-None-Match", []string{eTag})
+	}
+	if len(lastModified) > 0 {
+		this.SetHeader("If-Modified-Since", []string{lastModified})
+	}
+	this.cacheIsRevalidating = true
+}
+
+// 处理源站返回的304
+// 更新缓存有效期后直接从缓存中读取内容；如果是本地发起的验证请求，则直接返回304
+// 如果缓存已经无法读取（比如已经被清理），则 shouldRefetch 为true，需要重新不带条件地请求源站
+func (this *HTTPRequest) doCacheRevalidated(resp *http.Response) (shouldStop bool, shouldRefetch bool) {
+	this.cacheIsRevalidating = false
+
+	// 恢复客户端的条件请求Header，之后的重新回源不能再带有验证时使用的条件
+	this.DeleteHeader("If-None-Match")
+	this.DeleteHeader("If-Modified-Since")
+	for name, values := range this.cacheRevalidateHeader {
+		this.SetHeader(name, values)
+	}
+	this.cacheRevalidateHeader = nil
+
+	var storage = this.writer.cacheStorage
+	if storage == nil || this.cacheRef == nil {
+		return false, false
+	}
+
+	err := this.writer.updateCacheWithNotModified(storage, resp.Header)
+	if err != nil {
+		if !this.canIgnore(err) {
+			remotelogs.WarnServer("HTTP_REQUEST_CACHE", this.URL()+": revalidate cache failed: "+err.Error())
+		}
+	}
+
+	// 合并回源中等待的请求可以直接读取缓存
+	if this.cacheFetchCall != nil {
+		this.cacheFetchCall.Done(err == nil)
+		this.cacheFetchCall = nil
+	}
+
+	if this.localCacheAction() == httpCacheActionRevalidate {
+		return false, false
+	}
+
+	_ = resp.Body.Close()
+
+	// 直接读取更新后的缓存，304表示缓存中的内容仍然有效，所以也可以使用陈旧的内容
+	var useStale = false
+	reader, err := storage.OpenReader(this.cacheKey, false, false)
+	if err != nil {
+		useStale = true
+		reader, err = storage.OpenReader(this.cacheKey, true, false)
+		if err != nil {
+			return false, true
+		}
+	}
+
+	var tags = []string{}
+	var method = this.Method()
+	if method != http.MethodGet {
+		tags = append(tags, strings.ToLower(method))
+	}
+	if this.doCacheReader(storage, reader, useStale, this.cacheRefType, tags, false, nil, this.RawReq.Header.Get("Range")) {
+		return true, false
+	}
+
+	// 已经开始向客户端输出内容时，不能再重新回源
+	if this.writer.statusCode > 0 {
+		return true, false
+	}
+	return false, true
+}
+
+// 源站返回304时只更新缓存的有效期和Header，不再从源站读取内容
+func (this *HTTPWriter) updateCacheWithNotModified(storage caches.StorageInterface, respHeader http.Header) error {
+	var key = this.req.cacheKey
+
+	reader, err := storage.OpenReader(key, true, false)
+	if err != nil {
+		return err
+	}
+	headerData, err := httpRequestReadCacheHeaderData(reader)
+	_ = reader.Close()
+	if err != nil {
+		return err
+	}
+
+	// 使用304中的新Header更新缓存中的Header，并计算有效期
+	var newHeaderData = httpRequestUpdateCacheHeaderData(headerData, respHeader, httpCacheRevalidateHeaderNames)
+	var header = httpRequestParseCacheHeaderData(newHeaderData)
+	var age = respHeader.Get("Age")
+	if len(age) > 0 {
+		header.Set("Age", age)
+	}
+	if len(newHeaderData) != len(headerData) {
+		newHeaderData = httpRequestUpdateCacheHeaderData(headerData, respHeader, httpCacheRevalidateFreshnessHeaderNames)
+	}
+	if bytes.Equal(newHeaderData, headerData) {
+		newHeaderData = nil
+	}
+
+	// 源站要求不缓存或者内容仍然过期时，保持过期状态，下次请求时继续验证
+	life, canCache := this.calculateCacheLife(header)
+	if !canCache {
+		life = 0
+	}
+	var expiresAt = utils.UnixTime() + life
+	return storage.UpdateExpiresAt(key, expiresAt, expiresAt+int64(this.calculateStaleLife()), newHeaderData)
+}
+
+// 使用304响应中的Header替换缓存Header数据中的同名Header，其他Header保持原来的顺序
+// names 为需要替换的Header名称
+func httpRequestUpdateCacheHeaderData(headerData []byte, respHeader http.Header, names []string) []byte {
+	var updatedNames = map[string]bool{}
+	for _, name := range names {
+		if len(respHeader.Values(name)) > 0 {
+			updatedNames[name] = true
+		}
+	}
+	if len(updatedNames) == 0 {
+		return headerData
+	}
+
+	var buf = &bytes.Buffer{}
+	var writtenNames = map[string]bool{}
+	var writeValues = func(name string) {
+		writtenNames[name] = true
+		for _, value := range respHeader.Values(name) {
+			buf.WriteString(name + ":" + value + "\n")
+		}
+	}
+	for _, row := range bytes.Split(headerData, []byte{'\n'}) {
+		var index = bytes.IndexByte(row, ':')
+		if index <= 0 {
+			continue
+		}
+		var name = http.CanonicalHeaderKey(string(row[:index]))
+		if updatedNames[name] {
+			if !writtenNames[name] {
+				writeValues(name)
+			}
+			continue
+		}
+		buf.Write(row)
+		buf.WriteByte('\n')
+	}
+	for _, name := range names {
+		if updatedNames[name] && !writtenNames[name] {
+			writeValues(name)
+		}
+	}
+	return buf.Bytes()
+}
+
+// 读取缓存中的Header数据
+func httpRequestReadCacheHeaderData(reader caches.Reader) ([]byte, error) {
+	var buf = make([]byte, 1024)
+	var headerData = []byte{}
+	err := reader.ReadHeader(buf, func(n int) (goNext bool, err error) {
+		headerData = append(headerData, buf[:n]...)
+		return true, nil
+	})
+	return headerData, err
+}
+
+// 解析缓存中的Header数据，每行一个 Name:Value
+func httpRequestParseCacheHeaderData(headerData []byte) http.Header {
+	var header = http.Header{}
+	for _, row := range bytes.Split(headerData, []byte{'\n'}) {
+		var index = bytes.IndexByte(row, ':')
+		if index <= 0 {
+			continue
+		}
+		var name = string(row[:index])
+		header[name] = append(header[name], string(row[index+1:]))
+	}
+	return header
+}
@@ -0,0 +1,40 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"testing"
+)
+
+func TestHTTPRequest_UpdateCacheHeaderData(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var headerData = []byte("Content-Type:text/html\nCache-Control:max-age=60\nEtag:\"abc\"\nDate:Mon, 02 Jan 2006 15:04:05 GMT\n")
+
+	{
+		var newHeaderData = httpRequestUpdateCacheHeaderData(headerData, http.Header{
+			"Cache-Control": []string{"max-age=3600"},
+			"Etag":          []string{"\"abcdef\""},
+		}, httpCacheRevalidateHeaderNames)
+		a.IsTrue(string(newHeaderData) == "Content-Type:text/html\nCache-Control:max-age=3600\nEtag:\"abcdef\"\nDate:Mon, 02 Jan 2006 15:04:05 GMT\n")
+	}
+
+	// 只替换有效期相关的Header
+	{
+		var newHeaderData = httpRequestUpdateCacheHeaderData(headerData, http.Header{
+			"Etag":    []string{"\"abcdef\""},
+			"Expires": []string{"Tue, 03 Jan 2006 15:04:05 GMT"},
+		}, httpCacheRevalidateFreshnessHeaderNames)
+		a.IsTrue(string(newHeaderData) == "Content-Type:text/html\nCache-Control:max-age=60\nEtag:\"abc\"\nDate:Mon, 02 Jan 2006 15:04:05 GMT\nExpires:Tue, 03 Jan 2006 15:04:05 GMT\n")
+	}
+
+	// 没有需要替换的Header
+	{
+		var newHeaderData = httpRequestUpdateCacheHeaderData(headerData, http.Header{
+			"Etag": []string{"\"abcdef\""},
+		}, httpCacheRevalidateFreshnessHeaderNames)
+		a.IsTrue(string(newHeaderData) == string(headerData))
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"context"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"net/http"
+	"time"
+)
+
+// 分片回源完成后等待写入缓存的最长时间
+const httpCacheSliceDoneWaitDuration = 5 * time.Second
+
+// 尝试使用分片缓存读取内容
+// 缺少的分片会通过本地请求从源站读取，源站不支持区间请求时返回空
+func (this *HTTPRequest) trySliceReader(storage caches.StorageInterface, policyId int64, key string, rangeHeader string) caches.Reader {
+	var config = caches.SharedManager.FindPolicyOptions(policyId).Slice
+	if config == nil || !config.IsOn {
+		return nil
+	}
+
+	// 第一个需要读取的分片
+	var firstIndex int64 = 0
+	if len(rangeHeader) > 0 {
+		ranges, ok := httpRequestParseRangeHeader(rangeHeader)
+		if !ok || len(ranges) == 0 {
+			return nil
+		}
+		if ranges[0].Start() > 0 {
+			firstIndex = config.Index(ranges[0].Start())
+		}
+	}
+
+	var fullURL = this.requestScheme() + "://" + this.ReqHost + this.rawURI
+	var header = this.RawReq.Header.Clone()
+	var reader = caches.NewSliceReader(storage, key, config, firstIndex, func(index int64) error {
+		return this.fetchCacheSlice(config, key, fullURL, header, index)
+	})
+	err := reader.Init()
+	if err != nil {
+		if err != caches.ErrNotFound && !this.canIgnore(err) {
+			remotelogs.WarnServer("HTTP_REQUEST_CACHE", this.URL()+": read slice failed: "+err.Error())
+		}
+		return nil
+	}
+	return reader
+}
+
+// 从源站读取某个分片，并等待写入缓存
+// 同一个分片同时只会有一个本地请求
+func (this *HTTPRequest) fetchCacheSlice(config *caches.SliceConfig, key string, fullURL string, header http.Header, index int64) error {
+	call, isLeader := caches.SharedFetchGroup.Begin(caches.SliceKey(key, index))
+	if isLeader {
+		start, end := config.Range(index)
+		goman.New(func() {
+			err := SharedHTTPCacheTaskManager.FetchSlice(fullURL, header, start, end)
+			if err == nil {
+				// 本地请求结束时可能还没有写入完成
+				_, _, _ = call.Wait(context.Background(), httpCacheSliceDoneWaitDuration)
+			}
+			call.Done(false)
+		})
+	}
+
+	_, isCached, ok := call.Wait(this.RawReq.Context(), config.TimeoutDuration())
+	if !ok {
+		return errors.New("fetch slice timeout")
+	}
+	if !isCached {
+		return caches.ErrNotFound
+	}
+	return nil
+}
+
+// 准备分片回源
+// 此时为本地请求，Range为分片的区间，回源结果作为单独的分片缓存
+func (this *HTTPRequest) prepareCacheSlice(policyId int64, key string) {
+	var config = caches.SharedManager.FindPolicyOptions(policyId).Slice
+	if config == nil || !config.IsOn {
+		return
+	}
+
+	ranges, ok := httpRequestParseRangeHeader(this.RawReq.Header.Get("Range"))
+	if !ok || len(ranges) != 1 || ranges[0].Start() < 0 {
+		return
+	}
+	var index = config.Index(ranges[0].Start())
+	start, end := config.Range(index)
+	if ranges[0].Start() != start || ranges[0].End() != end {
+		return
+	}
+
+	this.cacheIsSlice = true
+	this.cacheSliceIndex = index
+	this.cacheKey = caches.SliceKey(key, index)
+	this.varMapping["cache.key"] = this.cacheKey
+
+	// 写入完成后通知等待的请求
+	call, _ := caches.SharedFetchGroup.Begin(this.cacheKey)
+	this.cacheFetchCall = call
+}
+
+// 检查源站返回的分片是否为请求的区间
+func (this *HTTPRequest) checkCacheSliceResponse(header http.Header) bool {
+	var policy = this.ReqServer.HTTPCachePolicy
+	if policy == nil {
+		return false
+	}
+	var config = caches.SharedManager.FindPolicyOptions(policy.Id).Slice
+	start, total := httpRequestParseContentRangeHeader(header.Get("Content-Range"))
+	if total <= 0 {
+		return false
+	}
+	sliceStart, _ := config.Range(this.cacheSliceIndex)
+	return start == sliceStart
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"strings"
+)
+
+// 根据缓存中记录的Vary查找当前请求对应的变体Key
+// 如果没有变体，则返回原始的Key
+func (this *HTTPRequest) findCacheVariantKey(storage caches.StorageInterface, policyId int64, key string, useStale bool) string {
+	var varyConfig = caches.SharedManager.FindPolicyOptions(policyId).Vary
+	if varyConfig == nil || !varyConfig.IsOn {
+		return key
+	}
+
+	marker, err := caches.ReadVaryMarker(storage, key, useStale)
+	if err != nil || len(marker.Names) == 0 {
+		return key
+	}
+	return caches.VaryVariantKey(key, marker.Names, this.RawReq.Header)
+}
+
+// 根据响应的Vary准备写入的缓存Key，并记录变体信息
+func (this *HTTPWriter) prepareCacheVariantKey(storage caches.StorageInterface, policyId int64, expiresAt int64) (string, error) {
+	var varyConfig = caches.SharedManager.FindPolicyOptions(policyId).Vary
+	if varyConfig == nil || !varyConfig.IsOn {
+		return this.req.cacheKey, nil
+	}
+
+	var baseKey = this.req.cacheBaseKey
+	if len(baseKey) == 0 {
+		baseKey = this.req.cacheKey
+	}
+
+	names, isAll := caches.ParseVary(strings.Join(this.Header().Values("Vary"), ","))
+	if isAll {
+		return "", errors.New("Vary: *")
+	}
+	if len(names) == 0 {
+		// 源站不再返回Vary时清除已有的变体
+		if this.req.cacheKey != baseKey {
+			_ = storage.Purge([]string{caches.VaryMarkerKey(baseKey)}, "dir")
+			this.req.cacheKey = baseKey
+		}
+		return baseKey, nil
+	}
+
+	var variantId = caches.VaryVariantId(names, this.req.RawReq.Header)
+
+	// 同一个Key的Vary信息需要串行更新，防止并发写入时丢失变体
+	var unlock = caches.LockVaryMarker(baseKey)
+	defer unlock()
+
+	marker, err := caches.ReadVaryMarker(storage, baseKey, false)
+	if err != nil || !marker.IsSameNames(names) {
+		marker = &caches.VaryMarker{
+			Names: names,
+		}
+	}
+
+	var isChanged = !marker.ContainsVariant(variantId)
+	err = marker.AddVariant(variantId, varyConfig.MaxVariants)
+	if err != nil {
+		return "", err
+	}
+	if marker.ExpiresAt < expiresAt {
+		marker.ExpiresAt = expiresAt
+		isChanged = true
+	}
+	if isChanged {
+		err = marker.Write(storage, baseKey, marker.ExpiresAt+int64(this.calculateStaleLife()), this.req.ReqHost, this.req.ReqServer.Id)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	this.req.cacheKey = caches.VaryMarkerKey(baseKey) + "_" + variantId
+	return this.req.cacheKey, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 单次回源尝试超时错误
+type originPerTryTimeoutError struct{}
+
+func (this *originPerTryTimeoutError) Error() string {
+	return "origin per-try timeout"
+}
+
+func (this *originPerTryTimeoutError) Timeout() bool {
+	return true
+}
+
+func (this *originPerTryTimeoutError) Temporary() bool {
+	return true
+}
+
+// 判断回源失败后是否可以重试
+// err 不为空时根据错误类型判断，否则根据响应状态码判断
+func (this *HTTPRequest) canRetryOrigin(err error, statusCode int) bool {
+	var policy = this.retryPolicy
+	if policy == nil {
+		// 默认只在连接错误时重试
+		return err != nil
+	}
+
+	if !policy.CanRetryMethod(this.RawReq.Method) {
+		return false
+	}
+
+	var retryOn = ""
+	if err != nil {
+		retryOn = this.originRetryOn(err)
+		if len(retryOn) == 0 || !policy.ShouldRetryOn(retryOn) {
+			return false
+		}
+	} else if !policy.ShouldRetryStatus(statusCode) {
+		return false
+	}
+
+	// 请求内容可能已经发送，无法再次发送
+	if retryOn != configs.RetryOnConnectFailure && this.RawReq.Body != nil && this.RawReq.Body != http.NoBody && this.RawReq.ContentLength != 0 {
+		return false
+	}
+
+	return SharedRetryBudgetManager.TryRetry(this.ReqServer.Id, policy)
+}
+
+// 重试前等待一段时间，如果客户端在等待期间取消请求则返回false
+func (this *HTTPRequest) waitOriginRetryBackoff(backoff time.Duration) bool {
+	var ctx = this.RawReq.Context()
+	if backoff <= 0 {
+		return ctx.Err() == nil
+	}
+
+	var timer = time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// 分析回源错误对应的重试条件
+func (this *HTTPRequest) originRetryOn(err error) configs.RetryOn {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return configs.RetryOnConnectFailure
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return configs.RetryOnTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || strings.Contains(err.Error(), "connection reset") {
+		return configs.RetryOnReset
+	}
+
+	return ""
+}
+
+// 记录回源尝试
+func (this *HTTPRequest) addOriginAttempt(originAddr string, result string) {
+	this.originAttempts = append(this.originAttempts, originAddr+" "+result)
+}
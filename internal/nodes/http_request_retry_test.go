@@ -0,0 +1,131 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testRetryRequest(t *testing.T, method string, body []byte, policy *configs.RetryPolicyConfig) *HTTPRequest {
+	if policy != nil {
+		err := policy.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rawReq = httptest.NewRequest(method, "https://example.com/hello", nil)
+	if len(body) > 0 {
+		rawReq = httptest.NewRequest(method, "https://example.com/hello", bytes.NewReader(body))
+	}
+	return &HTTPRequest{
+		RawReq:      rawReq,
+		ReqServer:   &serverconfigs.ServerConfig{Id: 1},
+		retryPolicy: policy,
+	}
+}
+
+func TestHTTPRequest_CanRetryOrigin(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var dialErr = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	// 没有重试策略时只在连接错误时重试
+	{
+		var req = testRetryRequest(t, http.MethodGet, nil, nil)
+		a.IsTrue(req.canRetryOrigin(dialErr, 0))
+		a.IsFalse(req.canRetryOrigin(nil, http.StatusBadGateway))
+	}
+
+	// 重试条件和状态码
+	{
+		var req = testRetryRequest(t, http.MethodGet, nil, &configs.RetryPolicyConfig{
+			IsOn:               true,
+			RetryOn:            []configs.RetryOn{configs.RetryOnConnectFailure, configs.RetryOnReset},
+			RetryOnStatusCodes: []int{http.StatusBadGateway},
+		})
+		a.IsTrue(req.canRetryOrigin(dialErr, 0))
+		a.IsTrue(req.canRetryOrigin(io.EOF, 0))
+		a.IsFalse(req.canRetryOrigin(&originPerTryTimeoutError{}, 0))
+		a.IsTrue(req.canRetryOrigin(nil, http.StatusBadGateway))
+		a.IsFalse(req.canRetryOrigin(nil, http.StatusServiceUnavailable))
+	}
+}
+
+func TestHTTPRequest_CanRetryOrigin_Method(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var dialErr = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete} {
+		var req = testRetryRequest(t, method, nil, &configs.RetryPolicyConfig{IsOn: true})
+		a.IsTrue(req.canRetryOrigin(dialErr, 0))
+	}
+
+	// 非幂等的方法默认不重试
+	for _, method := range []string{http.MethodPost, http.MethodPatch} {
+		var req = testRetryRequest(t, method, nil, &configs.RetryPolicyConfig{IsOn: true})
+		a.IsFalse(req.canRetryOrigin(dialErr, 0))
+	}
+
+	{
+		var req = testRetryRequest(t, http.MethodPost, nil, &configs.RetryPolicyConfig{
+			IsOn:               true,
+			RetryNonIdempotent: true,
+		})
+		a.IsTrue(req.canRetryOrigin(dialErr, 0))
+	}
+}
+
+func TestHTTPRequest_CanRetryOrigin_Body(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var dialErr = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	var policy = &configs.RetryPolicyConfig{
+		IsOn:               true,
+		RetryOn:            []configs.RetryOn{configs.RetryOnConnectFailure, configs.RetryOnReset},
+		RetryOnStatusCodes: []int{http.StatusBadGateway},
+	}
+
+	var req = testRetryRequest(t, http.MethodPut, []byte("hello"), policy)
+
+	// 连接失败时请求内容还没有发送
+	a.IsTrue(req.canRetryOrigin(dialErr, 0))
+
+	// 请求内容可能已经发送
+	a.IsFalse(req.canRetryOrigin(io.EOF, 0))
+	a.IsFalse(req.canRetryOrigin(nil, http.StatusBadGateway))
+}
+
+func TestHTTPRequest_WaitOriginRetryBackoff(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		var req = testRetryRequest(t, http.MethodGet, nil, nil)
+		a.IsTrue(req.waitOriginRetryBackoff(0))
+		a.IsTrue(req.waitOriginRetryBackoff(1 * time.Millisecond))
+	}
+
+	{
+		var req = testRetryRequest(t, http.MethodGet, nil, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		req.RawReq = req.RawReq.WithContext(ctx)
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		var before = time.Now()
+		a.IsFalse(req.waitOriginRetryBackoff(10 * time.Second))
+		a.IsTrue(time.Since(before) < 5*time.Second)
+		a.IsFalse(req.waitOriginRetryBackoff(0))
+	}
+}
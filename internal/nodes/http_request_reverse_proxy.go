@@ -7,12 +7,15 @@ import (
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/shared"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
 	"github.com/TeaOSLab/EdgeNode/internal/utils"
+	"github.com/iwind/TeaGo/maps"
 	"github.com/iwind/TeaGo/types"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // 处理反向代理
@@ -23,10 +26,35 @@ func (this *HTTPRequest) doReverseProxy() {
 
 	var retries = 3
 
+	// 重试策略
+	var retryPolicy = sharedProxyConfig.FindServerOptions(this.ReqServer.Id).RetryPolicy
+	if retryPolicy != nil && retryPolicy.IsOn {
+		this.retryPolicy = retryPolicy
+		retries = retryPolicy.MaxRetries + 1
+		SharedRetryBudgetManager.AddRequest(this.ReqServer.Id)
+	}
+
 	var failedOriginIds []int64
 	var failedLnNodeIds []int64
 
+	defer func() {
+		// 在访问日志中记录重试
+		if len(this.originAttempts) > 0 {
+			this.logAttrs["origin.retries"] = types.String(len(this.originAttempts))
+			this.logAttrs["origin.attempts"] = strings.Join(this.originAttempts, ", ")
+		}
+	}()
+
 	for i := 0; i < retries; i++ {
+		if i > 0 && this.retryPolicy != nil {
+			// 等待期间客户端关闭连接时不再重试
+			if !this.waitOriginRetryBackoff(this.retryPolicy.Backoff(i)) {
+				this.addError(errors.New(this.URL() + ": client closed the connection while waiting for retry"))
+				this.writer.WriteHeader(499) // 仿照nginx
+				break
+			}
+		}
+
 		originId, lnNodeId, shouldRetry := this.doOriginRequest(failedOriginIds, failedLnNodeIds, i == 0, i == retries-1)
 		if !shouldRetry {
 			break
@@ -72,21 +100,21 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 		}
 
 		// 回源Header中去除If-None-Match和If-Modified-Since
-		if !this.cacheRef.EnableIfNoneMatch {
+		// 正在验证缓存时需要保留
+		if !this.cacheRef.EnableIfNoneMatch && !this.cacheIsRevalidating {
 			this.DeleteHeader("If-None-Match")
 		}
-		if !this.cacheRef.EnableIfModifiedSince {
+		if !this.cacheRef.EnableIfModifiedSince && !this.cacheIsRevalidating {
 			this.DeleteHeader("If-Modified-Since")
 		}
 	}
 
 	// 自定义源站
 	if origin == nil {
-		if !isFirstTry {
-			origin = this.reverseProxy.AnyOrigin(requestCall, failedOriginIds)
-		}
-		if origin == nil {
-			origin = this.reverseProxy.NextOrigin(requestCall)
+		if isFirstTry {
+			origin = SharedOriginBalancer.NextOrigin(this.ReqServer.Id, this.reverseProxy, requestCall, nil)
+		} else {
+			origin = SharedOriginBalancer.NextOrigin(this.ReqServer.Id, this.reverseProxy, requestCall, failedOriginIds)
 		}
 		requestCall.CallResponseCallbacks(this.writer)
 		if origin == nil {
@@ -122,6 +150,13 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 	}
 	this.RawReq.URL.Scheme = origin.Addr.Protocol.Primary().Scheme()
 
+	// 主动健康检查
+	if requestHostHasVariables {
+		SharedOriginStateManager.Watch(this.ReqServer.Id, origin, "", this.reverseProxy)
+	} else {
+		SharedOriginStateManager.Watch(this.ReqServer.Id, origin, requestHost, this.reverseProxy)
+	}
+
 	// StripPrefix
 	if len(stripPrefix) > 0 {
 		if stripPrefix[0] != '/' {
@@ -253,25 +288,63 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 	}
 
 	// 开始请求
-	resp, err := client.Do(this.RawReq)
+	var requestStartedAt = time.Now()
+	SharedOriginBalancer.Begin(origin)
+	var originReq = this.RawReq
+	var perTryTimedOut int32
+	var perTryTimer *time.Timer
+	if this.retryPolicy != nil && this.retryPolicy.PerTryTimeout() > 0 {
+		ctx, cancel := context.WithCancel(this.RawReq.Context())
+		defer cancel()
+		originReq = this.RawReq.WithContext(ctx)
+		perTryTimer = time.AfterFunc(this.retryPolicy.PerTryTimeout(), func() {
+			atomic.StoreInt32(&perTryTimedOut, 1)
+			cancel()
+		})
+	}
+	resp, err := client.Do(originReq)
+	if perTryTimer != nil {
+		perTryTimer.Stop()
+		if err != nil && atomic.LoadInt32(&perTryTimedOut) == 1 {
+			err = &url.Error{
+				Op:  originReq.Method,
+				URL: originReq.URL.String(),
+				Err: &originPerTryTimeoutError{},
+			}
+		}
+	}
 	if err != nil {
+		// 源站证书验证失败
+		verifyErr, isVerifyErr := ParseOriginTLSVerifyError(err)
+		if isVerifyErr {
+			this.logAttrs["origin.error"] = "tlsVerify"
+			this.addError(verifyErr)
+			remotelogs.ServerError(this.ReqServer.Id, "HTTP_REQUEST_REVERSE_PROXY", this.URL()+": "+verifyErr.Error(), "", maps.Map{
+				"originId":   origin.Id,
+				"originAddr": originAddr,
+			})
+		}
+
 		// 客户端取消请求，则不提示
 		httpErr, ok := err.(*url.Error)
 		if !ok {
+			SharedOriginBalancer.End(this.ReqServer.Id, this.reverseProxy, origin, 0, 0)
 			SharedOriginStateManager.Fail(origin, requestHost, this.reverseProxy, func() {
 				this.reverseProxy.ResetScheduling()
 			})
 			this.write50x(err, http.StatusBadGateway, "Failed to read origin site", "源站读取失败", true)
 			remotelogs.WarnServer("HTTP_REQUEST_REVERSE_PROXY", this.RawReq.URL.String()+": Request origin server failed: "+err.Error())
 		} else if httpErr.Err != context.Canceled {
+			SharedOriginBalancer.End(this.ReqServer.Id, this.reverseProxy, origin, 0, 0)
 			SharedOriginStateManager.Fail(origin, requestHost, this.reverseProxy, func() {
 				this.reverseProxy.ResetScheduling()
 			})
 
 			// 是否需要重试
-			if (originId > 0 || (lnNodeId > 0 && hasMultipleLnNodes)) && !isLastRetry {
+			if (originId > 0 || (lnNodeId > 0 && hasMultipleLnNodes)) && !isLastRetry && this.canRetryOrigin(httpErr.Err, 0) {
 				shouldRetry = true
 				this.uri = oldURI // 恢复备份
+				this.addOriginAttempt(originAddr, "error: "+httpErr.Err.Error())
 
 				if resp != nil && resp.Body != nil {
 					_ = resp.Body.Close()
@@ -295,6 +368,8 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 				remotelogs.WarnServer("HTTP_REQUEST_REVERSE_PROXY", this.URL()+": Request origin server failed: "+err.Error())
 			}
 		} else {
+			SharedOriginBalancer.Cancel(origin)
+
 			// 是否为客户端方面的错误
 			var isClientError = false
 			if ok {
@@ -323,6 +398,16 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 
 	// 记录相关数据
 	this.originStatus = int32(resp.StatusCode)
+	SharedOriginBalancer.End(this.ReqServer.Id, this.reverseProxy, origin, time.Since(requestStartedAt), resp.StatusCode)
+
+	// 根据状态码重试
+	if this.retryPolicy != nil && (originId > 0 || (lnNodeId > 0 && hasMultipleLnNodes)) && !isLastRetry && this.canRetryOrigin(nil, resp.StatusCode) {
+		shouldRetry = true
+		this.uri = oldURI // 恢复备份
+		this.addOriginAttempt(originAddr, "status: "+types.String(resp.StatusCode))
+		_ = resp.Body.Close()
+		return
+	}
 
 	// 恢复源站状态
 	if !origin.IsOk {
@@ -331,6 +416,20 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 		})
 	}
 
+	// 源站内容没有变化时只更新缓存
+	if this.cacheIsRevalidating && resp.StatusCode == http.StatusNotModified {
+		shouldStop, shouldRefetch := this.doCacheRevalidated(resp)
+		if shouldStop {
+			return
+		}
+
+		// 缓存已经无法读取，不带条件请求Header重新回源
+		if shouldRefetch {
+			this.uri = oldURI
+			return this.doOriginRequest(failedOriginIds, failedLnNodeIds, isFirstTry, isLastRetry)
+		}
+	}
+
 	// WAF对出站进行检查
 	if this.web.FirewallRef != nil && this.web.FirewallRef.IsOn {
 		if this.doWAFResponse(resp) {
@@ -445,6 +544,16 @@ func (this *HTTPRequest) doOriginRequest(failedOriginIds []int64, failedLnNodeId
 	}
 	pool.Put(buf)
 
+	// 响应Trailer，比如gRPC中的grpc-status
+	if len(resp.Trailer) > 0 {
+		var header = this.writer.Header()
+		for name, values := range resp.Trailer {
+			for _, value := range values {
+				header.Add(http.TrailerPrefix+name, value)
+			}
+		}
+	}
+
 	var closeErr = resp.Body.Close()
 	if closeErr != nil {
 		if !this.canIgnore(closeErr) {
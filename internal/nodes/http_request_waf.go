@@ -13,8 +13,12 @@ import (
 	"github.com/iwind/TeaGo/types"
 	"io"
 	"net/http"
+	"strings"
 )
 
+// 仅检测模式下匹配的请求在访问日志中的标签
+const wafDetectOnlyTag = "wafDetectOnly"
+
 // 调用WAF
 func (this *HTTPRequest) doWAFRequest() (blocked bool) {
 	if this.web.FirewallRef == nil || !this.web.FirewallRef.IsOn {
@@ -217,6 +221,7 @@ func (this *HTTPRequest) checkWAFRequest(firewallPolicy *firewallconfigs.HTTPFir
 		return
 	}
 
+	var countDetectOnlyItems = len(this.wafDetectOnlyItems)
 	goNext, hasRequestBody, ruleGroup, ruleSet, err := w.MatchRequest(this, this.writer)
 	if forceLog && logRequestBody && hasRequestBody && ruleSet != nil && ruleSet.HasAttackActions() {
 		this.wafHasRequestBody = true
@@ -228,6 +233,16 @@ func (this *HTTPRequest) checkWAFRequest(firewallPolicy *firewallconfigs.HTTPFir
 		return
 	}
 
+	// 仅检测模式下匹配的规则集
+	if len(this.wafDetectOnlyItems) > countDetectOnlyItems {
+		if forceLog {
+			this.forceLog = true
+		}
+		if this.firewallPolicyId == 0 {
+			this.firewallPolicyId = firewallPolicy.Id
+		}
+	}
+
 	if ruleSet != nil {
 		if forceLog {
 			this.forceLog = true
@@ -293,6 +308,7 @@ func (this *HTTPRequest) checkWAFResponse(firewallPolicy *firewallconfigs.HTTPFi
 		return
 	}
 
+	var countDetectOnlyItems = len(this.wafDetectOnlyItems)
 	goNext, hasRequestBody, ruleGroup, ruleSet, err := w.MatchResponse(this, resp, this.writer)
 	if forceLog && logRequestBody && hasRequestBody && ruleSet != nil && ruleSet.HasAttackActions() {
 		this.wafHasRequestBody = true
@@ -304,6 +320,16 @@ func (this *HTTPRequest) checkWAFResponse(firewallPolicy *firewallconfigs.HTTPFi
 		return
 	}
 
+	// 仅检测模式下匹配的规则集
+	if len(this.wafDetectOnlyItems) > countDetectOnlyItems {
+		if forceLog {
+			this.forceLog = true
+		}
+		if this.firewallPolicyId == 0 {
+			this.firewallPolicyId = firewallPolicy.Id
+		}
+	}
+
 	if ruleSet != nil {
 		if forceLog {
 			this.forceLog = true
@@ -392,3 +418,30 @@ func (this *HTTPRequest) WAFOnAction(action interface{}) (goNext bool) {
 	}
 	return true
 }
+
+// WAFOnAnomalyScore 异常评分回调，总分、匹配的规则集和达到的阈值会记录到访问日志中
+// 阈值对应的规则集是根据设置生成的，没有规则集ID，所以需要记录阈值以便于区分执行的动作
+func (this *HTTPRequest) WAFOnAnomalyScore(score int, matchedSetIds []int64, thresholdScore int) {
+	this.wafAnomalyScore += score
+	for _, setId := range matchedSetIds {
+		this.wafAnomalySetIds = append(this.wafAnomalySetIds, types.String(setId))
+	}
+	this.logAttrs["waf.anomalyScore"] = types.String(this.wafAnomalyScore)
+	this.logAttrs["waf.anomalySets"] = strings.Join(this.wafAnomalySetIds, ",")
+	if thresholdScore > 0 {
+		this.logAttrs["waf.anomalyThreshold"] = types.String(thresholdScore)
+	}
+}
+
+// WAFOnDetectOnly 仅检测模式下匹配了会阻止请求的规则集
+// 在统计中使用 detectOnly: 前缀的动作代号，在访问日志中添加 wafDetectOnly 标签，以便于和实际阻止的请求区分
+func (this *HTTPRequest) WAFOnDetectOnly(groupId int64, setId int64, actionCode string) {
+	this.wafDetectOnlyItems = append(this.wafDetectOnlyItems, types.String(groupId)+":"+types.String(setId)+":"+actionCode)
+	this.logAttrs["waf.detectOnly"] = strings.Join(this.wafDetectOnlyItems, ",")
+	if !lists.ContainsString(this.tags, wafDetectOnlyTag) {
+		this.tags = append(this.tags, wafDetectOnlyTag)
+	}
+
+	// 添加统计，不计入攻击请求数
+	stats.SharedHTTPRequestStatManager.AddFirewallDetectOnlyRuleGroupId(this.ReqServer.Id, groupId, actionCode)
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/utils"
+	"sync"
+	"time"
+)
+
+const retryBudgetSeconds = 10 // 重试预算统计的时间范围
+
+var SharedRetryBudgetManager = NewRetryBudgetManager()
+
+type retryBudgetBucket struct {
+	timestamp int64
+	requests  int64
+	retries   int64
+}
+
+// RetryBudget 回源重试预算
+// 在最近一段时间内，重试次数不能超过请求数的一定比例，以免在源站故障时放大请求
+type RetryBudget struct {
+	buckets   [retryBudgetSeconds]retryBudgetBucket
+	updatedAt int64
+	locker    sync.Mutex
+}
+
+// NewRetryBudget 获取新对象
+func NewRetryBudget() *RetryBudget {
+	return &RetryBudget{}
+}
+
+// AddRequest 增加请求数
+func (this *RetryBudget) AddRequest(timestamp int64) {
+	this.locker.Lock()
+	this.bucket(timestamp).requests++
+	this.updatedAt = timestamp
+	this.locker.Unlock()
+}
+
+// TryRetry 尝试消耗一次重试
+func (this *RetryBudget) TryRetry(timestamp int64, percent int, minRetriesPerSecond int) bool {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	var requests int64
+	var retries int64
+	for _, bucket := range this.buckets {
+		if bucket.timestamp > timestamp-retryBudgetSeconds {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+
+	var maxRetries = requests * int64(percent) / 100
+	var minRetries = int64(minRetriesPerSecond) * retryBudgetSeconds
+	if maxRetries < minRetries {
+		maxRetries = minRetries
+	}
+	if retries >= maxRetries {
+		return false
+	}
+
+	this.bucket(timestamp).retries++
+	this.updatedAt = timestamp
+	return true
+}
+
+func (this *RetryBudget) bucket(timestamp int64) *retryBudgetBucket {
+	var bucket = &this.buckets[timestamp%retryBudgetSeconds]
+	if bucket.timestamp != timestamp {
+		bucket.timestamp = timestamp
+		bucket.requests = 0
+		bucket.retries = 0
+	}
+	return bucket
+}
+
+// RetryBudgetManager 管理所有网站的重试预算
+type RetryBudgetManager struct {
+	budgetMap map[int64]*RetryBudget // serverId => *RetryBudget
+
+	cleanTicker *time.Ticker
+	locker      sync.RWMutex
+}
+
+// NewRetryBudgetManager 获取新对象
+func NewRetryBudgetManager() *RetryBudgetManager {
+	var manager = &RetryBudgetManager{
+		budgetMap:   map[int64]*RetryBudget{},
+		cleanTicker: time.NewTicker(1 * time.Minute),
+	}
+
+	goman.New(func() {
+		manager.cleanBudgets()
+	})
+
+	return manager
+}
+
+// AddRequest 增加请求数
+func (this *RetryBudgetManager) AddRequest(serverId int64) {
+	this.findBudget(serverId).AddRequest(utils.UnixTime())
+}
+
+// TryRetry 尝试消耗一次重试
+func (this *RetryBudgetManager) TryRetry(serverId int64, policy *configs.RetryPolicyConfig) bool {
+	return this.findBudget(serverId).TryRetry(utils.UnixTime(), policy.BudgetPercent, policy.MinRetriesPerSecond)
+}
+
+func (this *RetryBudgetManager) findBudget(serverId int64) *RetryBudget {
+	this.locker.RLock()
+	budget, ok := this.budgetMap[serverId]
+	this.locker.RUnlock()
+	if ok {
+		return budget
+	}
+
+	this.locker.Lock()
+	budget, ok = this.budgetMap[serverId]
+	if !ok {
+		budget = NewRetryBudget()
+		this.budgetMap[serverId] = budget
+	}
+	this.locker.Unlock()
+	return budget
+}
+
+// 清理长时间没有使用的预算
+func (this *RetryBudgetManager) cleanBudgets() {
+	for range this.cleanTicker.C {
+		var expiresAt = utils.UnixTime() - 600
+
+		this.locker.Lock()
+		for serverId, budget := range this.budgetMap {
+			budget.locker.Lock()
+			var updatedAt = budget.updatedAt
+			budget.locker.Unlock()
+			if updatedAt < expiresAt {
+				delete(this.budgetMap, serverId)
+			}
+		}
+		this.locker.Unlock()
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"testing"
+)
+
+func TestRetryBudget_TryRetry(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var budget = NewRetryBudget()
+	var now int64 = 1_000_000
+	for i := 0; i < 1000; i++ {
+		budget.AddRequest(now)
+	}
+
+	// 1000 * 20% = 200
+	var countAllowed = 0
+	for i := 0; i < 300; i++ {
+		if budget.TryRetry(now, 20, 1) {
+			countAllowed++
+		}
+	}
+	a.IsTrue(countAllowed == 200)
+
+	// 超出统计时间范围之后重新计算
+	now += retryBudgetSeconds
+	countAllowed = 0
+	for i := 0; i < 100; i++ {
+		if budget.TryRetry(now, 20, 1) {
+			countAllowed++
+		}
+	}
+	a.IsTrue(countAllowed == 1*retryBudgetSeconds)
+}
@@ -105,6 +105,20 @@ func (this *HTTPWriter) Prepare(resp *http.Response, size int64, status int, ena
 	// 是否为区间请求
 	this.isPartial = status == http.StatusPartialContent
 
+	// 分片回源时区间内容作为单独的分片缓存
+	if this.req.cacheIsSlice {
+		if this.isPartial {
+			this.isPartial = false
+			if !this.req.checkCacheSliceResponse(this.Header()) {
+				enableCache = false
+			}
+		} else {
+			// 源站不支持区间请求时按照普通内容缓存
+			this.req.cacheIsSlice = false
+			this.req.cacheKey = this.req.cacheBaseKey
+		}
+	}
+
 	// 不支持对GET以外的方法返回的Partial内容的缓存
 	if this.isPartial && this.req.Method() != http.MethodGet {
 		enableCache = false
@@ -121,7 +135,7 @@ func (this *HTTPWriter) Prepare(resp *http.Response, size int64, status int, ena
 		if enableCache {
 			this.PrepareCache(resp, size)
 		}
-		if !this.isPartial {
+		if !this.isPartial && !this.req.cacheIsSlice {
 			this.PrepareWebP(resp, size)
 		}
 		this.PrepareCompression(resp, size)
@@ -245,6 +259,16 @@ func (this *HTTPWriter) PrepareCache(resp *http.Response, size int64) {
 		return
 	}
 
+	// 源站要求不缓存或者内容已经过期
+	life, canCache := this.calculateCacheLife(this.Header())
+	if !canCache {
+		this.req.varMapping["cache.status"] = "BYPASS"
+		if addStatusHeader {
+			this.Header().Set("X-Cache", "BYPASS, Cache-Control")
+		}
+		return
+	}
+
 	// 打开缓存写入
 	var storage = caches.SharedManager.FindStorageWithPolicy(cachePolicy.Id)
 	if storage == nil {
@@ -261,27 +285,6 @@ func (this *HTTPWriter) PrepareCache(resp *http.Response, size int64) {
 	}
 
 	this.cacheStorage = storage
-	var life = cacheRef.LifeSeconds()
-
-	if life <= 0 {
-		life = 60
-	}
-
-	// 支持源站设置的max-age
-	if this.req.web.Cache != nil && this.req.web.Cache.EnableCacheControlMaxAge {
-		var cacheControl = this.GetHeader("Cache-Control")
-		var pieces = strings.Split(cacheControl, ";")
-		for _, piece := range pieces {
-			var eqIndex = strings.Index(piece, "=")
-			if eqIndex > 0 && piece[:eqIndex] == "max-age" {
-				var maxAge = types.Int64(piece[eqIndex+1:])
-				if maxAge > 0 {
-					life = maxAge
-				}
-			}
-		}
-	}
-
 	var expiresAt = utils.UnixTime() + life
 
 	if this.req.isLnRequest {
@@ -299,7 +302,30 @@ func (this *HTTPWriter) PrepareCache(resp *http.Response, size int64) {
 		}
 	}
 
+	// 准入策略
+	// 本地的刷新、验证和分片请求不受影响
+	if !this.req.cacheIsSlice && len(this.req.localCacheAction()) == 0 && !caches.SharedManager.AdmitWrite(cachePolicy.Id, this.req.cacheKey) {
+		this.req.varMapping["cache.status"] = "BYPASS"
+		if addStatusHeader {
+			this.Header().Set("X-Cache", "BYPASS, Admission")
+		}
+		return
+	}
+
+	// Vary
+	// 分片不区分Vary变体
 	var cacheKey = this.req.cacheKey
+	var err error
+	if !this.req.cacheIsSlice {
+		cacheKey, err = this.prepareCacheVariantKey(storage, cachePolicy.Id, expiresAt)
+		if err != nil {
+			this.req.varMapping["cache.status"] = "BYPASS"
+			if addStatusHeader {
+				this.Header().Set("X-Cache", "BYPASS, "+err.Error())
+			}
+			return
+		}
+	}
 	if this.isPartial {
 		cacheKey += caches.SuffixPartial
 	}
@@ -357,6 +383,12 @@ func (this *HTTPWriter) PrepareCache(resp *http.Response, size int64) {
 		}
 	}
 	_, err = cacheWriter.WriteHeader(headerBuf.Bytes())
+
+	// 合并回源时等待的请求需要使用同样的Header
+	var fetchHeaderData []byte
+	if this.req.cacheFetchCall != nil && !this.isPartial {
+		fetchHeaderData = append([]byte{}, headerBuf.Bytes()...)
+	}
 	utils.SharedBufferPool.Put(headerBuf)
 	if err != nil {
 		remotelogs.Error("HTTP_WRITER", "write cache failed: "+err.Error())
@@ -469,7 +501,18 @@ func (this *HTTPWriter) PrepareCache(resp *http.Response, size int64) {
 		return
 	}
 
-	var cacheReader = readers.NewTeeReaderCloser(resp.Body, this.cacheWriter)
+	// 同时输出给等待的请求
+	var teeWriter io.Writer = this.cacheWriter
+	var fetchStream *caches.FetchStream
+	if this.req.cacheFetchCall != nil && !this.req.cacheIsSlice && this.req.cacheFetchCall.Key() == cacheKey {
+		var coalescingConfig = caches.SharedManager.FindPolicyOptions(cachePolicy.Id).FetchCoalescing
+		fetchStream = this.req.cacheFetchCall.StartStream(this.StatusCode(), fetchHeaderData, size, coalescingConfig.StreamMaxSize)
+		if fetchStream != nil {
+			teeWriter = io.MultiWriter(this.cacheWriter, fetchStream)
+		}
+	}
+
+	var cacheReader = readers.NewTeeReaderCloser(resp.Body, teeWriter)
 	resp.Body = cacheReader
 	this.rawReader = cacheReader
 
@@ -478,9 +521,17 @@ func (this *HTTPWriter) PrepareCache(resp *http.Response, size int64) {
 			_ = this.cacheWriter.Discard()
 		}
 		this.cacheWriter = nil
+
+		if fetchStream != nil {
+			fetchStream.Fail(err)
+		}
 	})
 	cacheReader.OnEOF(func() {
 		this.cacheIsFinished = true
+
+		if fetchStream != nil {
+			_ = fetchStream.Close()
+		}
 	})
 }
 
@@ -939,35 +990,62 @@ func (this *HTTPWriter) DelayRead() bool {
 	return this.delayRead
 }
 
+// 计算缓存时长
+// canCache 为false表示源站要求不缓存（no-store、private），或者内容在源站已经过期（max-age=0、过去的Expires等）
+func (this *HTTPWriter) calculateCacheLife(header http.Header) (life int64, canCache bool) {
+	// 支持源站设置的s-maxage、max-age、Expires等
+	if this.req.web.Cache != nil && this.req.web.Cache.EnableCacheControlMaxAge {
+		var freshnessConfig = caches.SharedManager.FindPolicyOptions(this.req.ReqServer.HTTPCachePolicy.Id).Freshness
+		return caches.CalculateCacheLife(header, utils.UnixTime(), this.req.cacheRef.LifeSeconds(), freshnessConfig)
+	}
+
+	life = this.req.cacheRef.LifeSeconds()
+	if life <= 0 {
+		life = 60
+	}
+	return life, true
+}
+
 // 计算stale时长
 func (this *HTTPWriter) calculateStaleLife() int {
-	var staleLife = 600 // TODO 可以在缓存策略里设置此时间
+	var staleLife = caches.DefaultFreshnessConfig().StaleLifeSeconds
+	var cachePolicy = this.req.ReqServer.HTTPCachePolicy
+	if cachePolicy != nil {
+		staleLife = caches.SharedManager.FindPolicyOptions(cachePolicy.Id).Freshness.StaleLifeSeconds
+	}
+
+	var cacheControl = caches.ParseCacheControl(strings.Join(this.Header().Values("Cache-Control"), ","))
 	var staleConfig = this.req.web.Cache.Stale
 	if staleConfig != nil && staleConfig.IsOn {
 		// 从Header中读取stale-if-error
+		// 这里预示着如果stale-if-error=0，可以关闭stale功能
 		var isDefinedInHeader = false
-		if staleConfig.SupportStaleIfErrorHeader {
-			var cacheControl = this.GetHeader("Cache-Control")
-			var pieces = strings.Split(cacheControl, ",")
-			for _, piece := range pieces {
-				var eqIndex = strings.Index(piece, "=")
-				if eqIndex > 0 && strings.TrimSpace(piece[:eqIndex]) == "stale-if-error" {
-					// 这里预示着如果stale-if-error=0，可以关闭stale功能
-					staleLife = types.Int(strings.TrimSpace(piece[eqIndex+1:]))
-					isDefinedInHeader = true
-					break
-				}
-			}
+		if staleConfig.SupportStaleIfErrorHeader && cacheControl.StaleIfError >= 0 {
+			staleLife = int(cacheControl.StaleIfError)
+			isDefinedInHeader = true
 		}
 
 		// 自定义
 		if !isDefinedInHeader && staleConfig.Life != nil {
 			staleLife = types.Int(staleConfig.Life.Duration().Seconds())
 		}
+	} else if cacheControl.StaleIfError >= 0 {
+		staleLife = int(cacheControl.StaleIfError)
+	}
+
+	// 保证在stale-while-revalidate期间内容仍然可用
+	if cacheControl.StaleWhileRevalidate > int64(staleLife) {
+		staleLife = int(cacheControl.StaleWhileRevalidate)
 	}
+
 	return staleLife
 }
 
+// 读取响应中的缓存标签
+func (this *HTTPWriter) cacheTags() []string {
+	return caches.ParseCacheTags(this.Header())
+}
+
 // 结束WebP
 func (this *HTTPWriter) finishWebP() {
 	// 处理WebP
@@ -1105,6 +1183,7 @@ func (this *HTTPWriter) finishWebP() {
 					BodySize:   webpCacheWriter.BodySize(),
 					Host:       this.req.ReqHost,
 					ServerId:   this.req.ReqServer.Id,
+					Tags:       this.cacheTags(),
 				})
 			}
 		}
@@ -1113,6 +1192,15 @@ func (this *HTTPWriter) finishWebP() {
 
 // 结束缓存相关处理
 func (this *HTTPWriter) finishCache() {
+	// 通知合并回源中等待的请求
+	var isCached = false
+	defer func() {
+		if this.req.cacheFetchCall != nil {
+			this.req.cacheFetchCall.Done(isCached)
+			this.req.cacheFetchCall = nil
+		}
+	}()
+
 	// 缓存
 	if this.cacheWriter != nil {
 		if this.isOk && this.cacheIsFinished {
@@ -1144,8 +1232,10 @@ func (this *HTTPWriter) finishCache() {
 							BodySize:   this.cacheWriter.BodySize(),
 							Host:       this.req.ReqHost,
 							ServerId:   this.req.ReqServer.Id,
+							Tags:       this.cacheTags(),
 						})
 					}
+					isCached = !this.isPartial
 				}
 			}
 		} else {
@@ -1165,6 +1255,7 @@ func (this *HTTPWriter) finishCache() {
 						BodySize:   this.cacheWriter.BodySize(),
 						Host:       this.req.ReqHost,
 						ServerId:   this.req.ReqServer.Id,
+						Tags:       this.cacheTags(),
 					})
 				}
 			}
@@ -1188,6 +1279,7 @@ func (this *HTTPWriter) finishCompression() {
 					BodySize:   this.compressionCacheWriter.BodySize(),
 					Host:       this.req.ReqHost,
 					ServerId:   this.req.ReqServer.Id,
+					Tags:       this.cacheTags(),
 				})
 			}
 		} else {
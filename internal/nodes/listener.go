@@ -4,19 +4,28 @@ import (
 	"context"
 	"errors"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	"github.com/TeaOSLab/EdgeNode/internal/events"
 	"github.com/TeaOSLab/EdgeNode/internal/goman"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/utils"
+	"github.com/quic-go/quic-go"
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Listener struct {
-	group    *serverconfigs.ServerAddressGroup
-	listener ListenerInterface // 监听器
+	group         *serverconfigs.ServerAddressGroup
+	listener      ListenerInterface // 监听器
+	http3Listener *HTTP3Listener    // HTTP/3监听器，只有HTTPS地址开启HTTP/3后才有
+	rawListeners  []net.Listener    // 原始的TCP或Unix监听器，开启SO_REUSEPORT时有多个，平滑重启时会传递给新进程
+	netListeners  []*ClientListener // 每个原始监听器对应一个
 
 	locker sync.RWMutex
 }
@@ -31,6 +40,9 @@ func (this *Listener) Reload(group *serverconfigs.ServerAddressGroup) {
 	if this.listener != nil {
 		this.listener.Reload(group)
 	}
+	if this.http3Listener != nil {
+		this.http3Listener.Reload(group)
+	}
 	this.locker.Unlock()
 }
 
@@ -58,43 +70,58 @@ func (this *Listener) listenTCP() error {
 	}
 	var protocol = this.group.Protocol()
 
-	tcpListener, err := this.createTCPListener()
+	tcpListeners, err := this.createTCPListeners()
 	if err != nil {
 		return err
 	}
-	var netListener = NewClientListener(tcpListener, protocol.IsHTTPFamily() || protocol.IsHTTPSFamily())
+	this.rawListeners = tcpListeners
+
+	// 开启SO_REUSEPORT时每个监听器都在单独的循环中接受连接
+	var netListeners = []*ClientListener{}
+	var listeners = []net.Listener{}
+	for _, tcpListener := range tcpListeners {
+		var netListener = NewClientListener(tcpListener, protocol.IsHTTPFamily() || protocol.IsHTTPSFamily() || protocol == serverconfigs.ProtocolUnix)
+		netListener.SetAddr(this.group.FullAddr())
+		netListeners = append(netListeners, netListener)
+		listeners = append(listeners, netListener)
+	}
+	this.netListeners = netListeners
 	events.OnKey(events.EventQuit, this, func() {
 		remotelogs.Println("LISTENER", "quit "+this.group.FullAddr())
-		_ = netListener.Close()
+		for _, netListener := range netListeners {
+			_ = netListener.Close()
+		}
 	})
 
 	switch protocol {
 	case serverconfigs.ProtocolHTTP, serverconfigs.ProtocolHTTP4, serverconfigs.ProtocolHTTP6:
 		this.listener = &HTTPListener{
 			BaseListener: BaseListener{Group: this.group},
-			Listener:     netListener,
+			Listeners:    listeners,
 		}
 	case serverconfigs.ProtocolHTTPS, serverconfigs.ProtocolHTTPS4, serverconfigs.ProtocolHTTPS6:
-		netListener.SetIsTLS(true)
-		this.listener = &HTTPListener{
+		this.setNetListenersTLS()
+		var httpListener = &HTTPListener{
 			BaseListener: BaseListener{Group: this.group},
-			Listener:     netListener,
+			Listeners:    listeners,
 		}
+		this.listener = httpListener
+		this.listenHTTP3(httpListener)
 	case serverconfigs.ProtocolTCP, serverconfigs.ProtocolTCP4, serverconfigs.ProtocolTCP6:
 		this.listener = &TCPListener{
 			BaseListener: BaseListener{Group: this.group},
-			Listener:     netListener,
+			Listeners:    listeners,
 		}
 	case serverconfigs.ProtocolTLS, serverconfigs.ProtocolTLS4, serverconfigs.ProtocolTLS6:
-		netListener.SetIsTLS(true)
+		this.setNetListenersTLS()
 		this.listener = &TCPListener{
 			BaseListener: BaseListener{Group: this.group},
-			Listener:     netListener,
+			Listeners:    listeners,
 		}
 	case serverconfigs.ProtocolUnix:
 		this.listener = &UnixListener{
 			BaseListener: BaseListener{Group: this.group},
-			Listener:     netListener,
+			Listeners:    listeners,
 		}
 	default:
 		return errors.New("unknown protocol '" + protocol.String() + "'")
@@ -190,9 +217,115 @@ func (this *Listener) listenUDP() error {
 	return nil
 }
 
+// 在HTTPS地址的同一个UDP端口上监听HTTP/3
+func (this *Listener) listenHTTP3(httpListener *HTTPListener) {
+	var options = sharedListenerConfig.FindAddressOptions(this.group.FullAddr()).HTTP3
+	if options == nil || !options.IsOn {
+		return
+	}
+
+	var http3Listener = &HTTP3Listener{
+		BaseListener: BaseListener{Group: this.group},
+		HTTPListener: httpListener,
+		Options:      options,
+		connMap:      map[*quic.Conn]*HTTP3ClientConn{},
+	}
+	http3Listener.Init()
+	this.http3Listener = http3Listener
+
+	events.OnKey(events.EventQuit, http3Listener, func() {
+		_ = http3Listener.Close()
+	})
+
+	goman.New(func() {
+		err := http3Listener.Serve()
+		if err != nil {
+			remotelogs.Error("LISTENER", err.Error())
+		}
+	})
+}
+
+// Files 获取原始监听器对应的文件，用于平滑重启时传递给新进程
+func (this *Listener) Files() ([]*os.File, error) {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+
+	if len(this.rawListeners) == 0 {
+		return nil, errors.New("listener '" + this.FullAddr() + "' can not be inherited")
+	}
+
+	var files = []*os.File{}
+	for _, rawListener := range this.rawListeners {
+		fileListener, ok := rawListener.(interface {
+			File() (*os.File, error)
+		})
+		var err error
+		if ok {
+			var file *os.File
+			file, err = fileListener.File()
+			if err == nil {
+				files = append(files, file)
+				continue
+			}
+		} else {
+			err = errors.New("listener '" + this.FullAddr() + "' can not be inherited")
+		}
+
+		for _, file := range files {
+			_ = file.Close()
+		}
+		return nil, err
+	}
+	return files, nil
+}
+
+// KeepUnixSockFile 关闭时保留Unix套接字文件，以便于新进程继续使用
+func (this *Listener) KeepUnixSockFile() {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+
+	for _, rawListener := range this.rawListeners {
+		unixListener, ok := rawListener.(interface {
+			SetUnlinkOnClose(unlink bool)
+		})
+		if ok {
+			unixListener.SetUnlinkOnClose(false)
+		}
+	}
+}
+
+// 设置所有的客户端监听器为TLS
+func (this *Listener) setNetListenersTLS() {
+	for _, netListener := range this.netListeners {
+		netListener.SetIsTLS(true)
+	}
+}
+
+// StopAccepting 停止接受新连接，并且不再保持连接，已有的连接会继续处理
+func (this *Listener) StopAccepting() {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+
+	for _, netListener := range this.netListeners {
+		_ = netListener.Close()
+	}
+
+	keepAliveListener, ok := this.listener.(interface {
+		DisableKeepAlives()
+	})
+	if ok {
+		keepAliveListener.DisableKeepAlives()
+	}
+}
+
 func (this *Listener) Close() error {
 	events.Remove(this)
 
+	if this.http3Listener != nil {
+		events.Remove(this.http3Listener)
+		_ = this.http3Listener.Close()
+	}
+
 	if this.listener == nil {
 		return nil
 	}
@@ -200,20 +333,162 @@ func (this *Listener) Close() error {
 }
 
 // 创建TCP监听器
-func (this *Listener) createTCPListener() (net.Listener, error) {
+// 开启SO_REUSEPORT时同一个地址会创建多个监听器，由系统内核在监听器之间分配连接
+func (this *Listener) createTCPListeners() ([]net.Listener, error) {
+	if this.group.Protocol() == serverconfigs.ProtocolUnix {
+		unixListener, err := this.createUnixListener()
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{unixListener}, nil
+	}
+
+	var options = sharedListenerConfig.FindAddressOptions(this.group.FullAddr()).Socket
+	var countAcceptors = 1
+	if options != nil && canReusePort {
+		countAcceptors = options.CountAcceptors()
+	}
+
+	// 平滑重启时从父进程继承的监听器
+	// 继承的监听器中可能有排队等待接受的连接，所以即使数量超出设置也不关闭
+	var listeners = takeInheritedListeners(this.group.FullAddr())
+	for len(listeners) < countAcceptors {
+		listener, err := this.createTCPListener(options)
+		if err != nil {
+			if len(listeners) == 0 {
+				return nil, err
+			}
+
+			// 继承的监听器没有开启SO_REUSEPORT时无法再创建新的监听器
+			remotelogs.Warn("LISTENER", "create more listeners on '"+this.group.FullAddr()+"' failed: "+err.Error())
+			break
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// 创建单个TCP监听器
+func (this *Listener) createTCPListener(options *configs.ListenerSocketConfig) (net.Listener, error) {
 	var listenConfig = net.ListenConfig{
-		Control:   nil,
+		Control:   listenerSocketControl(options),
 		KeepAlive: 0,
 	}
+	if options != nil {
+		listenConfig.KeepAlive = options.KeepAlive()
+	}
 
+	var network = "tcp"
 	switch this.group.Protocol() {
 	case serverconfigs.ProtocolHTTP4, serverconfigs.ProtocolHTTPS4, serverconfigs.ProtocolTLS4:
-		return listenConfig.Listen(context.Background(), "tcp4", this.group.Addr())
+		network = "tcp4"
 	case serverconfigs.ProtocolHTTP6, serverconfigs.ProtocolHTTPS6, serverconfigs.ProtocolTLS6:
-		return listenConfig.Listen(context.Background(), "tcp6", this.group.Addr())
+		network = "tcp6"
 	}
 
-	return listenConfig.Listen(context.Background(), "tcp", this.group.Addr())
+	listener, err := listenConfig.Listen(context.Background(), network, this.group.Addr())
+	if err != nil {
+		return nil, err
+	}
+
+	if options != nil && options.Backlog > 0 {
+		err = setListenerBacklog(listener, options.Backlog)
+		if err != nil {
+			remotelogs.Warn("LISTENER", "set backlog of '"+this.group.FullAddr()+"' failed: "+err.Error())
+		}
+	}
+
+	return listener, nil
+}
+
+// 创建Unix套接字监听器
+func (this *Listener) createUnixListener() (net.Listener, error) {
+	var sockFile = this.unixSockFile()
+	if len(sockFile) == 0 {
+		return nil, errors.New("unix socket file should not be empty")
+	}
+
+	// 平滑重启时从父进程继承的监听器
+	var inheritedListeners = takeInheritedListeners(this.group.FullAddr())
+	for index, inheritedListener := range inheritedListeners {
+		unixListener, ok := inheritedListener.(*net.UnixListener)
+		if ok {
+			for _, otherListener := range inheritedListeners[index+1:] {
+				_ = otherListener.Close()
+			}
+			return &unixNetListener{UnixListener: unixListener}, nil
+		}
+		_ = inheritedListener.Close()
+	}
+
+	// 清理上次没有正常删除的套接字文件
+	stat, err := os.Lstat(sockFile)
+	if err == nil {
+		if stat.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New("'" + sockFile + "' already exists and is not a socket file")
+		}
+
+		conn, dialErr := net.DialTimeout("unix", sockFile, 1*time.Second)
+		if dialErr == nil {
+			_ = conn.Close()
+			return nil, errors.New("another process is listening on '" + sockFile + "'")
+		}
+
+		err = os.Remove(sockFile)
+		if err != nil {
+			return nil, errors.New("remove stale socket file failed: " + err.Error())
+		}
+	} else if os.IsNotExist(err) {
+		err = os.MkdirAll(filepath.Dir(sockFile), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var listenConfig = net.ListenConfig{}
+	listener, err := listenConfig.Listen(context.Background(), "unix", sockFile)
+	if err != nil {
+		return nil, err
+	}
+	unixListener, ok := listener.(*net.UnixListener)
+	if !ok {
+		_ = listener.Close()
+		return nil, errors.New("unexpected unix listener type")
+	}
+
+	// 文件权限和所有者
+	var options = sharedListenerConfig.FindAddressOptions(this.group.FullAddr()).Unix
+	if options != nil {
+		if options.FileMode() > 0 {
+			err = os.Chmod(sockFile, options.FileMode())
+			if err != nil {
+				_ = listener.Close()
+				return nil, err
+			}
+		}
+		if options.HasOwner() {
+			uid, gid, err := utils.LookupUserAndGroup(options.User, options.Group)
+			if err == nil {
+				err = os.Chown(sockFile, uid, gid)
+			}
+			if err != nil {
+				_ = listener.Close()
+				return nil, errors.New("change owner of '" + sockFile + "' failed: " + err.Error())
+			}
+		}
+	}
+
+	return &unixNetListener{UnixListener: unixListener}, nil
+}
+
+// Unix套接字文件路径，比如 unix:/var/run/edge-node.sock
+func (this *Listener) unixSockFile() string {
+	var addr = this.group.FullAddr()
+	var prefix = serverconfigs.ProtocolUnix.String() + ":"
+	if strings.HasPrefix(addr, prefix+"//") {
+		return addr[len(prefix)+2:]
+	}
+	return strings.TrimPrefix(addr, prefix)
 }
 
 // 创建UDP IPv4监听器
@@ -6,9 +6,11 @@ import (
 	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/sslconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
 	"github.com/iwind/TeaGo/types"
 	"net"
+	"sync"
 )
 
 type BaseListener struct {
@@ -188,12 +190,54 @@ func (this *BaseListener) helloServerName(clientInfo *tls.ClientHelloInfo) strin
 	var serverName = clientInfo.ServerName
 	if len(serverName) == 0 {
 		var localAddr = clientInfo.Conn.LocalAddr()
-		if localAddr != nil {
-			tcpAddr, ok := localAddr.(*net.TCPAddr)
-			if ok {
-				serverName = tcpAddr.IP.String()
-			}
+		switch addr := localAddr.(type) {
+		case *net.TCPAddr:
+			serverName = addr.IP.String()
+		case *net.UDPAddr: // HTTP/3
+			serverName = addr.IP.String()
 		}
 	}
 	return serverName
 }
+
+// 在每个监听器上分别运行服务循环，直到所有的循环都结束，返回第一个错误
+func serveListeners(listeners []net.Listener, serveFunc func(listener net.Listener) error) error {
+	if len(listeners) == 1 {
+		return serveFunc(listeners[0])
+	}
+
+	var firstErr error
+	var errLocker = sync.Mutex{}
+	var wg = &sync.WaitGroup{}
+	wg.Add(len(listeners))
+	for _, listener := range listeners {
+		var rawListener = listener
+		goman.New(func() {
+			defer wg.Done()
+
+			err := serveFunc(rawListener)
+			if err != nil {
+				errLocker.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errLocker.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// 关闭所有监听器
+func closeListeners(listeners []net.Listener) error {
+	var firstErr error
+	for _, listener := range listeners {
+		err := listener.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
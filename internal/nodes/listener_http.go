@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/events"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
 	"github.com/iwind/TeaGo/Tea"
 	"golang.org/x/net/http2"
@@ -29,17 +30,19 @@ var HTTPConnContextKey = &contextKey{key: "http-conn"}
 type HTTPListener struct {
 	BaseListener
 
-	Listener net.Listener
+	Listeners []net.Listener // 开启SO_REUSEPORT时有多个
 
 	addr       string
 	isHTTP     bool
 	isHTTPS    bool
+	isUnix     bool // 是否为Unix套接字
 	httpServer *http.Server
+	altSvc     atomic.Value // Alt-Svc 报头值，开启HTTP/3后用来通知客户端
 }
 
 func (this *HTTPListener) Serve() error {
 	this.addr = this.Group.Addr()
-	this.isHTTP = this.Group.IsHTTP()
+	this.isHTTP = this.Group.IsHTTP() || this.isUnix
 	this.isHTTPS = this.Group.IsHTTPS()
 
 	this.httpServer = &http.Server{
@@ -51,7 +54,7 @@ func (this *HTTPListener) Serve() error {
 			switch state {
 			case http.StateNew:
 				atomic.AddInt64(&this.countActiveConnections, 1)
-			case http.StateClosed:
+			case http.StateClosed, http.StateHijacked: // Websocket等被接管的连接不再变为StateClosed，由 conns.SharedMap 管理
 				atomic.AddInt64(&this.countActiveConnections, -1)
 			}
 		},
@@ -72,10 +75,22 @@ func (this *HTTPListener) Serve() error {
 
 	this.httpServer.SetKeepAlivesEnabled(true)
 
+	// 退出时关闭空闲连接，并且不再保持连接，以便于尽快处理完已有请求
+	var httpServer = this.httpServer
+	events.OnKey(events.EventQuit, this, func() {
+		httpServer.SetKeepAlivesEnabled(false)
+	})
+
 	// HTTP协议
 	if this.isHTTP {
-		err := this.httpServer.Serve(this.Listener)
-		if err != nil && err != http.ErrServerClosed {
+		err := serveListeners(this.Listeners, func(listener net.Listener) error {
+			err := httpServer.Serve(listener)
+			if err != nil && err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
 			return err
 		}
 	}
@@ -90,8 +105,14 @@ func (this *HTTPListener) Serve() error {
 			remotelogs.Error("HTTP_LISTENER", "configure http2 error: "+err.Error())
 		}
 
-		err = this.httpServer.ServeTLS(this.Listener, "", "")
-		if err != nil && err != http.ErrServerClosed {
+		err = serveListeners(this.Listeners, func(listener net.Listener) error {
+			err := httpServer.ServeTLS(listener, "", "")
+			if err != nil && err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
 			return err
 		}
 	}
@@ -100,10 +121,20 @@ func (this *HTTPListener) Serve() error {
 }
 
 func (this *HTTPListener) Close() error {
+	events.Remove(this)
+
 	if this.httpServer != nil {
 		_ = this.httpServer.Close()
 	}
-	return this.Listener.Close()
+	return closeListeners(this.Listeners)
+}
+
+// DisableKeepAlives 不再保持连接，并关闭空闲连接
+func (this *HTTPListener) DisableKeepAlives() {
+	var httpServer = this.httpServer
+	if httpServer != nil {
+		httpServer.SetKeepAlivesEnabled(false)
+	}
 }
 
 func (this *HTTPListener) Reload(group *serverconfigs.ServerAddressGroup) {
@@ -112,6 +143,11 @@ func (this *HTTPListener) Reload(group *serverconfigs.ServerAddressGroup) {
 	this.Reset()
 }
 
+// SetAltSvc 设置 Alt-Svc 报头值，为空表示不再发送
+func (this *HTTPListener) SetAltSvc(altSvc string) {
+	this.altSvc.Store(altSvc)
+}
+
 // ServerHTTP 处理HTTP请求
 func (this *HTTPListener) ServeHTTP(rawWriter http.ResponseWriter, rawReq *http.Request) {
 	// 不支持Connect
@@ -120,6 +156,22 @@ func (this *HTTPListener) ServeHTTP(rawWriter http.ResponseWriter, rawReq *http.
 		return
 	}
 
+	// 通知客户端可以使用HTTP/3
+	if rawReq.ProtoMajor < 3 {
+		altSvc, _ := this.altSvc.Load().(string)
+		if len(altSvc) > 0 {
+			rawWriter.Header().Set("Alt-Svc", altSvc)
+		}
+	}
+
+	// Unix套接字连接中没有客户端地址，视为本机
+	if this.isUnix {
+		_, _, err := net.SplitHostPort(rawReq.RemoteAddr)
+		if err != nil {
+			rawReq.RemoteAddr = "127.0.0.1:0"
+		}
+	}
+
 	// 域名
 	var reqHost = strings.ToLower(strings.TrimRight(rawReq.Host, "."))
 
@@ -0,0 +1,200 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"context"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/TeaOSLab/EdgeNode/internal/goman"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 平滑重启时旧进程会继续占用UDP端口直到退出，所以需要多次尝试监听
+const http3ListenRetries = 120
+
+// HTTP3Listener HTTP/3（QUIC）监听
+// 和HTTPS监听共用同一个地址的UDP端口，请求交给HTTPS监听处理
+// 每个QUIC连接和TCP连接一样需要检查IP名单、限制并发连接数和统计活跃连接数
+type HTTP3Listener struct {
+	BaseListener
+
+	HTTPListener *HTTPListener // 同一个地址上的HTTPS监听
+	Options      *configs.HTTP3Config
+
+	packetConn net.PacketConn
+	server     *http3.Server
+	isClosed   bool
+	locker     sync.Mutex
+
+	connMap    map[*quic.Conn]*HTTP3ClientConn // raw conn => conn
+	connLocker sync.RWMutex
+}
+
+func (this *HTTP3Listener) Serve() error {
+	packetConn, server, err := this.listen()
+	if err != nil || server == nil {
+		return err
+	}
+
+	// 自行接受QUIC连接，以便于对每个连接进行检查
+	earlyListener, err := quic.ListenEarly(packetConn, http3.ConfigureTLSConfig(server.TLSConfig), server.QUICConfig)
+	if err != nil {
+		return err
+	}
+
+	// 通知TCP客户端可以使用HTTP/3
+	udpAddr, ok := packetConn.LocalAddr().(*net.UDPAddr)
+	if ok {
+		this.HTTPListener.SetAltSvc(this.Options.AltSvc(udpAddr.Port))
+	}
+
+	err = server.ServeListener(&http3EarlyListener{
+		EarlyListener: earlyListener,
+		listener:      this,
+	})
+	this.HTTPListener.SetAltSvc("")
+
+	this.locker.Lock()
+	var isClosed = this.isClosed
+	this.locker.Unlock()
+	if isClosed || err == http.ErrServerClosed || errors.Is(err, quic.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (this *HTTP3Listener) Close() error {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	this.isClosed = true
+
+	if this.server != nil {
+		_ = this.server.Close()
+	}
+	if this.packetConn != nil {
+		return this.packetConn.Close()
+	}
+	return nil
+}
+
+func (this *HTTP3Listener) Reload(group *serverconfigs.ServerAddressGroup) {
+	this.Group = group
+	this.Reset()
+}
+
+// 将请求所在的QUIC连接放入上下文中，以便于绑定服务和限制连接数
+func (this *HTTP3Listener) connContext(ctx context.Context, rawConn *quic.Conn) context.Context {
+	this.connLocker.RLock()
+	var conn = this.connMap[rawConn]
+	this.connLocker.RUnlock()
+
+	if conn != nil {
+		return context.WithValue(ctx, HTTPConnContextKey, conn)
+	}
+	return ctx
+}
+
+// 检查新的QUIC连接
+func (this *HTTP3Listener) acceptConn(rawConn *quic.Conn) bool {
+	ip, _, err := net.SplitHostPort(rawConn.RemoteAddr().String())
+	if err == nil {
+		canGoNext, _ := checkClientIP(ip)
+		if !canGoNext {
+			_ = rawConn.CloseWithError(0, "")
+			return false
+		}
+	}
+
+	var conn = NewHTTP3ClientConn(rawConn)
+	this.connLocker.Lock()
+	this.connMap[rawConn] = conn
+	this.connLocker.Unlock()
+	atomic.AddInt64(&this.countActiveConnections, 1)
+
+	// 连接关闭后释放
+	goman.New(func() {
+		<-rawConn.Context().Done()
+
+		_ = conn.Close()
+
+		this.connLocker.Lock()
+		delete(this.connMap, rawConn)
+		this.connLocker.Unlock()
+		atomic.AddInt64(&this.countActiveConnections, -1)
+	})
+
+	return true
+}
+
+// 监听UDP端口
+func (this *HTTP3Listener) listen() (net.PacketConn, *http3.Server, error) {
+	var network = "udp"
+	switch this.Group.Protocol() {
+	case serverconfigs.ProtocolHTTPS4:
+		network = "udp4"
+	case serverconfigs.ProtocolHTTPS6:
+		network = "udp6"
+	}
+
+	for i := 0; ; i++ {
+		this.locker.Lock()
+		if this.isClosed {
+			this.locker.Unlock()
+			return nil, nil, nil
+		}
+
+		packetConn, err := net.ListenPacket(network, this.Group.Addr())
+		if err == nil {
+			this.packetConn = packetConn
+			this.server = &http3.Server{
+				Handler:   this.HTTPListener,
+				TLSConfig: this.buildTLSConfig(),
+				QUICConfig: &quic.Config{
+					MaxIdleTimeout: HTTPIdleTimeout,
+				},
+				ConnContext: this.connContext,
+			}
+			var server = this.server
+			this.locker.Unlock()
+			return packetConn, server, nil
+		}
+		this.locker.Unlock()
+
+		if i >= http3ListenRetries {
+			return nil, nil, errors.New("listen http3 '" + this.Group.Addr() + "' failed: " + err.Error())
+		}
+		if i == 0 {
+			remotelogs.Warn("HTTP3_LISTENER", "listen '"+this.Group.Addr()+"' failed: "+err.Error()+", retrying ...")
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// 对接受的QUIC连接执行和TCP连接同样的检查
+type http3EarlyListener struct {
+	*quic.EarlyListener
+
+	listener *HTTP3Listener
+}
+
+func (this *http3EarlyListener) Accept(ctx context.Context) (*quic.Conn, error) {
+	for {
+		conn, err := this.EarlyListener.Accept(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if this.listener.acceptConn(conn) {
+			return conn, nil
+		}
+	}
+}
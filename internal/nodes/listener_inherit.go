@@ -0,0 +1,108 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	envInheritedListeners = "EdgeInheritedListeners" // 从父进程继承的监听器
+	envUpgradeReadyFd     = "EdgeUpgradeReadyFd"     // 新进程启动完成后通知父进程的文件描述符
+)
+
+// 平滑重启时传递给新进程的监听器信息
+type inheritedListenerInfo struct {
+	Addr string `json:"addr"` // 完整的监听地址
+	Fd   int    `json:"fd"`   // 文件描述符
+}
+
+var inheritedListenerMap = map[string][]net.Listener{} // addr => []net.Listener，开启SO_REUSEPORT时同一个地址有多个监听器
+var inheritedListenerLocker = sync.Mutex{}
+
+// 读取从父进程继承的监听器
+func loadInheritedListeners() error {
+	var data = os.Getenv(envInheritedListeners)
+	if len(data) == 0 {
+		return nil
+	}
+	_ = os.Unsetenv(envInheritedListeners)
+
+	var infoList = []*inheritedListenerInfo{}
+	err := json.Unmarshal([]byte(data), &infoList)
+	if err != nil {
+		return errors.New("decode inherited listeners failed: " + err.Error())
+	}
+
+	inheritedListenerLocker.Lock()
+	defer inheritedListenerLocker.Unlock()
+
+	for _, info := range infoList {
+		var file = os.NewFile(uintptr(info.Fd), info.Addr)
+		if file == nil {
+			continue
+		}
+		listener, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			remotelogs.Error("LISTENER", "inherit listener '"+info.Addr+"' failed: "+err.Error())
+			continue
+		}
+		inheritedListenerMap[info.Addr] = append(inheritedListenerMap[info.Addr], listener)
+	}
+
+	return nil
+}
+
+// 取出从父进程继承的某个地址的所有监听器
+func takeInheritedListeners(addr string) []net.Listener {
+	inheritedListenerLocker.Lock()
+	defer inheritedListenerLocker.Unlock()
+
+	listeners, ok := inheritedListenerMap[addr]
+	if ok {
+		delete(inheritedListenerMap, addr)
+		return listeners
+	}
+	return nil
+}
+
+// 关闭没有使用的继承的监听器
+func closeInheritedListeners() {
+	inheritedListenerLocker.Lock()
+	defer inheritedListenerLocker.Unlock()
+
+	for addr, listeners := range inheritedListenerMap {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+		delete(inheritedListenerMap, addr)
+	}
+}
+
+// 通知父进程新进程已经启动完成
+func notifyUpgradeReady() {
+	var fdString = os.Getenv(envUpgradeReadyFd)
+	if len(fdString) == 0 {
+		return
+	}
+	_ = os.Unsetenv(envUpgradeReadyFd)
+
+	fd, err := strconv.Atoi(fdString)
+	if err != nil {
+		return
+	}
+
+	var file = os.NewFile(uintptr(fd), "upgrade-ready")
+	if file == nil {
+		return
+	}
+	_, _ = file.Write([]byte(strconv.Itoa(os.Getpid()) + "\n"))
+	_ = file.Close()
+}
@@ -0,0 +1,115 @@
+//go:build !windows
+// +build !windows
+
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/iwind/TeaGo/assert"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestLoadInheritedListeners(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := syscall.Dup(int(file.Fd()))
+	_ = file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infoJSON, err := json.Marshal([]*inheritedListenerInfo{
+		{
+			Addr: "http://127.0.0.1:1234",
+			Fd:   fd,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Setenv(envInheritedListeners, string(infoJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = loadInheritedListeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(os.Getenv(envInheritedListeners)) == 0)
+
+	a.IsTrue(len(takeInheritedListeners("http://127.0.0.1:80")) == 0)
+
+	var inheritedListeners = takeInheritedListeners("http://127.0.0.1:1234")
+	if len(inheritedListeners) != 1 {
+		t.Fatal("listener should be inherited")
+	}
+	var inheritedListener = inheritedListeners[0]
+	defer func() {
+		_ = inheritedListener.Close()
+	}()
+	a.IsTrue(inheritedListener.Addr().String() == listener.Addr().String())
+	a.IsTrue(len(takeInheritedListeners("http://127.0.0.1:1234")) == 0)
+
+	// 继承的监听器可以接受连接
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err == nil {
+			_ = conn.Close()
+		}
+	}()
+	_ = listener.Close()
+	conn, err := inheritedListener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+}
+
+func TestNotifyUpgradeReady(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	fd, err := syscall.Dup(int(writer.Fd()))
+	_ = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Setenv(envUpgradeReadyFd, strconv.Itoa(fd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifyUpgradeReady()
+
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(line == strconv.Itoa(os.Getpid())+"\n")
+}
@@ -167,10 +167,27 @@ func (this *ListenerManager) TotalActiveConnections() int {
 	total := 0
 	for _, listener := range this.listenersMap {
 		total += listener.listener.CountActiveConnections()
+		if listener.http3Listener != nil {
+			total += listener.http3Listener.CountActiveConnections()
+		}
 	}
 	return total
 }
 
+// FindStreamListeners 查找所有TCP和Unix监听器
+func (this *ListenerManager) FindStreamListeners() []*Listener {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	var result = []*Listener{}
+	for _, listener := range this.listenersMap {
+		if len(listener.rawListeners) > 0 {
+			result = append(result, listener)
+		}
+	}
+	return result
+}
+
 // 返回更加友好格式的地址
 func (this *ListenerManager) prettyAddress(addr string) string {
 	u, err := url.Parse(addr)
@@ -241,6 +258,11 @@ func (this *ListenerManager) addToFirewalld(groupAddrs []string) {
 	var udpPorts = []int{}
 	var tcpPorts = []int{}
 	for _, addr := range groupAddrs {
+		// Unix套接字不需要开放端口
+		if strings.HasPrefix(addr, serverconfigs.ProtocolUnix.String()+":") {
+			continue
+		}
+
 		var protocol = "tcp"
 		if strings.HasPrefix(addr, "udp") {
 			protocol = "udp"
@@ -254,6 +276,13 @@ func (this *ListenerManager) addToFirewalld(groupAddrs []string) {
 			switch protocol {
 			case "tcp":
 				tcpPorts = append(tcpPorts, types.Int(portString))
+
+				// HTTP/3使用同一个UDP端口
+				var http3Options = sharedListenerConfig.FindAddressOptions(addr).HTTP3
+				if strings.HasPrefix(addr, "https") && http3Options != nil && http3Options.IsOn {
+					portStrings = append(portStrings, portString+"/udp")
+					udpPorts = append(udpPorts, types.Int(portString))
+				}
 			case "udp":
 				udpPorts = append(udpPorts, types.Int(portString))
 			}
@@ -0,0 +1,80 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build linux
+// +build linux
+
+package nodes
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"golang.org/x/sys/unix"
+	"net"
+	"syscall"
+)
+
+// 是否支持SO_REUSEPORT
+const canReusePort = true
+
+// 创建监听套接字之后、绑定地址之前设置套接字选项
+func listenerSocketControl(options *configs.ListenerSocketConfig) func(network string, address string, c syscall.RawConn) error {
+	if options == nil {
+		return nil
+	}
+
+	return func(network string, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if options.ReusePort {
+				sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+				if sockErr != nil {
+					sockErr = errors.New("set SO_REUSEPORT failed: " + sockErr.Error())
+					return
+				}
+			}
+			if options.FastOpen > 0 {
+				sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN, options.FastOpen)
+				if sockErr != nil {
+					sockErr = errors.New("set TCP_FASTOPEN failed: " + sockErr.Error())
+					return
+				}
+			}
+			if options.DeferAcceptSeconds > 0 {
+				sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_DEFER_ACCEPT, options.DeferAcceptSeconds)
+				if sockErr != nil {
+					sockErr = errors.New("set TCP_DEFER_ACCEPT failed: " + sockErr.Error())
+					return
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+// 修改监听套接字的等待队列长度
+// Linux中可以对已经监听的套接字再次调用listen()来修改队列长度
+func setListenerBacklog(listener net.Listener, backlog int) error {
+	if backlog <= 0 {
+		return nil
+	}
+
+	syscallListener, ok := listener.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rawConn, err := syscallListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var listenErr error
+	err = rawConn.Control(func(fd uintptr) {
+		listenErr = unix.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return listenErr
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build linux
+// +build linux
+
+package nodes
+
+import (
+	"context"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"net"
+	"testing"
+)
+
+func TestListenerSocketControl_ReusePort(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var options = &configs.ListenerSocketConfig{
+		ReusePort:          true,
+		FastOpen:           16,
+		DeferAcceptSeconds: 1,
+		Backlog:            256,
+	}
+	err := options.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var listenConfig = net.ListenConfig{
+		Control: listenerSocketControl(options),
+	}
+	listener1, err := listenConfig.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener1.Close()
+	}()
+
+	// 同一个地址上可以再次监听
+	listener2, err := listenConfig.Listen(context.Background(), "tcp", listener1.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener2.Close()
+	}()
+	a.IsTrue(listener1.Addr().String() == listener2.Addr().String())
+
+	a.IsNil(setListenerBacklog(listener1, options.Backlog))
+}
+
+func TestListenerSocketControl_NoReusePort(t *testing.T) {
+	var listenConfig = net.ListenConfig{
+		Control: listenerSocketControl(&configs.ListenerSocketConfig{}),
+	}
+	listener1, err := listenConfig.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener1.Close()
+	}()
+
+	listener2, err := listenConfig.Listen(context.Background(), "tcp", listener1.Addr().String())
+	if err == nil {
+		_ = listener2.Close()
+		t.Fatal("listen on same address should fail without SO_REUSEPORT")
+	}
+}
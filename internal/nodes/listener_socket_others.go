@@ -0,0 +1,26 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+//go:build !linux
+// +build !linux
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"net"
+	"syscall"
+)
+
+// 是否支持SO_REUSEPORT，非Linux系统暂不支持
+const canReusePort = false
+
+// 创建监听套接字之后、绑定地址之前设置套接字选项
+// 非Linux系统暂不支持
+func listenerSocketControl(options *configs.ListenerSocketConfig) func(network string, address string, c syscall.RawConn) error {
+	return nil
+}
+
+// 修改监听套接字的等待队列长度
+// 非Linux系统暂不支持
+func setListenerBacklog(listener net.Listener, backlog int) error {
+	return nil
+}
@@ -19,17 +19,12 @@ import (
 type TCPListener struct {
 	BaseListener
 
-	Listener net.Listener
+	Listeners []net.Listener // 开启SO_REUSEPORT时有多个
 
 	port int
 }
 
 func (this *TCPListener) Serve() error {
-	var listener = this.Listener
-	if this.Group.IsTLS() {
-		listener = tls.NewListener(listener, this.buildTLSConfig())
-	}
-
 	// 获取分组端口
 	var groupAddr = this.Group.Addr()
 	var portIndex = strings.LastIndex(groupAddr, ":")
@@ -38,24 +33,36 @@ func (this *TCPListener) Serve() error {
 		this.port = types.Int(port)
 	}
 
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			break
-		}
+	var isTLS = this.Group.IsTLS()
+	var tlsConfig *tls.Config
+	if isTLS {
+		tlsConfig = this.buildTLSConfig()
+	}
 
-		atomic.AddInt64(&this.countActiveConnections, 1)
+	return serveListeners(this.Listeners, func(listener net.Listener) error {
+		if isTLS {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
 
-		go func(conn net.Conn) {
-			err = this.handleConn(conn)
+		for {
+			conn, err := listener.Accept()
 			if err != nil {
-				remotelogs.Error("TCP_LISTENER", err.Error())
+				break
 			}
-			atomic.AddInt64(&this.countActiveConnections, -1)
-		}(conn)
-	}
 
-	return nil
+			atomic.AddInt64(&this.countActiveConnections, 1)
+
+			go func(conn net.Conn) {
+				err := this.handleConn(conn)
+				if err != nil {
+					remotelogs.Error("TCP_LISTENER", err.Error())
+				}
+				atomic.AddInt64(&this.countActiveConnections, -1)
+			}(conn)
+		}
+
+		return nil
+	})
 }
 
 func (this *TCPListener) Reload(group *serverconfigs.ServerAddressGroup) {
@@ -217,7 +224,7 @@ func (this *TCPListener) handleConn(conn net.Conn) error {
 }
 
 func (this *TCPListener) Close() error {
-	return this.Listener.Close()
+	return closeListeners(this.Listeners)
 }
 
 // 连接源站
@@ -253,6 +260,9 @@ func (this *TCPListener) connectOrigin(serverId int64, requestHost string, rever
 			requestHost = reverseProxy.RequestHost
 		}
 
+		// 主动健康检查
+		SharedOriginStateManager.Watch(serverId, origin, requestHost, reverseProxy)
+
 		conn, addr, err = OriginConnect(origin, this.port, remoteAddr, requestHost)
 		if err != nil {
 			failedOriginIds = append(failedOriginIds, origin.Id)
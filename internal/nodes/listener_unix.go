@@ -2,27 +2,109 @@ package nodes
 
 import (
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/iwind/TeaGo/types"
 	"net"
+	"sync"
+	"sync/atomic"
 )
 
+// UnixListener Unix套接字监听
+// 使用HTTP协议提供服务，通常用于本机上的代理程序转发请求
 type UnixListener struct {
 	BaseListener
 
-	Listener net.Listener
+	Listeners []net.Listener
+
+	httpListener *HTTPListener
+	locker       sync.Mutex
 }
 
 func (this *UnixListener) Serve() error {
-	// TODO
-	// TODO 注意管理 CountActiveConnections
-	return nil
+	this.locker.Lock()
+	var httpListener = &HTTPListener{
+		BaseListener: BaseListener{Group: this.Group},
+		Listeners:    this.Listeners,
+		isUnix:       true,
+	}
+	httpListener.Init()
+	this.httpListener = httpListener
+	this.locker.Unlock()
+
+	return httpListener.Serve()
 }
 
 func (this *UnixListener) Close() error {
-	// TODO
-	return nil
+	this.locker.Lock()
+	var httpListener = this.httpListener
+	this.locker.Unlock()
+
+	if httpListener != nil {
+		return httpListener.Close()
+	}
+	return closeListeners(this.Listeners)
+}
+
+// DisableKeepAlives 不再保持连接，并关闭空闲连接
+func (this *UnixListener) DisableKeepAlives() {
+	this.locker.Lock()
+	var httpListener = this.httpListener
+	this.locker.Unlock()
+
+	if httpListener != nil {
+		httpListener.DisableKeepAlives()
+	}
 }
 
 func (this *UnixListener) Reload(group *serverconfigs.ServerAddressGroup) {
 	this.Group = group
 	this.Reset()
+
+	this.locker.Lock()
+	if this.httpListener != nil {
+		this.httpListener.Reload(group)
+	}
+	this.locker.Unlock()
+}
+
+// CountActiveConnections 获取当前活跃连接数
+func (this *UnixListener) CountActiveConnections() int {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	if this.httpListener != nil {
+		return this.httpListener.CountActiveConnections()
+	}
+	return 0
+}
+
+// Unix套接字网络监听
+// 客户端连接的地址都为空，这里为每个连接分配一个唯一的地址，以便于统计和限制连接数
+type unixNetListener struct {
+	*net.UnixListener
+
+	connId uint64
+}
+
+func (this *unixNetListener) Accept() (net.Conn, error) {
+	conn, err := this.UnixListener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &unixConn{
+		Conn: conn,
+		remoteAddr: &net.UnixAddr{
+			Name: "@" + types.String(atomic.AddUint64(&this.connId, 1)),
+			Net:  "unix",
+		},
+	}, nil
+}
+
+type unixConn struct {
+	net.Conn
+
+	remoteAddr net.Addr
+}
+
+func (this *unixConn) RemoteAddr() net.Addr {
+	return this.remoteAddr
 }
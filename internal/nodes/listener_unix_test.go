@@ -0,0 +1,43 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/iwind/TeaGo/assert"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListener_createUnixListener(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var sockFile = filepath.Join(t.TempDir(), "edge-node.sock")
+
+	// 残留的套接字文件
+	staleListener, err := net.Listen("unix", sockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleListener.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = staleListener.Close()
+
+	var listener = NewListener()
+	listener.Reload(serverconfigs.NewServerAddressGroup("unix:" + sockFile))
+	a.IsTrue(listener.unixSockFile() == sockFile)
+
+	unixListener, err := listener.createUnixListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 正在使用中
+	_, err = listener.createUnixListener()
+	a.IsTrue(err != nil)
+
+	_ = unixListener.Close()
+	_, err = os.Stat(sockFile)
+	a.IsTrue(os.IsNotExist(err))
+}
@@ -50,6 +50,8 @@ import (
 )
 
 var sharedNodeConfig *nodeconfigs.NodeConfig
+var sharedProxyConfig = configs.NewProxyConfig()
+var sharedListenerConfig = configs.NewListenerConfig()
 var nodeTaskNotify = make(chan bool, 8)
 var nodeConfigChangedNotify = make(chan bool, 8)
 var nodeConfigUpdatedAt int64
@@ -128,6 +130,12 @@ func (this *Node) Start() {
 		return
 	}
 
+	// 平滑重启时从父进程继承的监听器
+	err = loadInheritedListeners()
+	if err != nil {
+		remotelogs.Error("NODE", err.Error())
+	}
+
 	// 启动IP库
 	remotelogs.Println("NODE", "initializing ip library ...")
 	err = iplib.InitDefault()
@@ -230,6 +238,10 @@ func (this *Node) Start() {
 		return
 	}
 
+	// 通知父进程启动完成
+	closeInheritedListeners()
+	notifyUpgradeReady()
+
 	// hold住进程
 	select {}
 }
@@ -796,6 +808,9 @@ func (this *Node) listenSock() error {
 		}
 	}
 
+	// 平滑重启时需要关闭sock
+	sharedGracefulRestarter.SetSock(this.sock)
+
 	// 启动监听
 	goman.New(func() {
 		this.sock.OnCommand(func(cmd *gosock.Command) {
@@ -991,9 +1006,18 @@ func (this *Node) listenSock() error {
 							"error": err.Error(),
 						},
 					})
+				} else if sharedGracefulRestarter.ExecutableChanged() {
+					// 可执行文件已经被替换，平滑重启以便于使用新的版本
+					this.replyGracefulRestart(cmd, DefaultGracefulDrainSeconds)
 				} else {
 					_ = cmd.ReplyOk()
 				}
+			case "gracefulRestart":
+				var drainSeconds = maps.NewMap(cmd.Params).GetInt("drainSeconds")
+				if drainSeconds <= 0 {
+					drainSeconds = DefaultGracefulDrainSeconds
+				}
+				this.replyGracefulRestart(cmd, drainSeconds)
 			case "accesslog":
 				err := sharedHTTPAccessLogViewer.Start()
 				if err != nil {
@@ -1006,6 +1030,52 @@ func (this *Node) listenSock() error {
 				} else {
 					_ = cmd.ReplyOk()
 				}
+			case "cacheExport":
+				var m = maps.NewMap(cmd.Params)
+				var filter = &caches.ExportFilter{}
+				var filterJSON = m.GetString("filterJSON")
+				if len(filterJSON) > 0 {
+					err := json.Unmarshal([]byte(filterJSON), filter)
+					if err != nil {
+						_ = cmd.Reply(&gosock.Command{
+							Params: map[string]interface{}{
+								"error": "decode filter failed: " + err.Error(),
+							},
+						})
+						return
+					}
+				}
+				count, err := this.exportCache(m.GetInt64("policyId"), m.GetString("path"), filter)
+				if err != nil {
+					_ = cmd.Reply(&gosock.Command{
+						Params: map[string]interface{}{
+							"error": err.Error(),
+						},
+					})
+				} else {
+					_ = cmd.Reply(&gosock.Command{
+						Params: map[string]interface{}{
+							"count": count,
+						},
+					})
+				}
+			case "cacheImport":
+				var m = maps.NewMap(cmd.Params)
+				count, err := this.importCache(m.GetInt64("policyId"), m.GetString("path"))
+				if err != nil {
+					_ = cmd.Reply(&gosock.Command{
+						Params: map[string]interface{}{
+							"error": err.Error(),
+							"count": count,
+						},
+					})
+				} else {
+					_ = cmd.Reply(&gosock.Command{
+						Params: map[string]interface{}{
+							"count": count,
+						},
+					})
+				}
 			case "bandwidth":
 				var m = stats.SharedBandwidthStatManager.Map()
 				_ = cmd.Reply(&gosock.Command{Params: maps.Map{
@@ -1028,6 +1098,25 @@ func (this *Node) listenSock() error {
 	return nil
 }
 
+// 平滑重启并回复命令
+func (this *Node) replyGracefulRestart(cmd *gosock.Command, drainSeconds int) {
+	newPid, err := sharedGracefulRestarter.Restart(time.Duration(drainSeconds) * time.Second)
+	if err != nil {
+		_ = cmd.Reply(&gosock.Command{
+			Params: map[string]interface{}{
+				"error": "graceful restart failed: " + err.Error(),
+			},
+		})
+		return
+	}
+	_ = cmd.Reply(&gosock.Command{
+		Params: map[string]interface{}{
+			"pid":       newPid,
+			"restarted": true,
+		},
+	})
+}
+
 // 重载配置调用
 func (this *Node) onReload(config *nodeconfigs.NodeConfig, reloadAll bool) {
 	nodeconfigs.ResetNodeConfig(config)
@@ -1056,7 +1145,8 @@ func (this *Node) onReload(config *nodeconfigs.NodeConfig, reloadAll bool) {
 		caches.SharedManager.MainDiskDir = config.CacheDiskDir
 		caches.SharedManager.SubDiskDirs = subDirs
 
-		if cachePoliciesChanged {
+		// 平滑重启时缓存已经交给新进程
+		if cachePoliciesChanged && !sharedGracefulRestarter.IsRestarting() {
 			// copy
 			this.oldHTTPCachePolicies = []*serverconfigs.HTTPCachePolicy{}
 			err := jsonutils.Copy(&this.oldHTTPCachePolicies, config.HTTPCachePolicies)
@@ -1188,7 +1278,63 @@ func (this *Node) onReload(config *nodeconfigs.NodeConfig, reloadAll bool) {
 
 		// API Node地址，这里不限制是否为空，因为在为空时仍然要有对应的处理
 		this.changeAPINodeAddrs(config.APINodeAddrs)
+
+		// 本地反向代理设置
+		this.reloadProxyConfig()
+
+		// 本地监听设置
+		this.reloadListenerConfig()
+
+		// 本地WAF设置
+		this.reloadWAFConfig()
+	}
+}
+
+// 重新加载本地反向代理设置
+func (this *Node) reloadProxyConfig() {
+	proxyConfig, err := configs.LoadProxyConfig()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			remotelogs.Error("NODE", "load 'configs/proxy.yaml' failed: "+err.Error())
+			return
+		}
+		proxyConfig = configs.NewProxyConfig()
+	}
+
+	var originOptionsChanged = !jsonutils.Equal(sharedProxyConfig.DefaultOrigin, proxyConfig.DefaultOrigin) ||
+		!jsonutils.Equal(sharedProxyConfig.Origins, proxyConfig.Origins)
+	sharedProxyConfig = proxyConfig
+
+	// 源站设置变化后需要重新建立连接
+	if originOptionsChanged {
+		SharedHTTPClientPool.Reset()
+	}
+}
+
+// 重新加载本地监听设置
+func (this *Node) reloadListenerConfig() {
+	listenerConfig, err := configs.LoadListenerConfig()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			remotelogs.Error("NODE", "load 'configs/listener.yaml' failed: "+err.Error())
+			return
+		}
+		listenerConfig = configs.NewListenerConfig()
+	}
+	sharedListenerConfig = listenerConfig
+}
+
+// 重新加载本地WAF设置
+func (this *Node) reloadWAFConfig() {
+	wafConfig, err := configs.LoadWAFConfig()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			remotelogs.Error("NODE", "load 'configs/waf.yaml' failed: "+err.Error())
+			return
+		}
+		wafConfig = configs.NewWAFConfig()
 	}
+	waf.SharedWAFManager.UpdateLocalConfig(wafConfig)
 }
 
 // reload server config
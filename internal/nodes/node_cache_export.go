@@ -0,0 +1,59 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/caches"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/iwind/TeaGo/types"
+	"path/filepath"
+)
+
+// 导出某个缓存策略的缓存
+func (this *Node) exportCache(policyId int64, path string, filter *caches.ExportFilter) (count int, err error) {
+	storage, err := this.findFileCacheStorage(policyId)
+	if err != nil {
+		return 0, err
+	}
+	if len(path) == 0 || !filepath.IsAbs(path) {
+		return 0, errors.New("'path' should be an absolute path")
+	}
+
+	count, err = storage.ExportFile(path, filter)
+	if err != nil {
+		return 0, err
+	}
+	remotelogs.Println("CACHE", "export "+types.String(count)+" items of policy '"+types.String(policyId)+"' to '"+path+"'")
+	return count, nil
+}
+
+// 导入缓存到某个缓存策略
+func (this *Node) importCache(policyId int64, path string) (count int, err error) {
+	storage, err := this.findFileCacheStorage(policyId)
+	if err != nil {
+		return 0, err
+	}
+	if len(path) == 0 || !filepath.IsAbs(path) {
+		return 0, errors.New("'path' should be an absolute path")
+	}
+
+	count, err = storage.ImportFile(path)
+	remotelogs.Println("CACHE", "import "+types.String(count)+" items to policy '"+types.String(policyId)+"' from '"+path+"'")
+	return count, err
+}
+
+func (this *Node) findFileCacheStorage(policyId int64) (*caches.FileStorage, error) {
+	if policyId <= 0 {
+		return nil, errors.New("'policyId' should be greater than 0")
+	}
+	var storage = caches.SharedManager.FindStorageWithPolicy(policyId)
+	if storage == nil {
+		return nil, errors.New("cache policy '" + types.String(policyId) + "' not found")
+	}
+	fileStorage, ok := storage.(*caches.FileStorage)
+	if !ok {
+		return nil, errors.New("cache policy '" + types.String(policyId) + "' is not a file storage")
+	}
+	return fileStorage, nil
+}
@@ -0,0 +1,402 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/shared"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var SharedOriginBalancer = NewOriginBalancer()
+
+// 5xx错误率对源站负载的放大倍数，错误率为100%时负载为原来的 1+originErrorRatePenalty 倍
+const originErrorRatePenalty = 10
+
+// OriginLoadStat 源站负载统计
+type OriginLoadStat struct {
+	InFlight       int64   `json:"inFlight"`       // 正在处理的请求数
+	EWMA           float64 `json:"ewma"`           // 延迟EWMA，单位为毫秒
+	ErrorRate      float64 `json:"errorRate"`      // 5xx错误率EWMA
+	Consecutive5xx int     `json:"consecutive5xx"` // 连续5xx错误数
+	EjectedUntil   int64   `json:"ejectedUntil"`   // 摘除截止时间
+	CountEjections int     `json:"countEjections"` // 摘除次数
+
+	updatedAt time.Time
+	locker    sync.Mutex
+}
+
+// 计算EWMA权重
+func (this *OriginLoadStat) weight(now time.Time, decay time.Duration) float64 {
+	if this.updatedAt.IsZero() {
+		return 0
+	}
+	var elapsed = now.Sub(this.updatedAt)
+	if elapsed <= 0 {
+		return 1
+	}
+	return math.Exp(-float64(elapsed) / float64(decay))
+}
+
+// OriginBalancer 根据真实请求数据进行源站负载均衡和异常摘除
+type OriginBalancer struct {
+	statMap map[int64]*OriginLoadStat // originId => *OriginLoadStat
+	locker  sync.RWMutex
+}
+
+// NewOriginBalancer 获取新对象
+func NewOriginBalancer() *OriginBalancer {
+	return &OriginBalancer{
+		statMap: map[int64]*OriginLoadStat{},
+	}
+}
+
+// NextOrigin 选择下一个源站
+// excludedOriginIds 为本次请求中已经失败的源站
+func (this *OriginBalancer) NextOrigin(serverId int64, reverseProxy *serverconfigs.ReverseProxyConfig, requestCall *shared.RequestCall, excludedOriginIds []int64) *serverconfigs.OriginConfig {
+	var options = sharedProxyConfig.FindServerOptions(serverId)
+	var now = time.Now()
+
+	if options.LoadBalance != nil && options.LoadBalance.Mode != configs.LoadBalanceModeDefault {
+		var origin = this.pick(options.LoadBalance, reverseProxy, requestCall, excludedOriginIds, now)
+		if origin != nil {
+			return origin
+		}
+	}
+
+	var origin *serverconfigs.OriginConfig
+	if len(excludedOriginIds) > 0 {
+		origin = reverseProxy.AnyOrigin(requestCall, excludedOriginIds)
+	}
+	if origin == nil {
+		origin = reverseProxy.NextOrigin(requestCall)
+	}
+	if origin == nil || !this.isEjected(origin.Id, now.Unix()) {
+		return origin
+	}
+
+	// 跳过已摘除的源站，如果没有其他可用源站，仍然使用当前源站
+	var ejectedOriginIds = append(this.ejectedOriginIds(now.Unix()), excludedOriginIds...)
+	var anotherOrigin = reverseProxy.AnyOrigin(requestCall, ejectedOriginIds)
+	if anotherOrigin != nil {
+		return anotherOrigin
+	}
+	return origin
+}
+
+// Begin 开始请求源站
+func (this *OriginBalancer) Begin(origin *serverconfigs.OriginConfig) {
+	var stat = this.findStat(origin, true)
+	if stat == nil {
+		return
+	}
+	stat.locker.Lock()
+	stat.InFlight++
+	stat.locker.Unlock()
+}
+
+// End 结束请求源站
+// cost 为0时表示不计算延迟，statusCode 为0时表示连接源站失败
+func (this *OriginBalancer) End(serverId int64, reverseProxy *serverconfigs.ReverseProxyConfig, origin *serverconfigs.OriginConfig, cost time.Duration, statusCode int) {
+	var stat = this.findStat(origin, false)
+	if stat == nil {
+		return
+	}
+
+	var options = sharedProxyConfig.FindServerOptions(serverId)
+	var decay = 10 * time.Second
+	if options.LoadBalance != nil {
+		decay = options.LoadBalance.Decay()
+	}
+
+	var now = time.Now()
+	var is5xx = statusCode == 0 || statusCode >= 500
+
+	stat.locker.Lock()
+	if stat.InFlight > 0 {
+		stat.InFlight--
+	}
+
+	var w = stat.weight(now, decay)
+	if cost > 0 {
+		var costMs = float64(cost) / float64(time.Millisecond)
+		if costMs > stat.EWMA {
+			// 峰值：遇到更高的延迟时立即使用
+			stat.EWMA = costMs
+		} else {
+			stat.EWMA = stat.EWMA*w + costMs*(1-w)
+		}
+	}
+	if is5xx {
+		stat.ErrorRate = stat.ErrorRate*w + (1 - w)
+		stat.Consecutive5xx++
+	} else {
+		stat.ErrorRate = stat.ErrorRate * w
+		stat.Consecutive5xx = 0
+	}
+	stat.updatedAt = now
+
+	var shouldEject = false
+	var outlierDetection = options.OutlierDetection
+	if is5xx && outlierDetection != nil && outlierDetection.IsOn && stat.Consecutive5xx >= outlierDetection.Consecutive5xx && stat.EjectedUntil < now.Unix() {
+		shouldEject = true
+	}
+	stat.locker.Unlock()
+
+	if shouldEject {
+		this.eject(serverId, reverseProxy, origin, stat, outlierDetection, now.Unix())
+	}
+}
+
+// Cancel 取消请求源站，比如客户端主动关闭连接时
+func (this *OriginBalancer) Cancel(origin *serverconfigs.OriginConfig) {
+	var stat = this.findStat(origin, false)
+	if stat == nil {
+		return
+	}
+	stat.locker.Lock()
+	if stat.InFlight > 0 {
+		stat.InFlight--
+	}
+	stat.locker.Unlock()
+}
+
+// Stat 查找源站统计信息
+func (this *OriginBalancer) Stat(originId int64) (stat OriginLoadStat, ok bool) {
+	this.locker.RLock()
+	originStat, ok := this.statMap[originId]
+	this.locker.RUnlock()
+	if !ok {
+		return
+	}
+
+	originStat.locker.Lock()
+	stat = OriginLoadStat{
+		InFlight:       originStat.InFlight,
+		EWMA:           originStat.EWMA,
+		ErrorRate:      originStat.ErrorRate,
+		Consecutive5xx: originStat.Consecutive5xx,
+		EjectedUntil:   originStat.EjectedUntil,
+		CountEjections: originStat.CountEjections,
+	}
+	originStat.locker.Unlock()
+	return
+}
+
+// Clean 清除不再使用的源站统计信息
+func (this *OriginBalancer) Clean() {
+	var nodeConfig = sharedNodeConfig
+	if nodeConfig == nil {
+		return
+	}
+
+	this.locker.Lock()
+	for originId := range this.statMap {
+		var originConfig = nodeConfig.FindOrigin(originId)
+		if originConfig == nil || !originConfig.IsOn {
+			delete(this.statMap, originId)
+		}
+	}
+	this.locker.Unlock()
+}
+
+// 使用二选一（Power of Two Choices）算法选择源站
+func (this *OriginBalancer) pick(config *configs.LoadBalanceConfig, reverseProxy *serverconfigs.ReverseProxyConfig, requestCall *shared.RequestCall, excludedOriginIds []int64, now time.Time) *serverconfigs.OriginConfig {
+	var candidates = this.candidates(reverseProxy.PrimaryOrigins, requestCall, excludedOriginIds, now.Unix())
+	if len(candidates) == 0 {
+		candidates = this.candidates(reverseProxy.BackupOrigins, requestCall, excludedOriginIds, now.Unix())
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil
+	case 1:
+		return candidates[0]
+	}
+
+	var index1 = rand.Intn(len(candidates))
+	var index2 = rand.Intn(len(candidates) - 1)
+	if index2 >= index1 {
+		index2++
+	}
+	var origin1 = candidates[index1]
+	var origin2 = candidates[index2]
+
+	if this.cost(config, origin2, now) < this.cost(config, origin1, now) {
+		return origin2
+	}
+	return origin1
+}
+
+// 筛选可用的源站
+func (this *OriginBalancer) candidates(origins []*serverconfigs.OriginConfig, requestCall *shared.RequestCall, excludedOriginIds []int64, nowUnix int64) []*serverconfigs.OriginConfig {
+	var result = []*serverconfigs.OriginConfig{}
+	var domain = ""
+	if requestCall != nil {
+		domain = requestCall.Domain
+	}
+	for _, origin := range origins {
+		if !origin.IsOn || !origin.IsOk || origin.Addr == nil {
+			continue
+		}
+		if len(origin.Domains) > 0 && !configutils.MatchDomains(origin.Domains, domain) {
+			continue
+		}
+		if this.containsOriginId(excludedOriginIds, origin.Id) || this.isEjected(origin.Id, nowUnix) {
+			continue
+		}
+		result = append(result, origin)
+	}
+	return result
+}
+
+// 计算源站负载
+func (this *OriginBalancer) cost(config *configs.LoadBalanceConfig, origin *serverconfigs.OriginConfig, now time.Time) float64 {
+	var weight = float64(origin.Weight)
+	if weight <= 0 {
+		weight = 1
+	}
+
+	var stat = this.findStat(origin, false)
+	if stat == nil {
+		return 1 / weight
+	}
+
+	stat.locker.Lock()
+	var inFlight = float64(stat.InFlight)
+	var w = stat.weight(now, config.Decay())
+	var latency = stat.EWMA * w // 长时间没有请求时逐渐衰减，以便于重新尝试
+	var errorRate = stat.ErrorRate * w
+	stat.locker.Unlock()
+
+	// 5xx错误率越高，负载越高，以便于把请求更多地分配给健康的源站
+	var errorFactor = 1 + errorRate*originErrorRatePenalty
+
+	switch config.Mode {
+	case configs.LoadBalanceModePeakEWMA:
+		if latency <= 0 {
+			return 0 // 尚无延迟数据时优先尝试
+		}
+		return latency * (inFlight + 1) * errorFactor / weight
+	default:
+		return (inFlight + 1) * errorFactor / weight
+	}
+}
+
+// 摘除源站
+func (this *OriginBalancer) eject(serverId int64, reverseProxy *serverconfigs.ReverseProxyConfig, origin *serverconfigs.OriginConfig, stat *OriginLoadStat, config *configs.OutlierDetectionConfig, nowUnix int64) {
+	// 检查最大摘除比例
+	var countOrigins = 0
+	var countEjected = 0
+	if reverseProxy != nil {
+		for _, origins := range [][]*serverconfigs.OriginConfig{reverseProxy.PrimaryOrigins, reverseProxy.BackupOrigins} {
+			for _, otherOrigin := range origins {
+				if !otherOrigin.IsOn {
+					continue
+				}
+				countOrigins++
+				if otherOrigin.Id != origin.Id && this.isEjected(otherOrigin.Id, nowUnix) {
+					countEjected++
+				}
+			}
+		}
+	}
+	if countEjected >= config.MaxEjections(countOrigins) {
+		return
+	}
+
+	stat.locker.Lock()
+	if stat.EjectedUntil >= nowUnix {
+		stat.locker.Unlock()
+		return
+	}
+	stat.EjectedUntil = nowUnix + int64(config.EjectionSeconds)
+	stat.CountEjections++
+	var consecutive5xx = stat.Consecutive5xx
+	stat.Consecutive5xx = 0
+	stat.locker.Unlock()
+
+	var addr = ""
+	if origin.Addr != nil {
+		addr = origin.Addr.Host + ":" + origin.Addr.PortRange
+	}
+	remotelogs.ServerLog(serverId, "ORIGIN_BALANCER", "origin '"+addr+"' is ejected for "+types.String(config.EjectionSeconds)+" seconds after "+types.String(consecutive5xx)+" consecutive 5xx errors", "", maps.Map{
+		"originId":        origin.Id,
+		"addr":            addr,
+		"ejectionSeconds": config.EjectionSeconds,
+	})
+}
+
+// 查找统计信息
+func (this *OriginBalancer) findStat(origin *serverconfigs.OriginConfig, autoCreate bool) *OriginLoadStat {
+	if origin == nil || origin.Id <= 0 {
+		return nil
+	}
+
+	this.locker.RLock()
+	stat, ok := this.statMap[origin.Id]
+	this.locker.RUnlock()
+	if ok || !autoCreate {
+		return stat
+	}
+
+	this.locker.Lock()
+	stat, ok = this.statMap[origin.Id]
+	if !ok {
+		stat = &OriginLoadStat{}
+		this.statMap[origin.Id] = stat
+	}
+	this.locker.Unlock()
+	return stat
+}
+
+// 判断源站是否已被摘除
+func (this *OriginBalancer) isEjected(originId int64, nowUnix int64) bool {
+	if originId <= 0 {
+		return false
+	}
+
+	this.locker.RLock()
+	stat, ok := this.statMap[originId]
+	this.locker.RUnlock()
+	if !ok {
+		return false
+	}
+
+	stat.locker.Lock()
+	var ejected = stat.EjectedUntil >= nowUnix
+	stat.locker.Unlock()
+	return ejected
+}
+
+// 所有已摘除的源站
+func (this *OriginBalancer) ejectedOriginIds(nowUnix int64) []int64 {
+	var result = []int64{}
+	this.locker.RLock()
+	for originId, stat := range this.statMap {
+		stat.locker.Lock()
+		if stat.EjectedUntil >= nowUnix {
+			result = append(result, originId)
+		}
+		stat.locker.Unlock()
+	}
+	this.locker.RUnlock()
+	return result
+}
+
+func (this *OriginBalancer) containsOriginId(originIds []int64, originId int64) bool {
+	for _, id := range originIds {
+		if id == originId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"testing"
+	"time"
+)
+
+func testOriginBalancerProxy(t *testing.T, mode configs.LoadBalanceMode) *serverconfigs.ReverseProxyConfig {
+	var proxyConfig = configs.NewProxyConfig()
+	proxyConfig.DefaultServer = &configs.ServerProxyOptions{
+		LoadBalance: &configs.LoadBalanceConfig{
+			Mode: mode,
+		},
+		OutlierDetection: &configs.OutlierDetectionConfig{
+			IsOn:               true,
+			Consecutive5xx:     3,
+			EjectionSeconds:    30,
+			MaxEjectionPercent: 50,
+		},
+	}
+	err := proxyConfig.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedProxyConfig = proxyConfig
+
+	var reverseProxy = &serverconfigs.ReverseProxyConfig{
+		IsOn: true,
+		PrimaryOrigins: []*serverconfigs.OriginConfig{
+			{Id: 1, IsOn: true, Addr: &serverconfigs.NetworkAddressConfig{Protocol: serverconfigs.ProtocolHTTP, Host: "127.0.0.1", PortRange: "1234"}},
+			{Id: 2, IsOn: true, Addr: &serverconfigs.NetworkAddressConfig{Protocol: serverconfigs.ProtocolHTTP, Host: "127.0.0.1", PortRange: "1235"}},
+		},
+	}
+	for _, origin := range reverseProxy.PrimaryOrigins {
+		err = origin.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		origin.IsOk = true
+	}
+	return reverseProxy
+}
+
+func TestOriginBalancer_LeastRequest(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var reverseProxy = testOriginBalancerProxy(t, configs.LoadBalanceModeLeastRequest)
+	defer func() {
+		sharedProxyConfig = configs.NewProxyConfig()
+	}()
+
+	var balancer = NewOriginBalancer()
+	var origin1 = reverseProxy.PrimaryOrigins[0]
+	balancer.Begin(origin1)
+	balancer.Begin(origin1)
+
+	for i := 0; i < 10; i++ {
+		var origin = balancer.NextOrigin(1, reverseProxy, nil, nil)
+		a.IsTrue(origin != nil && origin.Id == 2)
+	}
+
+	balancer.End(1, reverseProxy, origin1, 10*time.Millisecond, 200)
+	balancer.End(1, reverseProxy, origin1, 10*time.Millisecond, 200)
+	stat, ok := balancer.Stat(origin1.Id)
+	a.IsTrue(ok)
+	a.IsTrue(stat.InFlight == 0)
+	a.IsTrue(stat.EWMA > 0)
+}
+
+func TestOriginBalancer_PeakEWMA(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var reverseProxy = testOriginBalancerProxy(t, configs.LoadBalanceModePeakEWMA)
+	defer func() {
+		sharedProxyConfig = configs.NewProxyConfig()
+	}()
+
+	var balancer = NewOriginBalancer()
+	var origin1 = reverseProxy.PrimaryOrigins[0]
+	var origin2 = reverseProxy.PrimaryOrigins[1]
+
+	balancer.Begin(origin1)
+	balancer.End(1, reverseProxy, origin1, 500*time.Millisecond, 200)
+	balancer.Begin(origin2)
+	balancer.End(1, reverseProxy, origin2, 10*time.Millisecond, 200)
+
+	for i := 0; i < 10; i++ {
+		var origin = balancer.NextOrigin(1, reverseProxy, nil, nil)
+		a.IsTrue(origin != nil && origin.Id == origin2.Id)
+	}
+}
+
+func TestOriginBalancer_ErrorRate(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var reverseProxy = testOriginBalancerProxy(t, configs.LoadBalanceModeLeastRequest)
+	defer func() {
+		sharedProxyConfig = configs.NewProxyConfig()
+	}()
+
+	var balancer = NewOriginBalancer()
+	var origin1 = reverseProxy.PrimaryOrigins[0]
+	var origin2 = reverseProxy.PrimaryOrigins[1]
+
+	balancer.Begin(origin1)
+	balancer.End(1, reverseProxy, origin1, 10*time.Millisecond, 503)
+	balancer.Begin(origin2)
+	balancer.End(1, reverseProxy, origin2, 10*time.Millisecond, 200)
+	a.IsFalse(balancer.isEjected(origin1.Id, time.Now().Unix()))
+
+	stat, ok := balancer.Stat(origin1.Id)
+	a.IsTrue(ok)
+	a.IsTrue(stat.ErrorRate > 0)
+
+	for i := 0; i < 10; i++ {
+		var origin = balancer.NextOrigin(1, reverseProxy, nil, nil)
+		a.IsTrue(origin != nil && origin.Id == origin2.Id)
+	}
+}
+
+func TestOriginBalancer_Eject(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var reverseProxy = testOriginBalancerProxy(t, configs.LoadBalanceModeLeastRequest)
+	defer func() {
+		sharedProxyConfig = configs.NewProxyConfig()
+	}()
+
+	var balancer = NewOriginBalancer()
+	var origin1 = reverseProxy.PrimaryOrigins[0]
+	var origin2 = reverseProxy.PrimaryOrigins[1]
+	for i := 0; i < 3; i++ {
+		balancer.Begin(origin1)
+		balancer.End(1, reverseProxy, origin1, 0, 502)
+	}
+	a.IsTrue(balancer.isEjected(origin1.Id, time.Now().Unix()))
+
+	for i := 0; i < 10; i++ {
+		var origin = balancer.NextOrigin(1, reverseProxy, nil, nil)
+		a.IsTrue(origin != nil && origin.Id == origin2.Id)
+	}
+
+	// 超过最大摘除比例
+	for i := 0; i < 3; i++ {
+		balancer.Begin(origin2)
+		balancer.End(1, reverseProxy, origin2, 0, 0)
+	}
+	a.IsFalse(balancer.isEjected(origin2.Id, time.Now().Unix()))
+}
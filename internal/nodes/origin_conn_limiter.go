@@ -0,0 +1,76 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/zero"
+	"net"
+	"sync"
+	"time"
+)
+
+// 限制到某个源站的连接数
+type originConnLimiter struct {
+	c chan zero.Zero
+}
+
+func newOriginConnLimiter(maxConns int) *originConnLimiter {
+	if maxConns <= 0 {
+		maxConns = 1
+	}
+	return &originConnLimiter{
+		c: make(chan zero.Zero, maxConns),
+	}
+}
+
+// Acquire 获取一个连接名额，在超时时间内无法获取时返回false
+func (this *originConnLimiter) Acquire(timeout time.Duration) bool {
+	select {
+	case this.c <- zero.New():
+		return true
+	default:
+	}
+
+	var timer = time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case this.c <- zero.New():
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Release 释放一个连接名额
+func (this *originConnLimiter) Release() {
+	select {
+	case <-this.c:
+	default:
+	}
+}
+
+// Count 当前连接数
+func (this *originConnLimiter) Count() int {
+	return len(this.c)
+}
+
+// Wrap 包装连接，在连接关闭时释放名额
+func (this *originConnLimiter) Wrap(conn net.Conn) net.Conn {
+	return &originLimitedConn{
+		Conn:    conn,
+		limiter: this,
+	}
+}
+
+type originLimitedConn struct {
+	net.Conn
+
+	limiter *originConnLimiter
+	once    sync.Once
+}
+
+func (this *originLimitedConn) Close() error {
+	var err = this.Conn.Close()
+	this.once.Do(this.limiter.Release)
+	return err
+}
@@ -0,0 +1,33 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestOriginConnLimiter(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var limiter = newOriginConnLimiter(2)
+	a.IsTrue(limiter.Acquire(10 * time.Millisecond))
+	a.IsTrue(limiter.Acquire(10 * time.Millisecond))
+	a.IsFalse(limiter.Acquire(10 * time.Millisecond))
+	a.IsTrue(limiter.Count() == 2)
+
+	// 关闭连接后释放名额，多次关闭只释放一次
+	conn1, conn2 := net.Pipe()
+	defer func() {
+		_ = conn2.Close()
+	}()
+	var conn = limiter.Wrap(conn1)
+	_ = conn.Close()
+	_ = conn.Close()
+	a.IsTrue(limiter.Count() == 1)
+
+	a.IsTrue(limiter.Acquire(10 * time.Millisecond))
+	a.IsFalse(limiter.Acquire(10 * time.Millisecond))
+}
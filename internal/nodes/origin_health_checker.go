@@ -0,0 +1,241 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"context"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/configutils"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
+	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	maxOriginHealthCheckBodySize = 64 << 10 // 健康检查时最多读取的响应内容尺寸
+)
+
+// OriginHealthChecker 源站主动健康检查
+type OriginHealthChecker struct {
+	serverId     int64
+	origin       *serverconfigs.OriginConfig
+	tlsHost      string
+	reverseProxy *serverconfigs.ReverseProxyConfig
+	config       *configs.OriginHealthCheckConfig
+
+	client *http.Client
+
+	countSuccess int
+	countFails   int
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewOriginHealthChecker 获取新对象
+func NewOriginHealthChecker(serverId int64,
+	origin *serverconfigs.OriginConfig,
+	tlsHost string,
+	reverseProxy *serverconfigs.ReverseProxyConfig,
+	config *configs.OriginHealthCheckConfig) *OriginHealthChecker {
+	return &OriginHealthChecker{
+		serverId:     serverId,
+		origin:       origin,
+		tlsHost:      tlsHost,
+		reverseProxy: reverseProxy,
+		config:       config,
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// Start 启动
+func (this *OriginHealthChecker) Start() {
+	var timer = time.NewTimer(this.config.NextInterval())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-this.stopChan:
+			return
+		case <-timer.C:
+			this.report(this.Check())
+			timer.Reset(this.config.NextInterval())
+		}
+	}
+}
+
+// Stop 停止
+func (this *OriginHealthChecker) Stop() {
+	this.stopOnce.Do(func() {
+		close(this.stopChan)
+	})
+}
+
+// Check 执行一次检查
+func (this *OriginHealthChecker) Check() error {
+	if this.origin.Addr == nil {
+		return errors.New("origin server address should not be empty")
+	}
+
+	switch this.protocol() {
+	case configs.OriginHealthCheckProtocolHTTP, configs.OriginHealthCheckProtocolHTTPS:
+		return this.checkHTTP()
+	default:
+		return this.checkTCP()
+	}
+}
+
+// 检查TCP连接
+func (this *OriginHealthChecker) checkTCP() error {
+	conn, _, err := OriginConnect(this.origin, 0, "", this.tlsHost)
+	if err != nil {
+		return err
+	}
+	_ = conn.Close()
+	return nil
+}
+
+// 检查HTTP请求
+func (this *OriginHealthChecker) checkHTTP() error {
+	var host = this.config.Host
+	if len(host) == 0 {
+		host = this.tlsHost
+	}
+	if len(host) == 0 {
+		host = this.origin.Addr.Host
+	}
+
+	var scheme = this.protocol()
+	req, err := http.NewRequest(this.config.Method, scheme+"://"+configutils.QuoteIP(this.origin.Addr.Host)+this.config.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = host
+	req.Header.Set("User-Agent", teaconst.GlobalProductName+"-HealthCheck/"+teaconst.Version)
+	req.Header.Set("Connection", "close")
+
+	resp, err := this.httpClient(host).Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if !this.config.MatchStatus(resp.StatusCode) {
+		return errors.New("unexpected status code '" + types.String(resp.StatusCode) + "'")
+	}
+
+	if this.config.HasBodyRegexp() {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxOriginHealthCheckBodySize))
+		if err != nil {
+			return err
+		}
+		if !this.config.MatchBody(body) {
+			return errors.New("response body does not match '" + this.config.BodyRegexp + "'")
+		}
+	}
+
+	return nil
+}
+
+// 构造HTTP客户端
+// 总是连接到源站地址，而不解析请求中的主机名
+func (this *OriginHealthChecker) httpClient(host string) *http.Client {
+	if this.client != nil {
+		return this.client
+	}
+
+	var timeout = this.config.TimeoutDuration()
+	var serverName = this.tlsHost
+	if len(serverName) == 0 {
+		serverName = host
+	}
+	this.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var dialer = &net.Dialer{
+					Timeout: timeout,
+				}
+				return dialer.DialContext(ctx, network, this.origin.Addr.PickAddress())
+			},
+			TLSClientConfig:   NewOriginTLSConfig(this.origin, serverName),
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return this.client
+}
+
+// 检查使用的协议
+func (this *OriginHealthChecker) protocol() configs.OriginHealthCheckProtocol {
+	switch this.config.Protocol {
+	case configs.OriginHealthCheckProtocolHTTP, configs.OriginHealthCheckProtocolHTTPS, configs.OriginHealthCheckProtocolTCP:
+		return this.config.Protocol
+	}
+	if this.origin.Addr.Protocol.IsHTTPSFamily() {
+		return configs.OriginHealthCheckProtocolHTTPS
+	}
+	if this.origin.Addr.Protocol.IsHTTPFamily() {
+		return configs.OriginHealthCheckProtocolHTTP
+	}
+	return configs.OriginHealthCheckProtocolTCP
+}
+
+// 处理检查结果
+func (this *OriginHealthChecker) report(err error) {
+	var origin = this.origin
+	if err == nil {
+		this.countFails = 0
+		this.countSuccess++
+		if !origin.IsOk && this.countSuccess >= this.config.Rise {
+			origin.IsOk = true
+			SharedOriginStateManager.Success(origin, nil)
+			this.onChange("origin '"+this.addr()+"' is up after "+types.String(this.countSuccess)+" successful health checks", "")
+		}
+		return
+	}
+
+	this.countSuccess = 0
+	this.countFails++
+	if origin.IsOk && this.countFails >= this.config.Fall {
+		origin.IsOk = false
+		this.onChange("origin '"+this.addr()+"' is down after "+types.String(this.countFails)+" failed health checks", err.Error())
+	}
+}
+
+// 状态变化
+func (this *OriginHealthChecker) onChange(description string, reason string) {
+	if this.reverseProxy != nil {
+		this.reverseProxy.ResetScheduling()
+	}
+
+	var params = maps.Map{
+		"originId": this.origin.Id,
+		"addr":     this.addr(),
+		"isOk":     this.origin.IsOk,
+	}
+	if len(reason) > 0 {
+		description += ": " + reason
+		params["reason"] = reason
+	}
+	remotelogs.ServerLog(this.serverId, "ORIGIN_HEALTH_CHECK", description, "", params)
+}
+
+func (this *OriginHealthChecker) addr() string {
+	if this.origin.Addr == nil {
+		return ""
+	}
+	return this.origin.Addr.Host + ":" + this.origin.Addr.PortRange
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginHealthChecker_Check(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var statusCode = http.StatusBadGateway
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		writer.WriteHeader(statusCode)
+		_, _ = writer.Write([]byte("status: ok"))
+	}))
+	defer server.Close()
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var origin = &serverconfigs.OriginConfig{
+		Id:   1,
+		IsOn: true,
+		Addr: &serverconfigs.NetworkAddressConfig{Protocol: serverconfigs.ProtocolHTTP, Host: "127.0.0.1", PortRange: port},
+	}
+	err = origin.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin.IsOk = true
+
+	var config = &configs.OriginHealthCheckConfig{
+		IsOn:       true,
+		Path:       "/health",
+		BodyRegexp: "ok$",
+		Rise:       2,
+		Fall:       2,
+	}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var checker = NewOriginHealthChecker(0, origin, "", nil, config)
+
+	// TCP可以连接，但是状态码为502
+	a.IsNotNil(checker.Check())
+	checker.report(checker.Check())
+	a.IsTrue(origin.IsOk)
+	checker.report(checker.Check())
+	a.IsFalse(origin.IsOk)
+
+	statusCode = http.StatusOK
+	a.IsNil(checker.Check())
+	checker.report(checker.Check())
+	a.IsFalse(origin.IsOk)
+	checker.report(checker.Check())
+	a.IsTrue(origin.IsOk)
+}
@@ -4,6 +4,7 @@ package nodes
 
 import (
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	"github.com/TeaOSLab/EdgeNode/internal/events"
 	"github.com/TeaOSLab/EdgeNode/internal/goman"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
@@ -32,7 +33,8 @@ const (
 
 // OriginStateManager 源站状态管理
 type OriginStateManager struct {
-	stateMap map[int64]*OriginState // originId => *OriginState
+	stateMap   map[int64]*OriginState         // originId => *OriginState
+	checkerMap map[int64]*OriginHealthChecker // originId => *OriginHealthChecker
 
 	ticker *time.Ticker
 	locker sync.RWMutex
@@ -41,8 +43,9 @@ type OriginStateManager struct {
 // NewOriginStateManager 获取新管理对象
 func NewOriginStateManager() *OriginStateManager {
 	return &OriginStateManager{
-		stateMap: map[int64]*OriginState{},
-		ticker:   time.NewTicker(60 * time.Second),
+		stateMap:   map[int64]*OriginState{},
+		checkerMap: map[int64]*OriginHealthChecker{},
+		ticker:     time.NewTicker(60 * time.Second),
 	}
 }
 
@@ -63,6 +66,13 @@ func (this *OriginStateManager) Stop() {
 	if this.ticker != nil {
 		this.ticker.Stop()
 	}
+
+	this.locker.Lock()
+	for originId, checker := range this.checkerMap {
+		checker.Stop()
+		delete(this.checkerMap, originId)
+	}
+	this.locker.Unlock()
 }
 
 // Loop 单次循环检查
@@ -75,8 +85,27 @@ func (this *OriginStateManager) Loop() error {
 	var tr = trackers.Begin("CHECK_ORIGIN_STATES")
 	defer tr.End()
 
+	// 清除不再使用的负载统计
+	SharedOriginBalancer.Clean()
+
 	var currentStates = []*OriginState{}
 	this.locker.Lock()
+
+	// 停止不再使用的主动健康检查
+	for originId, checker := range this.checkerMap {
+		var originConfig = nodeConfig.FindOrigin(originId)
+		if originConfig == nil || !originConfig.IsOn || originConfig != checker.origin {
+			checker.Stop()
+			delete(this.checkerMap, originId)
+			continue
+		}
+		var config = sharedProxyConfig.FindOriginOptions(originId).HealthCheck
+		if config != checker.config || !this.shouldCheck(originConfig, config) {
+			checker.Stop()
+			delete(this.checkerMap, originId)
+		}
+	}
+
 	for originId, state := range this.stateMap {
 		// 检查Origin是否正在使用
 		var originConfig = nodeConfig.FindOrigin(originId)
@@ -85,6 +114,13 @@ func (this *OriginStateManager) Loop() error {
 			continue
 		}
 		state.Config = originConfig
+
+		// 有主动健康检查的源站由健康检查负责恢复
+		_, hasChecker := this.checkerMap[originId]
+		if hasChecker {
+			continue
+		}
+
 		currentStates = append(currentStates, state)
 	}
 	this.locker.Unlock()
@@ -186,6 +222,64 @@ func (this *OriginStateManager) Success(origin *serverconfigs.OriginConfig, call
 	this.locker.Unlock()
 }
 
+// Watch 对源站启动主动健康检查
+// 如果源站没有开启健康检查，则不做任何处理
+func (this *OriginStateManager) Watch(serverId int64, origin *serverconfigs.OriginConfig, tlsHost string, reverseProxy *serverconfigs.ReverseProxyConfig) {
+	if origin == nil || origin.Id <= 0 {
+		return
+	}
+
+	var config = sharedProxyConfig.FindOriginOptions(origin.Id).HealthCheck
+	if !this.shouldCheck(origin, config) {
+		return
+	}
+
+	this.locker.RLock()
+	checker, ok := this.checkerMap[origin.Id]
+	this.locker.RUnlock()
+	if ok && checker.origin == origin && checker.config == config {
+		return
+	}
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	// 再次检查，避免并发时重复启动
+	checker, ok = this.checkerMap[origin.Id]
+	if ok {
+		if checker.origin == origin && checker.config == config {
+			return
+		}
+		checker.Stop()
+	} else if len(this.checkerMap) >= maxOriginStates {
+		return
+	}
+
+	checker = NewOriginHealthChecker(serverId, origin, tlsHost, reverseProxy, config)
+	this.checkerMap[origin.Id] = checker
+	goman.New(func() {
+		checker.Start()
+	})
+}
+
+// 判断源站是否需要主动健康检查
+func (this *OriginStateManager) shouldCheck(origin *serverconfigs.OriginConfig, config *configs.OriginHealthCheckConfig) bool {
+	if config == nil || !config.IsOn || origin.Addr == nil {
+		return false
+	}
+
+	// 地址中有变量或者端口跟随时，无法确定要检查的地址
+	if origin.Addr.HostHasVariables() || origin.FollowPort {
+		return false
+	}
+
+	// UDP源站只有在明确指定检查协议时才检查
+	if origin.Addr.Protocol == serverconfigs.ProtocolUDP && len(config.Protocol) == 0 {
+		return false
+	}
+	return true
+}
+
 // IsAvailable 检查是否正常
 func (this *OriginStateManager) IsAvailable(originId int64) bool {
 	if originId <= 0 {
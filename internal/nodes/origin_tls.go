@@ -0,0 +1,108 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+)
+
+// OriginTLSVerifyError 源站TLS证书验证失败
+type OriginTLSVerifyError struct {
+	Err error
+}
+
+func (this *OriginTLSVerifyError) Error() string {
+	return "verify origin certificate failed: " + this.Err.Error()
+}
+
+func (this *OriginTLSVerifyError) Unwrap() error {
+	return this.Err
+}
+
+// ParseOriginTLSVerifyError 从错误中分析是否为源站证书验证错误
+func ParseOriginTLSVerifyError(err error) (verifyErr *OriginTLSVerifyError, ok bool) {
+	if err == nil {
+		return nil, false
+	}
+
+	if errors.As(err, &verifyErr) {
+		return verifyErr, true
+	}
+
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var systemRootsErr x509.SystemRootsError
+	if errors.As(err, &unknownAuthorityErr) {
+		return &OriginTLSVerifyError{Err: unknownAuthorityErr}, true
+	}
+	if errors.As(err, &hostnameErr) {
+		return &OriginTLSVerifyError{Err: hostnameErr}, true
+	}
+	if errors.As(err, &invalidErr) {
+		return &OriginTLSVerifyError{Err: invalidErr}, true
+	}
+	if errors.As(err, &systemRootsErr) {
+		return &OriginTLSVerifyError{Err: systemRootsErr}, true
+	}
+	return nil, false
+}
+
+// NewOriginTLSConfig 构造连接源站使用的TLS配置
+func NewOriginTLSConfig(origin *serverconfigs.OriginConfig, tlsHost string) *tls.Config {
+	var tlsConfig = &tls.Config{
+		InsecureSkipVerify: true,
+	}
+	if origin.Cert != nil {
+		var obj = origin.Cert.CertObject()
+		if obj != nil {
+			tlsConfig.InsecureSkipVerify = false
+			tlsConfig.Certificates = []tls.Certificate{*obj}
+			if len(origin.Cert.ServerName) > 0 {
+				tlsConfig.ServerName = origin.Cert.ServerName
+			}
+		}
+	}
+	if len(tlsHost) > 0 {
+		tlsConfig.ServerName = tlsHost
+	}
+
+	var options = sharedProxyConfig.FindOriginOptions(origin.Id).TLS
+	if options == nil {
+		return tlsConfig
+	}
+
+	if len(options.ServerName) > 0 {
+		tlsConfig.ServerName = options.ServerName
+	}
+	if options.MinTLSVersion() > 0 {
+		tlsConfig.MinVersion = options.MinTLSVersion()
+	}
+	if len(options.CipherSuiteIds()) > 0 {
+		tlsConfig.CipherSuites = options.CipherSuiteIds()
+	}
+
+	switch options.VerifyMode {
+	case configs.OriginTLSVerifyModeSystem:
+		tlsConfig.InsecureSkipVerify = false
+		tlsConfig.RootCAs = nil
+	case configs.OriginTLSVerifyModeCA:
+		tlsConfig.InsecureSkipVerify = false
+		tlsConfig.RootCAs = options.CAPool()
+	case configs.OriginTLSVerifyModePin:
+		// 只验证叶子证书的公钥，不验证证书链和主机名
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 || !options.MatchPin(state.PeerCertificates[0]) {
+				return &OriginTLSVerifyError{Err: errors.New("the origin certificate does not match the pinned public keys")}
+			}
+			return nil
+		}
+	}
+
+	return tlsConfig
+}
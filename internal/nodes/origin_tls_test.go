@@ -0,0 +1,205 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package nodes
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/iwind/TeaGo/assert"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewOriginTLSConfig(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var server = httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var origin = &serverconfigs.OriginConfig{
+		Id:   1,
+		IsOn: true,
+		Addr: &serverconfigs.NetworkAddressConfig{Protocol: serverconfigs.ProtocolHTTPS, Host: "127.0.0.1", PortRange: port},
+	}
+	err = origin.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		sharedProxyConfig = configs.NewProxyConfig()
+	}()
+	var setTLS = func(tlsConfig *configs.OriginTLSConfig) {
+		var proxyConfig = configs.NewProxyConfig()
+		proxyConfig.DefaultOrigin = &configs.OriginOptions{TLS: tlsConfig}
+		err := proxyConfig.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sharedProxyConfig = proxyConfig
+	}
+
+	// 不验证
+	{
+		conn, _, err := OriginConnect(origin, 0, "", "")
+		a.IsNil(err)
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}
+
+	// 使用系统根证书
+	{
+		setTLS(&configs.OriginTLSConfig{VerifyMode: configs.OriginTLSVerifyModeSystem})
+		_, _, err := OriginConnect(origin, 0, "", "")
+		_, ok := ParseOriginTLSVerifyError(err)
+		a.IsTrue(ok)
+		t.Log(err)
+	}
+
+	// 公钥摘要
+	{
+		var sum = sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+		setTLS(&configs.OriginTLSConfig{VerifyMode: configs.OriginTLSVerifyModePin, Pins: []string{base64.StdEncoding.EncodeToString(sum[:])}})
+		conn, _, err := OriginConnect(origin, 0, "", "")
+		a.IsNil(err)
+		if conn != nil {
+			_ = conn.Close()
+		}
+
+		var otherSum = sha256.Sum256([]byte("other"))
+		setTLS(&configs.OriginTLSConfig{VerifyMode: configs.OriginTLSVerifyModePin, Pins: []string{base64.StdEncoding.EncodeToString(otherSum[:])}})
+		_, _, err = OriginConnect(origin, 0, "", "")
+		_, ok := ParseOriginTLSVerifyError(err)
+		a.IsTrue(ok)
+		t.Log(err)
+	}
+}
+
+func TestNewOriginTLSConfig_PinChain(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	caCert, leafCert := testOriginTLSCertChain(t)
+	var server = httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{leafCert}}
+	server.StartTLS()
+	defer server.Close()
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var origin = &serverconfigs.OriginConfig{
+		Id:   1,
+		IsOn: true,
+		Addr: &serverconfigs.NetworkAddressConfig{Protocol: serverconfigs.ProtocolHTTPS, Host: "127.0.0.1", PortRange: port},
+	}
+	err = origin.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		sharedProxyConfig = configs.NewProxyConfig()
+	}()
+	var setPin = func(cert *x509.Certificate) {
+		var sum = sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		var proxyConfig = configs.NewProxyConfig()
+		proxyConfig.DefaultOrigin = &configs.OriginOptions{TLS: &configs.OriginTLSConfig{
+			VerifyMode: configs.OriginTLSVerifyModePin,
+			Pins:       []string{base64.StdEncoding.EncodeToString(sum[:])},
+		}}
+		err := proxyConfig.Init()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sharedProxyConfig = proxyConfig
+	}
+
+	// 源站发送的证书链中包含CA证书，但只设置了CA证书的摘要，验证必须失败
+	{
+		setPin(caCert)
+		_, _, err := OriginConnect(origin, 0, "", "")
+		_, ok := ParseOriginTLSVerifyError(err)
+		a.IsTrue(ok)
+		t.Log(err)
+	}
+
+	// 叶子证书
+	{
+		setPin(leafCert.Leaf)
+		conn, _, err := OriginConnect(origin, 0, "", "")
+		a.IsNil(err)
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}
+}
+
+// 生成CA证书和由CA签发的叶子证书
+func testOriginTLSCertChain(t *testing.T) (caCert *x509.Certificate, leafCert tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var caTemplate = &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caData, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err = x509.ParseCertificate(caData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var leafTemplate = &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(1 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafData, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCert = tls.Certificate{
+		Certificate: [][]byte{leafData, caData},
+		PrivateKey:  leafKey,
+	}
+	leafCert.Leaf, err = x509.ParseCertificate(leafData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
@@ -52,24 +52,15 @@ func OriginConnect(origin *serverconfigs.OriginConfig, serverPort int, remoteAdd
 						// TODO 支持TCP4/TCP6
 						// TODO 支持指定特定网卡
 
-						var tlsConfig = &tls.Config{
-							InsecureSkipVerify: true,
-						}
-						if origin.Cert != nil {
-							var obj = origin.Cert.CertObject()
-							if obj != nil {
-								tlsConfig.InsecureSkipVerify = false
-								tlsConfig.Certificates = []tls.Certificate{*obj}
-								if len(origin.Cert.ServerName) > 0 {
-									tlsConfig.ServerName = origin.Cert.ServerName
-								}
-							}
-						}
-						if len(tlsHost) > 0 {
-							tlsConfig.ServerName = tlsHost
-						}
+						var tlsConfig = NewOriginTLSConfig(origin, tlsHost)
 
 						conn, err = tls.DialWithDialer(&dialer, "tcp", originAddr, tlsConfig)
+						if err != nil {
+							verifyErr, ok := ParseOriginTLSVerifyError(err)
+							if ok {
+								err = verifyErr
+							}
+						}
 					}
 
 					// TODO 需要在合适的时机删除TOA记录
@@ -98,24 +89,15 @@ func OriginConnect(origin *serverconfigs.OriginConfig, serverPort int, remoteAdd
 		// TODO 支持TCP4/TCP6
 		// TODO 支持指定特定网卡
 
-		var tlsConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
-		if origin.Cert != nil {
-			var obj = origin.Cert.CertObject()
-			if obj != nil {
-				tlsConfig.InsecureSkipVerify = false
-				tlsConfig.Certificates = []tls.Certificate{*obj}
-				if len(origin.Cert.ServerName) > 0 {
-					tlsConfig.ServerName = origin.Cert.ServerName
-				}
-			}
-		}
-		if len(tlsHost) > 0 {
-			tlsConfig.ServerName = tlsHost
-		}
+		var tlsConfig = NewOriginTLSConfig(origin, tlsHost)
 
 		originConn, err = tls.Dial("tcp", originAddr, tlsConfig)
+		if err != nil {
+			verifyErr, ok := ParseOriginTLSVerifyError(err)
+			if ok {
+				err = verifyErr
+			}
+		}
 		return originConn, originAddr, err
 	case serverconfigs.ProtocolUDP:
 		addr, err := net.ResolveUDPAddr("udp", originAddr)
@@ -231,12 +231,19 @@ func (this *UpgradeManager) unzip(zipPath string) error {
 
 // 重启
 func (this *UpgradeManager) restart() error {
+	// 优先使用平滑重启，不中断已有连接
+	_, err := sharedGracefulRestarter.Restart(DefaultGracefulDrainSeconds * time.Second)
+	if err == nil {
+		return nil
+	}
+	remotelogs.Warn("UPGRADE_MANAGER", err.Error()+", restarting directly")
+
 	// 关闭当前sock，防止无法重启
 	_ = gosock.NewTmpSock(teaconst.ProcessName).Close()
 
 	// 重新启动
 	if DaemonIsOn && DaemonPid == os.Getppid() {
-		utils.Exit() // TODO 试着更优雅重启
+		utils.Exit()
 	} else {
 		exe, err := os.Executable()
 		if err != nil {
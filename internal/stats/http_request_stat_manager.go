@@ -181,6 +181,20 @@ func (this *HTTPRequestStatManager) AddFirewallRuleGroupId(serverId int64, firew
 	}
 }
 
+// AddFirewallDetectOnlyRuleGroupId 添加仅检测模式下匹配的防火墙动作
+// 请求并没有被拦截，所以不计入攻击请求数，动作代号使用 detectOnly: 前缀和实际拦截的动作区分
+func (this *HTTPRequestStatManager) AddFirewallDetectOnlyRuleGroupId(serverId int64, firewallRuleGroupId int64, actionCode string) {
+	if firewallRuleGroupId <= 0 {
+		return
+	}
+
+	select {
+	case this.firewallRuleGroupChan <- strconv.FormatInt(serverId, 10) + "@" + strconv.FormatInt(firewallRuleGroupId, 10) + "@" + waf.DetectOnlyActionPrefix + actionCode:
+	default:
+		// 超出容量我们就丢弃
+	}
+}
+
 // Loop 单个循环
 func (this *HTTPRequestStatManager) Loop() error {
 	var timeout = time.NewTimer(10 * time.Minute) // 执行的最大时间
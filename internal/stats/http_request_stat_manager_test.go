@@ -2,6 +2,7 @@ package stats
 
 import (
 	iplib "github.com/TeaOSLab/EdgeCommon/pkg/iplibrary"
+	"github.com/TeaOSLab/EdgeNode/internal/waf"
 	_ "github.com/iwind/TeaGo/bootstrap"
 	"github.com/iwind/TeaGo/logs"
 	"testing"
@@ -55,3 +56,21 @@ func TestHTTPRequestStatManager_Loop_UserAgent(t *testing.T) {
 	}
 	t.Log("ok")
 }
+
+func TestHTTPRequestStatManager_AddFirewallDetectOnlyRuleGroupId(t *testing.T) {
+	var manager = NewHTTPRequestStatManager()
+	manager.AddFirewallRuleGroupId(1, 2, []*waf.ActionConfig{{Code: waf.ActionBlock}})
+	manager.AddFirewallDetectOnlyRuleGroupId(1, 2, waf.ActionBlock)
+	if manager.totalAttackRequests != 1 {
+		t.Fatal("detect only actions should not be counted as attack requests")
+	}
+
+	err := manager.Loop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.dailyFirewallRuleGroupMap["1@2@"+waf.ActionBlock] != 1 || manager.dailyFirewallRuleGroupMap["1@2@"+waf.DetectOnlyActionPrefix+waf.ActionBlock] != 1 {
+		t.Fatal("unexpected firewall rule group stats")
+	}
+	logs.PrintAsJSON(manager.dailyFirewallRuleGroupMap, t)
+}
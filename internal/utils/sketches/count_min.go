@@ -0,0 +1,116 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package sketchutils
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/utils/fnv"
+	"sync"
+)
+
+const countMinDepth = 4
+
+// CountMinSketch 使用固定内存估算Key出现次数的计数器
+// 每个计数器占用1个字节，最大计数为255，估算值只会偏大不会偏小
+type CountMinSketch struct {
+	rows [countMinDepth][]uint8
+	mask uint64
+
+	locker sync.Mutex
+}
+
+// NewCountMinSketch 获取新对象
+// width 为每行计数器的数量，会被调整为2的幂
+func NewCountMinSketch(width int) *CountMinSketch {
+	if width < 64 {
+		width = 64
+	}
+	var size = 64
+	for size < width {
+		size <<= 1
+	}
+
+	var sketch = &CountMinSketch{
+		mask: uint64(size - 1),
+	}
+	for i := 0; i < countMinDepth; i++ {
+		sketch.rows[i] = make([]uint8, size)
+	}
+	return sketch
+}
+
+// Add 增加某个Key的计数，并返回增加后的估算值
+func (this *CountMinSketch) Add(key string) uint8 {
+	var hash = fnv.HashString(key)
+
+	this.locker.Lock()
+	var min uint8 = 255
+	for i := 0; i < countMinDepth; i++ {
+		var index = this.index(hash, i)
+		var count = this.rows[i][index]
+		if count < 255 {
+			count++
+			this.rows[i][index] = count
+		}
+		if count < min {
+			min = count
+		}
+	}
+	this.locker.Unlock()
+	return min
+}
+
+// Estimate 估算某个Key的计数
+func (this *CountMinSketch) Estimate(key string) uint8 {
+	var hash = fnv.HashString(key)
+
+	this.locker.Lock()
+	var min uint8 = 255
+	for i := 0; i < countMinDepth; i++ {
+		var count = this.rows[i][this.index(hash, i)]
+		if count < min {
+			min = count
+		}
+	}
+	this.locker.Unlock()
+	return min
+}
+
+// Halve 所有计数减半，用来让较早的访问逐渐失效
+func (this *CountMinSketch) Halve() {
+	this.locker.Lock()
+	for i := 0; i < countMinDepth; i++ {
+		var row = this.rows[i]
+		for j := range row {
+			row[j] >>= 1
+		}
+	}
+	this.locker.Unlock()
+}
+
+// Reset 清空所有计数
+func (this *CountMinSketch) Reset() {
+	this.locker.Lock()
+	for i := 0; i < countMinDepth; i++ {
+		var row = this.rows[i]
+		for j := range row {
+			row[j] = 0
+		}
+	}
+	this.locker.Unlock()
+}
+
+// Width 每行计数器的数量
+func (this *CountMinSketch) Width() int {
+	return int(this.mask + 1)
+}
+
+// 计算某行中的位置
+func (this *CountMinSketch) index(hash uint64, row int) uint64 {
+	var h = hash + uint64(row+1)*0x9e3779b97f4a7c15
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h & this.mask
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package sketchutils_test
+
+import (
+	sketchutils "github.com/TeaOSLab/EdgeNode/internal/utils/sketches"
+	"github.com/iwind/TeaGo/assert"
+	"github.com/iwind/TeaGo/types"
+	"testing"
+)
+
+func TestCountMinSketch_Add(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var sketch = sketchutils.NewCountMinSketch(1024)
+	a.IsTrue(sketch.Width() == 1024)
+	a.IsTrue(sketch.Add("a") == 1)
+	a.IsTrue(sketch.Add("a") == 2)
+	a.IsTrue(sketch.Add("b") == 1)
+	a.IsTrue(sketch.Estimate("a") == 2)
+	a.IsTrue(sketch.Estimate("c") == 0)
+
+	for i := 0; i < 300; i++ {
+		sketch.Add("a")
+	}
+	a.IsTrue(sketch.Estimate("a") == 255)
+
+	sketch.Halve()
+	a.IsTrue(sketch.Estimate("a") == 127)
+	a.IsTrue(sketch.Estimate("b") == 0)
+
+	sketch.Reset()
+	a.IsTrue(sketch.Estimate("a") == 0)
+}
+
+func TestCountMinSketch_Accuracy(t *testing.T) {
+	var sketch = sketchutils.NewCountMinSketch(1 << 16)
+	for i := 0; i < 10000; i++ {
+		sketch.Add("key" + types.String(i))
+	}
+
+	var countWrong = 0
+	for i := 10000; i < 20000; i++ {
+		if sketch.Estimate("key"+types.String(i)) > 0 {
+			countWrong++
+		}
+	}
+	t.Log("wrong:", countWrong, "/", 10000)
+	if countWrong > 100 {
+		t.Fatal("too many wrong estimates")
+	}
+}
+
+func BenchmarkCountMinSketch_Add(b *testing.B) {
+	var sketch = sketchutils.NewCountMinSketch(1 << 20)
+	b.RunParallel(func(pb *testing.PB) {
+		var i = 0
+		for pb.Next() {
+			sketch.Add("https://example.com/images/" + types.String(i%100000) + ".png")
+			i++
+		}
+	})
+}
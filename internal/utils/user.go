@@ -0,0 +1,45 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package utils
+
+import (
+	"os/user"
+	"strconv"
+)
+
+// LookupUserAndGroup 查找用户和用户组对应的UID和GID
+// 用户或用户组可以是名称，也可以是数字ID，为空时返回 -1
+func LookupUserAndGroup(userName string, groupName string) (uid int, gid int, err error) {
+	uid = -1
+	gid = -1
+
+	if len(userName) > 0 {
+		uid, err = strconv.Atoi(userName)
+		if err != nil {
+			u, lookupErr := user.Lookup(userName)
+			if lookupErr != nil {
+				return -1, -1, lookupErr
+			}
+			uid, err = strconv.Atoi(u.Uid)
+			if err != nil {
+				return -1, -1, err
+			}
+		}
+	}
+
+	if len(groupName) > 0 {
+		gid, err = strconv.Atoi(groupName)
+		if err != nil {
+			g, lookupErr := user.LookupGroup(groupName)
+			if lookupErr != nil {
+				return -1, -1, lookupErr
+			}
+			gid, err = strconv.Atoi(g.Gid)
+			if err != nil {
+				return -1, -1, err
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package utils
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"testing"
+)
+
+func TestLookupUserAndGroup(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		uid, gid, err := LookupUserAndGroup("", "")
+		a.IsNil(err)
+		a.IsTrue(uid == -1)
+		a.IsTrue(gid == -1)
+	}
+
+	{
+		uid, gid, err := LookupUserAndGroup("root", "0")
+		a.IsNil(err)
+		a.IsTrue(uid == 0)
+		a.IsTrue(gid == 0)
+	}
+
+	{
+		_, _, err := LookupUserAndGroup("edge-node-user-not-exists", "")
+		a.IsTrue(err != nil)
+	}
+}
@@ -20,6 +20,9 @@ const (
 	ActionGoSet            ActionString = "go_set"    // go to next rule set
 )
 
+// DetectOnlyActionPrefix 仅检测模式下统计中的动作代号前缀，比如 detectOnly:block
+const DetectOnlyActionPrefix = "detectOnly:"
+
 var AllActions = []*ActionDefinition{
 	{
 		Name:     "阻止",
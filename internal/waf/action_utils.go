@@ -49,3 +49,15 @@ func FindActionName(action ActionString) string {
 	}
 	return ""
 }
+
+// IsBlockingAction 是否为会阻止或者改变请求的动作，仅检测模式下不会执行这些动作
+func IsBlockingAction(instance ActionInterface) bool {
+	if !instance.WillChange() {
+		return false
+	}
+	switch instance.Code() {
+	case ActionAllow, ActionGoGroup, ActionGoSet:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,504 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+import (
+	"strings"
+)
+
+// SQL标记类型
+const (
+	sqlTokenString     byte = 's'
+	sqlTokenNumber     byte = '1'
+	sqlTokenBareword   byte = 'n'
+	sqlTokenVariable   byte = 'v'
+	sqlTokenKeyword    byte = 'k'
+	sqlTokenStatement  byte = 'E' // select、insert、drop等语句
+	sqlTokenUnion      byte = 'U'
+	sqlTokenClause     byte = 'B' // group by、order by、having、limit等子句
+	sqlTokenFunction   byte = 'f'
+	sqlTokenOperator   byte = 'o'
+	sqlTokenLogic      byte = '&' // and、or、&&、||
+	sqlTokenComment    byte = 'c'
+	sqlTokenLeftParen  byte = '('
+	sqlTokenRightParen byte = ')'
+	sqlTokenComma      byte = ','
+	sqlTokenSemicolon  byte = ';'
+	sqlTokenTSQL       byte = 'T' // waitfor等T-SQL语句
+	sqlTokenEvil       byte = 'X' // 正常SQL中不会出现的内容，比如MySQL的 /*! 注释
+)
+
+// 单个输入最多分析的标记数量
+const maxSQLTokens = 512
+
+type sqlToken struct {
+	Type   byte
+	Value  string // 单词统一转换为小写
+	IsExpr bool   // 是否为合并后的表达式，比如 1=1
+}
+
+// DetectSQLInjection 检查字符串中是否包含SQL注入
+// 和 libinjection 类似，分别假设输入处于SQL语句中的普通位置、单引号和双引号字符串中，
+// 将输入分解为标记并合并简单的表达式，然后根据标记序列的特征判断是否为注入
+func DetectSQLInjection(input string) bool {
+	if len(input) == 0 {
+		return false
+	}
+
+	if isSQLInjection(foldSQLTokens(tokenizeSQL(input, 0)), false) {
+		return true
+	}
+	for _, quote := range []byte{'\'', '"'} {
+		if strings.IndexByte(input, quote) >= 0 && isSQLInjection(foldSQLTokens(tokenizeSQL(input, quote)), true) {
+			return true
+		}
+	}
+	return false
+}
+
+// 分解SQL标记
+// quote 不为0时表示输入处于以此引号开始的字符串中
+func tokenizeSQL(s string, quote byte) []*sqlToken {
+	var tokens = []*sqlToken{}
+	var i = 0
+
+	if quote != 0 {
+		var end = findStringEnd(s, 0, quote)
+		if end >= len(s) {
+			// 整个输入都在字符串中
+			return []*sqlToken{{Type: sqlTokenString}}
+		}
+		tokens = append(tokens, &sqlToken{Type: sqlTokenString, Value: s[:end]})
+		i = end + 1
+	}
+
+	var l = len(s)
+	for i < l && len(tokens) < maxSQLTokens {
+		var c = s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f' || c == 0 || c == 0xa0:
+			i++
+		case c == '\'' || c == '"':
+			var end = findStringEnd(s, i+1, c)
+			if end >= l {
+				tokens = append(tokens, &sqlToken{Type: sqlTokenString, Value: s[i+1:]})
+				i = l
+			} else {
+				tokens = append(tokens, &sqlToken{Type: sqlTokenString, Value: s[i+1 : end]})
+				i = end + 1
+			}
+		case c == '`':
+			var end = strings.IndexByte(s[i+1:], '`')
+			if end < 0 {
+				tokens = append(tokens, &sqlToken{Type: sqlTokenBareword, Value: strings.ToLower(s[i+1:])})
+				i = l
+			} else {
+				tokens = append(tokens, &sqlToken{Type: sqlTokenBareword, Value: strings.ToLower(s[i+1 : i+1+end])})
+				i += end + 2
+			}
+		case c == '#' || (c == '-' && i+1 < l && s[i+1] == '-'):
+			var end = strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				end = l - i
+			}
+			tokens = append(tokens, &sqlToken{Type: sqlTokenComment, Value: s[i : i+end]})
+			i += end
+		case c == '/' && i+1 < l && s[i+1] == '*':
+			if i+2 < l && s[i+2] == '!' {
+				tokens = append(tokens, &sqlToken{Type: sqlTokenEvil, Value: "/*!"})
+				i += 3
+				continue
+			}
+			var end = strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				tokens = append(tokens, &sqlToken{Type: sqlTokenComment, Value: s[i:]})
+				i = l
+			} else {
+				tokens = append(tokens, &sqlToken{Type: sqlTokenComment, Value: s[i : i+end+4]})
+				i += end + 4
+			}
+		case isSQLDigit(c) || (c == '.' && i+1 < l && isSQLDigit(s[i+1])):
+			var end = scanSQLNumber(s, i)
+			tokens = append(tokens, &sqlToken{Type: sqlTokenNumber, Value: s[i:end]})
+			i = end
+		case c == '@':
+			var end = i + 1
+			for end < l && s[end] == '@' {
+				end++
+			}
+			for end < l && isSQLWordChar(s[end]) {
+				end++
+			}
+			tokens = append(tokens, &sqlToken{Type: sqlTokenVariable, Value: strings.ToLower(s[i:end])})
+			i = end
+		case isSQLWordStart(c):
+			var end = i + 1
+			for end < l && isSQLWordChar(s[end]) {
+				end++
+			}
+
+			// N'...'、X'...'、B'...' 形式的字符串
+			if end == i+1 && end < l && (s[end] == '\'' || s[end] == '"') && strings.IndexByte("nNxXbB", c) >= 0 {
+				i = end
+				continue
+			}
+
+			var word = strings.ToLower(s[i:end])
+			tokens = append(tokens, newSQLWordToken(word, s[end:]))
+			i = end
+		case c == '(':
+			tokens = append(tokens, &sqlToken{Type: sqlTokenLeftParen, Value: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, &sqlToken{Type: sqlTokenRightParen, Value: ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, &sqlToken{Type: sqlTokenComma, Value: ","})
+			i++
+		case c == ';':
+			tokens = append(tokens, &sqlToken{Type: sqlTokenSemicolon, Value: ";"})
+			i++
+		case strings.IndexByte("=<>!|&^~+-*/%:?.", c) >= 0:
+			var op = scanSQLOperator(s, i)
+			if op == "||" || op == "&&" {
+				tokens = append(tokens, &sqlToken{Type: sqlTokenLogic, Value: op})
+			} else {
+				tokens = append(tokens, &sqlToken{Type: sqlTokenOperator, Value: op})
+			}
+			i += len(op)
+		default:
+			// 忽略其他字符
+			i++
+		}
+	}
+
+	return mergeSQLTokens(tokens)
+}
+
+// 根据单词生成标记
+// rest 为单词后面的内容，用来判断是否为函数调用
+func newSQLWordToken(word string, rest string) *sqlToken {
+	if sqlFunctions[word] && strings.HasPrefix(strings.TrimLeft(rest, " \t\r\n"), "(") {
+		return &sqlToken{Type: sqlTokenFunction, Value: word}
+	}
+	tokenType, ok := sqlKeywords[word]
+	if ok {
+		return &sqlToken{Type: tokenType, Value: word}
+	}
+	return &sqlToken{Type: sqlTokenBareword, Value: word}
+}
+
+// 合并由多个单词组成的关键词，比如 union all、order by、not like
+func mergeSQLTokens(tokens []*sqlToken) []*sqlToken {
+	var result = []*sqlToken{}
+	for index := 0; index < len(tokens); index++ {
+		var token = tokens[index]
+		if index+1 < len(tokens) {
+			var next = tokens[index+1]
+			var merged = false
+			switch {
+			case token.Type == sqlTokenUnion && (next.Value == "all" || next.Value == "distinct"):
+				merged = true
+			case (token.Value == "group" || token.Value == "order") && next.Value == "by":
+				token = &sqlToken{Type: sqlTokenClause, Value: token.Value + " by"}
+				merged = true
+			case token.Value == "not" && next.Type == sqlTokenOperator:
+				merged = true
+			case token.Value == "is" && next.Value == "not":
+				merged = true
+			case token.Type == sqlTokenTSQL && (next.Value == "delay" || next.Value == "time"):
+				merged = true
+			}
+			if merged {
+				result = append(result, token)
+				index++
+				continue
+			}
+		}
+		result = append(result, token)
+	}
+	return result
+}
+
+// 去掉中间的注释，合并一元运算符和简单的表达式，比如 -1、1=1、'a'='a'
+func foldSQLTokens(tokens []*sqlToken) []*sqlToken {
+	var result = []*sqlToken{}
+	for index, token := range tokens {
+		// 只保留末尾的注释
+		if token.Type == sqlTokenComment && index < len(tokens)-1 {
+			continue
+		}
+
+		// 一元运算符
+		if token.Type == sqlTokenOperator && index < len(tokens)-1 && isSQLValue(tokens[index+1].Type) {
+			if len(result) == 0 || isSQLUnaryContext(result[len(result)-1].Type) {
+				continue
+			}
+		}
+
+		// 表达式
+		if isSQLValue(token.Type) && len(result) >= 2 && result[len(result)-1].Type == sqlTokenOperator && isSQLValue(result[len(result)-2].Type) {
+			result = result[:len(result)-1]
+			var left = result[len(result)-1]
+			result[len(result)-1] = &sqlToken{Type: left.Type, Value: left.Value, IsExpr: true}
+			continue
+		}
+
+		result = append(result, token)
+	}
+	return result
+}
+
+// 根据标记序列判断是否为SQL注入
+// inString 表示第一个标记是假设输入处于字符串中而得到的字符串
+func isSQLInjection(tokens []*sqlToken, inString bool) bool {
+	var count = len(tokens)
+	if count == 0 {
+		return false
+	}
+
+	var typeAt = func(index int) byte {
+		if index < 0 || index >= count {
+			return 0
+		}
+		return tokens[index].Type
+	}
+
+	for index, token := range tokens {
+		switch token.Type {
+		case sqlTokenEvil:
+			return true
+		case sqlTokenUnion:
+			// union select
+			var next = index + 1
+			for typeAt(next) == sqlTokenLeftParen {
+				next++
+			}
+			if typeAt(next) == sqlTokenStatement && tokens[next].Value == "select" {
+				return true
+			}
+		case sqlTokenSemicolon:
+			// 附加语句，比如 ; drop table a
+			if typeAt(index+1) == sqlTokenStatement && isSQLStatementTail(tokens, index+2) {
+				return true
+			}
+			if typeAt(index+1) == sqlTokenTSQL {
+				return true
+			}
+		case sqlTokenLeftParen:
+			// 子查询，比如 (select 1
+			if typeAt(index+1) == sqlTokenStatement && tokens[index+1].Value == "select" {
+				switch typeAt(index + 2) {
+				case sqlTokenNumber, sqlTokenOperator, sqlTokenFunction, sqlTokenVariable, sqlTokenLeftParen:
+					return true
+				}
+			}
+		case sqlTokenLogic:
+			// and sleep(1)、or (select ...)
+			switch typeAt(index + 1) {
+			case sqlTokenFunction:
+				return true
+			case sqlTokenLeftParen:
+				if typeAt(index+2) == sqlTokenStatement {
+					return true
+				}
+			}
+		case sqlTokenTSQL:
+			// waitfor delay
+			if index == 0 || isSQLValue(typeAt(index-1)) || typeAt(index-1) == sqlTokenRightParen || typeAt(index-1) == sqlTokenLogic {
+				return true
+			}
+		}
+	}
+
+	// 开头的结构
+	var first = tokens[0].Type
+	if inString || isSQLValue(first) {
+		// 跳过右括号，比如 1) or (1=1
+		var index = 1
+		for typeAt(index) == sqlTokenRightParen {
+			index++
+		}
+
+		switch typeAt(index) {
+		case sqlTokenLogic:
+			if isSQLLogicOperand(tokens, index+1, inString) {
+				return true
+			}
+		case sqlTokenClause:
+			// order by 1
+			if tokens[index].Value != "limit" {
+				switch typeAt(index + 1) {
+				case sqlTokenNumber, sqlTokenLeftParen, sqlTokenFunction:
+					return true
+				}
+			}
+		case sqlTokenComment:
+			// admin'--
+			if inString && index == count-1 {
+				return true
+			}
+		}
+	}
+
+	// select 1,2、select * from
+	if first == sqlTokenStatement && tokens[0].Value == "select" {
+		switch typeAt(1) {
+		case sqlTokenFunction:
+			return true
+		case sqlTokenNumber, sqlTokenOperator, sqlTokenVariable:
+			switch typeAt(2) {
+			case 0, sqlTokenKeyword, sqlTokenComma, sqlTokenComment:
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// 判断逻辑运算符后面的内容是否为注入条件，比如 or 1=1、and 'a'='a、or 1--
+func isSQLLogicOperand(tokens []*sqlToken, index int, inString bool) bool {
+	for index < len(tokens) && tokens[index].Type == sqlTokenLeftParen {
+		index++
+	}
+	if index >= len(tokens) {
+		return false
+	}
+	var token = tokens[index]
+	switch token.Type {
+	case sqlTokenFunction, sqlTokenVariable:
+		return true
+	case sqlTokenStatement:
+		return token.Value == "select"
+	}
+	if !isSQLValue(token.Type) {
+		return false
+	}
+	if token.IsExpr {
+		return true
+	}
+
+	// 后面紧跟着运算符、注释或者结束
+	if index+1 >= len(tokens) {
+		// 在字符串中时，应用程序会在末尾补上引号
+		return inString && token.Type == sqlTokenString
+	}
+	switch tokens[index+1].Type {
+	case sqlTokenOperator, sqlTokenComment, sqlTokenSemicolon:
+		return true
+	case sqlTokenRightParen:
+		return index+2 >= len(tokens) || tokens[index+2].Type == sqlTokenComment
+	}
+	return false
+}
+
+// 判断附加语句后面的内容是否像SQL，比如 drop table、delete from、update a set
+func isSQLStatementTail(tokens []*sqlToken, index int) bool {
+	if index >= len(tokens) {
+		return true
+	}
+	switch tokens[index].Type {
+	case sqlTokenKeyword, sqlTokenVariable, sqlTokenOperator, sqlTokenNumber, sqlTokenFunction, sqlTokenLeftParen, sqlTokenComment, sqlTokenSemicolon:
+		return true
+	case sqlTokenBareword:
+		if index+1 >= len(tokens) {
+			return false
+		}
+		switch tokens[index+1].Type {
+		case sqlTokenKeyword, sqlTokenOperator, sqlTokenLeftParen, sqlTokenSemicolon, sqlTokenComment, sqlTokenString, sqlTokenVariable:
+			return true
+		}
+	}
+	return false
+}
+
+// 查找字符串结束的引号位置，找不到时返回字符串长度
+// 支持使用两个引号和反斜杠转义
+func findStringEnd(s string, start int, quote byte) int {
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(s)
+}
+
+// 读取数字，支持十六进制、二进制、小数和科学计数法
+func scanSQLNumber(s string, start int) int {
+	var l = len(s)
+	var i = start
+	if s[i] == '0' && i+1 < l && (s[i+1] == 'x' || s[i+1] == 'X' || s[i+1] == 'b' || s[i+1] == 'B') {
+		i += 2
+		for i < l && isSQLHexDigit(s[i]) {
+			i++
+		}
+		return i
+	}
+	for i < l && isSQLDigit(s[i]) {
+		i++
+	}
+	if i < l && s[i] == '.' {
+		i++
+		for i < l && isSQLDigit(s[i]) {
+			i++
+		}
+	}
+	if i+1 < l && (s[i] == 'e' || s[i] == 'E') && (isSQLDigit(s[i+1]) || ((s[i+1] == '+' || s[i+1] == '-') && i+2 < l && isSQLDigit(s[i+2]))) {
+		i += 2
+		for i < l && isSQLDigit(s[i]) {
+			i++
+		}
+	}
+	return i
+}
+
+// 读取运算符
+func scanSQLOperator(s string, start int) string {
+	if strings.HasPrefix(s[start:], "<=>") {
+		return "<=>"
+	}
+	if start+1 < len(s) {
+		switch s[start : start+2] {
+		case "<=", ">=", "<>", "!=", "||", "&&", "::", ":=", "<<", ">>", "==":
+			return s[start : start+2]
+		}
+	}
+	return s[start : start+1]
+}
+
+func isSQLValue(tokenType byte) bool {
+	return tokenType == sqlTokenNumber || tokenType == sqlTokenString || tokenType == sqlTokenBareword || tokenType == sqlTokenVariable
+}
+
+// 运算符在这些标记后面时为一元运算符
+func isSQLUnaryContext(tokenType byte) bool {
+	switch tokenType {
+	case sqlTokenLogic, sqlTokenLeftParen, sqlTokenComma, sqlTokenOperator, sqlTokenKeyword, sqlTokenStatement, sqlTokenUnion, sqlTokenClause, sqlTokenSemicolon, sqlTokenTSQL:
+		return true
+	}
+	return false
+}
+
+func isSQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSQLHexDigit(c byte) bool {
+	return isSQLDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isSQLWordStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '$' || c >= 0x80
+}
+
+func isSQLWordChar(c byte) bool {
+	return isSQLWordStart(c) || isSQLDigit(c) || c == '.'
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+// SQL关键词对应的标记类型，没有列出的单词为普通单词
+var sqlKeywords = map[string]byte{
+	// 语句
+	"select":   sqlTokenStatement,
+	"insert":   sqlTokenStatement,
+	"update":   sqlTokenStatement,
+	"delete":   sqlTokenStatement,
+	"drop":     sqlTokenStatement,
+	"create":   sqlTokenStatement,
+	"alter":    sqlTokenStatement,
+	"truncate": sqlTokenStatement,
+	"rename":   sqlTokenStatement,
+	"exec":     sqlTokenStatement,
+	"execute":  sqlTokenStatement,
+	"declare":  sqlTokenStatement,
+	"shutdown": sqlTokenStatement,
+	"grant":    sqlTokenStatement,
+	"revoke":   sqlTokenStatement,
+	"handler":  sqlTokenStatement,
+	"load":     sqlTokenStatement,
+
+	"union": sqlTokenUnion,
+
+	// 分组、排序等子句
+	"having":    sqlTokenClause,
+	"limit":     sqlTokenClause,
+	"procedure": sqlTokenClause,
+
+	// 逻辑运算
+	"and": sqlTokenLogic,
+	"or":  sqlTokenLogic,
+	"xor": sqlTokenLogic,
+
+	// 运算符
+	"like":    sqlTokenOperator,
+	"rlike":   sqlTokenOperator,
+	"regexp":  sqlTokenOperator,
+	"between": sqlTokenOperator,
+	"is":      sqlTokenOperator,
+	"in":      sqlTokenOperator,
+	"not":     sqlTokenOperator,
+	"div":     sqlTokenOperator,
+	"mod":     sqlTokenOperator,
+	"escape":  sqlTokenOperator,
+	"collate": sqlTokenOperator,
+
+	// 常量
+	"null":  sqlTokenNumber,
+	"true":  sqlTokenNumber,
+	"false": sqlTokenNumber,
+
+	// 其他关键词
+	"from":     sqlTokenKeyword,
+	"where":    sqlTokenKeyword,
+	"into":     sqlTokenKeyword,
+	"table":    sqlTokenKeyword,
+	"values":   sqlTokenKeyword,
+	"set":      sqlTokenKeyword,
+	"join":     sqlTokenKeyword,
+	"by":       sqlTokenKeyword,
+	"all":      sqlTokenKeyword,
+	"distinct": sqlTokenKeyword,
+	"case":     sqlTokenKeyword,
+	"when":     sqlTokenKeyword,
+	"then":     sqlTokenKeyword,
+	"else":     sqlTokenKeyword,
+	"end":      sqlTokenKeyword,
+	"outfile":  sqlTokenKeyword,
+	"dumpfile": sqlTokenKeyword,
+	"database": sqlTokenKeyword,
+	"delay":    sqlTokenKeyword,
+
+	"waitfor": sqlTokenTSQL,
+}
+
+// SQL函数，只有后面紧跟着左括号时才会被当做函数
+var sqlFunctions = map[string]bool{
+	"sleep":                     true,
+	"benchmark":                 true,
+	"pg_sleep":                  true,
+	"load_file":                 true,
+	"extractvalue":              true,
+	"updatexml":                 true,
+	"name_const":                true,
+	"geometrycollection":        true,
+	"multipoint":                true,
+	"polygon":                   true,
+	"linestring":                true,
+	"exp":                       true,
+	"json_keys":                 true,
+	"concat":                    true,
+	"concat_ws":                 true,
+	"group_concat":              true,
+	"char":                      true,
+	"chr":                       true,
+	"nchar":                     true,
+	"ascii":                     true,
+	"ord":                       true,
+	"substring":                 true,
+	"substr":                    true,
+	"mid":                       true,
+	"left":                      true,
+	"right":                     true,
+	"length":                    true,
+	"len":                       true,
+	"hex":                       true,
+	"unhex":                     true,
+	"bin":                       true,
+	"md5":                       true,
+	"sha1":                      true,
+	"version":                   true,
+	"database":                  true,
+	"schema":                    true,
+	"user":                      true,
+	"current_user":              true,
+	"system_user":               true,
+	"session_user":              true,
+	"count":                     true,
+	"if":                        true,
+	"ifnull":                    true,
+	"isnull":                    true,
+	"nullif":                    true,
+	"coalesce":                  true,
+	"cast":                      true,
+	"convert":                   true,
+	"floor":                     true,
+	"rand":                      true,
+	"elt":                       true,
+	"make_set":                  true,
+	"row":                       true,
+	"lower":                     true,
+	"upper":                     true,
+	"replace":                   true,
+	"reverse":                   true,
+	"instr":                     true,
+	"locate":                    true,
+	"position":                  true,
+	"xp_cmdshell":               true,
+	"sys_eval":                  true,
+	"sys_exec":                  true,
+	"utl_inaddr.get_host_name":  true,
+	"utl_http.request":          true,
+	"dbms_pipe.receive_message": true,
+	"dbms_lock.sleep":           true,
+	"ctxsys.drithsx.sn":         true,
+	"db_name":                   true,
+	"host_name":                 true,
+	"is_srvrolemember":          true,
+	"openrowset":                true,
+	"opendatasource":            true,
+	"pg_read_file":              true,
+	"pg_ls_dir":                 true,
+	"current_database":          true,
+	"sqlite_version":            true,
+	"randomblob":                true,
+}
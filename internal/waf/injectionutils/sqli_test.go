@@ -0,0 +1,120 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"runtime"
+	"testing"
+)
+
+func TestDetectSQLInjection(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	for _, s := range []string{
+		"1' or '1'='1",
+		"1' OR 1=1--",
+		"admin'--",
+		"admin' #",
+		"1 or 1=1",
+		"-1 or 1=1",
+		"1) or (1=1",
+		"1' and sleep(5)#",
+		"1 AND SLEEP(5)",
+		"1' and updatexml(1,concat(0x7e,version()),1)--",
+		"1 union select 1,2,3",
+		"1' UNION ALL SELECT NULL,NULL--",
+		"-1 union/**/select user,password from users",
+		"1/*!50000union*/select 1",
+		"1; drop table users",
+		"1'; DROP TABLE users--",
+		"1;waitfor delay '0:0:5'--",
+		"1 waitfor delay '0:0:5'",
+		"1 and (select 1 from dual)",
+		"(select * from (select(sleep(5)))a)",
+		"1' order by 3--",
+		"select 1,2,3",
+		"select @@version",
+		"\" or \"\"=\"",
+		"1' and 'a'='a",
+		"1' || '1'='1",
+	} {
+		if !DetectSQLInjection(s) {
+			t.Log("expected injection:", s)
+			a.IsTrue(false)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"hello",
+		"lu",
+		"123",
+		"1 or 2",
+		"John O'Brien",
+		"It's a nice day",
+		"Tom & Jerry",
+		"rock and roll",
+		"select your option",
+		"Please select; then continue",
+		"order by price",
+		"limit 10",
+		"2022-10-01",
+		"a-b-c",
+		"/hello/world?name=lu",
+		"user@example.com",
+		"SELECT",
+		"union station",
+		"the union of select items",
+		"1.2.3",
+		"#hashtag",
+		"--help",
+		`{"name":"lu","age":20}`,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/107.0.0.0 Safari/537.36",
+	} {
+		if DetectSQLInjection(s) {
+			t.Log("unexpected injection:", s)
+			a.IsTrue(false)
+		}
+	}
+}
+
+func TestDetectSQLInjectionValue(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsFalse(DetectSQLInjectionValue(nil))
+	a.IsFalse(DetectSQLInjectionValue("name=lu&age=20"))
+	a.IsTrue(DetectSQLInjectionValue("name=lu&id=1%27%20or%20%271%27%3D%271"))
+	a.IsTrue(DetectSQLInjectionValue("id=1+union+select+1,2"))
+	a.IsTrue(DetectSQLInjectionValue("1%20union%20select%201"))
+	a.IsTrue(DetectSQLInjectionValue([]byte("id=1' or 1=1--")))
+	a.IsTrue(DetectSQLInjectionValue([]string{"lu", "1 or 1=1"}))
+	a.IsTrue(DetectSQLInjectionValue(map[string]interface{}{
+		"user": map[string]interface{}{
+			"name": "admin'--",
+		},
+	}))
+	a.IsTrue(DetectSQLInjectionValue(map[string]interface{}{
+		"1 union select 1": "lu",
+	}))
+	a.IsTrue(DetectSQLInjectionValue([]interface{}{1, "1; drop table a"}))
+	a.IsFalse(DetectSQLInjectionValue(map[string][]string{
+		"name": {"lu"},
+	}))
+	a.IsFalse(DetectSQLInjectionValue(123))
+}
+
+func BenchmarkDetectSQLInjection(b *testing.B) {
+	runtime.GOMAXPROCS(1)
+
+	for i := 0; i < b.N; i++ {
+		_ = DetectSQLInjection("/hello/world?name=lu&age=20&desc=It's a nice day")
+	}
+}
+
+func BenchmarkDetectSQLInjection_Attack(b *testing.B) {
+	runtime.GOMAXPROCS(1)
+
+	for i := 0; i < b.N; i++ {
+		_ = DetectSQLInjection("1' and updatexml(1,concat(0x7e,version()),1)--")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+import (
+	"github.com/iwind/TeaGo/types"
+	"net/url"
+	"strings"
+)
+
+// DetectSQLInjectionValue 检查参数值中是否包含SQL注入
+// 支持字符串、字节、切片和Map等类型，URL编码的参数会分别检查参数名和解码后的参数值
+func DetectSQLInjectionValue(value interface{}) bool {
+	return detectValue(value, DetectSQLInjection)
+}
+
+// DetectXSSValue 检查参数值中是否包含XSS
+// 支持的类型和 DetectSQLInjectionValue 相同
+func DetectXSSValue(value interface{}) bool {
+	return detectValue(value, DetectXSS)
+}
+
+func detectValue(value interface{}, detectFunc func(s string) bool) bool {
+	if value == nil {
+		return false
+	}
+
+	switch v := value.(type) {
+	case string:
+		return detectString(v, detectFunc)
+	case []byte:
+		return detectString(string(v), detectFunc)
+	case []string:
+		for _, s := range v {
+			if detectString(s, detectFunc) {
+				return true
+			}
+		}
+		return false
+	case []interface{}:
+		for _, item := range v {
+			if detectValue(item, detectFunc) {
+				return true
+			}
+		}
+		return false
+	case map[string]string:
+		for k, item := range v {
+			if detectString(k, detectFunc) || detectString(item, detectFunc) {
+				return true
+			}
+		}
+		return false
+	case map[string][]string:
+		for k, items := range v {
+			if detectString(k, detectFunc) || detectValue(items, detectFunc) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		for k, item := range v {
+			if detectString(k, detectFunc) || detectValue(item, detectFunc) {
+				return true
+			}
+		}
+		return false
+	case url.Values:
+		return detectValue(map[string][]string(v), detectFunc)
+	}
+
+	return detectString(types.String(value), detectFunc)
+}
+
+// 检查字符串，如果是URL编码的参数，则同时检查各个参数
+func detectString(s string, detectFunc func(s string) bool) bool {
+	if len(s) == 0 {
+		return false
+	}
+	if detectFunc(s) {
+		return true
+	}
+
+	if strings.IndexByte(s, '&') >= 0 || strings.IndexByte(s, '=') >= 0 {
+		for _, piece := range strings.Split(s, "&") {
+			var key = piece
+			var value = ""
+			var index = strings.IndexByte(piece, '=')
+			if index >= 0 {
+				key = piece[:index]
+				value = piece[index+1:]
+			}
+			if detectPiece(key, detectFunc) || detectPiece(value, detectFunc) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if strings.IndexByte(s, '%') >= 0 || strings.IndexByte(s, '+') >= 0 {
+		unescaped, err := url.QueryUnescape(s)
+		if err == nil && unescaped != s {
+			return detectFunc(unescaped)
+		}
+	}
+	return false
+}
+
+// 检查URL编码的参数名或参数值
+func detectPiece(s string, detectFunc func(s string) bool) bool {
+	if len(s) == 0 {
+		return false
+	}
+	unescaped, err := url.QueryUnescape(s)
+	if err != nil {
+		unescaped = s
+	}
+	return detectFunc(unescaped)
+}
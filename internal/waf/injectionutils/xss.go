@@ -0,0 +1,394 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 危险的标签
+var xssTags = map[string]bool{
+	"script":   true,
+	"iframe":   true,
+	"frame":    true,
+	"frameset": true,
+	"object":   true,
+	"embed":    true,
+	"applet":   true,
+	"base":     true,
+	"link":     true,
+	"meta":     true,
+	"style":    true,
+	"xml":      true,
+	"import":   true,
+	"vmlframe": true,
+	"xss":      true,
+}
+
+// 事件属性，只在无法确定是否处于标签中时使用，标签中所有 on 开头的属性都会被当做事件属性
+var xssEventAttrs = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`abort activate afterprint animationend animationiteration animationstart auxclick
+beforeactivate beforecopy beforecut beforedeactivate beforepaste beforeprint beforeunload begin blur bounce
+canplay canplaythrough change click contextmenu copy cut dblclick deactivate drag dragend dragenter dragleave
+dragover dragstart drop durationchange end ended error filterchange finish focus focusin focusout hashchange
+input invalid keydown keypress keyup load loadeddata loadedmetadata loadstart message mousedown mouseenter
+mouseleave mousemove mouseout mouseover mouseup mousewheel offline online pagehide pageshow paste pause play
+playing pointerdown pointerenter pointerleave pointermove pointerout pointerover pointerup popstate progress
+propertychange ratechange readystatechange repeat reset resize scroll search seeked seeking select
+selectionchange selectstart show stalled start storage submit suspend timeupdate toggle touchend touchmove
+touchstart transitionend unload volumechange waiting wheel`) {
+		xssEventAttrs["on"+name] = true
+	}
+}
+
+// 值为URL的属性
+var xssURLAttrs = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"data":       true,
+	"background": true,
+	"lowsrc":     true,
+	"dynsrc":     true,
+	"poster":     true,
+	"codebase":   true,
+	"xlink:href": true,
+	"from":       true,
+	"to":         true,
+	"values":     true,
+	"by":         true,
+}
+
+// 输入可能所处的HTML上下文
+type htmlContext = int
+
+const (
+	htmlContextData         htmlContext = iota // 标签之间的文本
+	htmlContextValueNoQuote                    // 没有引号的属性值
+	htmlContextValueSingleQuote
+	htmlContextValueDoubleQuote
+	htmlContextValueBackQuote
+)
+
+// DetectXSS 检查字符串中是否包含XSS
+// 和 libinjection 类似，分别假设输入处于标签之间的文本和各种属性值中，
+// 使用简化的HTML5解析过程检查其中的危险标签、事件属性、脚本链接和样式
+func DetectXSS(input string) bool {
+	if len(input) == 0 {
+		return false
+	}
+
+	if strings.IndexByte(input, '<') >= 0 && newHTMLScanner(input).scan(htmlContextData) {
+		return true
+	}
+
+	// 属性值中的注入一定包含 =、: 或者 > 等特殊字符
+	if strings.IndexByte(input, '=') >= 0 || strings.IndexByte(input, ':') >= 0 || strings.IndexByte(input, '>') >= 0 {
+		if newHTMLScanner(input).scan(htmlContextValueNoQuote) {
+			return true
+		}
+		for quote, context := range map[byte]htmlContext{
+			'\'': htmlContextValueSingleQuote,
+			'"':  htmlContextValueDoubleQuote,
+			'`':  htmlContextValueBackQuote,
+		} {
+			if strings.IndexByte(input, quote) >= 0 && newHTMLScanner(input).scan(context) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 简化的HTML扫描器
+type htmlScanner struct {
+	s   string
+	pos int
+}
+
+func newHTMLScanner(s string) *htmlScanner {
+	return &htmlScanner{s: s}
+}
+
+// 从某个上下文开始扫描，发现危险内容时返回true
+func (this *htmlScanner) scan(context htmlContext) bool {
+	if context != htmlContextData {
+		// 输入开头为属性值
+		var value string
+		switch context {
+		case htmlContextValueNoQuote:
+			value = this.readUntilAny(" \t\n\r\f>")
+		case htmlContextValueSingleQuote:
+			value = this.readQuoted('\'')
+		case htmlContextValueDoubleQuote:
+			value = this.readQuoted('"')
+		case htmlContextValueBackQuote:
+			value = this.readQuoted('`')
+		}
+		if isXSSScriptURL(value) {
+			return true
+		}
+		if this.scanAttrs(false) {
+			return true
+		}
+	}
+
+	return this.scanData()
+}
+
+// 扫描标签之间的文本
+func (this *htmlScanner) scanData() bool {
+	for this.pos < len(this.s) {
+		var index = strings.IndexByte(this.s[this.pos:], '<')
+		if index < 0 {
+			return false
+		}
+		this.pos += index + 1
+		if this.pos >= len(this.s) {
+			return false
+		}
+
+		var c = this.s[this.pos]
+		switch {
+		case isHTMLLetter(c):
+			var name = strings.ToLower(strings.ReplaceAll(this.readUntilAny(" \t\n\r\f/>"), "\x00", ""))
+			if xssTags[name] {
+				return true
+			}
+			if this.scanAttrs(true) {
+				return true
+			}
+		case c == '/':
+			// 结束标签
+			this.readUntilAny(">")
+		case c == '!':
+			if strings.HasPrefix(this.s[this.pos:], "!--") {
+				var end = strings.Index(this.s[this.pos+3:], "-->")
+				var comment string
+				if end < 0 {
+					comment = this.s[this.pos+3:]
+					this.pos = len(this.s)
+				} else {
+					comment = this.s[this.pos+3 : this.pos+3+end]
+					this.pos += end + 6
+				}
+
+				// IE条件注释
+				if strings.Contains(strings.ToLower(comment), "[if") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// 扫描标签中的属性，遇到 > 时结束
+// inTag 表示确定处于标签中，此时所有 on 开头的属性都被当做事件属性
+func (this *htmlScanner) scanAttrs(inTag bool) bool {
+	for this.pos < len(this.s) {
+		var c = this.s[this.pos]
+		if c == '>' {
+			this.pos++
+			return false
+		}
+		if isHTMLSpace(c) || c == '/' {
+			this.pos++
+			continue
+		}
+
+		var name = strings.ToLower(strings.ReplaceAll(this.readUntilAny(" \t\n\r\f/>="), "\x00", ""))
+		this.skipSpaces()
+		if this.pos >= len(this.s) || this.s[this.pos] != '=' {
+			continue
+		}
+		this.pos++
+		this.skipSpaces()
+
+		var value = ""
+		if this.pos < len(this.s) {
+			switch this.s[this.pos] {
+			case '\'', '"', '`':
+				var quote = this.s[this.pos]
+				this.pos++
+				value = this.readQuoted(quote)
+			default:
+				value = this.readUntilAny(" \t\n\r\f>")
+			}
+		}
+		if isXSSAttr(name, value, inTag) {
+			return true
+		}
+	}
+	return false
+}
+
+// 读取内容直到某些字符，不包含这些字符
+func (this *htmlScanner) readUntilAny(chars string) string {
+	var start = this.pos
+	var index = strings.IndexAny(this.s[start:], chars)
+	if index < 0 {
+		this.pos = len(this.s)
+		return this.s[start:]
+	}
+	this.pos += index
+	return this.s[start:this.pos]
+}
+
+// 读取引号中的内容，并跳过结束的引号
+func (this *htmlScanner) readQuoted(quote byte) string {
+	var start = this.pos
+	var index = strings.IndexByte(this.s[start:], quote)
+	if index < 0 {
+		this.pos = len(this.s)
+		return this.s[start:]
+	}
+	this.pos += index + 1
+	return this.s[start : start+index]
+}
+
+func (this *htmlScanner) skipSpaces() {
+	for this.pos < len(this.s) && isHTMLSpace(this.s[this.pos]) {
+		this.pos++
+	}
+}
+
+// 检查属性是否危险
+func isXSSAttr(name string, value string, inTag bool) bool {
+	if len(name) > 2 && strings.HasPrefix(name, "on") {
+		if inTag || xssEventAttrs[name] {
+			return true
+		}
+	}
+	if xssURLAttrs[name] {
+		return isXSSScriptURL(value)
+	}
+	switch name {
+	case "style":
+		var lowerValue = strings.ToLower(decodeHTMLEntities(value))
+		return strings.Contains(lowerValue, "expression(") ||
+			strings.Contains(lowerValue, "javascript:") ||
+			strings.Contains(lowerValue, "behavior:") ||
+			strings.Contains(lowerValue, "-moz-binding")
+	case "srcdoc":
+		var decoded = decodeHTMLEntities(value)
+		return strings.IndexByte(decoded, '<') >= 0 && newHTMLScanner(decoded).scan(htmlContextData)
+	}
+	return false
+}
+
+// 判断是否为脚本链接，比如 javascript:alert(1)、java&#09;script:alert(1)
+func isXSSScriptURL(value string) bool {
+	if len(value) == 0 {
+		return false
+	}
+	if strings.IndexByte(value, ':') < 0 && strings.IndexByte(value, '&') < 0 {
+		return false
+	}
+
+	// 浏览器会忽略协议中的空白和控制字符
+	var decoded = decodeHTMLEntities(value)
+	var scheme = strings.Builder{}
+	for i := 0; i < len(decoded) && scheme.Len() < 32; i++ {
+		var c = decoded[i]
+		if c <= ' ' {
+			continue
+		}
+		if c == ':' {
+			break
+		}
+		scheme.WriteByte(c)
+	}
+	switch strings.ToLower(scheme.String()) {
+	case "javascript", "vbscript", "livescript":
+		return true
+	case "data":
+		var lowerValue = strings.ToLower(decoded)
+		return strings.Contains(lowerValue, "text/html") ||
+			strings.Contains(lowerValue, "svg") ||
+			strings.Contains(lowerValue, "javascript") ||
+			strings.Contains(lowerValue, "xml")
+	}
+	return false
+}
+
+// 常用的命名字符实体
+var htmlNamedEntities = map[string]string{
+	"colon":   ":",
+	"tab":     "\t",
+	"newline": "\n",
+	"lpar":    "(",
+	"rpar":    ")",
+	"amp":     "&",
+	"lt":      "<",
+	"gt":      ">",
+	"quot":    "\"",
+	"apos":    "'",
+	"sol":     "/",
+}
+
+// 解码字符实体，比如 &#106;、&#x6A;、&colon;，结尾的分号可以省略
+func decodeHTMLEntities(s string) string {
+	if strings.IndexByte(s, '&') < 0 {
+		return s
+	}
+
+	var builder = strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '&' {
+			builder.WriteByte(s[i])
+			continue
+		}
+
+		var j = i + 1
+		if j < len(s) && s[j] == '#' {
+			j++
+			var base = 10
+			if j < len(s) && (s[j] == 'x' || s[j] == 'X') {
+				base = 16
+				j++
+			}
+			var start = j
+			for j < len(s) && ((s[j] >= '0' && s[j] <= '9') || (base == 16 && isHTMLHexLetter(s[j]))) {
+				j++
+			}
+			code, err := strconv.ParseInt(s[start:j], base, 32)
+			if err != nil || start == j {
+				builder.WriteByte(s[i])
+				continue
+			}
+			builder.WriteRune(rune(code))
+		} else {
+			for j < len(s) && isHTMLLetter(s[j]) {
+				j++
+			}
+			value, ok := htmlNamedEntities[strings.ToLower(s[i+1:j])]
+			if !ok {
+				builder.WriteByte(s[i])
+				continue
+			}
+			builder.WriteString(value)
+		}
+		if j < len(s) && s[j] == ';' {
+			j++
+		}
+		i = j - 1
+	}
+	return builder.String()
+}
+
+func isHTMLLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHTMLHexLetter(c byte) bool {
+	return (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package injectionutils
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"runtime"
+	"testing"
+)
+
+func TestDetectXSS(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	for _, s := range []string{
+		"<script>alert(1)</script>",
+		"<ScRiPt src=//a.com/x.js>",
+		"<scr\x00ipt>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"<IMG SRC=x OnError='alert(1)'>",
+		"<svg/onload=alert(1)>",
+		"<body onpageshow=alert(1)>",
+		"<a href=\"javascript:alert(1)\">x</a>",
+		"<a href='jav&#x09;ascript:alert(1)'>x</a>",
+		"<a href=&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;&#58;alert(1)>x</a>",
+		"<a href=\"javascript&colon;alert(1)\">x</a>",
+		"<iframe src=//a.com>",
+		"<object data=x>",
+		"<embed src=x>",
+		"<meta http-equiv=refresh content=0>",
+		"<div style=\"width: expression(alert(1))\">",
+		"<iframe srcdoc=\"&lt;script&gt;alert(1)&lt;/script&gt;\">",
+		"<a href=\"data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==\">x</a>",
+		"<!--[if gte IE 4]><script>alert(1)</script><![endif]-->",
+		"\"><script>alert(1)</script>",
+		"\" onmouseover=\"alert(1)",
+		"' onfocus='alert(1)' autofocus '",
+		"x onclick=alert(1)",
+		"javascript:alert(1)",
+		"JaVaScRiPt:alert(1)",
+		"vbscript:msgbox(1)",
+	} {
+		if !DetectXSS(s) {
+			t.Log("expected xss:", s)
+			a.IsTrue(false)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"hello",
+		"a < b",
+		"a<b and c>d",
+		"1 <2",
+		"<b>bold</b>",
+		"<p class=\"intro\">Hello</p>",
+		"<a href=\"https://goedge.cn/\">GoEdge</a>",
+		"<img src=\"/images/logo.png\" alt=\"logo\">",
+		"John O'Brien",
+		"Say \"hello\"",
+		"name=lu&age=20",
+		"https://example.com/path?q=1",
+		"data:image/png;base64,iVBORw0KGgo=",
+		"online=1",
+		"one=two",
+		"time: 10:00",
+		"<!-- comment -->",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/107.0.0.0 Safari/537.36",
+	} {
+		if DetectXSS(s) {
+			t.Log("unexpected xss:", s)
+			a.IsTrue(false)
+		}
+	}
+}
+
+func TestDetectXSSValue(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsFalse(DetectXSSValue(nil))
+	a.IsFalse(DetectXSSValue("name=lu&age=20"))
+	a.IsTrue(DetectXSSValue("name=%3Cscript%3Ealert(1)%3C%2Fscript%3E"))
+	a.IsTrue(DetectXSSValue("q=%22+onmouseover%3D%22alert(1)"))
+	a.IsTrue(DetectXSSValue([]byte("<svg/onload=alert(1)>")))
+	a.IsTrue(DetectXSSValue(map[string]interface{}{
+		"comments": []interface{}{"hello", "<img src=x onerror=alert(1)>"},
+	}))
+	a.IsFalse(DetectXSSValue(map[string]interface{}{
+		"comment": "<b>hello</b>",
+	}))
+}
+
+func TestDecodeHTMLEntities(t *testing.T) {
+	var a = assert.NewAssertion(t)
+	a.IsTrue(decodeHTMLEntities("hello") == "hello")
+	a.IsTrue(decodeHTMLEntities("&#106;&#x61;&#X76;a") == "java")
+	a.IsTrue(decodeHTMLEntities("&#0000106&#0000097") == "ja")
+	a.IsTrue(decodeHTMLEntities("a&colon;b&Tab;c") == "a:b\tc")
+	a.IsTrue(decodeHTMLEntities("a&unknown;b&#;c") == "a&unknown;b&#;c")
+}
+
+func BenchmarkDetectXSS(b *testing.B) {
+	runtime.GOMAXPROCS(1)
+
+	for i := 0; i < b.N; i++ {
+		_ = DetectXSS("/hello/world?name=lu&age=20&desc=<b>It's a nice day</b>")
+	}
+}
+
+func BenchmarkDetectXSS_Attack(b *testing.B) {
+	runtime.GOMAXPROCS(1)
+
+	for i := 0; i < b.N; i++ {
+		_ = DetectXSS("<a href='jav&#x09;ascript:alert(1)'>x</a>")
+	}
+}
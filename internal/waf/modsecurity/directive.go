@@ -0,0 +1,107 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package modsecurity
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Directive 配置文件中的一条指令，比如 SecRule ARGS "@rx ..." "id:1,deny"
+type Directive struct {
+	Name string   // 指令名，比如 SecRule
+	Args []string // 参数，已经去掉了两边的引号
+	File string   // 所在文件
+	Line int      // 所在行，从1开始
+}
+
+// ParseDirectives 分析配置文件中的所有指令
+// 支持 # 注释、行尾的 \ 续行和双引号参数
+func ParseDirectives(file string, data []byte) ([]*Directive, error) {
+	var result = []*Directive{}
+
+	var lines = strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	var buf = strings.Builder{}
+	var startLine = 0
+	for index, line := range lines {
+		var trimmedLine = strings.TrimSpace(line)
+
+		// 注释只在指令开始时有效
+		if buf.Len() == 0 && (len(trimmedLine) == 0 || trimmedLine[0] == '#') {
+			continue
+		}
+		if buf.Len() == 0 {
+			startLine = index + 1
+		}
+
+		// 续行
+		if strings.HasSuffix(trimmedLine, "\\") && !strings.HasSuffix(trimmedLine, "\\\\") {
+			buf.WriteString(strings.TrimSuffix(trimmedLine, "\\"))
+			buf.WriteString(" ")
+			continue
+		}
+		buf.WriteString(trimmedLine)
+
+		directive, err := parseDirectiveLine(buf.String())
+		if err != nil {
+			return nil, errors.New(file + ":" + strconv.Itoa(startLine) + ": " + err.Error())
+		}
+		buf.Reset()
+		if directive == nil {
+			continue
+		}
+		directive.File = file
+		directive.Line = startLine
+		result = append(result, directive)
+	}
+
+	if buf.Len() > 0 {
+		return nil, errors.New(file + ":" + strconv.Itoa(startLine) + ": unexpected end of file")
+	}
+
+	return result, nil
+}
+
+// 分析单条指令
+func parseDirectiveLine(line string) (*Directive, error) {
+	var tokens = []string{}
+	var token = strings.Builder{}
+	var hasToken = false
+	var inQuote = false
+
+	for i := 0; i < len(line); i++ {
+		var c = line[i]
+		switch {
+		case inQuote && c == '\\' && i+1 < len(line) && line[i+1] == '"':
+			token.WriteByte('"')
+			i++
+		case c == '"':
+			inQuote = !inQuote
+			hasToken = true
+		case !inQuote && (c == ' ' || c == '\t'):
+			if hasToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				hasToken = false
+			}
+		default:
+			token.WriteByte(c)
+			hasToken = true
+		}
+	}
+	if inQuote {
+		return nil, errors.New("unterminated quoted string")
+	}
+	if hasToken {
+		tokens = append(tokens, token.String())
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return &Directive{
+		Name: tokens[0],
+		Args: tokens[1:],
+	}, nil
+}
@@ -0,0 +1,580 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package modsecurity
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 链接规则展开后最多可以生成的规则集数量
+const maxChainRuleSets = 16
+
+// 导入时需要跳过整条规则的动作
+var unsupportedActions = map[string]bool{
+	"skip":      true,
+	"skipafter": true,
+	"ctl":       true,
+	"exec":      true,
+	"redirect":  true,
+	"proxy":     true,
+	"pause":     true,
+}
+
+// 导入时忽略但需要提示的动作
+var ignoredActions = map[string]bool{
+	"setvar":          true,
+	"expirevar":       true,
+	"initcol":         true,
+	"setenv":          true,
+	"setuid":          true,
+	"setsid":          true,
+	"sanitisearg":     true,
+	"sanitisematched": true,
+	"append":          true,
+	"prepend":         true,
+}
+
+// Issue 导入过程中遇到的问题
+type Issue struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	RuleId    int64  `json:"ruleId"`
+	Message   string `json:"message"`
+	IsSkipped bool   `json:"isSkipped"` // 整条规则是否因此被跳过
+}
+
+func (this *Issue) String() string {
+	var s = this.File + ":" + strconv.Itoa(this.Line)
+	if this.RuleId > 0 {
+		s += " [id " + types.String(this.RuleId) + "]"
+	}
+	s += " " + this.Message
+	if this.IsSkipped {
+		s += " (skipped)"
+	}
+	return s
+}
+
+// Importer 将ModSecurity规则文件（比如OWASP CRS）转换为WAF规则分组
+// 每个文件按照请求阶段和响应阶段分别生成一个分组
+type Importer struct {
+	DefaultAction string // 规则中使用 block 或者没有中断动作时使用的动作：deny、pass，文件中的 SecDefaultAction 会覆盖此设置
+
+	groups        []*waf.RuleGroup
+	groupMap      map[string]*waf.RuleGroup // code => group
+	issues        []*Issue
+	countRules    int
+	countImported int
+	maxSetId      int64 // 已分配的最大规则集ID
+
+	defaultAction string // 当前使用的默认动作
+}
+
+func NewImporter() *Importer {
+	return &Importer{
+		DefaultAction: "deny",
+		groupMap:      map[string]*waf.RuleGroup{},
+	}
+}
+
+// ImportFile 导入规则文件
+// 规则中引用的文件（比如 @pmFromFile）相对于规则文件所在目录
+func (this *Importer) ImportFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var dir = filepath.Dir(path)
+	return this.importData(path, data, func(file string) ([]byte, error) {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		return os.ReadFile(file)
+	})
+}
+
+// ImportData 导入规则内容
+// 规则中引用的文件相对于当前工作目录
+func (this *Importer) ImportData(filename string, data []byte) error {
+	return this.importData(filename, data, os.ReadFile)
+}
+
+// Groups 导入的规则分组
+func (this *Importer) Groups() []*waf.RuleGroup {
+	return this.groups
+}
+
+// Issues 导入过程中遇到的问题
+func (this *Importer) Issues() []*Issue {
+	return this.issues
+}
+
+// CountRules 读取到的规则数量，链接的规则算作一条
+func (this *Importer) CountRules() int {
+	return this.countRules
+}
+
+// CountImportedRules 成功导入的规则数量
+func (this *Importer) CountImportedRules() int {
+	return this.countImported
+}
+
+// Apply 将导入的分组添加到WAF策略中
+// 策略中已有同样代号的分组会被替换，以便于重复导入新版本的规则
+// 导入的规则集会在策略已有规则集ID的基础上重新编号，防止ID冲突
+func (this *Importer) Apply(w *waf.WAF) {
+	var maxGroupId int64
+	var maxSetId int64
+	for _, group := range append(append([]*waf.RuleGroup{}, w.Inbound...), w.Outbound...) {
+		if group.Id > maxGroupId {
+			maxGroupId = group.Id
+		}
+		for _, set := range group.RuleSets {
+			if set.Id > maxSetId {
+				maxSetId = set.Id
+			}
+		}
+	}
+
+	for _, group := range this.groups {
+		var oldGroup = w.FindRuleGroupWithCode(group.Code)
+		if oldGroup != nil {
+			group.Id = oldGroup.Id
+			w.RemoveRuleGroup(oldGroup.Id)
+		} else {
+			maxGroupId++
+			group.Id = maxGroupId
+		}
+		for _, set := range group.RuleSets {
+			maxSetId++
+			set.Id = maxSetId
+		}
+		w.AddRuleGroup(group)
+	}
+}
+
+func (this *Importer) importData(filename string, data []byte, readFile func(path string) ([]byte, error)) error {
+	directives, err := ParseDirectives(filename, data)
+	if err != nil {
+		return err
+	}
+
+	// SecDefaultAction 对之后导入的所有文件都有效
+	if len(this.defaultAction) == 0 {
+		this.defaultAction = this.DefaultAction
+	}
+
+	var head, tail *SecRule
+	for _, directive := range directives {
+		if head != nil && !strings.EqualFold(directive.Name, "SecRule") {
+			this.addIssue(head, "chain is not completed", true)
+			head, tail = nil, nil
+		}
+
+		switch strings.ToLower(directive.Name) {
+		case "secrule":
+			rule, err := ParseSecRule(directive)
+			if err != nil {
+				this.issues = append(this.issues, &Issue{
+					File:      directive.File,
+					Line:      directive.Line,
+					Message:   err.Error(),
+					IsSkipped: true,
+				})
+				if head != nil {
+					this.addIssue(head, "chain is broken", true)
+					head, tail = nil, nil
+				}
+				continue
+			}
+			if head == nil {
+				head = rule
+			} else {
+				tail.Chain = rule
+			}
+			tail = rule
+			if rule.HasAction("chain") {
+				continue
+			}
+			this.importRule(head, readFile)
+			head, tail = nil, nil
+		case "secdefaultaction":
+			if len(directive.Args) == 0 {
+				continue
+			}
+			actions, err := ParseActions(directive.Args[0])
+			if err != nil {
+				this.issues = append(this.issues, &Issue{
+					File:    directive.File,
+					Line:    directive.Line,
+					Message: "SecDefaultAction: " + err.Error(),
+				})
+				continue
+			}
+			for _, action := range actions {
+				switch action.Name {
+				case "deny", "drop", "pass":
+					this.defaultAction = action.Name
+				}
+			}
+		case "secmarker", "seccomponentsignature":
+			// 不影响规则匹配
+		default:
+			this.issues = append(this.issues, &Issue{
+				File:    directive.File,
+				Line:    directive.Line,
+				Message: "directive '" + directive.Name + "' is not supported",
+			})
+		}
+	}
+	if head != nil {
+		this.addIssue(head, "chain is not completed", true)
+	}
+
+	return nil
+}
+
+// 导入单条规则及其链接的规则
+func (this *Importer) importRule(rule *SecRule, readFile func(path string) ([]byte, error)) {
+	this.countRules++
+
+	var id = rule.Id()
+	if id <= 0 {
+		this.addIssue(rule, "rule id is missing", true)
+		return
+	}
+
+	// 阶段
+	var isInbound = true
+	var phaseAction = rule.FindAction("phase")
+	if phaseAction != nil {
+		switch strings.ToLower(phaseAction.Value) {
+		case "1", "2", "request":
+			isInbound = true
+		case "3", "4", "response":
+			isInbound = false
+		default:
+			this.addIssue(rule, "phase '"+phaseAction.Value+"' is not supported", true)
+			return
+		}
+	}
+
+	// 动作
+	var score = 0
+	for _, link := range rule.Rules() {
+		for _, action := range link.Actions {
+			if unsupportedActions[action.Name] {
+				this.addIssue(rule, "action '"+action.Name+"' is not supported", true)
+				return
+			}
+
+			// 异常评分
+			if action.Name == "setvar" {
+				setvarScore, ok := mapAnomalyScore(action.Value)
+				if ok {
+					if setvarScore > score {
+						score = setvarScore
+					}
+					continue
+				}
+			}
+
+			if ignoredActions[action.Name] {
+				this.addIssue(rule, "action '"+action.Name+"' is ignored", false)
+			}
+		}
+	}
+	actionCode, actionOptions := this.mapDisruptiveAction(rule)
+
+	// 规则
+	var linkRules = [][]*waf.Rule{}
+	var countSets = 1
+	for _, link := range rule.Rules() {
+		rules, ok := this.mapRules(rule, link, isInbound, readFile)
+		if !ok {
+			return
+		}
+		linkRules = append(linkRules, rules)
+		countSets *= len(rules)
+	}
+
+	var sets = []*waf.RuleSet{}
+	if len(linkRules) == 1 {
+		var set = this.newRuleSet(rule, id, "")
+		set.Connector = waf.RuleConnectorOr
+		set.Rules = linkRules[0]
+		sets = append(sets, set)
+	} else {
+		if countSets > maxChainRuleSets {
+			this.addIssue(rule, "chain expands to "+strconv.Itoa(countSets)+" rule sets, exceeds the limit "+strconv.Itoa(maxChainRuleSets), true)
+			return
+		}
+
+		// 链接的规则之间是 and 关系，单个规则中的多个变量之间是 or 关系，所以需要展开为多个规则集
+		for index, rules := range product(linkRules) {
+			var suffix = ""
+			if index > 0 {
+				suffix = "-" + strconv.Itoa(index+1)
+			}
+			var set = this.newRuleSet(rule, id, suffix)
+			set.Connector = waf.RuleConnectorAnd
+			set.Rules = rules
+			sets = append(sets, set)
+		}
+	}
+
+	// 只记录而不阻止的规则在异常评分模式下不计分
+	if score == 0 && actionCode == waf.ActionTag {
+		score = -1
+	}
+	for _, set := range sets {
+		set.Score = score
+		set.AddAction(actionCode, actionOptions)
+	}
+
+	var group = this.findGroup(rule.File, isInbound, this.paranoiaLevel(rule))
+	for _, set := range sets {
+		group.AddRuleSet(set)
+	}
+	this.countImported++
+}
+
+// 将规则中的变量和操作符转换为WAF规则
+func (this *Importer) mapRules(rule *SecRule, link *SecRule, isInbound bool, readFile func(path string) ([]byte, error)) ([]*waf.Rule, bool) {
+	operator, err := mapOperator(link.Operator, readFile)
+	if err != nil {
+		this.addIssue(rule, err.Error(), true)
+		return nil, false
+	}
+
+	// 转换函数
+	var filters = []*waf.ParamFilter{}
+	var isCaseInsensitive = operator.IsCaseInsensitive
+	for _, action := range link.FindActions("t") {
+		var name = strings.ToLower(action.Value)
+		if name == "none" {
+			filters = []*waf.ParamFilter{}
+			isCaseInsensitive = operator.IsCaseInsensitive
+			continue
+		}
+		if name == "lowercase" {
+			isCaseInsensitive = true
+			continue
+		}
+		filterCode, ok := transformationFilters[name]
+		if ok {
+			filters = append(filters, &waf.ParamFilter{Code: filterCode})
+			continue
+		}
+		if !ignoredTransformations[name] {
+			this.addIssue(rule, "transformation 't:"+action.Value+"' is ignored", false)
+		}
+	}
+
+	var result = []*waf.Rule{}
+	for _, variable := range link.Variables {
+		if variable.IsExclusion {
+			this.addIssue(rule, "exclusion '"+variable.String()+"' is ignored", false)
+			continue
+		}
+		params, err := mapVariable(variable)
+		if err != nil {
+			this.addIssue(rule, err.Error(), false)
+			continue
+		}
+		for _, param := range params {
+			if param.IsResponse && isInbound {
+				this.addIssue(rule, "variable '"+variable.String()+"' is not available in request phase", false)
+				continue
+			}
+
+			var paramFilters = []*waf.ParamFilter{}
+			if param.NeedDecode && (len(filters) == 0 || filters[0].Code != "urlDecode") {
+				paramFilters = append(paramFilters, &waf.ParamFilter{Code: "urlDecode"})
+			}
+			for _, filter := range filters {
+				paramFilters = append(paramFilters, &waf.ParamFilter{Code: filter.Code})
+			}
+
+			var wafRule = &waf.Rule{
+				Description:       variable.String() + " " + link.Operator.String(),
+				Param:             param.Param,
+				ParamFilters:      paramFilters,
+				Operator:          operator.Operator,
+				Value:             operator.Value,
+				IsCaseInsensitive: isCaseInsensitive,
+			}
+
+			// 检查规则是否可用
+			var testRule = *wafRule
+			err = testRule.Init()
+			if err != nil {
+				this.addIssue(rule, "invalid rule for '"+variable.String()+"': "+err.Error(), true)
+				return nil, false
+			}
+
+			result = append(result, wafRule)
+		}
+	}
+
+	if len(result) == 0 {
+		this.addIssue(rule, "no supported variables", true)
+		return nil, false
+	}
+	return result, true
+}
+
+// 转换中断动作
+func (this *Importer) mapDisruptiveAction(rule *SecRule) (code string, options maps.Map) {
+	var disruptive = ""
+	var statusCode = 0
+	for _, link := range rule.Rules() {
+		for _, action := range link.Actions {
+			switch action.Name {
+			case "deny", "drop", "block", "pass", "allow":
+				disruptive = action.Name
+			case "status":
+				statusCode = types.Int(action.Value)
+			}
+		}
+	}
+	if len(disruptive) == 0 || disruptive == "block" {
+		disruptive = this.defaultAction
+	}
+
+	switch disruptive {
+	case "deny", "drop":
+		options = maps.Map{}
+		if statusCode > 0 {
+			options["statusCode"] = statusCode
+		} else {
+			options["statusCode"] = 403
+		}
+		return waf.ActionBlock, options
+	case "allow":
+		return waf.ActionAllow, nil
+	}
+
+	// pass 只记录匹配的规则，继续匹配其他规则
+	return waf.ActionTag, maps.Map{
+		"tags": []string{"modsecurity-" + types.String(rule.Id())},
+	}
+}
+
+// 创建规则集
+// 同一个链接规则展开的多个规则集需要使用不同的ID，所以不能直接使用规则ID，规则ID保留在代号和描述中
+func (this *Importer) newRuleSet(rule *SecRule, id int64, codeSuffix string) *waf.RuleSet {
+	this.maxSetId++
+
+	var set = waf.NewRuleSet()
+	set.Id = this.maxSetId
+	set.Code = "modsecurity-" + types.String(id) + codeSuffix
+	set.IsOn = true
+
+	var msgAction = rule.FindAction("msg")
+	if msgAction != nil && len(msgAction.Value) > 0 {
+		set.Name = msgAction.Value
+	} else {
+		set.Name = "ModSecurity rule " + types.String(id)
+	}
+
+	var descriptions = []string{"ModSecurity rule " + types.String(id) + " (" + filepath.Base(rule.File) + ":" + strconv.Itoa(rule.Line) + ")"}
+	var severityAction = rule.FindAction("severity")
+	if severityAction != nil {
+		descriptions = append(descriptions, "severity: "+severityAction.Value)
+	}
+	var tags = []string{}
+	for _, tagAction := range rule.FindActions("tag") {
+		tags = append(tags, tagAction.Value)
+	}
+	if len(tags) > 0 {
+		descriptions = append(descriptions, "tags: "+strings.Join(tags, ", "))
+	}
+	set.Description = strings.Join(descriptions, "; ")
+
+	return set
+}
+
+// 规则的偏执级别，从 paranoia-level/N 标签中读取，默认为1
+func (this *Importer) paranoiaLevel(rule *SecRule) int {
+	for _, tagAction := range rule.FindActions("tag") {
+		if strings.HasPrefix(tagAction.Value, "paranoia-level/") {
+			var level = types.Int(strings.TrimPrefix(tagAction.Value, "paranoia-level/"))
+			if level > 1 {
+				return level
+			}
+		}
+	}
+	return 1
+}
+
+// 查找或创建文件对应的分组
+// 偏执级别大于1的规则放在单独的分组中，以便于在异常评分模式下按照级别启用
+func (this *Importer) findGroup(file string, isInbound bool, paranoiaLevel int) *waf.RuleGroup {
+	var name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	var code = "modsecurity:" + name
+	if !isInbound {
+		code += ":outbound"
+	}
+	if paranoiaLevel > 1 {
+		code += ":pl" + strconv.Itoa(paranoiaLevel)
+		name += " (PL" + strconv.Itoa(paranoiaLevel) + ")"
+	}
+
+	group, ok := this.groupMap[code]
+	if ok {
+		return group
+	}
+
+	group = waf.NewRuleGroup()
+	group.Code = code
+	group.Name = name
+	group.Description = "Imported from ModSecurity rule file '" + filepath.Base(file) + "'"
+	group.IsInbound = isInbound
+	if paranoiaLevel > 1 {
+		group.ParanoiaLevel = paranoiaLevel
+	}
+	this.groupMap[code] = group
+	this.groups = append(this.groups, group)
+	return group
+}
+
+func (this *Importer) addIssue(rule *SecRule, message string, isSkipped bool) {
+	this.issues = append(this.issues, &Issue{
+		File:      rule.File,
+		Line:      rule.Line,
+		RuleId:    rule.Id(),
+		Message:   message,
+		IsSkipped: isSkipped,
+	})
+}
+
+// 计算多组规则的笛卡尔积
+func product(lists [][]*waf.Rule) [][]*waf.Rule {
+	var result = [][]*waf.Rule{{}}
+	for _, list := range lists {
+		var newResult = [][]*waf.Rule{}
+		for _, prefix := range result {
+			for _, rule := range list {
+				var item = append(append([]*waf.Rule{}, prefix...), rule)
+				newResult = append(newResult, item)
+			}
+		}
+		result = newResult
+	}
+
+	// 每个规则集需要使用独立的规则对象
+	for index, rules := range result {
+		for ruleIndex, rule := range rules {
+			var newRule = *rule
+			result[index][ruleIndex] = &newRule
+		}
+	}
+	return result
+}
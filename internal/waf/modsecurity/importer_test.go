@@ -0,0 +1,240 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package modsecurity
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"testing"
+)
+
+var testRules = `
+SecDefaultAction "phase:2,log,auditlog,deny,status:403"
+
+SecRule REQUEST_HEADERS:User-Agent "@pm nikto sqlmap" \
+    "id:913100,phase:1,t:none,msg:'Found User-Agent associated with security scanner',severity:'CRITICAL',tag:'attack-reputation-scanner',block"
+
+SecRule ARGS "@rx (?i)<script[^>]*>" \
+    "id:941110,phase:2,t:none,t:urlDecodeUni,msg:'XSS Filter - Category 1',block"
+
+SecRule REQUEST_METHOD "@streq POST" \
+    "id:920100,phase:2,deny,status:405,chain"
+    SecRule REQUEST_HEADERS:Content-Type "@contains text/xml"
+
+SecRule REQUEST_URI "@beginsWith /healthz" "id:900100,phase:1,pass,nolog"
+
+SecRule &ARGS "@gt 255" "id:920380,phase:2,block"
+
+SecRule ARGS "@rx abc" "id:930000,phase:2,block,skipAfter:END"
+
+SecRule RESPONSE_BODY "@contains Fatal error" "id:951100,phase:4,block"
+
+SecRule ARGS "@detectSQLi" "id:942100,phase:2,block"
+
+SecMarker END
+SecAction "id:900000,phase:1,nolog,pass,setvar:tx.paranoia_level=1"
+`
+
+func TestImporter_ImportData(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var importer = NewImporter()
+	err := importer.ImportData("REQUEST-901-TEST.conf", []byte(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range importer.Issues() {
+		t.Log(issue.String())
+	}
+
+	a.IsTrue(importer.CountRules() == 8)
+	a.IsTrue(importer.CountImportedRules() == 6)
+
+	var groups = importer.Groups()
+	a.IsTrue(len(groups) == 2)
+	a.IsTrue(groups[0].Code == "modsecurity:REQUEST-901-TEST")
+	a.IsTrue(groups[0].IsInbound)
+	a.IsTrue(len(groups[0].RuleSets) == 5)
+	a.IsTrue(groups[1].Code == "modsecurity:REQUEST-901-TEST:outbound")
+	a.IsFalse(groups[1].IsInbound)
+
+	// @pm
+	var scannerSet = groups[0].FindRuleSetWithCode("modsecurity-913100")
+	a.IsNotNil(scannerSet)
+	a.IsTrue(scannerSet.Name == "Found User-Agent associated with security scanner")
+	a.IsTrue(scannerSet.Rules[0].Param == "${header.User-Agent}")
+	a.IsTrue(scannerSet.Rules[0].Operator == waf.RuleOperatorContainsAny)
+	a.IsTrue(scannerSet.Actions[0].Code == waf.ActionBlock)
+
+	// ARGS => 两个参数
+	var xssSet = groups[0].FindRuleSetWithCode("modsecurity-941110")
+	a.IsNotNil(xssSet)
+	a.IsTrue(xssSet.Connector == waf.RuleConnectorOr)
+	a.IsTrue(len(xssSet.Rules) == 2)
+	a.IsTrue(len(xssSet.Rules[0].ParamFilters) == 1)
+
+	// chain
+	var chainSet = groups[0].FindRuleSetWithCode("modsecurity-920100")
+	a.IsNotNil(chainSet)
+	a.IsTrue(chainSet.Connector == waf.RuleConnectorAnd)
+	a.IsTrue(len(chainSet.Rules) == 2)
+	a.IsTrue(chainSet.Actions[0].Options.GetInt("statusCode") == 405)
+
+	// @detectSQLi
+	var sqliSet = groups[0].FindRuleSetWithCode("modsecurity-942100")
+	a.IsNotNil(sqliSet)
+	a.IsTrue(sqliSet.Rules[0].Operator == waf.RuleOperatorDetectSQLInjection)
+
+	// pass
+	var passSet = groups[0].FindRuleSetWithCode("modsecurity-900100")
+	a.IsNotNil(passSet)
+	a.IsTrue(passSet.Actions[0].Code == waf.ActionTag)
+}
+
+func TestImporter_Apply(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var importer = NewImporter()
+	err := importer.ImportData("test.conf", []byte(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var w = waf.NewWAF()
+	var group = waf.NewRuleGroup()
+	group.Id = 10
+	group.Code = "modsecurity:test"
+	group.IsInbound = true
+	w.AddRuleGroup(group)
+
+	importer.Apply(w)
+	a.IsTrue(len(w.Inbound) == 1)
+	a.IsTrue(w.Inbound[0].Id == 10)
+	a.IsTrue(len(w.Outbound) == 1)
+	a.IsTrue(w.Outbound[0].Id == 11)
+
+	errs := w.Init()
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	for _, u := range []string{"http://teaos.cn/hello?name=%3Cscript%3Ealert(1)%3C/script%3E", "http://teaos.cn/hello?name=lu"} {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, _, set, err := w.MatchRequest(requests.NewTestRequest(req), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if set != nil {
+			t.Log(u, "=>", set.Code)
+		} else {
+			t.Log(u, "=>", "not matched")
+		}
+		a.IsTrue((set != nil) == (u != "http://teaos.cn/hello?name=lu"))
+	}
+}
+
+func TestImporter_Apply_SetIds(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var importer = NewImporter()
+	err := importer.ImportData("test.conf", []byte(`
+SecRule ARGS|REQUEST_HEADERS "@rx abc" "id:920100,phase:2,deny,chain"
+    SecRule REQUEST_METHOD "@streq POST"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 链接规则展开的规则集ID不能重复
+	var setIds = map[int64]bool{}
+	for _, set := range importer.Groups()[0].RuleSets {
+		a.IsFalse(setIds[set.Id])
+		setIds[set.Id] = true
+	}
+	a.IsTrue(len(setIds) == 2)
+
+	// 合并到已有的策略中
+	var w = waf.NewWAF()
+	var group = waf.NewRuleGroup()
+	group.Id = 1
+	group.Code = "custom"
+	group.IsInbound = true
+	var set = waf.NewRuleSet()
+	set.Id = 1
+	set.Code = "custom"
+	group.AddRuleSet(set)
+	w.AddRuleGroup(group)
+
+	importer.Apply(w)
+	setIds = map[int64]bool{}
+	for _, group := range w.Inbound {
+		for _, set := range group.RuleSets {
+			a.IsFalse(setIds[set.Id])
+			setIds[set.Id] = true
+		}
+	}
+	a.IsTrue(len(setIds) == 3)
+	a.IsTrue(setIds[1])
+}
+
+func TestImporter_AnomalyScoring(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var importer = NewImporter()
+	err := importer.ImportData("REQUEST-942-APPLICATION-ATTACK-SQLI.conf", []byte(`
+SecRule ARGS "@rx (?i)union\s+select" \
+    "id:942100,phase:2,block,t:none,tag:'paranoia-level/1',severity:'CRITICAL',setvar:'tx.sql_injection_score=+%{tx.critical_anomaly_score}',setvar:'tx.inbound_anomaly_score_pl1=+%{tx.critical_anomaly_score}'"
+
+SecRule ARGS "@rx (?i)sleep\(" \
+    "id:942160,phase:2,block,t:none,tag:'paranoia-level/2',setvar:'tx.inbound_anomaly_score_pl2=+%{tx.warning_anomaly_score}'"
+
+SecRule ARGS "@contains --" "id:942440,phase:2,block,tag:'paranoia-level/2',setvar:tx.anomaly_score_pl2=+7"
+
+SecRule REQUEST_URI "@beginsWith /static/" "id:942001,phase:1,pass,nolog"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range importer.Issues() {
+		t.Log(issue.String())
+	}
+
+	var groups = importer.Groups()
+	a.IsTrue(len(groups) == 2)
+	a.IsTrue(groups[0].Code == "modsecurity:REQUEST-942-APPLICATION-ATTACK-SQLI")
+	a.IsTrue(groups[0].ParanoiaLevel == 0)
+	a.IsTrue(groups[1].Code == "modsecurity:REQUEST-942-APPLICATION-ATTACK-SQLI:pl2")
+	a.IsTrue(groups[1].ParanoiaLevel == 2)
+
+	a.IsTrue(groups[0].FindRuleSetWithCode("modsecurity-942100").Score == 5)
+	a.IsTrue(groups[0].FindRuleSetWithCode("modsecurity-942001").Score == -1)
+	a.IsTrue(groups[1].FindRuleSetWithCode("modsecurity-942160").Score == 3)
+	a.IsTrue(groups[1].FindRuleSetWithCode("modsecurity-942440").Score == 7)
+}
+
+func TestMapAnomalyScore(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	for _, testCase := range []struct {
+		setvar string
+		score  int
+		ok     bool
+	}{
+		{"tx.inbound_anomaly_score_pl1=+%{tx.critical_anomaly_score}", 5, true},
+		{"tx.anomaly_score=+%{tx.notice_anomaly_score}", 2, true},
+		{"tx.outbound_anomaly_score_pl1=+4", 4, true},
+		{"tx.sql_injection_score=+%{tx.critical_anomaly_score}", 0, false},
+		{"tx.inbound_anomaly_score_pl1=0", 0, false},
+		{"tx.anomaly_score=+%{tx.unknown_anomaly_score}", 0, false},
+		{"tx.msg=%{rule.msg}", 0, false},
+	} {
+		score, ok := mapAnomalyScore(testCase.setvar)
+		a.IsTrue(score == testCase.score)
+		a.IsTrue(ok == testCase.ok)
+	}
+}
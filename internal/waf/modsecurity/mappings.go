@@ -0,0 +1,281 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package modsecurity
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeNode/internal/waf"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 变量对应的WAF参数
+type paramMapping struct {
+	Param      string // 比如 ${args}
+	NeedDecode bool   // 原始值是否需要URL解码才能和ModSecurity中的值一致
+	IsResponse bool   // 是否为响应参数
+}
+
+// 将变量转换为WAF参数
+// 一个变量可能对应多个参数，比如 ARGS 同时对应URL参数和表单参数
+func mapVariable(variable *Variable) ([]*paramMapping, error) {
+	if variable.IsCount {
+		return nil, errors.New("count of variable '" + variable.String() + "' is not supported")
+	}
+	if variable.IsRegexpKey() {
+		return nil, errors.New("regexp key of variable '" + variable.String() + "' is not supported")
+	}
+
+	var key = variable.Key
+	var hasKey = len(key) > 0
+	switch variable.Name {
+	case "ARGS":
+		if hasKey {
+			return []*paramMapping{{Param: "${arg." + key + "}"}, {Param: "${requestForm." + key + "}"}}, nil
+		}
+		return []*paramMapping{{Param: "${args}", NeedDecode: true}, {Param: "${requestBody}", NeedDecode: true}}, nil
+	case "ARGS_GET":
+		if hasKey {
+			return []*paramMapping{{Param: "${arg." + key + "}"}}, nil
+		}
+		return []*paramMapping{{Param: "${args}", NeedDecode: true}}, nil
+	case "ARGS_POST":
+		if hasKey {
+			return []*paramMapping{{Param: "${requestForm." + key + "}"}}, nil
+		}
+		return []*paramMapping{{Param: "${requestBody}", NeedDecode: true}}, nil
+	case "QUERY_STRING":
+		return []*paramMapping{{Param: "${args}"}}, nil
+	case "REQUEST_BODY":
+		return []*paramMapping{{Param: "${requestBody}"}}, nil
+	case "REQUEST_URI", "REQUEST_URI_RAW":
+		return []*paramMapping{{Param: "${requestURI}"}}, nil
+	case "REQUEST_FILENAME":
+		return []*paramMapping{{Param: "${requestPath}"}}, nil
+	case "REQUEST_METHOD":
+		return []*paramMapping{{Param: "${requestMethod}"}}, nil
+	case "REQUEST_PROTOCOL":
+		return []*paramMapping{{Param: "${proto}"}}, nil
+	case "REMOTE_ADDR":
+		return []*paramMapping{{Param: "${remoteAddr}"}}, nil
+	case "REQUEST_HEADERS":
+		if !hasKey {
+			return []*paramMapping{{Param: "${headers}"}}, nil
+		}
+		if strings.EqualFold(key, "Host") {
+			return []*paramMapping{{Param: "${host}"}}, nil
+		}
+		return []*paramMapping{{Param: "${header." + http.CanonicalHeaderKey(key) + "}"}}, nil
+	case "REQUEST_COOKIES":
+		if hasKey {
+			return []*paramMapping{{Param: "${cookie." + key + "}"}}, nil
+		}
+		return []*paramMapping{{Param: "${cookies}", NeedDecode: true}}, nil
+	case "FILES":
+		return []*paramMapping{{Param: "${requestUpload.name}"}}, nil
+	case "FILES_NAMES":
+		return []*paramMapping{{Param: "${requestUpload.field}"}}, nil
+	case "RESPONSE_STATUS":
+		return []*paramMapping{{Param: "${status}", IsResponse: true}}, nil
+	case "RESPONSE_BODY":
+		return []*paramMapping{{Param: "${responseBody}", IsResponse: true}}, nil
+	case "RESPONSE_HEADERS":
+		if hasKey {
+			return []*paramMapping{{Param: "${responseHeader." + http.CanonicalHeaderKey(key) + "}", IsResponse: true}}, nil
+		}
+	}
+	return nil, errors.New("variable '" + variable.String() + "' is not supported")
+}
+
+// 操作符对应的WAF规则
+type operatorMapping struct {
+	Operator          waf.RuleOperator
+	Value             string
+	IsCaseInsensitive bool
+}
+
+// 将操作符转换为WAF规则操作符
+// readFile 用来读取 @pmFromFile 等操作符中的文件
+func mapOperator(operator *Operator, readFile func(path string) ([]byte, error)) (*operatorMapping, error) {
+	if strings.Contains(operator.Argument, "%{") {
+		return nil, errors.New("macro expansion in operator '" + operator.String() + "' is not supported")
+	}
+
+	var negatedErr = errors.New("negated operator '" + operator.String() + "' is not supported")
+	var arg = operator.Argument
+	var name = strings.ToLower(operator.Name)
+	switch name {
+	case "rx":
+		_, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, errors.New("regexp is not compatible: " + err.Error())
+		}
+		if operator.IsNegated {
+			return &operatorMapping{Operator: waf.RuleOperatorNotMatch, Value: arg}, nil
+		}
+		return &operatorMapping{Operator: waf.RuleOperatorMatch, Value: arg}, nil
+	case "pm":
+		if operator.IsNegated {
+			return nil, negatedErr
+		}
+		return &operatorMapping{Operator: waf.RuleOperatorContainsAny, Value: strings.Join(strings.Fields(arg), "\n"), IsCaseInsensitive: true}, nil
+	case "pmfromfile", "pmf":
+		if operator.IsNegated {
+			return nil, negatedErr
+		}
+		words, err := readWordFiles(arg, readFile)
+		if err != nil {
+			return nil, err
+		}
+		return &operatorMapping{Operator: waf.RuleOperatorContainsAny, Value: strings.Join(words, "\n"), IsCaseInsensitive: true}, nil
+	case "streq":
+		if operator.IsNegated {
+			return &operatorMapping{Operator: waf.RuleOperatorNeqString, Value: arg}, nil
+		}
+		return &operatorMapping{Operator: waf.RuleOperatorEqString, Value: arg}, nil
+	case "contains", "strmatch":
+		if operator.IsNegated {
+			return &operatorMapping{Operator: waf.RuleOperatorNotContains, Value: arg}, nil
+		}
+		return &operatorMapping{Operator: waf.RuleOperatorContains, Value: arg}, nil
+	case "beginswith":
+		if operator.IsNegated {
+			return nil, negatedErr
+		}
+		return &operatorMapping{Operator: waf.RuleOperatorPrefix, Value: arg}, nil
+	case "endswith":
+		if operator.IsNegated {
+			return nil, negatedErr
+		}
+		return &operatorMapping{Operator: waf.RuleOperatorSuffix, Value: arg}, nil
+	case "eq", "gt", "ge", "lt", "le":
+		_, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, errors.New("invalid number '" + arg + "' in operator '" + operator.String() + "'")
+		}
+		var operators = map[string][2]waf.RuleOperator{ // name => [operator, negated operator]
+			"eq": {waf.RuleOperatorEq, waf.RuleOperatorNeq},
+			"gt": {waf.RuleOperatorGt, waf.RuleOperatorLte},
+			"ge": {waf.RuleOperatorGte, waf.RuleOperatorLt},
+			"lt": {waf.RuleOperatorLt, waf.RuleOperatorGte},
+			"le": {waf.RuleOperatorLte, waf.RuleOperatorGt},
+		}
+		var pair = operators[name]
+		if operator.IsNegated {
+			return &operatorMapping{Operator: pair[1], Value: arg}, nil
+		}
+		return &operatorMapping{Operator: pair[0], Value: arg}, nil
+	case "ipmatch", "ipmatchfromfile", "ipmatchf":
+		var ips []string
+		if name == "ipmatch" {
+			ips = strings.Split(arg, ",")
+		} else {
+			words, err := readWordFiles(arg, readFile)
+			if err != nil {
+				return nil, err
+			}
+			ips = words
+		}
+		for index, ip := range ips {
+			ips[index] = strings.TrimSpace(ip)
+		}
+		if operator.IsNegated {
+			return &operatorMapping{Operator: waf.RuleOperatorNotIPRange, Value: strings.Join(ips, "\n")}, nil
+		}
+		return &operatorMapping{Operator: waf.RuleOperatorIPRange, Value: strings.Join(ips, "\n")}, nil
+	case "detectsqli":
+		if operator.IsNegated {
+			return nil, negatedErr
+		}
+		return &operatorMapping{Operator: waf.RuleOperatorDetectSQLInjection}, nil
+	case "detectxss":
+		if operator.IsNegated {
+			return nil, negatedErr
+		}
+		return &operatorMapping{Operator: waf.RuleOperatorDetectXSS}, nil
+	}
+	return nil, errors.New("operator '" + operator.String() + "' is not supported")
+}
+
+// 读取单词列表文件，忽略空行和注释
+func readWordFiles(arg string, readFile func(path string) ([]byte, error)) ([]string, error) {
+	var result = []string{}
+	for _, path := range strings.Fields(arg) {
+		if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+			return nil, errors.New("remote file '" + path + "' is not supported")
+		}
+		if readFile == nil {
+			return nil, errors.New("can not read file '" + path + "'")
+		}
+		data, err := readFile(path)
+		if err != nil {
+			return nil, errors.New("read file '" + path + "' failed: " + err.Error())
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) == 0 || line[0] == '#' {
+				continue
+			}
+			result = append(result, line)
+		}
+	}
+	return result, nil
+}
+
+// ModSecurity转换函数对应的WAF参数过滤器
+// 没有列出的转换函数会被忽略
+var transformationFilters = map[string]string{
+	"urldecode":        "urlDecode",
+	"urldecodeuni":     "urlDecode",
+	"htmlentitydecode": "htmlUnescape",
+	"base64decode":     "base64Decode",
+	"length":           "length",
+	"md5":              "md5",
+	"sha1":             "sha1",
+}
+
+// 不影响匹配结果或者已经通过其他方式实现的转换函数
+var ignoredTransformations = map[string]bool{
+	"none":      true,
+	"lowercase": true, // 使用不区分大小写实现
+}
+
+// CRS中各个严重级别默认的异常分数
+var severityAnomalyScores = map[string]int{
+	"critical": 5,
+	"error":    4,
+	"warning":  3,
+	"notice":   2,
+}
+
+// 从 setvar 中读取累加的异常分数，比如 tx.inbound_anomaly_score_pl1=+%{tx.critical_anomaly_score}
+func mapAnomalyScore(setvar string) (score int, ok bool) {
+	var index = strings.Index(setvar, "=")
+	if index < 0 {
+		return 0, false
+	}
+	var name = strings.ToLower(strings.TrimSpace(setvar[:index]))
+	if !strings.Contains(name, "anomaly_score") {
+		return 0, false
+	}
+	var value = strings.TrimSpace(setvar[index+1:])
+	if !strings.HasPrefix(value, "+") {
+		return 0, false
+	}
+	value = value[1:]
+
+	// 严重级别对应的分数
+	if strings.HasPrefix(value, "%{") && strings.HasSuffix(value, "}") {
+		var macro = strings.TrimPrefix(strings.ToLower(value[2:len(value)-1]), "tx.")
+		score, ok = severityAnomalyScores[strings.TrimSuffix(macro, "_anomaly_score")]
+		return score, ok && strings.HasSuffix(macro, "_anomaly_score")
+	}
+
+	score, err := strconv.Atoi(value)
+	if err != nil || score < 0 {
+		return 0, false
+	}
+	return score, true
+}
@@ -0,0 +1,296 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package modsecurity
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Variable SecRule中的变量，比如 ARGS、REQUEST_HEADERS:User-Agent、!REQUEST_COOKIES:/__utm/
+type Variable struct {
+	Name        string // 变量名，统一转换为大写
+	Key         string // 冒号后的键名
+	IsCount     bool   // 是否以 & 开头，表示数量
+	IsExclusion bool   // 是否以 ! 开头，表示排除
+}
+
+// IsRegexpKey 键名是否为正则表达式，比如 /__utm/
+func (this *Variable) IsRegexpKey() bool {
+	return len(this.Key) >= 2 && strings.HasPrefix(this.Key, "/") && strings.HasSuffix(this.Key, "/")
+}
+
+func (this *Variable) String() string {
+	var s = this.Name
+	if len(this.Key) > 0 {
+		s += ":" + this.Key
+	}
+	if this.IsCount {
+		s = "&" + s
+	}
+	if this.IsExclusion {
+		s = "!" + s
+	}
+	return s
+}
+
+// Operator SecRule中的操作符，比如 @rx、!@streq
+type Operator struct {
+	Name      string // 操作符名，不包含 @
+	Argument  string // 参数
+	IsNegated bool   // 是否以 ! 开头
+}
+
+func (this *Operator) String() string {
+	var s = "@" + this.Name
+	if this.IsNegated {
+		s = "!" + s
+	}
+	return s
+}
+
+// Action SecRule中的动作，比如 id:1、t:lowercase、deny
+type Action struct {
+	Name  string
+	Value string
+}
+
+// SecRule 规则
+type SecRule struct {
+	Variables []*Variable
+	Operator  *Operator
+	Actions   []*Action
+
+	File string
+	Line int
+
+	Chain *SecRule // 链接的下一条规则
+}
+
+// ParseSecRule 从指令中分析规则
+func ParseSecRule(directive *Directive) (*SecRule, error) {
+	if len(directive.Args) < 2 {
+		return nil, errors.New("SecRule should have at least 2 arguments")
+	}
+
+	var rule = &SecRule{
+		File: directive.File,
+		Line: directive.Line,
+	}
+
+	variables, err := parseVariables(directive.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	rule.Variables = variables
+	rule.Operator = parseOperator(directive.Args[1])
+
+	if len(directive.Args) > 2 {
+		actions, err := ParseActions(directive.Args[2])
+		if err != nil {
+			return nil, err
+		}
+		rule.Actions = actions
+	}
+
+	return rule, nil
+}
+
+// Id 规则ID，没有设置时返回0
+func (this *SecRule) Id() int64 {
+	var action = this.FindAction("id")
+	if action == nil {
+		return 0
+	}
+	id, _ := strconv.ParseInt(action.Value, 10, 64)
+	return id
+}
+
+// FindAction 查找某个动作，如果有多个则返回第一个
+func (this *SecRule) FindAction(name string) *Action {
+	for _, action := range this.Actions {
+		if action.Name == name {
+			return action
+		}
+	}
+	return nil
+}
+
+// FindActions 查找某个动作的所有值
+func (this *SecRule) FindActions(name string) []*Action {
+	var result = []*Action{}
+	for _, action := range this.Actions {
+		if action.Name == name {
+			result = append(result, action)
+		}
+	}
+	return result
+}
+
+// HasAction 是否有某个动作
+func (this *SecRule) HasAction(name string) bool {
+	return this.FindAction(name) != nil
+}
+
+// Rules 当前规则及所有链接的规则
+func (this *SecRule) Rules() []*SecRule {
+	var result = []*SecRule{}
+	for rule := this; rule != nil; rule = rule.Chain {
+		result = append(result, rule)
+	}
+	return result
+}
+
+// 分析变量列表，比如 ARGS|!ARGS:foo|&REQUEST_HEADERS:Host
+func parseVariables(s string) ([]*Variable, error) {
+	var result = []*Variable{}
+	for _, piece := range splitVariables(s) {
+		piece = strings.TrimSpace(piece)
+		if len(piece) == 0 {
+			continue
+		}
+
+		var variable = &Variable{}
+		if strings.HasPrefix(piece, "!") {
+			variable.IsExclusion = true
+			piece = piece[1:]
+		}
+		if strings.HasPrefix(piece, "&") {
+			variable.IsCount = true
+			piece = piece[1:]
+		}
+
+		var index = strings.Index(piece, ":")
+		if index >= 0 {
+			variable.Name = strings.ToUpper(piece[:index])
+			variable.Key = strings.Trim(piece[index+1:], "'")
+		} else {
+			variable.Name = strings.ToUpper(piece)
+		}
+		if len(variable.Name) == 0 {
+			return nil, errors.New("invalid variable '" + piece + "'")
+		}
+		result = append(result, variable)
+	}
+	if len(result) == 0 {
+		return nil, errors.New("variables should not be empty")
+	}
+	return result, nil
+}
+
+// 使用 | 分割变量，忽略正则表达式键名中的 |
+func splitVariables(s string) []string {
+	var result = []string{}
+	var start = 0
+	var inRegexp = false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '/':
+			if i > 0 && s[i-1] == '\\' {
+				continue
+			}
+			if inRegexp || (i > 0 && s[i-1] == ':') {
+				inRegexp = !inRegexp
+			}
+		case '|':
+			if !inRegexp {
+				result = append(result, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	result = append(result, s[start:])
+	return result
+}
+
+// 分析操作符，没有 @ 的表示正则表达式
+func parseOperator(s string) *Operator {
+	var operator = &Operator{}
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "!") {
+		operator.IsNegated = true
+		s = strings.TrimSpace(s[1:])
+	}
+	if !strings.HasPrefix(s, "@") {
+		operator.Name = "rx"
+		operator.Argument = s
+		return operator
+	}
+
+	var index = strings.IndexAny(s, " \t")
+	if index < 0 {
+		operator.Name = s[1:]
+		return operator
+	}
+	operator.Name = s[1:index]
+	operator.Argument = strings.TrimSpace(s[index+1:])
+	return operator
+}
+
+// ParseActions 分析动作列表，比如 id:1,phase:2,t:none,msg:'Hello, World'
+func ParseActions(s string) ([]*Action, error) {
+	var result = []*Action{}
+	var piece = strings.Builder{}
+	var inQuote = false
+
+	var addPiece = func() error {
+		var p = strings.TrimSpace(piece.String())
+		piece.Reset()
+		if len(p) == 0 {
+			return nil
+		}
+
+		var action = &Action{}
+		var index = strings.Index(p, ":")
+		if index < 0 {
+			action.Name = strings.ToLower(p)
+		} else {
+			action.Name = strings.ToLower(strings.TrimSpace(p[:index]))
+			var value = strings.TrimSpace(p[index+1:])
+			if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+				value = value[1 : len(value)-1]
+			}
+			action.Value = value
+		}
+		if len(action.Name) == 0 {
+			return errors.New("invalid action '" + p + "'")
+		}
+		result = append(result, action)
+		return nil
+	}
+
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		switch {
+		case inQuote && c == '\\' && i+1 < len(s) && s[i+1] == '\'':
+			piece.WriteByte(c)
+			piece.WriteByte(s[i+1])
+			i++
+		case c == '\'':
+			inQuote = !inQuote
+			piece.WriteByte(c)
+		case c == ',' && !inQuote:
+			err := addPiece()
+			if err != nil {
+				return nil, err
+			}
+		default:
+			piece.WriteByte(c)
+		}
+	}
+	if inQuote {
+		return nil, errors.New("unterminated quoted action value")
+	}
+	err := addPiece()
+	if err != nil {
+		return nil, err
+	}
+
+	// 去掉值中转义的单引号
+	for _, action := range result {
+		action.Value = strings.ReplaceAll(action.Value, "\\'", "'")
+	}
+
+	return result, nil
+}
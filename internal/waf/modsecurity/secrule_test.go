@@ -0,0 +1,64 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package modsecurity
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	directives, err := ParseDirectives("test.conf", []byte(`# comment
+SecRuleEngine On
+
+SecRule REQUEST_HEADERS:User-Agent "@pm nikto sqlmap" \
+    "id:1001,\
+    phase:1,\
+    msg:'Scanner \"detected\"',\
+    deny"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(directives) == 2)
+	a.IsTrue(directives[0].Name == "SecRuleEngine")
+	a.IsTrue(directives[0].Line == 2)
+	a.IsTrue(directives[1].Name == "SecRule")
+	a.IsTrue(directives[1].Line == 4)
+	a.IsTrue(len(directives[1].Args) == 3)
+	a.IsTrue(directives[1].Args[1] == "@pm nikto sqlmap")
+	t.Log(directives[1].Args[2])
+
+	_, err = ParseDirectives("test.conf", []byte(`SecRule ARGS "@rx abc`))
+	a.IsNotNil(err)
+}
+
+func TestParseSecRule(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	directives, err := ParseDirectives("test.conf", []byte(`SecRule ARGS|!ARGS:foo|REQUEST_COOKIES:/^__utm|x$/|&ARGS "!@streq admin" "id:1002,phase:2,t:none,t:lowercase,msg:'Hello, it\'s me',tag:'a',tag:'b',block"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := ParseSecRule(directives[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(rule.Variables) == 4)
+	a.IsTrue(rule.Variables[0].Name == "ARGS")
+	a.IsTrue(rule.Variables[1].IsExclusion && rule.Variables[1].Key == "foo")
+	a.IsTrue(rule.Variables[2].IsRegexpKey())
+	a.IsTrue(rule.Variables[3].IsCount)
+
+	a.IsTrue(rule.Operator.Name == "streq")
+	a.IsTrue(rule.Operator.Argument == "admin")
+	a.IsTrue(rule.Operator.IsNegated)
+
+	a.IsTrue(rule.Id() == 1002)
+	a.IsTrue(rule.FindAction("msg").Value == "Hello, it's me")
+	a.IsTrue(len(rule.FindActions("t")) == 2)
+	a.IsTrue(len(rule.FindActions("tag")) == 2)
+	a.IsTrue(rule.HasAction("block"))
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/types"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// edge-node accesslog 命令输出的日志格式：
+// 1.2.3.4 [02/Jan/2006:15:04:05 +0800] "GET http://example.com/hello?name=lu HTTP/1.1" 200 - 1.23ms
+var accessLogLineRegexp = regexp.MustCompile(`^(\S+) \[[^]]*] "(\S+) (\S+) (\S+)" (\d+) `)
+
+// ParseAccessLog 从节点访问日志中读取请求
+// 每行一条日志，可以是JSON格式的访问日志（pb.HTTPAccessLog），也可以是 edge-node accesslog 命令输出的格式
+func ParseAccessLog(data []byte, source string) ([]*Case, error) {
+	var result = []*Case{}
+	for index, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		var lineSource = source + ":" + strconv.Itoa(index+1)
+
+		var c *Case
+		var err error
+		if line[0] == '{' {
+			c, err = parseJSONAccessLog([]byte(line))
+		} else {
+			c, err = parseTextAccessLog(line)
+		}
+		if err != nil {
+			return nil, errors.New(lineSource + ": " + err.Error())
+		}
+		c.Source = lineSource
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// 分析JSON格式的访问日志
+func parseJSONAccessLog(data []byte) (*Case, error) {
+	var accessLog = &pb.HTTPAccessLog{}
+	err := json.Unmarshal(data, accessLog)
+	if err != nil {
+		return nil, errors.New("decode access log failed: " + err.Error())
+	}
+	if len(accessLog.Host) == 0 {
+		return nil, errors.New("'host' should not be empty")
+	}
+
+	var scheme = accessLog.Scheme
+	if len(scheme) == 0 {
+		scheme = "http"
+	}
+	var c = &Case{
+		Method: accessLog.RequestMethod,
+		URL:    scheme + "://" + accessLog.Host + accessLog.RequestURI,
+		Header: http.Header{},
+		Body:   accessLog.RequestBody,
+	}
+	for k, v := range accessLog.Header {
+		if v != nil {
+			c.Header[http.CanonicalHeaderKey(k)] = v.Values
+		}
+	}
+
+	// 客户端地址
+	var remoteAddr = accessLog.RawRemoteAddr
+	if len(remoteAddr) == 0 {
+		remoteAddr = accessLog.RemoteAddr
+	}
+	if len(remoteAddr) > 0 {
+		c.RemoteAddr = net.JoinHostPort(remoteAddr, types.String(accessLog.RemotePort))
+	}
+
+	// 响应，日志中没有响应内容
+	if accessLog.Status > 0 {
+		c.StatusCode = int(accessLog.Status)
+		c.ResponseHeader = http.Header{}
+		for k, v := range accessLog.SentHeader {
+			if v != nil {
+				c.ResponseHeader[http.CanonicalHeaderKey(k)] = v.Values
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// 分析 edge-node accesslog 命令输出的日志
+func parseTextAccessLog(line string) (*Case, error) {
+	var matches = accessLogLineRegexp.FindStringSubmatch(line)
+	if len(matches) == 0 {
+		return nil, errors.New("invalid access log line")
+	}
+	var remoteAddr = matches[1]
+	if net.ParseIP(remoteAddr) != nil {
+		remoteAddr = net.JoinHostPort(remoteAddr, "0")
+	}
+	return &Case{
+		Method:         matches[2],
+		URL:            matches[3],
+		Header:         http.Header{},
+		RemoteAddr:     remoteAddr,
+		StatusCode:     types.Int(matches[5]),
+		ResponseHeader: http.Header{},
+	}, nil
+}
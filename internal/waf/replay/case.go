@@ -0,0 +1,142 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format 请求文件格式
+type Format = string
+
+const (
+	FormatHAR       Format = "har"       // 浏览器导出的HAR文件
+	FormatCurl      Format = "curl"      // curl命令
+	FormatAccessLog Format = "accesslog" // 节点访问日志
+)
+
+// DefaultRemoteAddr 来源中没有客户端地址时使用的地址
+// 使用文档保留地址，以免被当成局域网IP而忽略
+const DefaultRemoteAddr = "203.0.113.1:12345"
+
+// Case 需要重放的请求
+type Case struct {
+	Source     string // 来源，比如 requests.har#3
+	Method     string
+	URL        string
+	Header     http.Header
+	Body       []byte
+	RemoteAddr string
+
+	StatusCode     int         // 响应状态码，为0表示没有响应
+	ResponseHeader http.Header // 响应Header
+	ResponseBody   []byte      // 响应内容
+
+	Expect string // 期望的结果：pass、block 或者某个动作代号
+}
+
+// NewRequest 构造新的请求
+// 每次调用都会构造新的请求，以便重复读取请求内容
+func (this *Case) NewRequest() (*http.Request, error) {
+	var method = this.Method
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if len(this.Body) > 0 {
+		body = bytes.NewReader(this.Body)
+	}
+	req, err := http.NewRequest(method, this.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range this.Header {
+		if strings.EqualFold(k, "Host") {
+			if len(v) > 0 && len(v[0]) > 0 {
+				req.Host = v[0]
+			}
+			continue
+		}
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+
+	req.RemoteAddr = this.RemoteAddr
+	if len(req.RemoteAddr) == 0 {
+		req.RemoteAddr = DefaultRemoteAddr
+	}
+	return req, nil
+}
+
+// NewResponse 构造响应，没有响应时返回nil
+func (this *Case) NewResponse(req *http.Request) *http.Response {
+	if this.StatusCode <= 0 {
+		return nil
+	}
+	var header = this.ResponseHeader
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        http.StatusText(this.StatusCode),
+		StatusCode:    this.StatusCode,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(this.ResponseBody)),
+		ContentLength: int64(len(this.ResponseBody)),
+		Request:       req,
+	}
+}
+
+// ParseFile 从文件中读取请求
+// format 为空时根据文件扩展名和内容自动判断格式
+func ParseFile(path string, format Format) ([]*Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(format) == 0 {
+		format = DetectFormat(path, data)
+	}
+
+	var source = filepath.Base(path)
+	switch format {
+	case FormatHAR:
+		return ParseHAR(data, source)
+	case FormatCurl:
+		return ParseCurl(data, source)
+	case FormatAccessLog:
+		return ParseAccessLog(data, source)
+	}
+	return nil, errors.New("unknown format '" + format + "', should be one of 'har', 'curl' and 'accesslog'")
+}
+
+// DetectFormat 根据文件扩展名和内容判断格式
+func DetectFormat(path string, data []byte) Format {
+	if strings.EqualFold(filepath.Ext(path), ".har") {
+		return FormatHAR
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "curl ") {
+			return FormatCurl
+		}
+		if strings.HasPrefix(line, "{") && strings.Contains(line, "\"log\"") {
+			return FormatHAR
+		}
+		break
+	}
+	return FormatAccessLog
+}
@@ -0,0 +1,392 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package replay
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 需要参数但不影响请求内容的curl选项
+var curlIgnoredArgOptions = map[string]bool{
+	"-o":                true,
+	"--output":          true,
+	"-m":                true,
+	"--max-time":        true,
+	"--connect-timeout": true,
+	"-x":                true,
+	"--proxy":           true,
+	"--resolve":         true,
+	"-w":                true,
+	"--write-out":       true,
+	"-r":                true,
+	"--range":           true,
+	"--retry":           true,
+	"-c":                true,
+	"--cookie-jar":      true,
+}
+
+// curl命令中的一个单词
+type curlWord struct {
+	Value string
+	Line  int
+}
+
+// ParseCurl 从curl命令中读取请求
+// 支持多条命令、使用反斜杠换行以及单引号、双引号和 $'...' 形式的参数；
+// 命令前面的 # expect: ACTION 注释用来设置期望的结果
+func ParseCurl(data []byte, source string) ([]*Case, error) {
+	commands, err := splitCurlCommands(string(data))
+	if err != nil {
+		return nil, errors.New(source + ": " + err.Error())
+	}
+
+	var result = []*Case{}
+	for _, command := range commands {
+		if len(command.words) == 0 {
+			continue
+		}
+		var commandSource = source + ":" + strconv.Itoa(command.words[0].Line)
+		if command.words[0].Value != "curl" {
+			return nil, errors.New(commandSource + ": command should start with 'curl'")
+		}
+		c, err := parseCurlCommand(command.words[1:])
+		if err != nil {
+			return nil, errors.New(commandSource + ": " + err.Error())
+		}
+		c.Source = commandSource
+		c.Expect = command.expect
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+type curlCommand struct {
+	words  []*curlWord
+	expect string
+}
+
+// 将文本分割为多条命令
+func splitCurlCommands(s string) ([]*curlCommand, error) {
+	var result = []*curlCommand{}
+	var current = &curlCommand{}
+	var expect = ""
+	var word = strings.Builder{}
+	var hasWord = false
+	var wordLine = 0
+	var line = 1
+
+	var addWord = func() {
+		if hasWord {
+			current.words = append(current.words, &curlWord{Value: word.String(), Line: wordLine})
+		}
+		word.Reset()
+		hasWord = false
+	}
+	var startWord = func() {
+		if !hasWord {
+			hasWord = true
+			wordLine = line
+		}
+	}
+	var endCommand = func() {
+		addWord()
+		if len(current.words) > 0 {
+			current.expect = expect
+			result = append(result, current)
+			expect = ""
+		}
+		current = &curlCommand{}
+	}
+
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		switch {
+		case c == '\n':
+			endCommand()
+			line++
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '\n' || (s[i+1] == '\r' && i+2 < len(s) && s[i+2] == '\n')):
+			// 续行
+			addWord()
+			if s[i+1] == '\r' {
+				i++
+			}
+			i++
+			line++
+		case c == ' ' || c == '\t' || c == '\r':
+			addWord()
+		case c == '#' && !hasWord && len(current.words) == 0:
+			var end = strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				end = len(s) - i
+			}
+			var commentExpect = parseExpect(strings.TrimSpace(s[i+1 : i+end]))
+			if len(commentExpect) > 0 {
+				expect = commentExpect
+			}
+			i += end - 1
+		case c == '\'':
+			startWord()
+			var end = strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("line " + strconv.Itoa(line) + ": unterminated single quote")
+			}
+			var value = s[i+1 : i+1+end]
+			word.WriteString(value)
+			line += strings.Count(value, "\n")
+			i += end + 1
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			startWord()
+			n, value, err := readANSIQuoted(s[i+2:])
+			if err != nil {
+				return nil, errors.New("line " + strconv.Itoa(line) + ": " + err.Error())
+			}
+			word.WriteString(value)
+			line += strings.Count(s[i+2:i+2+n], "\n")
+			i += n + 1
+		case c == '"':
+			startWord()
+			var j = i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) && strings.IndexByte("\"\\$`\n", s[j+1]) >= 0 {
+					if s[j+1] != '\n' {
+						word.WriteByte(s[j+1])
+					}
+					j++
+					continue
+				}
+				word.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, errors.New("line " + strconv.Itoa(line) + ": unterminated double quote")
+			}
+			line += strings.Count(s[i:j], "\n")
+			i = j
+		case c == '\\' && i+1 < len(s):
+			startWord()
+			word.WriteByte(s[i+1])
+			i++
+		default:
+			startWord()
+			word.WriteByte(c)
+		}
+	}
+	endCommand()
+
+	return result, nil
+}
+
+// 读取 $'...' 形式的参数，返回读取的字节数（包含结束的单引号）和参数值
+func readANSIQuoted(s string) (n int, value string, err error) {
+	var builder = strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		if c == '\'' {
+			return i + 1, builder.String(), nil
+		}
+		if c != '\\' || i+1 >= len(s) {
+			builder.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case '0':
+			builder.WriteByte(0)
+		case 'x':
+			if i+2 < len(s) {
+				b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+				if err == nil {
+					builder.WriteByte(byte(b))
+					i += 2
+					continue
+				}
+			}
+			builder.WriteString("\\x")
+		case 'u':
+			if i+4 < len(s) {
+				r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+				if err == nil {
+					builder.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+			}
+			builder.WriteString("\\u")
+		default:
+			builder.WriteByte(s[i])
+		}
+	}
+	return 0, "", errors.New("unterminated $'...' quote")
+}
+
+// 分析单条curl命令的参数
+func parseCurlCommand(words []*curlWord) (*Case, error) {
+	var c = &Case{
+		Header: http.Header{},
+	}
+	var dataPieces = []string{}
+	var isGet = false
+	var isHead = false
+
+	for i := 0; i < len(words); i++ {
+		var arg = words[i].Value
+
+		// 短选项和参数连在一起，比如 -XPOST
+		var attachedValue = ""
+		var hasAttachedValue = false
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && strings.IndexByte("XHdbAeu", arg[1]) >= 0 {
+			attachedValue = arg[2:]
+			hasAttachedValue = true
+			arg = arg[:2]
+		}
+
+		// 选项的参数
+		var nextValue = func() (string, error) {
+			if hasAttachedValue {
+				return attachedValue, nil
+			}
+			if i+1 >= len(words) {
+				return "", errors.New("option '" + arg + "' requires a value")
+			}
+			i++
+			return words[i].Value, nil
+		}
+
+		switch arg {
+		case "-X", "--request":
+			value, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			c.Method = strings.ToUpper(value)
+		case "-H", "--header":
+			value, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			var index = strings.Index(value, ":")
+			if index <= 0 {
+				return nil, errors.New("invalid header '" + value + "'")
+			}
+			c.Header.Add(strings.TrimSpace(value[:index]), strings.TrimSpace(value[index+1:]))
+		case "-d", "--data", "--data-raw", "--data-binary", "--data-ascii", "--data-urlencode":
+			value, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			if arg != "--data-raw" && strings.HasPrefix(value, "@") {
+				return nil, errors.New("reading data from file '" + value[1:] + "' is not supported")
+			}
+			if arg == "--data-urlencode" {
+				var index = strings.Index(value, "=")
+				if index >= 0 {
+					value = value[:index+1] + url.QueryEscape(value[index+1:])
+				} else {
+					value = url.QueryEscape(value)
+				}
+			}
+			dataPieces = append(dataPieces, value)
+		case "-b", "--cookie":
+			value, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			if !strings.Contains(value, "=") {
+				return nil, errors.New("reading cookies from file '" + value + "' is not supported")
+			}
+			c.Header.Add("Cookie", value)
+		case "-A", "--user-agent":
+			value, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			c.Header.Set("User-Agent", value)
+		case "-e", "--referer":
+			value, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			c.Header.Set("Referer", value)
+		case "-u", "--user":
+			value, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			c.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(value)))
+		case "--url":
+			value, err := nextValue()
+			if err != nil {
+				return nil, err
+			}
+			c.URL = value
+		case "-G", "--get":
+			isGet = true
+		case "-I", "--head":
+			isHead = true
+		default:
+			if curlIgnoredArgOptions[arg] {
+				_, err := nextValue()
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				// 其他不需要参数的选项，比如 --compressed、-k、-s
+				continue
+			}
+			if len(c.URL) > 0 {
+				return nil, errors.New("only one url is supported in a command")
+			}
+			c.URL = arg
+		}
+	}
+
+	if len(c.URL) == 0 {
+		return nil, errors.New("url should not be empty")
+	}
+	if !strings.Contains(c.URL, "://") {
+		c.URL = "http://" + c.URL
+	}
+
+	// 请求数据
+	if len(dataPieces) > 0 {
+		var data = strings.Join(dataPieces, "&")
+		if isGet {
+			if strings.Contains(c.URL, "?") {
+				c.URL += "&" + data
+			} else {
+				c.URL += "?" + data
+			}
+		} else {
+			c.Body = []byte(data)
+			if len(c.Method) == 0 {
+				c.Method = http.MethodPost
+			}
+			if len(c.Header.Get("Content-Type")) == 0 {
+				c.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+		}
+	}
+
+	if len(c.Method) == 0 {
+		if isHead {
+			c.Method = http.MethodHead
+		} else {
+			c.Method = http.MethodGet
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package replay
+
+import (
+	"github.com/iwind/TeaGo/assert"
+	"testing"
+)
+
+func TestParseCurl(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	cases, err := ParseCurl([]byte(`# expect: block
+curl 'https://example.com/login?from=home' \
+  -H 'User-Agent: sqlmap/1.0' \
+  -H "Cookie: sid=\"abc\"" \
+  --data-raw $'name=admin\' or 1=1--&pass=1' \
+  --compressed
+
+curl example.com/hello -XPUT -d a=1 -d b=2
+curl -G https://example.com/search --data-urlencode 'q=a b'
+`), "test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(cases) == 3)
+
+	var c = cases[0]
+	a.IsTrue(c.Source == "test.txt:2")
+	a.IsTrue(c.Expect == "block")
+	a.IsTrue(c.Method == "POST")
+	a.IsTrue(c.URL == "https://example.com/login?from=home")
+	a.IsTrue(c.Header.Get("User-Agent") == "sqlmap/1.0")
+	a.IsTrue(c.Header.Get("Cookie") == `sid="abc"`)
+	a.IsTrue(c.Header.Get("Content-Type") == "application/x-www-form-urlencoded")
+	a.IsTrue(string(c.Body) == "name=admin' or 1=1--&pass=1")
+
+	c = cases[1]
+	a.IsTrue(c.Source == "test.txt:8")
+	a.IsTrue(len(c.Expect) == 0)
+	a.IsTrue(c.Method == "PUT")
+	a.IsTrue(c.URL == "http://example.com/hello")
+	a.IsTrue(string(c.Body) == "a=1&b=2")
+
+	c = cases[2]
+	a.IsTrue(c.Method == "GET")
+	a.IsTrue(c.URL == "https://example.com/search?q=a+b")
+	a.IsTrue(len(c.Body) == 0)
+
+	_, err = ParseCurl([]byte(`curl 'https://example.com`), "test.txt")
+	a.IsNotNil(err)
+
+	_, err = ParseCurl([]byte(`wget https://example.com`), "test.txt")
+	a.IsNotNil(err)
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package replay
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harFile struct {
+	Log struct {
+		Entries []*struct {
+			Comment string `json:"comment"`
+			Request struct {
+				Method   string          `json:"method"`
+				URL      string          `json:"url"`
+				Headers  []*harNameValue `json:"headers"`
+				PostData *struct {
+					MimeType string          `json:"mimeType"`
+					Text     string          `json:"text"`
+					Params   []*harNameValue `json:"params"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response *struct {
+				Status  int             `json:"status"`
+				Headers []*harNameValue `json:"headers"`
+				Content *struct {
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+			ServerIPAddress string `json:"serverIPAddress"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ParseHAR 从HAR文件中读取请求
+// 条目的 comment 中可以使用 expect: ACTION 设置期望的结果
+func ParseHAR(data []byte, source string) ([]*Case, error) {
+	var file = &harFile{}
+	err := json.Unmarshal(data, file)
+	if err != nil {
+		return nil, errors.New("decode HAR failed: " + err.Error())
+	}
+
+	var result = []*Case{}
+	for index, entry := range file.Log.Entries {
+		if entry == nil {
+			continue
+		}
+		var entrySource = source + "#" + strconv.Itoa(index+1)
+		if len(entry.Request.URL) == 0 {
+			return nil, errors.New(entrySource + ": request url should not be empty")
+		}
+
+		var c = &Case{
+			Source: entrySource,
+			Method: entry.Request.Method,
+			URL:    entry.Request.URL,
+			Header: harHeader(entry.Request.Headers),
+			Expect: parseExpect(entry.Comment),
+		}
+
+		// 请求内容
+		var postData = entry.Request.PostData
+		if postData != nil {
+			if len(postData.Text) > 0 {
+				c.Body = []byte(postData.Text)
+			} else if len(postData.Params) > 0 {
+				var pieces = []string{}
+				for _, param := range postData.Params {
+					pieces = append(pieces, param.Name+"="+param.Value)
+				}
+				c.Body = []byte(strings.Join(pieces, "&"))
+			}
+			if len(postData.MimeType) > 0 && len(c.Header.Get("Content-Type")) == 0 {
+				c.Header.Set("Content-Type", postData.MimeType)
+			}
+		}
+
+		// 响应
+		var response = entry.Response
+		if response != nil && response.Status > 0 {
+			c.StatusCode = response.Status
+			c.ResponseHeader = harHeader(response.Headers)
+			if response.Content != nil && len(response.Content.Text) > 0 {
+				if response.Content.Encoding == "base64" {
+					body, err := base64.StdEncoding.DecodeString(response.Content.Text)
+					if err != nil {
+						return nil, errors.New(entrySource + ": decode response content failed: " + err.Error())
+					}
+					c.ResponseBody = body
+				} else {
+					c.ResponseBody = []byte(response.Content.Text)
+				}
+
+				// HAR中记录的是解压后的内容
+				c.ResponseHeader.Del("Content-Encoding")
+			}
+		}
+
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// 转换Header，忽略HTTP/2中的伪Header
+func harHeader(pairs []*harNameValue) http.Header {
+	var header = http.Header{}
+	for _, pair := range pairs {
+		if pair == nil || len(pair.Name) == 0 || strings.HasPrefix(pair.Name, ":") {
+			continue
+		}
+		header.Add(pair.Name, pair.Value)
+	}
+	return header
+}
+
+// 分析注释中期望的结果，比如 expect: block
+func parseExpect(comment string) string {
+	comment = strings.TrimSpace(comment)
+	if !strings.HasPrefix(strings.ToLower(comment), "expect:") {
+		return ""
+	}
+	return strings.TrimSpace(comment[len("expect:"):])
+}
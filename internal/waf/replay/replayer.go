@@ -0,0 +1,228 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/waf"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadWAF 从文件中加载WAF策略
+// 扩展名为 .json 的文件为从管理平台导出的策略，其他文件为 waf.Save() 保存的YAML文件
+// 两种策略都会应用节点本地 configs/waf.yaml 中的扩展设置
+func LoadWAF(path string) (*waf.WAF, error) {
+	var w *waf.WAF
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var policy = &firewallconfigs.HTTPFirewallPolicy{}
+		err = json.Unmarshal(data, policy)
+		if err != nil {
+			return nil, errors.New("decode policy failed: " + err.Error())
+		}
+		w, err = waf.SharedWAFManager.ConvertWAF(policy)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		w, err = waf.NewWAFFromFile(path)
+		if err != nil {
+			return nil, err
+		}
+		waf.SharedWAFManager.ApplyLocalOptions(w)
+		var errs = w.Init()
+		if len(errs) > 0 {
+			return nil, errs[0]
+		}
+	}
+
+	// 离线测试时不能修改本机防火墙
+	w.UseLocalFirewall = false
+
+	return w, nil
+}
+
+// Replayer 使用WAF策略重放请求
+// 为了获取参数值，匹配的规则集中的规则会被再次检查，所以CC等计数类参数的计数会比实际请求多
+type Replayer struct {
+	waf *waf.WAF
+}
+
+// NewReplayer 获取新对象
+func NewReplayer(w *waf.WAF) *Replayer {
+	return &Replayer{
+		waf: w,
+	}
+}
+
+// Replay 重放单个请求
+// 请求没有被阻止并且有响应时，继续检查响应
+func (this *Replayer) Replay(c *Case) *Result {
+	var result = &Result{
+		Case:   c,
+		GoNext: true,
+	}
+
+	rawReq, err := c.NewRequest()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	var req = requests.NewTestRequest(rawReq)
+	var writer = newResponseWriter()
+	goNext, _, group, set, err := this.waf.MatchRequest(req, writer)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	this.collect(result, PhaseRequest, req, nil, goNext, group, set, writer)
+	if !goNext {
+		return result
+	}
+
+	// 响应
+	var rawResp = c.NewResponse(rawReq)
+	if rawResp == nil {
+		return result
+	}
+	req.AnomalyScore = 0
+	req.AnomalyMatchedSetIds = nil
+	req.DetectOnlySetIds = nil
+	goNext, _, group, set, err = this.waf.MatchResponse(req, rawResp, writer)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	this.collect(result, PhaseResponse, req, rawResp, goNext, group, set, writer)
+
+	return result
+}
+
+// ReplayAll 重放多个请求
+func (this *Replayer) ReplayAll(cases []*Case) []*Result {
+	var results = []*Result{}
+	for _, c := range cases {
+		results = append(results, this.Replay(c))
+	}
+	return results
+}
+
+// 收集某个阶段的检查结果
+func (this *Replayer) collect(result *Result, phase Phase, req *requests.TestRequest, rawResp *http.Response, goNext bool, group *waf.RuleGroup, set *waf.RuleSet, writer *responseWriter) {
+	var groups = this.waf.Inbound
+	if phase == PhaseResponse {
+		groups = this.waf.Outbound
+	}
+
+	var matchedSets = []*SetResult{}
+	var addSet = func(group *waf.RuleGroup, set *waf.RuleSet, isDetectOnly bool) {
+		if group == nil || set == nil || len(set.Rules) == 0 {
+			return
+		}
+		for _, matchedSet := range matchedSets {
+			if matchedSet.Set == set {
+				return
+			}
+		}
+		matchedSets = append(matchedSets, &SetResult{
+			Group:        group,
+			Set:          set,
+			IsDetectOnly: isDetectOnly,
+			Rules:        this.matchRules(phase, req, rawResp, set),
+		})
+	}
+
+	for _, setId := range req.DetectOnlySetIds {
+		var detectGroup, detectSet = findRuleSet(groups, setId)
+		addSet(detectGroup, detectSet, true)
+	}
+	for _, setId := range req.AnomalyMatchedSetIds {
+		var scoreGroup, scoreSet = findRuleSet(groups, setId)
+		addSet(scoreGroup, scoreSet, false)
+	}
+	addSet(group, set, false)
+
+	if len(req.AnomalyMatchedSetIds) > 0 {
+		result.AnomalyScore = req.AnomalyScore
+	}
+	result.MatchedSets = append(result.MatchedSets, matchedSets...)
+
+	if set != nil {
+		result.Phase = phase
+		result.Group = group
+		result.Set = set
+		result.Actions = set.ActionCodes()
+	}
+	if !goNext {
+		result.Phase = phase
+		result.GoNext = false
+		result.StatusCode = writer.statusCode
+	}
+}
+
+// 检查规则集中的所有规则，获取每个规则的参数值
+func (this *Replayer) matchRules(phase Phase, req *requests.TestRequest, rawResp *http.Response, set *waf.RuleSet) []*RuleResult {
+	var result = []*RuleResult{}
+	for _, rule := range set.Rules {
+		var ruleResult = &RuleResult{
+			Rule: rule,
+		}
+		if phase == PhaseResponse {
+			ruleResult.IsMatched, ruleResult.Value, _, ruleResult.Err = rule.MatchResponseValue(req, requests.NewResponse(rawResp))
+		} else {
+			ruleResult.IsMatched, ruleResult.Value, _, ruleResult.Err = rule.MatchRequestValue(req)
+		}
+		result = append(result, ruleResult)
+	}
+	return result
+}
+
+// 根据ID查找规则集
+func findRuleSet(groups []*waf.RuleGroup, setId int64) (*waf.RuleGroup, *waf.RuleSet) {
+	if setId <= 0 {
+		return nil, nil
+	}
+	for _, group := range groups {
+		var set = group.FindRuleSet(setId)
+		if set != nil {
+			return group, set
+		}
+	}
+	return nil, nil
+}
+
+// 记录WAF动作输出的响应
+type responseWriter struct {
+	header     http.Header
+	statusCode int
+}
+
+func newResponseWriter() *responseWriter {
+	return &responseWriter{
+		header:     http.Header{},
+		statusCode: http.StatusOK,
+	}
+}
+
+func (this *responseWriter) Header() http.Header {
+	return this.header
+}
+
+func (this *responseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (this *responseWriter) WriteHeader(statusCode int) {
+	this.statusCode = statusCode
+}
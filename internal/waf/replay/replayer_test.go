@@ -0,0 +1,193 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package replay
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/TeaOSLab/EdgeNode/internal/waf"
+	"github.com/iwind/TeaGo/assert"
+	"path/filepath"
+	"testing"
+)
+
+func testReplayWAF(t *testing.T) *waf.WAF {
+	var set = waf.NewRuleSet()
+	set.Id = 1
+	set.Code = "sqli"
+	set.Name = "SQL Injection"
+	set.Connector = waf.RuleConnectorOr
+	set.Rules = []*waf.Rule{
+		{
+			Id:       1,
+			Param:    "${arg.name}",
+			Operator: waf.RuleOperatorContains,
+			Value:    "' or ",
+		},
+		{
+			Id:       2,
+			Param:    "${requestBody}",
+			Operator: waf.RuleOperatorContains,
+			Value:    "' or ",
+		},
+	}
+	set.AddAction(waf.ActionBlock, nil)
+
+	var group = waf.NewRuleGroup()
+	group.Id = 1
+	group.Code = "sqlInjection"
+	group.IsInbound = true
+	group.AddRuleSet(set)
+
+	var responseSet = waf.NewRuleSet()
+	responseSet.Id = 2
+	responseSet.Rules = []*waf.Rule{
+		{
+			Id:       3,
+			Param:    "${status}",
+			Operator: waf.RuleOperatorEq,
+			Value:    "500",
+		},
+	}
+	responseSet.AddAction(waf.ActionLog, nil)
+
+	var responseGroup = waf.NewRuleGroup()
+	responseGroup.Id = 2
+	responseGroup.AddRuleSet(responseSet)
+
+	var w = waf.NewWAF()
+	w.AddRuleGroup(group)
+	w.Outbound = append(w.Outbound, responseGroup)
+	var errs = w.Init()
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+	return w
+}
+
+func TestReplayer_Replay_HAR(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	cases, err := ParseHAR([]byte(`{
+	"log": {
+		"entries": [
+			{
+				"comment": "expect: block",
+				"request": {
+					"method": "POST",
+					"url": "https://example.com/login",
+					"headers": [ { "name": ":authority", "value": "example.com" }, { "name": "User-Agent", "value": "test" } ],
+					"postData": { "mimeType": "application/x-www-form-urlencoded", "text": "name=admin' or 1=1" }
+				},
+				"response": { "status": 403 }
+			},
+			{
+				"comment": "expect: log",
+				"request": { "method": "GET", "url": "https://example.com/hello?name=lu" },
+				"response": { "status": 500, "content": { "text": "error" } }
+			},
+			{
+				"request": { "method": "GET", "url": "https://example.com/" },
+				"response": { "status": 200 }
+			}
+		]
+	}
+}`), "test.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(cases) == 3)
+	a.IsTrue(cases[0].Source == "test.har#1")
+	a.IsTrue(cases[0].Header.Get("User-Agent") == "test")
+
+	var replayer = NewReplayer(testReplayWAF(t))
+	var results = replayer.ReplayAll(cases)
+
+	// 请求被阻止
+	var result = results[0]
+	a.IsNil(result.Err)
+	a.IsFalse(result.GoNext)
+	a.IsTrue(result.Phase == PhaseRequest)
+	a.IsTrue(result.StatusCode == 403)
+	a.IsTrue(result.Set.Id == 1)
+	a.IsTrue(len(result.MatchedSets) == 1)
+	a.IsTrue(len(result.MatchedSets[0].Rules) == 2)
+	a.IsFalse(result.MatchedSets[0].Rules[0].IsMatched)
+	a.IsTrue(result.MatchedSets[0].Rules[1].IsMatched)
+	ok, _ := result.Check("")
+	a.IsTrue(ok)
+	t.Log(result.String())
+
+	// 响应匹配
+	result = results[1]
+	a.IsTrue(result.GoNext)
+	a.IsTrue(result.Phase == PhaseResponse)
+	a.IsTrue(result.Set.Id == 2)
+	ok, _ = result.Check("")
+	a.IsTrue(ok)
+	t.Log(result.String())
+
+	// 没有匹配
+	result = results[2]
+	a.IsTrue(result.GoNext)
+	a.IsNil(result.Set)
+	ok, _ = result.Check(ExpectNone)
+	a.IsTrue(ok)
+	ok, message := result.Check(ExpectBlock)
+	a.IsFalse(ok)
+	t.Log(message)
+}
+
+func TestReplayer_Replay_AccessLog(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	cases, err := ParseAccessLog([]byte(`1.2.3.4 [02/Jan/2006:15:04:05 +0800] "GET https://example.com/hello?name=admin'%20or%201=1 HTTP/1.1" 200 - 1.23ms
+{"remoteAddr":"1.2.3.4","remotePort":1234,"requestMethod":"GET","scheme":"https","host":"example.com","requestURI":"/hello?name=lu","status":200}
+`), "access.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(len(cases) == 2)
+	a.IsTrue(cases[0].RemoteAddr == "1.2.3.4:0")
+	a.IsTrue(cases[1].RemoteAddr == "1.2.3.4:1234")
+	a.IsTrue(cases[1].URL == "https://example.com/hello?name=lu")
+
+	var replayer = NewReplayer(testReplayWAF(t))
+	var results = replayer.ReplayAll(cases)
+	a.IsFalse(results[0].GoNext)
+	a.IsTrue(results[1].GoNext)
+	for _, result := range results {
+		t.Log(result.String())
+	}
+}
+
+func TestLoadWAF_LocalOptions(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var path = filepath.Join(t.TempDir(), "policy.yaml")
+	err := testReplayWAF(t).Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var localConfig = &configs.WAFConfig{
+		Default: &configs.WAFPolicyOptions{
+			AnomalyScoring: &configs.AnomalyScoringConfig{IsOn: true},
+			DetectOnlySets: []int64{1},
+		},
+	}
+	err = localConfig.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waf.SharedWAFManager.UpdateLocalConfig(localConfig)
+	defer waf.SharedWAFManager.UpdateLocalConfig(nil)
+
+	// YAML文件中的策略同样需要应用本地扩展设置
+	w, err := LoadWAF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsNotNil(w.AnomalyScoring)
+	a.IsTrue(w.AnomalyScoring.IsOn)
+	a.IsTrue(w.Inbound[0].RuleSets[0].IsDetectOnly)
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package replay
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/waf"
+	"github.com/iwind/TeaGo/lists"
+	"github.com/iwind/TeaGo/types"
+	"strconv"
+	"strings"
+)
+
+// Phase 检查阶段
+type Phase = string
+
+const (
+	PhaseRequest  Phase = "request"
+	PhaseResponse Phase = "response"
+)
+
+// 期望的结果
+const (
+	ExpectPass  = "pass"  // 请求没有被阻止
+	ExpectBlock = "block" // 请求被阻止
+	ExpectNone  = "none"  // 没有匹配任何规则集
+)
+
+// 输出的参数值的最大长度
+const maxValueLength = 256
+
+// Result 单个请求的重放结果
+type Result struct {
+	Case *Case
+
+	Phase      Phase          // 最后一个匹配的规则集所在的阶段
+	GoNext     bool           // 请求是否可以继续
+	StatusCode int            // 请求被阻止时WAF输出的状态码
+	Group      *waf.RuleGroup // 最后一个匹配的规则分组
+	Set        *waf.RuleSet   // 最后一个匹配的规则集，异常评分模式下为分数阈值对应的规则集
+	Actions    []string       // 执行的动作代号
+
+	MatchedSets  []*SetResult // 匹配的规则集详情，包括仅检测模式和异常评分模式中匹配的规则集
+	AnomalyScore int          // 异常评分模式下的总分
+
+	Err error
+}
+
+// SetResult 匹配的规则集
+type SetResult struct {
+	Group        *waf.RuleGroup
+	Set          *waf.RuleSet
+	IsDetectOnly bool
+	Rules        []*RuleResult
+}
+
+// RuleResult 规则检查结果
+type RuleResult struct {
+	Rule      *waf.Rule
+	Value     interface{} // 检查的参数值
+	IsMatched bool
+	Err       error
+}
+
+// Check 检查结果是否符合期望
+// defaultExpect 为请求中没有设置期望结果时使用的期望结果，为空表示不检查
+func (this *Result) Check(defaultExpect string) (ok bool, message string) {
+	if this.Err != nil {
+		return false, "error: " + this.Err.Error()
+	}
+
+	var expect = this.Case.Expect
+	if len(expect) == 0 {
+		expect = defaultExpect
+	}
+	if len(expect) == 0 {
+		return true, ""
+	}
+
+	var actual = this.Outcome()
+	switch expect {
+	case ExpectPass:
+		ok = this.GoNext
+	case ExpectBlock:
+		ok = !this.GoNext
+	case ExpectNone:
+		ok = this.Set == nil && len(this.MatchedSets) == 0
+	default:
+		ok = lists.ContainsString(this.Actions, expect)
+	}
+	if ok {
+		return true, ""
+	}
+	return false, "expect '" + expect + "', but got '" + actual + "'"
+}
+
+// Outcome 结果描述：pass、block 或者执行的动作代号
+func (this *Result) Outcome() string {
+	if !this.GoNext {
+		return ExpectBlock
+	}
+	if this.Set != nil && len(this.Actions) > 0 {
+		return strings.Join(this.Actions, ",")
+	}
+	if this.Set == nil && len(this.MatchedSets) == 0 {
+		return ExpectNone
+	}
+	return ExpectPass
+}
+
+// String 输出可读的结果
+func (this *Result) String() string {
+	var lines = []string{this.Case.Source + " " + this.Case.Method + " " + this.Case.URL}
+	if this.Err != nil {
+		lines = append(lines, "  error: "+this.Err.Error())
+		return strings.Join(lines, "\n")
+	}
+
+	var outcome = "  result: " + this.Outcome()
+	if !this.GoNext {
+		outcome += " (status: " + strconv.Itoa(this.StatusCode) + ", phase: " + this.Phase + ")"
+	}
+	lines = append(lines, outcome)
+
+	if this.Set != nil {
+		lines = append(lines, "  group: "+formatItem(this.Group.Id, this.Group.Code, this.Group.Name))
+		lines = append(lines, "  set: "+formatItem(this.Set.Id, this.Set.Code, this.Set.Name)+", actions: "+strings.Join(this.Actions, ","))
+	}
+	if this.AnomalyScore > 0 {
+		lines = append(lines, "  anomaly score: "+strconv.Itoa(this.AnomalyScore))
+	}
+
+	for _, setResult := range this.MatchedSets {
+		var line = "  matched set: " + formatItem(setResult.Set.Id, setResult.Set.Code, setResult.Set.Name) + " in group " + formatItem(setResult.Group.Id, setResult.Group.Code, setResult.Group.Name)
+		if setResult.IsDetectOnly {
+			line += " (detect only)"
+		}
+		lines = append(lines, line)
+
+		for _, ruleResult := range setResult.Rules {
+			var rule = ruleResult.Rule
+			var ruleLine = "    rule: [" + types.String(rule.Id) + "] " + rule.Param + " " + rule.Operator + " " + formatValue(rule.Value)
+			if ruleResult.Err != nil {
+				ruleLine += ", error: " + ruleResult.Err.Error()
+			} else {
+				ruleLine += ", value: " + formatValue(ruleResult.Value)
+				if ruleResult.IsMatched {
+					ruleLine += ", matched"
+				} else {
+					ruleLine += ", not matched"
+				}
+			}
+			lines = append(lines, ruleLine)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// 输出分组和规则集
+func formatItem(id int64, code string, name string) string {
+	var s = "[" + types.String(id) + "]"
+	if len(code) > 0 {
+		s += " " + code
+	}
+	if len(name) > 0 {
+		s += " '" + name + "'"
+	}
+	return s
+}
+
+// 输出参数值，过长的参数值会被截断
+func formatValue(value interface{}) string {
+	var s = types.String(value)
+	if len(s) > maxValueLength {
+		s = s[:maxValueLength] + "..."
+	}
+	return strconv.Quote(s)
+}
@@ -32,6 +32,12 @@ type Request interface {
 	// WAFOnAction 动作回调
 	WAFOnAction(action interface{}) (goNext bool)
 
+	// WAFOnAnomalyScore 异常评分模式下的评分回调，thresholdScore 为达到的阈值分数，没有达到任何阈值时为0
+	WAFOnAnomalyScore(score int, matchedSetIds []int64, thresholdScore int)
+
+	// WAFOnDetectOnly 仅检测模式下匹配了会阻止请求的规则集时的回调
+	WAFOnDetectOnly(groupId int64, setId int64, actionCode string)
+
 	// Format 格式化变量
 	Format(string) string
 }
@@ -12,6 +12,11 @@ import (
 type TestRequest struct {
 	req      *http.Request
 	BodyData []byte
+
+	AnomalyScore          int
+	AnomalyMatchedSetIds  []int64
+	AnomalyThresholdScore int
+	DetectOnlySetIds      []int64
 }
 
 func NewTestRequest(raw *http.Request) *TestRequest {
@@ -76,3 +81,13 @@ func (this *TestRequest) Format(s string) string {
 func (this *TestRequest) WAFOnAction(action interface{}) bool {
 	return true
 }
+
+func (this *TestRequest) WAFOnAnomalyScore(score int, matchedSetIds []int64, thresholdScore int) {
+	this.AnomalyScore += score
+	this.AnomalyMatchedSetIds = append(this.AnomalyMatchedSetIds, matchedSetIds...)
+	this.AnomalyThresholdScore = thresholdScore
+}
+
+func (this *TestRequest) WAFOnDetectOnly(groupId int64, setId int64, actionCode string) {
+	this.DetectOnlySetIds = append(this.DetectOnlySetIds, setId)
+}
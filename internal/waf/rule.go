@@ -10,6 +10,7 @@ import (
 	"github.com/TeaOSLab/EdgeNode/internal/re"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
 	"github.com/TeaOSLab/EdgeNode/internal/waf/checkpoints"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/injectionutils"
 	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
 	"github.com/TeaOSLab/EdgeNode/internal/waf/utils"
 	"github.com/TeaOSLab/EdgeNode/internal/waf/values"
@@ -189,13 +190,19 @@ func (this *Rule) Init() error {
 }
 
 func (this *Rule) MatchRequest(req requests.Request) (b bool, hasRequestBody bool, err error) {
+	b, _, hasRequestBody, err = this.MatchRequestValue(req)
+	return
+}
+
+// MatchRequestValue 检查请求，同时返回检查的参数值
+func (this *Rule) MatchRequestValue(req requests.Request) (b bool, value interface{}, hasRequestBody bool, err error) {
 	if this.singleCheckpoint != nil {
 		value, hasCheckedRequestBody, err, _ := this.singleCheckpoint.RequestValue(req, this.singleParam, this.CheckpointOptions, this.Id)
 		if hasCheckedRequestBody {
 			hasRequestBody = true
 		}
 		if err != nil {
-			return false, hasRequestBody, err
+			return false, value, hasRequestBody, err
 		}
 
 		// execute filters
@@ -205,13 +212,13 @@ func (this *Rule) MatchRequest(req requests.Request) (b bool, hasRequestBody boo
 
 		// if is composed checkpoint, we just returns true or false
 		if this.singleCheckpoint.IsComposed() {
-			return types.Bool(value), hasRequestBody, nil
+			return types.Bool(value), value, hasRequestBody, nil
 		}
 
-		return this.Test(value), hasRequestBody, nil
+		return this.Test(value), value, hasRequestBody, nil
 	}
 
-	value := configutils.ParseVariables(this.Param, func(varName string) (value string) {
+	value = configutils.ParseVariables(this.Param, func(varName string) (value string) {
 		pieces := strings.SplitN(varName, ".", 2)
 		prefix := pieces[0]
 		point, ok := this.multipleCheckpoints[prefix]
@@ -241,13 +248,19 @@ func (this *Rule) MatchRequest(req requests.Request) (b bool, hasRequestBody boo
 	})
 
 	if err != nil {
-		return false, hasRequestBody, err
+		return false, value, hasRequestBody, err
 	}
 
-	return this.Test(value), hasRequestBody, nil
+	return this.Test(value), value, hasRequestBody, nil
 }
 
 func (this *Rule) MatchResponse(req requests.Request, resp *requests.Response) (b bool, hasRequestBody bool, err error) {
+	b, _, hasRequestBody, err = this.MatchResponseValue(req, resp)
+	return
+}
+
+// MatchResponseValue 检查响应，同时返回检查的参数值
+func (this *Rule) MatchResponseValue(req requests.Request, resp *requests.Response) (b bool, value interface{}, hasRequestBody bool, err error) {
 	if this.singleCheckpoint != nil {
 		// if is request param
 		if this.singleCheckpoint.IsRequest() {
@@ -256,7 +269,7 @@ func (this *Rule) MatchResponse(req requests.Request, resp *requests.Response) (
 				hasRequestBody = true
 			}
 			if err != nil {
-				return false, hasRequestBody, err
+				return false, value, hasRequestBody, err
 			}
 
 			// execute filters
@@ -264,7 +277,7 @@ func (this *Rule) MatchResponse(req requests.Request, resp *requests.Response) (
 				value = this.execFilter(value)
 			}
 
-			return this.Test(value), hasRequestBody, nil
+			return this.Test(value), value, hasRequestBody, nil
 		}
 
 		// response param
@@ -273,18 +286,18 @@ func (this *Rule) MatchResponse(req requests.Request, resp *requests.Response) (
 			hasRequestBody = true
 		}
 		if err != nil {
-			return false, hasRequestBody, err
+			return false, value, hasRequestBody, err
 		}
 
 		// if is composed checkpoint, we just returns true or false
 		if this.singleCheckpoint.IsComposed() {
-			return types.Bool(value), hasRequestBody, nil
+			return types.Bool(value), value, hasRequestBody, nil
 		}
 
-		return this.Test(value), hasRequestBody, nil
+		return this.Test(value), value, hasRequestBody, nil
 	}
 
-	value := configutils.ParseVariables(this.Param, func(varName string) (value string) {
+	value = configutils.ParseVariables(this.Param, func(varName string) (value string) {
 		pieces := strings.SplitN(varName, ".", 2)
 		prefix := pieces[0]
 		point, ok := this.multipleCheckpoints[prefix]
@@ -336,10 +349,10 @@ func (this *Rule) MatchResponse(req requests.Request, resp *requests.Response) (
 	})
 
 	if err != nil {
-		return false, hasRequestBody, err
+		return false, value, hasRequestBody, err
 	}
 
-	return this.Test(value), hasRequestBody, nil
+	return this.Test(value), value, hasRequestBody, nil
 }
 
 func (this *Rule) Test(value interface{}) bool {
@@ -607,6 +620,10 @@ func (this *Rule) Test(value interface{}) bool {
 			return this.ipList.Contains(types.String(value))
 		}
 		return false
+	case RuleOperatorDetectSQLInjection:
+		return injectionutils.DetectSQLInjectionValue(value)
+	case RuleOperatorDetectXSS:
+		return injectionutils.DetectXSSValue(value)
 	}
 	return false
 }
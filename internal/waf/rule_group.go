@@ -16,6 +16,9 @@ type RuleGroup struct {
 	RuleSets    []*RuleSet `yaml:"ruleSets" json:"ruleSets"`
 	IsInbound   bool       `yaml:"isInbound" json:"isInbound"`
 
+	ParanoiaLevel int  `yaml:"paranoiaLevel" json:"paranoiaLevel"` // 异常评分模式下的偏执级别，为0表示使用WAF策略中的设置
+	IsDetectOnly  bool `yaml:"isDetectOnly" json:"isDetectOnly"`   // 仅检测模式，分组中的规则集匹配时只记录而不阻止请求
+
 	hasRuleSets bool
 }
 
@@ -76,38 +79,98 @@ func (this *RuleGroup) RemoveRuleSet(id int64) {
 }
 
 func (this *RuleGroup) MatchRequest(req requests.Request) (b bool, hasRequestBody bool, set *RuleSet, err error) {
+	b, hasRequestBody, set, _, err = this.matchRequestFrom(req, 0)
+	return
+}
+
+// 从某个位置开始查找匹配请求的规则集
+func (this *RuleGroup) matchRequestFrom(req requests.Request, fromIndex int) (b bool, hasRequestBody bool, set *RuleSet, index int, err error) {
 	if !this.hasRuleSets {
 		return
 	}
-	for _, set := range this.RuleSets {
+	for index = fromIndex; index < len(this.RuleSets); index++ {
+		var set = this.RuleSets[index]
 		if !set.IsOn {
 			continue
 		}
 		b, hasRequestBody, err = set.MatchRequest(req)
 		if err != nil {
-			return false, hasRequestBody, nil, err
+			return false, hasRequestBody, nil, index, err
 		}
 		if b {
-			return true, hasRequestBody, set, nil
+			return true, hasRequestBody, set, index, nil
 		}
 	}
 	return
 }
 
 func (this *RuleGroup) MatchResponse(req requests.Request, resp *requests.Response) (b bool, hasRequestBody bool, set *RuleSet, err error) {
+	b, hasRequestBody, set, _, err = this.matchResponseFrom(req, resp, 0)
+	return
+}
+
+// 从某个位置开始查找匹配响应的规则集
+func (this *RuleGroup) matchResponseFrom(req requests.Request, resp *requests.Response, fromIndex int) (b bool, hasRequestBody bool, set *RuleSet, index int, err error) {
 	if !this.hasRuleSets {
 		return
 	}
-	for _, set := range this.RuleSets {
+	for index = fromIndex; index < len(this.RuleSets); index++ {
+		var set = this.RuleSets[index]
 		if !set.IsOn {
 			continue
 		}
 		b, hasRequestBody, err = set.MatchResponse(req, resp)
 		if err != nil {
-			return false, hasRequestBody, nil, err
+			return false, hasRequestBody, nil, index, err
+		}
+		if b {
+			return true, hasRequestBody, set, index, nil
+		}
+	}
+	return
+}
+
+// MatchRequestAll 查找所有匹配请求的规则集
+func (this *RuleGroup) MatchRequestAll(req requests.Request) (sets []*RuleSet, hasRequestBody bool, err error) {
+	if !this.hasRuleSets {
+		return
+	}
+	for _, set := range this.RuleSets {
+		if !set.IsOn {
+			continue
+		}
+		b, hasCheckedRequestBody, err := set.MatchRequest(req)
+		if hasCheckedRequestBody {
+			hasRequestBody = true
+		}
+		if err != nil {
+			return nil, hasRequestBody, err
+		}
+		if b {
+			sets = append(sets, set)
+		}
+	}
+	return
+}
+
+// MatchResponseAll 查找所有匹配响应的规则集
+func (this *RuleGroup) MatchResponseAll(req requests.Request, resp *requests.Response) (sets []*RuleSet, hasRequestBody bool, err error) {
+	if !this.hasRuleSets {
+		return
+	}
+	for _, set := range this.RuleSets {
+		if !set.IsOn {
+			continue
+		}
+		b, hasCheckedRequestBody, err := set.MatchResponse(req, resp)
+		if hasCheckedRequestBody {
+			hasRequestBody = true
+		}
+		if err != nil {
+			return nil, hasRequestBody, err
 		}
 		if b {
-			return true, hasRequestBody, set, nil
+			sets = append(sets, set)
 		}
 	}
 	return
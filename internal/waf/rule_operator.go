@@ -41,6 +41,10 @@ const (
 	RuleOperatorIPMod100   RuleOperator = "ip mod 100"
 	RuleOperatorIPMod      RuleOperator = "ip mod"
 
+	// injection
+	RuleOperatorDetectSQLInjection RuleOperator = "detect sqli"
+	RuleOperatorDetectXSS          RuleOperator = "detect xss"
+
 	RuleCaseInsensitiveNone = "none"
 	RuleCaseInsensitiveYes  = "yes"
 	RuleCaseInsensitiveNo   = "no"
@@ -222,4 +226,16 @@ var AllRuleOperators = []*RuleOperatorDefinition{
 		Description:     "对IP参数值取模，对比值格式为：除数,余数，比如10,1",
 		CaseInsensitive: RuleCaseInsensitiveNo,
 	},
+	{
+		Name:            "包含SQL注入",
+		Code:            RuleOperatorDetectSQLInjection,
+		Description:     "使用内置的语法分析检测参数中是否包含SQL注入，不需要填写对比值",
+		CaseInsensitive: RuleCaseInsensitiveNone,
+	},
+	{
+		Name:            "包含XSS注入",
+		Code:            RuleOperatorDetectXSS,
+		Description:     "使用内置的HTML分析检测参数中是否包含XSS注入，不需要填写对比值",
+		CaseInsensitive: RuleCaseInsensitiveNone,
+	},
 }
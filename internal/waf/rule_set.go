@@ -31,6 +31,9 @@ type RuleSet struct {
 	Actions     []*ActionConfig `yaml:"actions" json:"actions"`
 	IgnoreLocal bool            `yaml:"ignoreLocal" json:"ignoreLocal"`
 
+	Score        int  `yaml:"score" json:"score"`               // 异常评分模式下匹配时增加的分数，为0表示使用WAF策略中的设置，小于0表示不计分
+	IsDetectOnly bool `yaml:"isDetectOnly" json:"isDetectOnly"` // 仅检测模式，匹配时只记录而不阻止请求
+
 	actionCodes     []string
 	actionInstances []ActionInterface
 
@@ -127,6 +130,31 @@ func (this *RuleSet) HasSpecialActions() bool {
 	return false
 }
 
+// HasAllowAction 是否有Allow动作
+func (this *RuleSet) HasAllowAction() bool {
+	for _, action := range this.Actions {
+		if action.Code == ActionAllow {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDetectOnlyIn 在某个分组中是否为仅检测模式
+func (this *RuleSet) IsDetectOnlyIn(group *RuleGroup) bool {
+	return this.IsDetectOnly || (group != nil && group.IsDetectOnly)
+}
+
+// BlockingActionCode 第一个会阻止请求的动作代号，没有时返回空
+func (this *RuleSet) BlockingActionCode() string {
+	for _, instance := range this.actionInstances {
+		if IsBlockingAction(instance) {
+			return instance.Code()
+		}
+	}
+	return ""
+}
+
 // HasAttackActions 检查是否含有攻击防御动作
 func (this *RuleSet) HasAttackActions() bool {
 	for _, action := range this.actionInstances {
@@ -161,6 +189,16 @@ func (this *RuleSet) PerformActions(waf *WAF, group *RuleGroup, req requests.Req
 	for _, instance := range this.actionInstances {
 		// 只执行第一个可能改变请求的动作，其余的都会被忽略
 		if instance.WillChange() {
+			// 仅检测模式下只记录会阻止请求的动作，然后继续检查其他规则集
+			if this.IsDetectOnlyIn(group) && IsBlockingAction(instance) {
+				var groupId int64
+				if group != nil {
+					groupId = group.Id
+				}
+				req.WAFOnDetectOnly(groupId, this.Id, instance.Code())
+				return true, true
+			}
+
 			continueRequest = req.WAFOnAction(instance)
 			if !continueRequest {
 				return false, false
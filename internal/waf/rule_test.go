@@ -7,6 +7,7 @@ import (
 	"github.com/iwind/TeaGo/maps"
 	"net/http"
 	"net/url"
+	"runtime"
 	"testing"
 )
 
@@ -731,3 +732,105 @@ func TestRule_IP(t *testing.T) {
 		a.IsTrue(rule.Test("192.169.2.100"))
 	}
 }
+
+func TestRule_Injection(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	{
+		rule := Rule{
+			Operator: RuleOperatorDetectSQLInjection,
+		}
+		a.IsNil(rule.Init())
+		a.IsTrue(rule.Test("1' or 1=1--"))
+		a.IsTrue(rule.Test([]byte("name=lu&id=1%20union%20select%201,2")))
+		a.IsTrue(rule.Test(map[string]interface{}{
+			"id": "1; drop table users",
+		}))
+		a.IsFalse(rule.Test("name=lu&age=20"))
+		a.IsFalse(rule.Test(nil))
+	}
+
+	{
+		rule := Rule{
+			Operator: RuleOperatorDetectXSS,
+		}
+		a.IsNil(rule.Init())
+		a.IsTrue(rule.Test("<img src=x onerror=alert(1)>"))
+		a.IsTrue(rule.Test([]string{"lu", "javascript:alert(1)"}))
+		a.IsFalse(rule.Test("<b>hello</b>"))
+		a.IsFalse(rule.Test(nil))
+	}
+}
+
+// 模板中某个分组的正则表达式规则
+func testTemplateRules(b *testing.B, groupCode string) []*Rule {
+	var rules = []*Rule{}
+	for _, group := range Template().Inbound {
+		if group.Code != groupCode {
+			continue
+		}
+		for _, set := range group.RuleSets {
+			for _, rule := range set.Rules {
+				if rule.Operator != RuleOperatorMatch {
+					continue
+				}
+				err := rule.Init()
+				if err != nil {
+					b.Fatal(err)
+				}
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules
+}
+
+func BenchmarkRule_Test_DetectSQLInjection(b *testing.B) {
+	runtime.GOMAXPROCS(1)
+
+	var rule = &Rule{
+		Operator: RuleOperatorDetectSQLInjection,
+	}
+	_ = rule.Init()
+	for i := 0; i < b.N; i++ {
+		_ = rule.Test("/hello/world?name=lu&age=20&id=1%27%20and%20sleep(5)--")
+	}
+}
+
+func BenchmarkRule_Test_TemplateSQLInjection(b *testing.B) {
+	runtime.GOMAXPROCS(1)
+
+	var rules = testTemplateRules(b, "sqlInjection")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, rule := range rules {
+			_ = rule.Test("/hello/world?name=lu&age=20&id=1%27%20and%20sleep(5)--")
+		}
+	}
+}
+
+func BenchmarkRule_Test_DetectXSS(b *testing.B) {
+	runtime.GOMAXPROCS(1)
+
+	var rule = &Rule{
+		Operator: RuleOperatorDetectXSS,
+	}
+	_ = rule.Init()
+	for i := 0; i < b.N; i++ {
+		_ = rule.Test("/hello/world?name=lu&age=20&desc=%3Cimg%20src%3Dx%20onerror%3Dalert(1)%3E")
+	}
+}
+
+func BenchmarkRule_Test_TemplateXSS(b *testing.B) {
+	runtime.GOMAXPROCS(1)
+
+	var rules = testTemplateRules(b, "xss")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, rule := range rules {
+			_ = rule.Test("/hello/world?name=lu&age=20&desc=%3Cimg%20src%3Dx%20onerror%3Dalert(1)%3E")
+		}
+	}
+}
@@ -3,6 +3,7 @@ package waf
 import (
 	"errors"
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	teaconst "github.com/TeaOSLab/EdgeNode/internal/const"
 	"github.com/TeaOSLab/EdgeNode/internal/waf/checkpoints"
 	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
@@ -25,6 +26,7 @@ type WAF struct {
 	Mode             firewallconfigs.FirewallMode    `yaml:"mode" json:"mode"`
 	UseLocalFirewall bool                            `yaml:"useLocalFirewall" json:"useLocalFirewall"`
 	SYNFlood         *firewallconfigs.SYNFloodConfig `yaml:"synFlood" json:"synFlood"`
+	AnomalyScoring   *configs.AnomalyScoringConfig   `yaml:"anomalyScoring" json:"anomalyScoring"` // 异常评分模式
 
 	DefaultBlockAction   *BlockAction
 	DefaultCaptchaAction *CaptchaAction
@@ -32,6 +34,9 @@ type WAF struct {
 	hasInboundRules  bool
 	hasOutboundRules bool
 
+	anomalyInboundSets  []*RuleSet // 异常评分阈值对应的规则集
+	anomalyOutboundSets []*RuleSet
+
 	checkpointsMap map[string]checkpoints.CheckpointInterface // prefix => checkpoint
 	actionMap      map[int64]ActionInterface                  // actionId => ActionInterface
 }
@@ -64,6 +69,14 @@ func NewWAFFromFile(path string) (waf *WAF, err error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// 异常评分设置在加载时初始化
+	if waf.AnomalyScoring != nil {
+		err = waf.AnomalyScoring.Init()
+		if err != nil {
+			return nil, errors.New("anomalyScoring: " + err.Error())
+		}
+	}
 	return waf, nil
 }
 
@@ -118,7 +131,17 @@ func (this *WAF) Init() (resultErrors []error) {
 		}
 	}
 
-	return nil
+	// anomaly scoring
+	this.anomalyInboundSets = nil
+	this.anomalyOutboundSets = nil
+	if this.AnomalyScoring != nil && this.AnomalyScoring.IsOn {
+		err := this.initAnomalyScoring()
+		if err != nil {
+			resultErrors = append(resultErrors, errors.New("init anomaly scoring failed: "+err.Error()))
+		}
+	}
+
+	return resultErrors
 }
 
 func (this *WAF) AddRuleGroup(ruleGroup *RuleGroup) {
@@ -260,23 +283,38 @@ func (this *WAF) MatchRequest(req requests.Request, writer http.ResponseWriter)
 		return
 	}
 
+	// 异常评分模式
+	if len(this.anomalyInboundSets) > 0 {
+		return this.matchRequestWithScore(req, writer)
+	}
+
 	// match rules
 	for _, group := range this.Inbound {
 		if !group.IsOn {
 			continue
 		}
-		b, hasCheckedRequestBody, set, err := group.MatchRequest(req)
-		if hasCheckedRequestBody {
-			hasRequestBody = true
-		}
-		if err != nil {
-			return true, hasRequestBody, nil, nil, err
-		}
-		if b {
+		var fromIndex = 0
+		for {
+			b, hasCheckedRequestBody, set, index, err := group.matchRequestFrom(req, fromIndex)
+			if hasCheckedRequestBody {
+				hasRequestBody = true
+			}
+			if err != nil {
+				return true, hasRequestBody, nil, nil, err
+			}
+			if !b {
+				break
+			}
 			continueRequest, goNextSet := set.PerformActions(this, group, req, writer)
 			if !goNextSet {
 				return continueRequest, hasRequestBody, group, set, nil
 			}
+
+			// 仅检测模式的规则集匹配后继续检查分组中的其他规则集
+			if !set.IsDetectOnlyIn(group) {
+				break
+			}
+			fromIndex = index + 1
 		}
 	}
 	return true, hasRequestBody, nil, nil, nil
@@ -287,22 +325,38 @@ func (this *WAF) MatchResponse(req requests.Request, rawResp *http.Response, wri
 		return true, hasRequestBody, nil, nil, nil
 	}
 	resp := requests.NewResponse(rawResp)
+
+	// 异常评分模式
+	if len(this.anomalyOutboundSets) > 0 {
+		return this.matchResponseWithScore(req, resp, writer)
+	}
+
 	for _, group := range this.Outbound {
 		if !group.IsOn {
 			continue
 		}
-		b, hasCheckedRequestBody, set, err := group.MatchResponse(req, resp)
-		if hasCheckedRequestBody {
-			hasRequestBody = true
-		}
-		if err != nil {
-			return true, hasRequestBody, nil, nil, err
-		}
-		if b {
+		var fromIndex = 0
+		for {
+			b, hasCheckedRequestBody, set, index, err := group.matchResponseFrom(req, resp, fromIndex)
+			if hasCheckedRequestBody {
+				hasRequestBody = true
+			}
+			if err != nil {
+				return true, hasRequestBody, nil, nil, err
+			}
+			if !b {
+				break
+			}
 			continueRequest, goNextSet := set.PerformActions(this, group, req, writer)
 			if !goNextSet {
 				return continueRequest, hasRequestBody, group, set, nil
 			}
+
+			// 仅检测模式的规则集匹配后继续检查分组中的其他规则集
+			if !set.IsDetectOnlyIn(group) {
+				break
+			}
+			fromIndex = index + 1
 		}
 	}
 	return true, hasRequestBody, nil, nil, nil
@@ -350,11 +404,12 @@ func (this *WAF) FindAction(actionId int64) ActionInterface {
 
 func (this *WAF) Copy() *WAF {
 	var waf = &WAF{
-		Id:       this.Id,
-		IsOn:     this.IsOn,
-		Name:     this.Name,
-		Inbound:  this.Inbound,
-		Outbound: this.Outbound,
+		Id:             this.Id,
+		IsOn:           this.IsOn,
+		Name:           this.Name,
+		Inbound:        this.Inbound,
+		Outbound:       this.Outbound,
+		AnomalyScoring: this.AnomalyScoring,
 	}
 	return waf
 }
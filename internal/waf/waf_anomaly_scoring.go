@@ -0,0 +1,164 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package waf
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	"net/http"
+)
+
+// 初始化异常评分阈值对应的规则集
+// 异常评分设置在加载时已经初始化，可能被多个策略共用，这里只读取不修改
+func (this *WAF) initAnomalyScoring() error {
+	var newSets = func(thresholds []*configs.AnomalyThreshold, prefix string) ([]*RuleSet, error) {
+		var result = []*RuleSet{}
+		for _, threshold := range thresholds {
+			var set = NewRuleSet()
+			set.Code = prefix + types.String(threshold.Score)
+			set.Name = "Anomaly score >= " + types.String(threshold.Score)
+			set.AddAction(threshold.Action, maps.Map(threshold.Options))
+			err := set.Init(this)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, set)
+		}
+		return result, nil
+	}
+
+	inboundSets, err := newSets(this.AnomalyScoring.Thresholds, "anomaly-inbound-")
+	if err != nil {
+		return err
+	}
+	outboundSets, err := newSets(this.AnomalyScoring.OutboundThresholds, "anomaly-outbound-")
+	if err != nil {
+		return err
+	}
+	this.anomalyInboundSets = inboundSets
+	this.anomalyOutboundSets = outboundSets
+	return nil
+}
+
+// 使用异常评分模式检查请求
+// 匹配的规则集只累加分数（含有allow动作的规则集和仅检测模式的规则集除外），最后根据总分选择阈值动作；
+// 返回的分组为第一个匹配的规则集所在分组，返回的规则集为阈值对应的规则集
+func (this *WAF) matchRequestWithScore(req requests.Request, writer http.ResponseWriter) (goNext bool, hasRequestBody bool, group *RuleGroup, set *RuleSet, err error) {
+	var score = 0
+	var matchedSetIds = []int64{}
+	var firstGroup *RuleGroup
+	for _, group := range this.Inbound {
+		if !group.IsOn || this.AnomalyScoring.GroupParanoiaLevel(group.Code, group.ParanoiaLevel) > this.AnomalyScoring.ParanoiaLevel {
+			continue
+		}
+		sets, hasCheckedRequestBody, err := group.MatchRequestAll(req)
+		if hasCheckedRequestBody {
+			hasRequestBody = true
+		}
+		if err != nil {
+			return true, hasRequestBody, nil, nil, err
+		}
+		for _, set := range sets {
+			// 白名单
+			if set.HasAllowAction() {
+				continueRequest, _ := set.PerformActions(this, group, req, writer)
+				return continueRequest, hasRequestBody, group, set, nil
+			}
+
+			// 仅检测模式的规则集不计分
+			if set.IsDetectOnlyIn(group) {
+				var actionCode = set.BlockingActionCode()
+				if len(actionCode) > 0 {
+					req.WAFOnDetectOnly(group.Id, set.Id, actionCode)
+				}
+				continue
+			}
+
+			if firstGroup == nil {
+				firstGroup = group
+			}
+			score += this.AnomalyScoring.SetScore(set.Code, set.Score)
+			matchedSetIds = append(matchedSetIds, set.Id)
+		}
+	}
+
+	if len(matchedSetIds) == 0 {
+		return true, hasRequestBody, nil, nil, nil
+	}
+	var index = this.AnomalyScoring.MatchThreshold(score, true)
+	if index < 0 || index >= len(this.anomalyInboundSets) {
+		req.WAFOnAnomalyScore(score, matchedSetIds, 0)
+		return true, hasRequestBody, nil, nil, nil
+	}
+	req.WAFOnAnomalyScore(score, matchedSetIds, this.anomalyThresholdScore(index, true))
+	set = this.anomalyInboundSets[index]
+	continueRequest, _ := set.PerformActions(this, firstGroup, req, writer)
+	return continueRequest, hasRequestBody, firstGroup, set, nil
+}
+
+// 使用异常评分模式检查响应
+func (this *WAF) matchResponseWithScore(req requests.Request, resp *requests.Response, writer http.ResponseWriter) (goNext bool, hasRequestBody bool, group *RuleGroup, set *RuleSet, err error) {
+	var score = 0
+	var matchedSetIds = []int64{}
+	var firstGroup *RuleGroup
+	for _, group := range this.Outbound {
+		if !group.IsOn || this.AnomalyScoring.GroupParanoiaLevel(group.Code, group.ParanoiaLevel) > this.AnomalyScoring.ParanoiaLevel {
+			continue
+		}
+		sets, hasCheckedRequestBody, err := group.MatchResponseAll(req, resp)
+		if hasCheckedRequestBody {
+			hasRequestBody = true
+		}
+		if err != nil {
+			return true, hasRequestBody, nil, nil, err
+		}
+		for _, set := range sets {
+			if set.HasAllowAction() {
+				continueRequest, _ := set.PerformActions(this, group, req, writer)
+				return continueRequest, hasRequestBody, group, set, nil
+			}
+
+			// 仅检测模式的规则集不计分
+			if set.IsDetectOnlyIn(group) {
+				var actionCode = set.BlockingActionCode()
+				if len(actionCode) > 0 {
+					req.WAFOnDetectOnly(group.Id, set.Id, actionCode)
+				}
+				continue
+			}
+
+			if firstGroup == nil {
+				firstGroup = group
+			}
+			score += this.AnomalyScoring.SetScore(set.Code, set.Score)
+			matchedSetIds = append(matchedSetIds, set.Id)
+		}
+	}
+
+	if len(matchedSetIds) == 0 {
+		return true, hasRequestBody, nil, nil, nil
+	}
+	var index = this.AnomalyScoring.MatchThreshold(score, false)
+	if index < 0 || index >= len(this.anomalyOutboundSets) {
+		req.WAFOnAnomalyScore(score, matchedSetIds, 0)
+		return true, hasRequestBody, nil, nil, nil
+	}
+	req.WAFOnAnomalyScore(score, matchedSetIds, this.anomalyThresholdScore(index, false))
+	set = this.anomalyOutboundSets[index]
+	continueRequest, _ := set.PerformActions(this, firstGroup, req, writer)
+	return continueRequest, hasRequestBody, firstGroup, set, nil
+}
+
+// 阈值的分数
+func (this *WAF) anomalyThresholdScore(index int, isInbound bool) int {
+	var thresholds = this.AnomalyScoring.Thresholds
+	if !isInbound {
+		thresholds = this.AnomalyScoring.OutboundThresholds
+	}
+	if index >= 0 && index < len(thresholds) {
+		return thresholds[index].Score
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 Liuxiangchao iwind.liu@gmail.com. All rights reserved. Official site: https://goedge.cn .
+
+package waf
+
+import (
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
+	"github.com/TeaOSLab/EdgeNode/internal/waf/requests"
+	"github.com/iwind/TeaGo/assert"
+	"net/http"
+	"testing"
+)
+
+func TestWAF_MatchRequestWithScore(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var newSet = func(id int64, argName string, score int) *RuleSet {
+		var set = NewRuleSet()
+		set.Id = id
+		set.Connector = RuleConnectorOr
+		set.Score = score
+		set.Rules = []*Rule{
+			{
+				Param:    "${arg." + argName + "}",
+				Operator: RuleOperatorEqString,
+				Value:    "1",
+			},
+		}
+		set.AddAction(ActionBlock, nil)
+		return set
+	}
+
+	var group1 = NewRuleGroup()
+	group1.Id = 1
+	group1.IsInbound = true
+	group1.AddRuleSet(newSet(11, "a", 3))
+	group1.AddRuleSet(newSet(12, "b", 0))
+
+	var group2 = NewRuleGroup()
+	group2.Id = 2
+	group2.IsInbound = true
+	group2.ParanoiaLevel = 2
+	group2.AddRuleSet(newSet(21, "c", 10))
+
+	var waf = NewWAF()
+	waf.AddRuleGroup(group1)
+	waf.AddRuleGroup(group2)
+	waf.AnomalyScoring = &configs.AnomalyScoringConfig{
+		IsOn: true,
+		Thresholds: []*configs.AnomalyThreshold{
+			{Score: 5, Action: ActionLog},
+			{Score: 8, Action: ActionBlock},
+		},
+	}
+	err := waf.AnomalyScoring.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := waf.Init()
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	for _, testCase := range []struct {
+		query          string
+		score          int
+		thresholdScore int
+		goNext         bool
+		actionCode     string
+	}{
+		{"a=1", 3, 0, true, ""},
+		{"b=1", 5, 5, true, ActionLog},
+		{"a=1&b=1", 8, 8, false, ActionBlock},
+		{"c=1", 0, 0, true, ""}, // 偏执级别不够
+	} {
+		req, err := http.NewRequest(http.MethodGet, "http://teaos.cn/hello?"+testCase.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var testReq = requests.NewTestRequest(req)
+		goNext, _, _, set, err := waf.MatchRequest(testReq, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log(testCase.query, "score:", testReq.AnomalyScore, "sets:", testReq.AnomalyMatchedSetIds, "goNext:", goNext)
+		a.IsTrue(testReq.AnomalyScore == testCase.score)
+		a.IsTrue(testReq.AnomalyThresholdScore == testCase.thresholdScore)
+		a.IsTrue(goNext == testCase.goNext)
+		if len(testCase.actionCode) == 0 {
+			a.IsNil(set)
+		} else {
+			a.IsNotNil(set)
+			a.IsTrue(set.Actions[0].Code == testCase.actionCode)
+		}
+	}
+
+	// 提高偏执级别
+	waf.AnomalyScoring.ParanoiaLevel = 2
+	req, err := http.NewRequest(http.MethodGet, "http://teaos.cn/hello?c=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var testReq = requests.NewTestRequest(req)
+	goNext, _, _, _, err := waf.MatchRequest(testReq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.IsTrue(testReq.AnomalyScore == 10)
+	a.IsFalse(goNext)
+}
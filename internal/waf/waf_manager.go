@@ -2,8 +2,10 @@ package waf
 
 import (
 	"github.com/TeaOSLab/EdgeCommon/pkg/serverconfigs/firewallconfigs"
+	"github.com/TeaOSLab/EdgeNode/internal/configs"
 	"github.com/TeaOSLab/EdgeNode/internal/errors"
 	"github.com/TeaOSLab/EdgeNode/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeNode/internal/utils/jsonutils"
 	"strconv"
 	"sync"
 )
@@ -12,8 +14,10 @@ var SharedWAFManager = NewWAFManager()
 
 // WAFManager WAF管理器
 type WAFManager struct {
-	mapping map[int64]*WAF // policyId => WAF
-	locker  sync.RWMutex
+	mapping     map[int64]*WAF // policyId => WAF
+	policies    []*firewallconfigs.HTTPFirewallPolicy
+	localConfig *configs.WAFConfig // 节点本地的WAF扩展设置
+	locker      sync.RWMutex
 }
 
 // NewWAFManager 获取新对象
@@ -40,6 +44,21 @@ func (this *WAFManager) UpdatePolicies(policies []*firewallconfigs.HTTPFirewallP
 		}
 	}
 	this.mapping = m
+	this.policies = policies
+}
+
+// UpdateLocalConfig 更新节点本地的WAF扩展设置
+// 设置变化后会重新生成所有策略
+func (this *WAFManager) UpdateLocalConfig(config *configs.WAFConfig) {
+	this.locker.Lock()
+	var changed = !jsonutils.Equal(this.localConfig, config)
+	this.localConfig = config
+	var policies = this.policies
+	this.locker.Unlock()
+
+	if changed && len(policies) > 0 {
+		this.UpdatePolicies(policies)
+	}
 }
 
 // FindWAF 查找WAF
@@ -203,6 +222,9 @@ func (this *WAFManager) ConvertWAF(policy *firewallconfigs.HTTPFirewallPolicy) (
 		}
 	}
 
+	// 本地扩展设置
+	applyLocalOptions(w, this.localConfig, policy.Id)
+
 	errorList := w.Init()
 	if len(errorList) > 0 {
 		return w, errorList[0]
@@ -210,3 +232,39 @@ func (this *WAFManager) ConvertWAF(policy *firewallconfigs.HTTPFirewallPolicy) (
 
 	return w, nil
 }
+
+// ApplyLocalOptions 在WAF策略上应用节点本地的WAF扩展设置，需要在 WAF.Init() 之前调用
+// 用于不经过 ConvertWAF() 加载的策略，比如从YAML文件中加载的策略
+func (this *WAFManager) ApplyLocalOptions(w *WAF) {
+	this.locker.RLock()
+	var localConfig = this.localConfig
+	this.locker.RUnlock()
+
+	applyLocalOptions(w, localConfig, w.Id)
+}
+
+// 应用本地扩展设置
+func applyLocalOptions(w *WAF, localConfig *configs.WAFConfig, policyId int64) {
+	if w == nil || localConfig == nil {
+		return
+	}
+
+	var options = localConfig.FindPolicyOptions(policyId)
+	if options.AnomalyScoring != nil {
+		w.AnomalyScoring = options.AnomalyScoring
+	}
+
+	// 仅检测模式
+	for _, groups := range [][]*RuleGroup{w.Inbound, w.Outbound} {
+		for _, group := range groups {
+			if options.IsDetectOnlyGroup(group.Id) {
+				group.IsDetectOnly = true
+			}
+			for _, set := range group.RuleSets {
+				if options.IsDetectOnlySet(set.Id) {
+					set.IsDetectOnly = true
+				}
+			}
+		}
+	}
+}
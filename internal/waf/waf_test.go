@@ -53,3 +53,79 @@ func TestWAF_MatchRequest(t *testing.T) {
 	t.Log("goNext:", goNext, "set:", set.Name)
 	a.IsFalse(goNext)
 }
+
+func TestWAF_MatchRequest_DetectOnly(t *testing.T) {
+	var a = assert.NewAssertion(t)
+
+	var newSet = func(id int64, argName string) *RuleSet {
+		var set = NewRuleSet()
+		set.Id = id
+		set.Connector = RuleConnectorOr
+		set.Rules = []*Rule{
+			{
+				Param:    "${arg." + argName + "}",
+				Operator: RuleOperatorEqString,
+				Value:    "1",
+			},
+		}
+		set.AddAction(ActionBlock, nil)
+		return set
+	}
+
+	var detectOnlySet = newSet(11, "a")
+	detectOnlySet.IsDetectOnly = true
+
+	var group1 = NewRuleGroup()
+	group1.Id = 1
+	group1.IsInbound = true
+	group1.AddRuleSet(detectOnlySet)
+	group1.AddRuleSet(newSet(12, "b"))
+
+	var group2 = NewRuleGroup()
+	group2.Id = 2
+	group2.IsInbound = true
+	group2.IsDetectOnly = true
+	group2.AddRuleSet(newSet(21, "c"))
+
+	var waf = NewWAF()
+	waf.AddRuleGroup(group1)
+	waf.AddRuleGroup(group2)
+	errs := waf.Init()
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+
+	for _, testCase := range []struct {
+		query        string
+		goNext       bool
+		detectSetIds []int64
+		matchedSetId int64
+	}{
+		{"a=1", true, []int64{11}, 0},
+		{"c=1", true, []int64{21}, 0},
+		{"a=1&c=1", true, []int64{11, 21}, 0},
+		{"a=1&b=1", false, []int64{11}, 12},
+	} {
+		req, err := http.NewRequest(http.MethodGet, "http://teaos.cn/hello?"+testCase.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var testReq = requests.NewTestRequest(req)
+		goNext, _, _, set, err := waf.MatchRequest(testReq, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Log(testCase.query, "goNext:", goNext, "detect only:", testReq.DetectOnlySetIds)
+		a.IsTrue(goNext == testCase.goNext)
+		a.IsTrue(len(testReq.DetectOnlySetIds) == len(testCase.detectSetIds))
+		for index, setId := range testCase.detectSetIds {
+			a.IsTrue(testReq.DetectOnlySetIds[index] == setId)
+		}
+		if testCase.matchedSetId > 0 {
+			a.IsNotNil(set)
+			a.IsTrue(set.Id == testCase.matchedSetId)
+		} else {
+			a.IsNil(set)
+		}
+	}
+}